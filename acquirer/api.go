@@ -1,6 +1,7 @@
 package acquirer
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"log/slog"
@@ -8,17 +9,20 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer/models"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/clearing"
 )
 
 type API struct {
-	acquirer *Service
-	logger   *slog.Logger
+	acquirer   *Service
+	settlement *SettlementService
+	logger     *slog.Logger
 }
 
-func NewAPI(logger *slog.Logger, acquirer *Service) *API {
+func NewAPI(logger *slog.Logger, acquirer *Service, settlement *SettlementService) *API {
 	return &API{
-		logger:   logger,
-		acquirer: acquirer,
+		logger:     logger,
+		acquirer:   acquirer,
+		settlement: settlement,
 	}
 }
 
@@ -28,9 +32,21 @@ func (a *API) AppendRoutes(r chi.Router) {
 		r.Route("/{merchantID}", func(r chi.Router) {
 			r.Post("/payments", a.createPayment)
 			r.Get("/payments/{paymentID}", a.getPayment)
+			r.Post("/payments/{paymentID}/increment", a.incrementAuthorization)
+			r.Post("/payments/{paymentID}/capture", a.capturePayment)
+			r.Post("/payments/{paymentID}/complete", a.completePayment)
+			r.Post("/payments/{paymentID}/void", a.voidPayment)
+			r.Post("/payments/{paymentID}/refund", a.refundPayment)
+			r.Get("/payments/{paymentID}/refunds", a.getRefunds)
 			r.Get("/payments", a.getPayments)
+			r.Post("/batches", a.closeBatches)
+			r.Get("/batches", a.getBatches)
+			r.Get("/batches/{batchID}", a.getBatch)
+			r.Get("/batches/{batchID}/clearing", a.getClearingFile)
 		})
 	})
+
+	r.Get("/routes", a.getRoutes)
 }
 
 func (a *API) createMerchant(w http.ResponseWriter, r *http.Request) {
@@ -52,6 +68,16 @@ func (a *API) createMerchant(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(account)
 }
 
+// IdempotencyKeyHeader is the header with the key that makes retries of the
+// payment creation safe. The keys are scoped to the merchant.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength is the longest key we accept, UUIDs fit easily
+const maxIdempotencyKeyLength = 255
+
+// createPayment creates the payment. If the request has an idempotency key,
+// its response is saved and the retries with the same key get the saved
+// response instead of a second payment.
 func (a *API) createPayment(w http.ResponseWriter, r *http.Request) {
 	merchantID := chi.URLParam(r, "merchantID")
 
@@ -62,6 +88,49 @@ func (a *API) createPayment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if key == "" {
+		a.writeCreatedPayment(w, merchantID, create)
+		return
+	}
+
+	if len(key) > maxIdempotencyKeyLength {
+		http.Error(w, "idempotency key is too long", http.StatusBadRequest)
+		return
+	}
+
+	request, err := a.acquirer.BeginIdempotentRequest(merchantID, key, create)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrIdempotencyKeyReused):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.Is(err, models.ErrIdempotencyInProgress):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			a.logger.Error("failed to begin idempotent request", "err", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if request.Completed() {
+		w.Header().Set("Content-Type", request.ResponseContentType)
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(request.ResponseStatus)
+		w.Write(request.ResponseBody)
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: w}
+	a.writeCreatedPayment(recorder, merchantID, create)
+
+	err = a.acquirer.CompleteIdempotentRequest(request, recorder.status, recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+	if err != nil {
+		a.logger.Error("failed to complete idempotent request", "err", err)
+	}
+}
+
+func (a *API) writeCreatedPayment(w http.ResponseWriter, merchantID string, create models.CreatePayment) {
 	payment, err := a.acquirer.CreatePayment(merchantID, create)
 	if err != nil {
 		a.logger.Error("failed to create payment", "err", err)
@@ -99,6 +168,200 @@ func (a *API) getPayment(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(payment)
 }
 
+func (a *API) incrementAuthorization(w http.ResponseWriter, r *http.Request) {
+	merchantID := chi.URLParam(r, "merchantID")
+	paymentID := chi.URLParam(r, "paymentID")
+
+	create := models.CreateIncrement{}
+	err := json.NewDecoder(r.Body).Decode(&create)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	payment, err := a.acquirer.IncrementAuthorization(merchantID, paymentID, create)
+	if err != nil {
+		a.logger.Error("failed to increment authorization", "err", err)
+
+		switch {
+		case errors.Is(err, ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrInvalidAmount):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrInvalidPaymentStatus):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, ErrDeclined):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(payment)
+}
+
+func (a *API) capturePayment(w http.ResponseWriter, r *http.Request) {
+	merchantID := chi.URLParam(r, "merchantID")
+	paymentID := chi.URLParam(r, "paymentID")
+
+	// empty body means capture of the full authorized amount
+	create := models.CreateCapture{}
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&create)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	payment, err := a.acquirer.CapturePayment(merchantID, paymentID, create)
+	if err != nil {
+		a.logger.Error("failed to capture payment", "err", err)
+
+		switch {
+		case errors.Is(err, ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrInvalidAmount):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrInvalidPaymentStatus), errors.Is(err, models.ErrInvalidPaymentStatusTransition):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, ErrDeclined):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(payment)
+}
+
+func (a *API) completePayment(w http.ResponseWriter, r *http.Request) {
+	merchantID := chi.URLParam(r, "merchantID")
+	paymentID := chi.URLParam(r, "paymentID")
+
+	// empty body means completion of the full authorized amount
+	create := models.CreateCompletion{}
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&create)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	payment, err := a.acquirer.CompletePayment(merchantID, paymentID, create)
+	if err != nil {
+		a.logger.Error("failed to complete payment", "err", err)
+
+		switch {
+		case errors.Is(err, ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrInvalidAmount):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrInvalidPaymentStatus), errors.Is(err, models.ErrInvalidPaymentStatusTransition):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, ErrDeclined):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(payment)
+}
+
+func (a *API) voidPayment(w http.ResponseWriter, r *http.Request) {
+	merchantID := chi.URLParam(r, "merchantID")
+	paymentID := chi.URLParam(r, "paymentID")
+
+	payment, err := a.acquirer.VoidPayment(merchantID, paymentID)
+	if err != nil {
+		a.logger.Error("failed to void payment", "err", err)
+
+		switch {
+		case errors.Is(err, ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrInvalidPaymentStatus), errors.Is(err, models.ErrInvalidPaymentStatusTransition):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, ErrDeclined):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(payment)
+}
+
+func (a *API) refundPayment(w http.ResponseWriter, r *http.Request) {
+	merchantID := chi.URLParam(r, "merchantID")
+	paymentID := chi.URLParam(r, "paymentID")
+
+	// empty body means refund of what is left of the captured amount
+	create := models.CreateRefund{}
+	if r.ContentLength != 0 {
+		err := json.NewDecoder(r.Body).Decode(&create)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	refund, err := a.acquirer.RefundPayment(merchantID, paymentID, create)
+	if err != nil {
+		a.logger.Error("failed to refund payment", "err", err)
+
+		switch {
+		case errors.Is(err, ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrInvalidAmount), errors.Is(err, models.ErrRefundExceedsCapturedAmount):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, ErrInvalidPaymentStatus), errors.Is(err, models.ErrInvalidPaymentStatusTransition):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, ErrDeclined):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(refund)
+}
+
+func (a *API) getRefunds(w http.ResponseWriter, r *http.Request) {
+	merchantID := chi.URLParam(r, "merchantID")
+	paymentID := chi.URLParam(r, "paymentID")
+
+	refunds, err := a.acquirer.GetRefunds(merchantID, paymentID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(refunds)
+}
+
 func (a *API) getPayments(w http.ResponseWriter, r *http.Request) {
 	merchantID := chi.URLParam(r, "merchantID")
 
@@ -116,3 +379,111 @@ func (a *API) getPayments(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(payments)
 }
+
+func (a *API) closeBatches(w http.ResponseWriter, r *http.Request) {
+	merchantID := chi.URLParam(r, "merchantID")
+
+	batches, err := a.settlement.CloseBatches(merchantID)
+	if err != nil {
+		a.logger.Error("failed to close batches", "err", err)
+
+		switch {
+		case errors.Is(err, ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, models.ErrNothingToSettle), errors.Is(err, models.ErrAlreadySettled):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(batches)
+}
+
+func (a *API) getBatches(w http.ResponseWriter, r *http.Request) {
+	merchantID := chi.URLParam(r, "merchantID")
+
+	batches, err := a.settlement.GetBatches(merchantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(batches)
+}
+
+func (a *API) getBatch(w http.ResponseWriter, r *http.Request) {
+	merchantID := chi.URLParam(r, "merchantID")
+	batchID := chi.URLParam(r, "batchID")
+
+	batch, err := a.settlement.GetBatch(merchantID, batchID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(batch)
+}
+
+func (a *API) getClearingFile(w http.ResponseWriter, r *http.Request) {
+	merchantID := chi.URLParam(r, "merchantID")
+	batchID := chi.URLParam(r, "batchID")
+
+	batch, err := a.settlement.GetBatch(merchantID, batchID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.WriteHeader(http.StatusOK)
+	if err := clearing.Write(w, batch.ClearingFile()); err != nil {
+		a.logger.Error("failed to write clearing file", "err", err)
+	}
+}
+
+// responseRecorder keeps a copy of the response it writes, so the response
+// can be saved.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+
+	r.body.Write(b)
+
+	return r.ResponseWriter.Write(b)
+}
+
+// getRoutes returns the routes to the issuers and whether we are connected
+// to them.
+func (a *API) getRoutes(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(a.acquirer.Routes())
+}
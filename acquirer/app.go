@@ -7,6 +7,7 @@ import (
 	"net"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer/iso8583"
@@ -21,7 +22,12 @@ type App struct {
 	Addr              string
 	ISO8583ServerAddr string
 	logger            *slog.Logger
+	iso8583Clients    []*iso8583.Client
+	repository        Repository
 	config            *Config
+
+	// stop is closed on shutdown to stop the settlement schedule
+	stop chan struct{}
 }
 
 func NewApp(logger *slog.Logger, config *Config) *App {
@@ -35,6 +41,7 @@ func NewApp(logger *slog.Logger, config *Config) *App {
 		logger: logger,
 		wg:     &sync.WaitGroup{},
 		config: config,
+		stop:   make(chan struct{}),
 	}
 }
 
@@ -45,26 +52,88 @@ func (a *App) Start() error {
 	router := chi.NewRouter()
 	router.Use(middleware.NewStructuredLogger(a.logger))
 
-	repository := NewRepository()
-	err := repository.LoadFromFile()
+	repository, err := OpenRepository(a.config.Storage)
 	if err != nil {
-		return fmt.Errorf("loading repository from file: %w", err)
+		return fmt.Errorf("opening repository: %w", err)
 	}
+	a.repository = repository
 
-	// setup iso8583Client
-	stanGenerator := iso8583.NewStanGenerator()
-	iso8583Client, err := iso8583.NewClient(a.logger, a.config.ISO8583Addr, stanGenerator)
+	routeConfigs, err := a.config.RouteConfigs()
 	if err != nil {
-		return fmt.Errorf("creating iso8583 client: %w", err)
+		return fmt.Errorf("configuring routes: %w", err)
 	}
 
-	// connect to iso8583 server
-	if err := iso8583Client.Connect(); err != nil {
-		return fmt.Errorf("connecting to iso8583 server: %w", err)
+	// setup a client for every issuer, the STANs continue after the last one
+	// we sent to any of them
+	stanGenerator, err := iso8583.NewStanGenerator(repository)
+	if err != nil {
+		return fmt.Errorf("creating stan generator: %w", err)
+	}
+
+	var routes []*Route
+	for _, routeConfig := range routeConfigs {
+		logger := a.logger.With(slog.String("route", routeConfig.Name))
+
+		iso8583Client, err := iso8583.NewClient(logger, routeConfig.ISO8583Addr, a.config.AcquirerID, stanGenerator)
+		if err != nil {
+			return fmt.Errorf("creating iso8583 client of route %s: %w", routeConfig.Name, err)
+		}
+
+		if a.config.ReconnectInterval > 0 {
+			iso8583Client.ReconnectInterval = a.config.ReconnectInterval
+		}
+
+		a.iso8583Clients = append(a.iso8583Clients, iso8583Client)
+		routes = append(routes, &Route{
+			Name:      routeConfig.Name,
+			BINRanges: routeConfig.BINRanges,
+			Client:    iso8583Client,
+		})
 	}
 
-	acq := NewService(a.logger, repository, iso8583Client)
-	api := NewAPI(a.logger, acq)
+	// connect to the iso8583 servers. A route we can't connect to is down
+	// and we keep connecting to it in the background, so the app starts
+	// unless all issuers are down and we can't approve payments in stand-in.
+	var (
+		down       []*iso8583.Client
+		connectErr error
+	)
+
+	for i, iso8583Client := range a.iso8583Clients {
+		if err := iso8583Client.Connect(); err != nil {
+			a.logger.Warn("issuer is unreachable", slog.String("route", routes[i].Name), "err", err)
+
+			down = append(down, iso8583Client)
+			connectErr = err
+		}
+	}
+
+	if len(down) == len(a.iso8583Clients) && !a.config.StandIn.Enabled {
+		return fmt.Errorf("connecting to iso8583 server: %w", connectErr)
+	}
+
+	for _, iso8583Client := range down {
+		iso8583Client.Reconnect()
+	}
+
+	acq := NewService(a.logger, repository, NewRouter(routes...), a.config.StandIn)
+
+	// advise the issuers of the payments approved in stand-in once they are
+	// back
+	for _, iso8583Client := range a.iso8583Clients {
+		iso8583Client.OnReconnect(func() {
+			if err := acq.ForwardStandInAdvices(); err != nil {
+				a.logger.Error("failed to forward stand-in advices", "err", err)
+			}
+		})
+	}
+
+	if err := acq.ForwardStandInAdvices(); err != nil {
+		a.logger.Error("failed to forward stand-in advices", "err", err)
+	}
+
+	settlement := NewSettlementService(a.logger, repository, a.config.AcquirerID, a.config.Settlement)
+	api := NewAPI(a.logger, acq, settlement)
 	api.AppendRoutes(router)
 
 	l, err := net.Listen("tcp", a.config.HTTPAddr)
@@ -90,19 +159,56 @@ func (a *App) Start() error {
 			a.logger.Info("http server stopped")
 		}
 
-		repository.SaveToFile()
 		a.wg.Done()
 	}()
 
+	if interval := a.config.Settlement.Interval; interval > 0 {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.runSettlementSchedule(settlement, interval)
+		}()
+	}
+
 	return nil
 }
 
+// runSettlementSchedule closes the batches of all merchants every interval
+// until the app is shut down.
+func (a *App) runSettlementSchedule(settlement *SettlementService, interval time.Duration) {
+	a.logger.Info("settlement schedule started", slog.Duration("interval", interval))
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := settlement.CloseAllBatches(); err != nil {
+				a.logger.Error("failed to close settlement batches", "err", err)
+			}
+		case <-a.stop:
+			return
+		}
+	}
+}
+
 func (a *App) Shutdown() {
 	a.logger.Info("shutting down app...")
 
 	a.srv.Shutdown(context.Background())
+	close(a.stop)
 
 	a.wg.Wait()
 
+	for _, iso8583Client := range a.iso8583Clients {
+		iso8583Client.Close()
+	}
+
+	// the servers are stopped, so nothing writes to the repository anymore
+	if err := a.repository.Close(); err != nil {
+		a.logger.Error("closing repository", "err", err)
+	}
+
 	a.logger.Info("app stopped")
 }
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer/models"
 )
 
@@ -38,6 +40,7 @@ func (c *client) CreateMerchant(req models.CreateMerchant) (models.Merchant, err
 	if err != nil {
 		return models.Merchant{}, err
 	}
+	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusCreated {
 		return models.Merchant{}, fmt.Errorf("unexpected status code: %d; expected: %d", res.StatusCode, http.StatusCreated)
@@ -52,19 +55,110 @@ func (c *client) CreateMerchant(req models.CreateMerchant) (models.Merchant, err
 	return merchant, nil
 }
 
+// IdempotencyKeyHeader is the header with the idempotency key of the payment
+// creation.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// createPaymentAttempts is how many times the payment creation is sent if no
+// response is received.
+const createPaymentAttempts = 3
+
+// createPaymentInProgressTimeout is how long the payment creation is sent
+// again while the first request with the key is in progress. The acquirer
+// lets a retry take over the key of a request that didn't complete within a
+// minute.
+const createPaymentInProgressTimeout = 70 * time.Second
+
+// createPaymentBackoff is the wait before the payment creation is sent
+// again, it's doubled after each retry up to createPaymentMaxBackoff.
+const (
+	createPaymentBackoff    = 100 * time.Millisecond
+	createPaymentMaxBackoff = 5 * time.Second
+)
+
+// CreatePayment creates the payment with a new idempotency key, see
+// CreatePaymentWithIdempotencyKey.
 func (c *client) CreatePayment(merchantID string, req models.CreatePayment) (models.Payment, error) {
+	return c.CreatePaymentWithIdempotencyKey(merchantID, uuid.New().String(), req)
+}
+
+// CreatePaymentWithIdempotencyKey creates the payment with the idempotency
+// key. The request is sent again with the same key if no response was
+// received or while the first request with the key is in progress, so the
+// card is charged only once. Retrying with the same key later returns the
+// response of the first request. A key used for another request is rejected
+// with models.ErrIdempotencyKeyReused.
+func (c *client) CreatePaymentWithIdempotencyKey(merchantID, key string, req models.CreatePayment) (models.Payment, error) {
 	reqJSON, err := json.Marshal(req)
 	if err != nil {
 		return models.Payment{}, err
 	}
 
-	res, err := c.httpClient.Post(c.baseURL+"/merchants/"+merchantID+"/payments", "application/json", bytes.NewReader(reqJSON))
+	inProgressUntil := time.Now().Add(createPaymentInProgressTimeout)
+	backoff := createPaymentBackoff
+
+	for failures := 0; ; {
+		res, err := c.postPayment(merchantID, key, reqJSON)
+		if err != nil {
+			failures++
+			if failures == createPaymentAttempts {
+				return models.Payment{}, fmt.Errorf("creating payment after %d attempts: %w", failures, err)
+			}
+		} else {
+			switch res.StatusCode {
+			case http.StatusCreated:
+				defer res.Body.Close()
+
+				var payment models.Payment
+				err = json.NewDecoder(res.Body).Decode(&payment)
+				if err != nil {
+					return models.Payment{}, err
+				}
+
+				return payment, nil
+			case http.StatusConflict:
+				res.Body.Close()
+
+				if time.Now().After(inProgressUntil) {
+					return models.Payment{}, fmt.Errorf("creating payment: %w", models.ErrIdempotencyInProgress)
+				}
+			case http.StatusUnprocessableEntity:
+				res.Body.Close()
+
+				return models.Payment{}, fmt.Errorf("creating payment: %w", models.ErrIdempotencyKeyReused)
+			default:
+				res.Body.Close()
+
+				return models.Payment{}, fmt.Errorf("unexpected status code: %d; expected: %d", res.StatusCode, http.StatusCreated)
+			}
+		}
+
+		time.Sleep(backoff)
+		backoff = min(2*backoff, createPaymentMaxBackoff)
+	}
+}
+
+func (c *client) postPayment(merchantID, key string, reqJSON []byte) (*http.Response, error) {
+	httpReq, err := http.NewRequest(http.MethodPost, c.baseURL+"/merchants/"+merchantID+"/payments", bytes.NewReader(reqJSON))
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(IdempotencyKeyHeader, key)
+
+	return c.httpClient.Do(httpReq)
+}
+
+func (c *client) GetPayment(merchantID, paymentID string) (models.Payment, error) {
+	res, err := c.httpClient.Get(c.baseURL + "/merchants/" + merchantID + "/payments/" + paymentID)
 	if err != nil {
 		return models.Payment{}, err
 	}
+	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusCreated {
-		return models.Payment{}, fmt.Errorf("unexpected status code: %d; expected: %d", res.StatusCode, http.StatusCreated)
+	if res.StatusCode != http.StatusOK {
+		return models.Payment{}, fmt.Errorf("unexpected status code: %d; expected: %d", res.StatusCode, http.StatusOK)
 	}
 
 	var payment models.Payment
@@ -76,11 +170,94 @@ func (c *client) CreatePayment(merchantID string, req models.CreatePayment) (mod
 	return payment, nil
 }
 
-func (c *client) GetPayment(merchantID, paymentID string) (models.Payment, error) {
-	res, err := c.httpClient.Get(c.baseURL + "/merchants/" + merchantID + "/payments/" + paymentID)
+// IncrementAuthorization increases the authorized amount of the authorized
+// payment.
+func (c *client) IncrementAuthorization(merchantID, paymentID string, req models.CreateIncrement) (models.Payment, error) {
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	res, err := c.httpClient.Post(c.baseURL+"/merchants/"+merchantID+"/payments/"+paymentID+"/increment", "application/json", bytes.NewReader(reqJSON))
+	if err != nil {
+		return models.Payment{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return models.Payment{}, fmt.Errorf("unexpected status code: %d; expected: %d", res.StatusCode, http.StatusOK)
+	}
+
+	var payment models.Payment
+	err = json.NewDecoder(res.Body).Decode(&payment)
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	return payment, nil
+}
+
+// CapturePayment captures the authorized payment. Zero amount captures the
+// full authorized amount.
+func (c *client) CapturePayment(merchantID, paymentID string, req models.CreateCapture) (models.Payment, error) {
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	res, err := c.httpClient.Post(c.baseURL+"/merchants/"+merchantID+"/payments/"+paymentID+"/capture", "application/json", bytes.NewReader(reqJSON))
+	if err != nil {
+		return models.Payment{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return models.Payment{}, fmt.Errorf("unexpected status code: %d; expected: %d", res.StatusCode, http.StatusOK)
+	}
+
+	var payment models.Payment
+	err = json.NewDecoder(res.Body).Decode(&payment)
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	return payment, nil
+}
+
+// CompletePayment captures the final amount of the authorized payment. Zero
+// amount completes the full authorized amount.
+func (c *client) CompletePayment(merchantID, paymentID string, req models.CreateCompletion) (models.Payment, error) {
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	res, err := c.httpClient.Post(c.baseURL+"/merchants/"+merchantID+"/payments/"+paymentID+"/complete", "application/json", bytes.NewReader(reqJSON))
+	if err != nil {
+		return models.Payment{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return models.Payment{}, fmt.Errorf("unexpected status code: %d; expected: %d", res.StatusCode, http.StatusOK)
+	}
+
+	var payment models.Payment
+	err = json.NewDecoder(res.Body).Decode(&payment)
+	if err != nil {
+		return models.Payment{}, err
+	}
+
+	return payment, nil
+}
+
+// VoidPayment voids the authorized or captured payment.
+func (c *client) VoidPayment(merchantID, paymentID string) (models.Payment, error) {
+	res, err := c.httpClient.Post(c.baseURL+"/merchants/"+merchantID+"/payments/"+paymentID+"/void", "application/json", nil)
 	if err != nil {
 		return models.Payment{}, err
 	}
+	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusOK {
 		return models.Payment{}, fmt.Errorf("unexpected status code: %d; expected: %d", res.StatusCode, http.StatusOK)
@@ -94,3 +271,107 @@ func (c *client) GetPayment(merchantID, paymentID string) (models.Payment, error
 
 	return payment, nil
 }
+
+// RefundPayment refunds the captured payment. Zero amount refunds what is left
+// of the captured amount.
+func (c *client) RefundPayment(merchantID, paymentID string, req models.CreateRefund) (models.Refund, error) {
+	reqJSON, err := json.Marshal(req)
+	if err != nil {
+		return models.Refund{}, err
+	}
+
+	res, err := c.httpClient.Post(c.baseURL+"/merchants/"+merchantID+"/payments/"+paymentID+"/refund", "application/json", bytes.NewReader(reqJSON))
+	if err != nil {
+		return models.Refund{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusCreated {
+		return models.Refund{}, fmt.Errorf("unexpected status code: %d; expected: %d", res.StatusCode, http.StatusCreated)
+	}
+
+	var refund models.Refund
+	err = json.NewDecoder(res.Body).Decode(&refund)
+	if err != nil {
+		return models.Refund{}, err
+	}
+
+	return refund, nil
+}
+
+func (c *client) GetRefunds(merchantID, paymentID string) ([]models.Refund, error) {
+	res, err := c.httpClient.Get(c.baseURL + "/merchants/" + merchantID + "/payments/" + paymentID + "/refunds")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d; expected: %d", res.StatusCode, http.StatusOK)
+	}
+
+	var refunds []models.Refund
+	err = json.NewDecoder(res.Body).Decode(&refunds)
+	if err != nil {
+		return nil, err
+	}
+
+	return refunds, nil
+}
+
+// CloseBatches closes the settlement batches of the merchant.
+func (c *client) CloseBatches(merchantID string) ([]models.Batch, error) {
+	res, err := c.httpClient.Post(c.baseURL+"/merchants/"+merchantID+"/batches", "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("unexpected status code: %d; expected: %d", res.StatusCode, http.StatusCreated)
+	}
+
+	var batches []models.Batch
+	err = json.NewDecoder(res.Body).Decode(&batches)
+	if err != nil {
+		return nil, err
+	}
+
+	return batches, nil
+}
+
+// GetClearingFile returns the clearing file of the batch.
+func (c *client) GetClearingFile(merchantID, batchID string) ([]byte, error) {
+	res, err := c.httpClient.Get(c.baseURL + "/merchants/" + merchantID + "/batches/" + batchID + "/clearing")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d; expected: %d", res.StatusCode, http.StatusOK)
+	}
+
+	return io.ReadAll(res.Body)
+}
+
+// GetRoutes returns the routes to the issuers and their health.
+func (c *client) GetRoutes() ([]models.RouteStatus, error) {
+	res, err := c.httpClient.Get(c.baseURL + "/routes")
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d; expected: %d", res.StatusCode, http.StatusOK)
+	}
+
+	var routes []models.RouteStatus
+	err = json.NewDecoder(res.Body).Decode(&routes)
+	if err != nil {
+		return nil, err
+	}
+
+	return routes, nil
+}
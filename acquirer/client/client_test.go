@@ -0,0 +1,47 @@
+package client_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer/client"
+	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreatePaymentWithIdempotencyKey(t *testing.T) {
+	t.Run("request in progress is retried until its response is replayed", func(t *testing.T) {
+		var keys []string
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			keys = append(keys, r.Header.Get(client.IdempotencyKeyHeader))
+
+			if len(keys) < 3 {
+				http.Error(w, models.ErrIdempotencyInProgress.Error(), http.StatusConflict)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(models.Payment{ID: "payment-1"})
+		}))
+		t.Cleanup(server.Close)
+
+		payment, err := client.New(server.URL).CreatePaymentWithIdempotencyKey("merchant-1", "key-1", models.CreatePayment{Amount: 10_00})
+		require.NoError(t, err)
+		require.Equal(t, "payment-1", payment.ID)
+		require.Equal(t, []string{"key-1", "key-1", "key-1"}, keys)
+	})
+
+	t.Run("key used for another request is rejected", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, models.ErrIdempotencyKeyReused.Error(), http.StatusUnprocessableEntity)
+		}))
+		t.Cleanup(server.Close)
+
+		_, err := client.New(server.URL).CreatePaymentWithIdempotencyKey("merchant-1", "key-1", models.CreatePayment{Amount: 10_00})
+		require.ErrorIs(t, err, models.ErrIdempotencyKeyReused)
+	})
+}
@@ -1,13 +1,126 @@
 package acquirer
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer/iso8583"
+	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer/models"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/bin"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/storage"
+)
+
 type Config struct {
-	HTTPAddr    string `yaml:"http_addr"`
+	HTTPAddr string `yaml:"http_addr"`
+
+	// ISO8583Addr is the issuer of all cards when no Routes are configured
 	ISO8583Addr string `yaml:"iso8583_addr"`
+
+	// Routes are the issuers the payments are sent to by the BIN of the card
+	Routes []RouteConfig `yaml:"routes"`
+
+	// AcquirerID is sent to the issuer in field 32 of the requests
+	AcquirerID string `yaml:"acquirer_id"`
+
+	// Storage selects where the merchants and payments are kept
+	Storage storage.Config `yaml:"storage"`
+
+	// ReconnectInterval is the time between the attempts to connect to the
+	// issuer again after the connection was lost
+	ReconnectInterval time.Duration `yaml:"reconnect_interval"`
+
+	Settlement SettlementConfig `yaml:"settlement"`
+	StandIn    StandInConfig    `yaml:"stand_in"`
+}
+
+// RouteConfig is an issuer and the BIN ranges of its cards. A route without
+// BIN ranges gets the cards no other route serves.
+type RouteConfig struct {
+	Name        string      `yaml:"name"`
+	ISO8583Addr string      `yaml:"iso8583_addr"`
+	BINRanges   []bin.Range `yaml:"bin_ranges"`
+}
+
+// RouteConfigs returns the configured routes, or the default route to
+// ISO8583Addr for all cards if there are none.
+func (c *Config) RouteConfigs() ([]RouteConfig, error) {
+	if len(c.Routes) == 0 {
+		return []RouteConfig{{Name: "default", ISO8583Addr: c.ISO8583Addr}}, nil
+	}
+
+	names := make(map[string]bool)
+	for _, route := range c.Routes {
+		if route.Name == "" || route.ISO8583Addr == "" {
+			return nil, fmt.Errorf("route %q: name and iso8583 address are required", route.Name)
+		}
+
+		if names[route.Name] {
+			return nil, fmt.Errorf("route %q is configured twice", route.Name)
+		}
+		names[route.Name] = true
+
+		for _, binRange := range route.BINRanges {
+			if err := binRange.Validate(); err != nil {
+				return nil, fmt.Errorf("route %q: %w", route.Name, err)
+			}
+		}
+	}
+
+	return c.Routes, nil
+}
+
+type SettlementConfig struct {
+	// Interval between the scheduled closings of the batches of all
+	// merchants. Zero disables the schedule, the batches are closed only on
+	// demand.
+	Interval time.Duration `yaml:"interval"`
+
+	// ClearingDir is the directory the clearing files of the closed batches
+	// are written to. No files are written if it's empty.
+	ClearingDir string `yaml:"clearing_dir"`
+
+	// Fee charged for each settled capture
+	Fee models.Fee `yaml:"fee"`
+}
+
+// StandInConfig configures the approval of payments while the issuer is
+// unreachable. Payments within the limits are approved with a local
+// authorization code and the issuer is advised of them once it's back.
+type StandInConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Limits of the merchants that don't have their own
+	Limits models.StandInLimits `yaml:"limits"`
+
+	// Merchants are the limits by merchant ID
+	Merchants map[string]models.StandInLimits `yaml:"merchants"`
+}
+
+// MerchantLimits returns the stand-in limits of the merchant.
+func (c StandInConfig) MerchantLimits(merchantID string) models.StandInLimits {
+	if limits, ok := c.Merchants[merchantID]; ok {
+		return limits
+	}
+
+	return c.Limits
 }
 
 func DefaultConfig() *Config {
 	return &Config{
 		HTTPAddr:    "127.0.0.1:8080",
 		ISO8583Addr: "127.0.0.1:8583",
+		AcquirerID:  "000001",
+
+		ReconnectInterval: iso8583.DefaultReconnectInterval,
+		Storage: storage.Config{
+			Backend: storage.BackendMemory,
+		},
+		Settlement: SettlementConfig{
+			ClearingDir: "db/clearing",
+			Fee: models.Fee{
+				BasisPoints: 150,
+				Fixed:       10,
+			},
+		},
 	}
 }
@@ -1,25 +1,49 @@
 package iso8583
 
+// AuthorizationRequest is the 0100 message the acquirer sends to authorize a
+// payment. When the original data elements are set, the message is an
+// incremental authorization: Amount is added to the hold of the original
+// authorization and the card data and the acceptor information are not sent.
 type AuthorizationRequest struct {
-	MTI                   string               `index:"0"`
-	PrimaryAccountNumber  string               `index:"2"`
-	Amount                int64                `index:"3"`
-	TransmissionDateTime  string               `index:"4"`
-	Currency              string               `index:"7"`
-	CardVerificationValue string               `index:"8"`
-	ExpirationDate        string               `index:"9"`
-	AcceptorInformation   *AcceptorInformation `index:"10"`
-	STAN                  string               `index:"11"`
-	ChipData              []byte               `index:"55"`
+	MTI                   string                `index:"0"`
+	PrimaryAccountNumber  string                `index:"2"`
+	Amount                int64                 `index:"3"`
+	TransmissionDateTime  string                `index:"4"`
+	Currency              string                `index:"7"`
+	CardVerificationValue string                `index:"8"`
+	ExpirationDate        string                `index:"9"`
+	AcceptorInformation   *AcceptorInformation  `index:"10"`
+	STAN                  string                `index:"11"`
+	POSEntryMode          string                `index:"22"`
+	AcquirerID            string                `index:"32"`
+	ChipData              []byte                `index:"55"`
+	PartialApproval       string                `index:"60"`
+	OriginalDataElements  *OriginalDataElements `index:"90"`
 }
 
+// AuthorizationResponse is the 0110 message the issuer sends back. The
+// approved amount is set only for partial approvals (response code 10), the
+// chip data only for chip requests with a verified cryptogram.
 type AuthorizationResponse struct {
 	MTI               string `index:"0"`
-	ApprovalCode      string `index:"5"`
+	ResponseCode      string `index:"39"`
 	AuthorizationCode string `index:"6"`
 	STAN              string `index:"11"`
+	ApprovedAmount    int64  `index:"54"`
+	ChipData          []byte `index:"55"`
 }
 
+// PartialApprovalSupported is the partial approval indicator (field 60) of an
+// authorization request the merchant accepts partial approvals for.
+const PartialApprovalSupported = "1"
+
+// POS entry modes (field 22) of the authorization requests: how the card data
+// was read
+const (
+	POSEntryModeManual      = "01"
+	POSEntryModeContactless = "07"
+)
+
 type AcceptorInformation struct {
 	Name       string `index:"01"`
 	MCC        string `index:"02"`
@@ -0,0 +1,23 @@
+package iso8583
+
+// CaptureRequest is the 0220 message the acquirer sends to post (capture) a
+// previously authorized transaction. The original authorization is referenced
+// by the acquirer ID and its STAN and transmission date & time in the
+// original data elements, and its authorization code. Without the
+// authorization code the message is a completion.
+type CaptureRequest struct {
+	MTI                  string                `index:"0"`
+	Amount               int64                 `index:"3"`
+	TransmissionDateTime string                `index:"4"`
+	AuthorizationCode    string                `index:"6"`
+	Currency             string                `index:"7"`
+	STAN                 string                `index:"11"`
+	AcquirerID           string                `index:"32"`
+	OriginalDataElements *OriginalDataElements `index:"90"`
+}
+
+type CaptureResponse struct {
+	MTI          string `index:"0"`
+	ResponseCode string `index:"39"`
+	STAN         string `index:"11"`
+}
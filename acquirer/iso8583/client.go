@@ -1,67 +1,358 @@
 package iso8583
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
+	"sync"
 	"time"
 
 	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer/models"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/responsecode"
 	"github.com/moov-io/iso8583"
 	iso8583Connection "github.com/moov-io/iso8583-connection"
 )
 
+var (
+	// ErrNoResponse is returned when the issuer didn't respond to the request
+	// in time. The request may still have been processed by the issuer.
+	ErrNoResponse = errors.New("no response from issuer")
+
+	// ErrIssuerUnavailable is returned when the request can't be sent
+	// because we are not connected to the issuer.
+	ErrIssuerUnavailable = errors.New("issuer unavailable")
+)
+
+// DefaultReconnectInterval is the time between the attempts to connect again
+// after the connection to the issuer was lost.
+const DefaultReconnectInterval = 5 * time.Second
+
 type Client struct {
+	logger        *slog.Logger
+	stanGenerator STANGenerator
+	addr          string
+
+	// acquirerID is sent in field 32, so the issuer can tell our requests
+	// from the requests of other acquirers with the same STAN
+	acquirerID string
+
+	// ReconnectInterval is the time between the attempts to connect again.
+	// It must be set before connecting.
+	ReconnectInterval time.Duration
+
+	// mu guards the connection, which is replaced when we reconnect
+	mu                sync.RWMutex
 	iso8583Connection *iso8583Connection.Connection
-	logger            *slog.Logger
-	stanGenerator     STANGenerator
+	connected         bool
+	reconnecting      bool
+	closed            bool
+	onReconnect       []func()
+	stop              chan struct{}
 }
 
 type STANGenerator interface {
-	Next() string
+	Next() (string, error)
 }
 
-func NewClient(logger *slog.Logger, iso8583ServerAddr string, stanGenerator STANGenerator) (*Client, error) {
+func NewClient(logger *slog.Logger, iso8583ServerAddr, acquirerID string, stanGenerator STANGenerator) (*Client, error) {
 	logger = logger.With(slog.String("type", "iso8583-client"), slog.String("addr", iso8583ServerAddr))
 
+	c := &Client{
+		logger:            logger,
+		stanGenerator:     stanGenerator,
+		addr:              iso8583ServerAddr,
+		acquirerID:        acquirerID,
+		ReconnectInterval: DefaultReconnectInterval,
+		stop:              make(chan struct{}),
+	}
+
+	conn, err := c.newConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	c.iso8583Connection = conn
+
+	return c, nil
+}
+
+func (c *Client) newConnection() (*iso8583Connection.Connection, error) {
 	conn, err := iso8583Connection.New(
-		iso8583ServerAddr,
+		c.addr,
 		spec,
 		readMessageLength,
 		writeMessageLength,
 		iso8583Connection.SendTimeout(5*time.Second),
+
+		// the issuer accepts financial messages only after we sign on
+		iso8583Connection.OnConnect(c.signOn),
+		iso8583Connection.OnClose(c.signOff),
+
+		// send echo test when nothing was sent for a while
+		iso8583Connection.IdleTime(30*time.Second),
+		iso8583Connection.PingHandler(c.echo),
+
+		iso8583Connection.ConnectionClosedHandler(c.connectionClosed),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("creating iso8583 connection: %w", err)
 	}
 
-	return &Client{
-		iso8583Connection: conn,
-		logger:            logger,
-		stanGenerator:     stanGenerator,
-	}, nil
+	return conn, nil
 }
 
 func (c *Client) Connect() error {
 	c.logger.Info("connecting to ISO 8583 server...")
 
-	if err := c.iso8583Connection.Connect(); err != nil {
+	c.mu.RLock()
+	conn := c.iso8583Connection
+	c.mu.RUnlock()
+
+	if err := conn.Connect(); err != nil {
 		return fmt.Errorf("connecting to ISO 8583 server: %w", err)
 	}
 
+	c.mu.Lock()
+	c.connected = conn == c.iso8583Connection
+	c.mu.Unlock()
+
 	c.logger.Info("connected to ISO 8583 server")
 	return nil
 }
 
+// Connected returns true while we are connected to the issuer.
+func (c *Client) Connected() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.connected
+}
+
+// OnReconnect registers the handler called after we connected to the issuer
+// again.
+func (c *Client) OnReconnect(handler func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onReconnect = append(c.onReconnect, handler)
+}
+
+// Reconnect keeps connecting to the issuer in the background every
+// ReconnectInterval until it succeeds or the client is closed. It's called
+// when the connection is lost, and can be called when the first Connect
+// failed. Requests sent in the meantime fail with ErrIssuerUnavailable.
+func (c *Client) Reconnect() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.reconnecting || c.closed {
+		return
+	}
+
+	c.connected = false
+	c.reconnecting = true
+
+	go c.reconnectLoop()
+}
+
+func (c *Client) reconnectLoop() {
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(c.ReconnectInterval):
+		}
+
+		conn, err := c.newConnection()
+		if err != nil {
+			c.logger.Error("failed to create connection", "err", err)
+			continue
+		}
+
+		if err := conn.Connect(); err != nil {
+			c.logger.Warn("failed to reconnect to ISO 8583 server", "err", err)
+			continue
+		}
+
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			conn.Close()
+			return
+		}
+
+		c.iso8583Connection = conn
+		c.connected = true
+		c.reconnecting = false
+		handlers := c.onReconnect
+		c.mu.Unlock()
+
+		c.logger.Info("reconnected to ISO 8583 server")
+
+		for _, handler := range handlers {
+			handler()
+		}
+
+		return
+	}
+}
+
+// connectionClosed starts reconnecting when the current connection is lost.
+// Connections we closed ourselves are ignored.
+func (c *Client) connectionClosed(conn *iso8583Connection.Connection) {
+	c.mu.RLock()
+	lost := conn == c.iso8583Connection && c.connected && !c.closed
+	c.mu.RUnlock()
+
+	if !lost {
+		return
+	}
+
+	c.logger.Warn("connection to ISO 8583 server lost")
+
+	c.Reconnect()
+}
+
+// Close signs off and closes the connection to the ISO 8583 server.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+
+	c.closed = true
+	close(c.stop)
+	conn, connected := c.iso8583Connection, c.connected
+	c.mu.Unlock()
+
+	if !connected {
+		return nil
+	}
+
+	if err := conn.Close(); err != nil {
+		return fmt.Errorf("closing connection: %w", err)
+	}
+
+	return nil
+}
+
+// send sends the request over the current connection. It fails with
+// ErrIssuerUnavailable when we are not connected to the issuer, and with
+// ErrNoResponse when the issuer didn't respond in time.
+func (c *Client) send(requestMessage *iso8583.Message) (*iso8583.Message, error) {
+	c.mu.RLock()
+	conn, connected := c.iso8583Connection, c.connected
+	c.mu.RUnlock()
+
+	if !connected {
+		return nil, fmt.Errorf("sending ISO 8583 message to server: %w", ErrIssuerUnavailable)
+	}
+
+	// the connection may be lost before we notice it, then the request
+	// can't be written to it
+	var netErr *net.OpError
+
+	responseMessage, err := conn.Send(requestMessage)
+	switch {
+	case errors.Is(err, iso8583Connection.ErrSendTimeout):
+		return nil, fmt.Errorf("sending ISO 8583 message to server: %w: %w", ErrNoResponse, err)
+	case errors.Is(err, iso8583Connection.ErrConnectionClosed), errors.As(err, &netErr):
+		return nil, fmt.Errorf("sending ISO 8583 message to server: %w: %w", ErrIssuerUnavailable, err)
+	case err != nil:
+		return nil, fmt.Errorf("sending ISO 8583 message to server: %w", err)
+	}
+
+	return responseMessage, nil
+}
+
+func (c *Client) signOn(conn *iso8583Connection.Connection) error {
+	if err := c.sendNetworkManagement(conn, NetworkCodeSignOn); err != nil {
+		return fmt.Errorf("signing on: %w", err)
+	}
+
+	c.logger.Info("signed on to ISO 8583 server")
+
+	return nil
+}
+
+func (c *Client) signOff(conn *iso8583Connection.Connection) error {
+	if err := c.sendNetworkManagement(conn, NetworkCodeSignOff); err != nil {
+		return fmt.Errorf("signing off: %w", err)
+	}
+
+	c.logger.Info("signed off from ISO 8583 server")
+
+	return nil
+}
+
+func (c *Client) echo(conn *iso8583Connection.Connection) {
+	if err := c.sendNetworkManagement(conn, NetworkCodeEchoTest); err != nil {
+		c.logger.Error("echo test failed", "err", err)
+	}
+}
+
+// sendNetworkManagement sends 0800 with the given network management code and
+// returns an error if the issuer didn't approve it.
+func (c *Client) sendNetworkManagement(conn *iso8583Connection.Connection, code string) error {
+	stan, err := c.stanGenerator.Next()
+	if err != nil {
+		return fmt.Errorf("generating stan: %w", err)
+	}
+
+	requestMessage := iso8583.NewMessage(spec)
+	requestData := &NetworkManagementRequest{
+		MTI:                  "0800",
+		TransmissionDateTime: time.Now().UTC().Format(time.RFC3339),
+		STAN:                 stan,
+		Code:                 code,
+	}
+
+	err = requestMessage.Marshal(requestData)
+	if err != nil {
+		return fmt.Errorf("marshaling request data: %w", err)
+	}
+
+	responseMessage, err := conn.Send(requestMessage)
+	if err != nil {
+		return fmt.Errorf("sending ISO 8583 message to server: %w", err)
+	}
+
+	responseData := &NetworkManagementResponse{}
+	err = responseMessage.Unmarshal(responseData)
+	if err != nil {
+		return fmt.Errorf("unmarshaling response data: %w", err)
+	}
+
+	if info := responsecode.GetInfo(responseData.ResponseCode); !info.IsApproved() {
+		return fmt.Errorf("network management code %s declined with response code %s (%s)", code, info.Code, info.Description)
+	}
+
+	return nil
+}
+
 func (c *Client) AuthorizePayment(payment *models.Payment, create models.CreatePayment, merchant models.Merchant) (models.AuthorizationResponse, error) {
 	c.logger.Info("authorizing payment", slog.String("payment_id", payment.ID))
 
+	stan, err := c.stanGenerator.Next()
+	if err != nil {
+		return models.AuthorizationResponse{}, fmt.Errorf("generating stan: %w", err)
+	}
+
+	// keep the STAN and the transmission date & time on the payment, so we
+	// can reference the request later
+	payment.STAN = stan
+	payment.TransmissionDateTime = payment.CreatedAt.UTC().Format(time.RFC3339)
+
 	requestMessage := iso8583.NewMessage(spec)
 	requestData := &AuthorizationRequest{
 		MTI:                  "0100",
 		Amount:               payment.Amount,
 		Currency:             payment.Currency,
-		TransmissionDateTime: payment.CreatedAt.UTC().Format(time.RFC3339),
-		STAN:                 c.stanGenerator.Next(),
+		TransmissionDateTime: payment.TransmissionDateTime,
+		STAN:                 payment.STAN,
+		AcquirerID:           c.acquirerID,
 		AcceptorInformation: &AcceptorInformation{
 			Name:       merchant.Name,
 			MCC:        merchant.MCC,
@@ -70,21 +361,129 @@ func (c *Client) AuthorizePayment(payment *models.Payment, create models.CreateP
 		},
 	}
 
+	if create.PartialApproval {
+		requestData.PartialApproval = PartialApprovalSupported
+	}
+
+	// the terminal reads the chip of the cards over NFC
 	if create.EMVPayload != nil {
+		requestData.POSEntryMode = POSEntryModeContactless
 		requestData.ChipData = create.EMVPayload
 	} else {
+		requestData.POSEntryMode = POSEntryModeManual
 		requestData.PrimaryAccountNumber = create.Card.Number
 		requestData.ExpirationDate = create.Card.ExpirationDate
+		requestData.CardVerificationValue = create.Card.CardVerificationValue
 	}
 
-	err := requestMessage.Marshal(requestData)
+	err = requestMessage.Marshal(requestData)
+	if err != nil {
+		return models.AuthorizationResponse{}, fmt.Errorf("marshaling request data: %w", err)
+	}
+
+	responseMessage, err := c.send(requestMessage)
+	if err != nil {
+		return models.AuthorizationResponse{}, err
+	}
+
+	responseData := &AuthorizationResponse{}
+	err = responseMessage.Unmarshal(responseData)
+	if err != nil {
+		return models.AuthorizationResponse{}, fmt.Errorf("unmarshaling response data: %w", err)
+	}
+
+	return models.AuthorizationResponse{
+		ResponseCode:      responseData.ResponseCode,
+		AuthorizationCode: responseData.AuthorizationCode,
+		ApprovedAmount:    responseData.ApprovedAmount,
+
+		IssuerAuthenticationData: responseData.ChipData,
+	}, nil
+}
+
+// CapturePayment sends a capture (0220) for the authorized payment. The
+// issuer finds the original authorization by its STAN, transmission date &
+// time and our acquirer ID, and checks its authorization code.
+func (c *Client) CapturePayment(payment *models.Payment, amount int64) (models.CaptureResponse, error) {
+	c.logger.Info("capturing payment", slog.String("payment_id", payment.ID), slog.Int64("amount", amount))
+
+	stan, err := c.stanGenerator.Next()
+	if err != nil {
+		return models.CaptureResponse{}, fmt.Errorf("generating stan: %w", err)
+	}
+
+	requestMessage := iso8583.NewMessage(spec)
+	requestData := &CaptureRequest{
+		MTI:                  "0220",
+		Amount:               amount,
+		Currency:             payment.Currency,
+		TransmissionDateTime: time.Now().UTC().Format(time.RFC3339),
+		AuthorizationCode:    payment.AuthorizationCode,
+		STAN:                 stan,
+		AcquirerID:           c.acquirerID,
+		OriginalDataElements: &OriginalDataElements{
+			MTI:                  "0100",
+			STAN:                 payment.STAN,
+			TransmissionDateTime: payment.TransmissionDateTime,
+		},
+	}
+
+	err = requestMessage.Marshal(requestData)
+	if err != nil {
+		return models.CaptureResponse{}, fmt.Errorf("marshaling request data: %w", err)
+	}
+
+	responseMessage, err := c.send(requestMessage)
+	if err != nil {
+		return models.CaptureResponse{}, err
+	}
+
+	responseData := &CaptureResponse{}
+	err = responseMessage.Unmarshal(responseData)
+	if err != nil {
+		return models.CaptureResponse{}, fmt.Errorf("unmarshaling response data: %w", err)
+	}
+
+	return models.CaptureResponse{
+		ResponseCode: responseData.ResponseCode,
+	}, nil
+}
+
+// IncrementAuthorization sends an incremental authorization (0100 with the
+// original data elements) for the authorized payment. The issuer finds the
+// original authorization by its STAN, transmission date & time and our
+// acquirer ID and adds the amount to its hold.
+func (c *Client) IncrementAuthorization(payment *models.Payment, amount int64) (models.AuthorizationResponse, error) {
+	c.logger.Info("incrementing authorization", slog.String("payment_id", payment.ID), slog.Int64("amount", amount))
+
+	stan, err := c.stanGenerator.Next()
+	if err != nil {
+		return models.AuthorizationResponse{}, fmt.Errorf("generating stan: %w", err)
+	}
+
+	requestMessage := iso8583.NewMessage(spec)
+	requestData := &AuthorizationRequest{
+		MTI:                  "0100",
+		Amount:               amount,
+		Currency:             payment.Currency,
+		TransmissionDateTime: time.Now().UTC().Format(time.RFC3339),
+		STAN:                 stan,
+		AcquirerID:           c.acquirerID,
+		OriginalDataElements: &OriginalDataElements{
+			MTI:                  "0100",
+			STAN:                 payment.STAN,
+			TransmissionDateTime: payment.TransmissionDateTime,
+		},
+	}
+
+	err = requestMessage.Marshal(requestData)
 	if err != nil {
 		return models.AuthorizationResponse{}, fmt.Errorf("marshaling request data: %w", err)
 	}
 
-	responseMessage, err := c.iso8583Connection.Send(requestMessage)
+	responseMessage, err := c.send(requestMessage)
 	if err != nil {
-		return models.AuthorizationResponse{}, fmt.Errorf("sending ISO 8583 message to server: %w", err)
+		return models.AuthorizationResponse{}, err
 	}
 
 	responseData := &AuthorizationResponse{}
@@ -94,7 +493,204 @@ func (c *Client) AuthorizePayment(payment *models.Payment, create models.CreateP
 	}
 
 	return models.AuthorizationResponse{
-		ApprovalCode:      responseData.ApprovalCode,
+		ResponseCode:      responseData.ResponseCode,
 		AuthorizationCode: responseData.AuthorizationCode,
 	}, nil
 }
+
+// CompletePayment sends a completion (0220 with the original data elements
+// and without the authorization code) for the authorized payment. The issuer finds the original authorization by
+// its STAN, transmission date & time and our acquirer ID, captures the amount
+// and releases the rest of the hold.
+func (c *Client) CompletePayment(payment *models.Payment, amount int64) (models.CaptureResponse, error) {
+	c.logger.Info("completing payment", slog.String("payment_id", payment.ID), slog.Int64("amount", amount))
+
+	stan, err := c.stanGenerator.Next()
+	if err != nil {
+		return models.CaptureResponse{}, fmt.Errorf("generating stan: %w", err)
+	}
+
+	requestMessage := iso8583.NewMessage(spec)
+	requestData := &CaptureRequest{
+		MTI:                  "0220",
+		Amount:               amount,
+		Currency:             payment.Currency,
+		TransmissionDateTime: time.Now().UTC().Format(time.RFC3339),
+		STAN:                 stan,
+		AcquirerID:           c.acquirerID,
+		OriginalDataElements: &OriginalDataElements{
+			MTI:                  "0100",
+			STAN:                 payment.STAN,
+			TransmissionDateTime: payment.TransmissionDateTime,
+		},
+	}
+
+	err = requestMessage.Marshal(requestData)
+	if err != nil {
+		return models.CaptureResponse{}, fmt.Errorf("marshaling request data: %w", err)
+	}
+
+	responseMessage, err := c.send(requestMessage)
+	if err != nil {
+		return models.CaptureResponse{}, err
+	}
+
+	responseData := &CaptureResponse{}
+	err = responseMessage.Unmarshal(responseData)
+	if err != nil {
+		return models.CaptureResponse{}, fmt.Errorf("unmarshaling response data: %w", err)
+	}
+
+	return models.CaptureResponse{
+		ResponseCode: responseData.ResponseCode,
+	}, nil
+}
+
+// ReversePayment sends a reversal (0400) for the payment's authorization. The
+// issuer finds the original authorization by its STAN, transmission date &
+// time and our acquirer ID and releases its hold.
+func (c *Client) ReversePayment(payment *models.Payment) (models.ReversalResponse, error) {
+	c.logger.Info("reversing payment", slog.String("payment_id", payment.ID), slog.String("original_stan", payment.STAN))
+
+	stan, err := c.stanGenerator.Next()
+	if err != nil {
+		return models.ReversalResponse{}, fmt.Errorf("generating stan: %w", err)
+	}
+
+	requestMessage := iso8583.NewMessage(spec)
+	requestData := &ReversalRequest{
+		MTI:                  "0400",
+		Amount:               payment.Amount,
+		Currency:             payment.Currency,
+		TransmissionDateTime: time.Now().UTC().Format(time.RFC3339),
+		STAN:                 stan,
+		AcquirerID:           c.acquirerID,
+		OriginalDataElements: &OriginalDataElements{
+			MTI:                  "0100",
+			STAN:                 payment.STAN,
+			TransmissionDateTime: payment.TransmissionDateTime,
+		},
+	}
+
+	err = requestMessage.Marshal(requestData)
+	if err != nil {
+		return models.ReversalResponse{}, fmt.Errorf("marshaling request data: %w", err)
+	}
+
+	responseMessage, err := c.send(requestMessage)
+	if err != nil {
+		return models.ReversalResponse{}, err
+	}
+
+	responseData := &ReversalResponse{}
+	err = responseMessage.Unmarshal(responseData)
+	if err != nil {
+		return models.ReversalResponse{}, fmt.Errorf("unmarshaling response data: %w", err)
+	}
+
+	return models.ReversalResponse{
+		ResponseCode: responseData.ResponseCode,
+	}, nil
+}
+
+// RefundPayment sends a refund (0200) for the captured payment. The issuer
+// finds the original authorization by its STAN and transmission date & time
+// and returns the refunded amount to the account.
+func (c *Client) RefundPayment(payment *models.Payment, refund *models.Refund) (models.RefundResponse, error) {
+	c.logger.Info("refunding payment", slog.String("payment_id", payment.ID), slog.Int64("amount", refund.Amount))
+
+	stan, err := c.stanGenerator.Next()
+	if err != nil {
+		return models.RefundResponse{}, fmt.Errorf("generating stan: %w", err)
+	}
+
+	// keep the STAN on the refund, so we can reference the request later
+	refund.STAN = stan
+
+	requestMessage := iso8583.NewMessage(spec)
+	requestData := &RefundRequest{
+		MTI:                  "0200",
+		Amount:               refund.Amount,
+		Currency:             refund.Currency,
+		TransmissionDateTime: time.Now().UTC().Format(time.RFC3339),
+		STAN:                 refund.STAN,
+		AcquirerID:           c.acquirerID,
+		OriginalDataElements: &OriginalDataElements{
+			MTI:                  "0100",
+			STAN:                 payment.STAN,
+			TransmissionDateTime: payment.TransmissionDateTime,
+		},
+	}
+
+	err = requestMessage.Marshal(requestData)
+	if err != nil {
+		return models.RefundResponse{}, fmt.Errorf("marshaling request data: %w", err)
+	}
+
+	responseMessage, err := c.send(requestMessage)
+	if err != nil {
+		return models.RefundResponse{}, err
+	}
+
+	responseData := &RefundResponse{}
+	err = responseMessage.Unmarshal(responseData)
+	if err != nil {
+		return models.RefundResponse{}, fmt.Errorf("unmarshaling response data: %w", err)
+	}
+
+	return models.RefundResponse{
+		ResponseCode: responseData.ResponseCode,
+	}, nil
+}
+
+// SendAdvice sends the advice (0120) of the payment we approved in stand-in.
+// The advice carries the STAN and the transmission date & time of the payment,
+// so the issuer can tell a repeated advice, and the authorization code we
+// approved the payment with.
+func (c *Client) SendAdvice(payment *models.Payment, advice *models.StandInAdvice, merchant models.Merchant) (models.AdviceResponse, error) {
+	c.logger.Info("sending stand-in advice", slog.String("payment_id", payment.ID), slog.String("stan", payment.STAN))
+
+	requestMessage := iso8583.NewMessage(spec)
+	requestData := &AdviceRequest{
+		MTI:                  "0120",
+		Amount:               payment.Amount,
+		Currency:             payment.Currency,
+		TransmissionDateTime: payment.TransmissionDateTime,
+		AuthorizationCode:    payment.AuthorizationCode,
+		STAN:                 payment.STAN,
+		AcquirerID:           c.acquirerID,
+		AcceptorInformation: &AcceptorInformation{
+			Name:       merchant.Name,
+			MCC:        merchant.MCC,
+			PostalCode: merchant.PostalCode,
+			WebSite:    merchant.WebSite,
+		},
+	}
+
+	if advice.EMVPayload != nil {
+		requestData.ChipData = advice.EMVPayload
+	} else {
+		requestData.PrimaryAccountNumber = advice.Card.Number
+		requestData.ExpirationDate = advice.Card.ExpirationDate
+	}
+
+	err := requestMessage.Marshal(requestData)
+	if err != nil {
+		return models.AdviceResponse{}, fmt.Errorf("marshaling request data: %w", err)
+	}
+
+	responseMessage, err := c.send(requestMessage)
+	if err != nil {
+		return models.AdviceResponse{}, err
+	}
+
+	responseData := &AdviceResponse{}
+	err = responseMessage.Unmarshal(responseData)
+	if err != nil {
+		return models.AdviceResponse{}, fmt.Errorf("unmarshaling response data: %w", err)
+	}
+
+	return models.AdviceResponse{
+		ResponseCode: responseData.ResponseCode,
+	}, nil
+}
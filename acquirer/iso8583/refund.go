@@ -0,0 +1,21 @@
+package iso8583
+
+// RefundRequest is the 0200 message the acquirer sends to return the amount
+// of a captured transaction to the cardholder. The original authorization is
+// referenced by its STAN and transmission date & time in the original data
+// elements and the acquirer ID.
+type RefundRequest struct {
+	MTI                  string                `index:"0"`
+	Amount               int64                 `index:"3"`
+	TransmissionDateTime string                `index:"4"`
+	Currency             string                `index:"7"`
+	STAN                 string                `index:"11"`
+	AcquirerID           string                `index:"32"`
+	OriginalDataElements *OriginalDataElements `index:"90"`
+}
+
+type RefundResponse struct {
+	MTI          string `index:"0"`
+	ResponseCode string `index:"39"`
+	STAN         string `index:"11"`
+}
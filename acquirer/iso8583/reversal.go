@@ -0,0 +1,26 @@
+package iso8583
+
+// ReversalRequest is the 0400 message the acquirer sends to cancel a previous
+// authorization. The original authorization is referenced by its STAN and
+// transmission date & time in the original data elements and the acquirer ID.
+type ReversalRequest struct {
+	MTI                  string                `index:"0"`
+	Amount               int64                 `index:"3"`
+	TransmissionDateTime string                `index:"4"`
+	Currency             string                `index:"7"`
+	STAN                 string                `index:"11"`
+	AcquirerID           string                `index:"32"`
+	OriginalDataElements *OriginalDataElements `index:"90"`
+}
+
+type ReversalResponse struct {
+	MTI          string `index:"0"`
+	ResponseCode string `index:"39"`
+	STAN         string `index:"11"`
+}
+
+type OriginalDataElements struct {
+	MTI                  string `index:"01"`
+	STAN                 string `index:"02"`
+	TransmissionDateTime string `index:"03"`
+}
@@ -5,27 +5,46 @@ import (
 	"sync"
 )
 
+// STANStore keeps the last STAN, so the numbering continues where it stopped
+// when the acquirer is restarted.
+type STANStore interface {
+	GetLastSTAN() (int, error)
+	SaveLastSTAN(stan int) error
+}
+
 type stanGenerator struct {
-	mu  sync.Mutex
-	num int
+	mu    sync.Mutex
+	num   int
+	store STANStore
 }
 
-func NewStanGenerator() *stanGenerator {
-	return &stanGenerator{
-		num: 1,
+// NewStanGenerator returns the generator that continues after the last STAN
+// saved in the store.
+func NewStanGenerator(store STANStore) (*stanGenerator, error) {
+	last, err := store.GetLastSTAN()
+	if err != nil {
+		return nil, fmt.Errorf("getting last stan: %w", err)
 	}
+
+	return &stanGenerator{
+		num:   last,
+		store: store,
+	}, nil
 }
 
-func (g *stanGenerator) Next() string {
+// Next saves and returns the next STAN. STANs wrap around after 999999.
+func (g *stanGenerator) Next() (string, error) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	defer func() {
-		g.num++
-		if g.num > 999999 {
-			g.num = 1
-		}
-	}()
+	next := g.num%999999 + 1
+
+	// the STAN is saved before it's used, so it's never sent twice
+	if err := g.store.SaveLastSTAN(next); err != nil {
+		return "", fmt.Errorf("saving last stan: %w", err)
+	}
+
+	g.num = next
 
-	return fmt.Sprintf("%06d", g.num)
+	return fmt.Sprintf("%06d", next), nil
 }
@@ -0,0 +1,681 @@
+package acquirer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer/models"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/clearing"
+)
+
+type persistedData struct {
+	Merchants map[string]*models.Merchant `json:"merchants"`
+	Payments  map[string]*models.Payment  `json:"payments"`
+	Refunds   map[string]*models.Refund   `json:"refunds"`
+	Batches   map[string]*models.Batch    `json:"batches"`
+	LastSTAN  int                         `json:"last_stan"`
+
+	IdempotentRequests map[string]*models.IdempotentRequest `json:"idempotent_requests"`
+	StandInAdvices     map[string]*models.StandInAdvice     `json:"stand_in_advices"`
+}
+
+// MemoryRepository keeps the data in memory. It's saved to the JSON file it
+// was loaded from when the repository is closed. The last STAN is saved to a
+// file next to it each time it changes.
+type MemoryRepository struct {
+	mu   sync.RWMutex
+	path string
+
+	merchants map[string]*models.Merchant
+	payments  map[string]*models.Payment
+	refunds   map[string]*models.Refund
+	batches   map[string]*models.Batch
+
+	// stanMu guards the last STAN, so it's saved without holding mu
+	stanMu   sync.Mutex
+	lastSTAN int
+
+	// idempotentRequests are keyed by the merchant ID and the key
+	idempotentRequests map[string]*models.IdempotentRequest
+
+	// standInAdvices are keyed by the payment ID
+	standInAdvices map[string]*models.StandInAdvice
+}
+
+var _ Repository = (*MemoryRepository)(nil)
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		merchants: make(map[string]*models.Merchant),
+		payments:  make(map[string]*models.Payment),
+		refunds:   make(map[string]*models.Refund),
+		batches:   make(map[string]*models.Batch),
+
+		idempotentRequests: make(map[string]*models.IdempotentRequest),
+		standInAdvices:     make(map[string]*models.StandInAdvice),
+	}
+}
+
+func (r *MemoryRepository) CreateMerchant(merchant *models.Merchant) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := *merchant
+	r.merchants[merchant.ID] = &stored
+
+	return nil
+}
+
+func (r *MemoryRepository) GetMerchant(merchantID string) (*models.Merchant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	merchant, ok := r.merchants[merchantID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	found := *merchant
+	return &found, nil
+}
+
+func (r *MemoryRepository) GetMerchants() ([]*models.Merchant, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	merchants := make([]*models.Merchant, 0, len(r.merchants))
+	for _, merchant := range r.merchants {
+		found := *merchant
+		merchants = append(merchants, &found)
+	}
+
+	return merchants, nil
+}
+
+func (r *MemoryRepository) CreatePayment(payment *models.Payment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.payments[payment.ID] = copyPayment(payment)
+
+	return nil
+}
+
+func (r *MemoryRepository) UpdatePayment(payment *models.Payment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.updatePayment(payment)
+}
+
+func (r *MemoryRepository) updatePayment(payment *models.Payment) error {
+	stored, ok := r.payments[payment.ID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	updated := copyPayment(payment)
+	updated.RefundedAmount = stored.RefundedAmount
+	updated.SettlementBatchID = stored.SettlementBatchID
+	r.payments[payment.ID] = updated
+
+	return nil
+}
+
+func (r *MemoryRepository) GetPayment(merchantID, paymentID string) (*models.Payment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	payment, ok := r.payments[paymentID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if payment.MerchantID != merchantID {
+		return nil, ErrNotFound
+	}
+
+	return copyPayment(payment), nil
+}
+
+func (r *MemoryRepository) GetPayments(merchantID string) ([]*models.Payment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var payments []*models.Payment
+	for _, payment := range r.payments {
+		if payment.MerchantID == merchantID {
+			payments = append(payments, copyPayment(payment))
+		}
+	}
+
+	return payments, nil
+}
+
+func (r *MemoryRepository) CreateRefund(refund *models.Refund) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	payment, ok := r.payments[refund.PaymentID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	total := refund.Amount
+	for _, other := range r.refunds {
+		if other.PaymentID == refund.PaymentID && other.Holds() {
+			total += other.Amount
+		}
+	}
+
+	if total > payment.CapturedAmount {
+		return models.ErrRefundExceedsCapturedAmount
+	}
+
+	stored := *refund
+	r.refunds[refund.ID] = &stored
+
+	return nil
+}
+
+func (r *MemoryRepository) UpdateRefund(refund *models.Refund) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	payment, ok := r.payments[refund.PaymentID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	stored, ok := r.refunds[refund.ID]
+	if !ok {
+		return ErrNotFound
+	}
+
+	updated := *refund
+	updated.SettlementBatchID = stored.SettlementBatchID
+	r.refunds[refund.ID] = &updated
+
+	payment.RefundedAmount = 0
+	for _, other := range r.refunds {
+		if other.PaymentID == refund.PaymentID && other.Status == models.RefundStatusApproved {
+			payment.RefundedAmount += other.Amount
+		}
+	}
+
+	return nil
+}
+
+func (r *MemoryRepository) GetRefunds(merchantID, paymentID string) ([]*models.Refund, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	payment, ok := r.payments[paymentID]
+	if !ok || payment.MerchantID != merchantID {
+		return nil, ErrNotFound
+	}
+
+	refunds := make([]*models.Refund, 0)
+	for _, refund := range r.refunds {
+		if refund.PaymentID == paymentID {
+			found := *refund
+			refunds = append(refunds, &found)
+		}
+	}
+
+	slices.SortFunc(refunds, func(a, b *models.Refund) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return refunds, nil
+}
+
+func (r *MemoryRepository) GetUnsettled(merchantID string) ([]*models.Payment, []*models.Refund, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var payments []*models.Payment
+	for _, payment := range r.payments {
+		if payment.MerchantID == merchantID && isUnsettledCapture(payment) {
+			payments = append(payments, copyPayment(payment))
+		}
+	}
+
+	var refunds []*models.Refund
+	for _, refund := range r.refunds {
+		if refund.MerchantID == merchantID && isUnsettledRefund(refund) {
+			found := *refund
+			refunds = append(refunds, &found)
+		}
+	}
+
+	slices.SortFunc(payments, func(a, b *models.Payment) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	slices.SortFunc(refunds, func(a, b *models.Refund) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return payments, refunds, nil
+}
+
+func isUnsettledCapture(payment *models.Payment) bool {
+	return payment.SettlementBatchID == "" &&
+		(payment.Status == models.PaymentStatusCaptured || payment.Status == models.PaymentStatusRefunded)
+}
+
+func isUnsettledRefund(refund *models.Refund) bool {
+	return refund.SettlementBatchID == "" && refund.Status == models.RefundStatusApproved
+}
+
+func (r *MemoryRepository) CreateBatch(batch *models.Batch) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// check all the records first, so nothing is marked if the batch is
+	// rejected
+	for _, record := range batch.Records {
+		switch record.Type {
+		case clearing.RecordTypeCapture:
+			payment, ok := r.payments[record.PaymentID]
+			if !ok || !isUnsettledCapture(payment) {
+				return fmt.Errorf("%w: payment %s", models.ErrAlreadySettled, record.PaymentID)
+			}
+		case clearing.RecordTypeRefund:
+			refund, ok := r.refunds[record.RefundID]
+			if !ok || !isUnsettledRefund(refund) {
+				return fmt.Errorf("%w: refund %s", models.ErrAlreadySettled, record.RefundID)
+			}
+		}
+	}
+
+	for _, record := range batch.Records {
+		switch record.Type {
+		case clearing.RecordTypeCapture:
+			r.payments[record.PaymentID].SettlementBatchID = batch.ID
+		case clearing.RecordTypeRefund:
+			r.refunds[record.RefundID].SettlementBatchID = batch.ID
+		}
+	}
+
+	r.batches[batch.ID] = copyBatch(batch)
+
+	return nil
+}
+
+func (r *MemoryRepository) GetBatch(merchantID, batchID string) (*models.Batch, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	batch, ok := r.batches[batchID]
+	if !ok || batch.MerchantID != merchantID {
+		return nil, ErrNotFound
+	}
+
+	return copyBatch(batch), nil
+}
+
+func (r *MemoryRepository) GetBatches(merchantID string) ([]*models.Batch, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	batches := make([]*models.Batch, 0)
+	for _, batch := range r.batches {
+		if batch.MerchantID == merchantID {
+			batches = append(batches, copyBatch(batch))
+		}
+	}
+
+	slices.SortFunc(batches, func(a, b *models.Batch) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return batches, nil
+}
+
+func (r *MemoryRepository) CreateIdempotentRequest(request *models.IdempotentRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := idempotentRequestKey(request.MerchantID, request.Key)
+	if _, ok := r.idempotentRequests[key]; ok {
+		return models.ErrIdempotencyKeyExists
+	}
+
+	r.idempotentRequests[key] = copyIdempotentRequest(request)
+
+	return nil
+}
+
+func (r *MemoryRepository) GetIdempotentRequest(merchantID, key string) (*models.IdempotentRequest, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	request, ok := r.idempotentRequests[idempotentRequestKey(merchantID, key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return copyIdempotentRequest(request), nil
+}
+
+func (r *MemoryRepository) UpdateIdempotentRequest(request *models.IdempotentRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := idempotentRequestKey(request.MerchantID, request.Key)
+	if _, ok := r.idempotentRequests[key]; !ok {
+		return ErrNotFound
+	}
+
+	r.idempotentRequests[key] = copyIdempotentRequest(request)
+
+	return nil
+}
+
+func (r *MemoryRepository) ReclaimIdempotentRequest(request *models.IdempotentRequest, claimedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := idempotentRequestKey(request.MerchantID, request.Key)
+	saved, ok := r.idempotentRequests[key]
+	if !ok || saved.Completed() || !saved.CreatedAt.Equal(claimedAt) {
+		return ErrNotFound
+	}
+
+	r.idempotentRequests[key] = copyIdempotentRequest(request)
+
+	return nil
+}
+
+func (r *MemoryRepository) DeleteIdempotentRequest(merchantID, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.idempotentRequests, idempotentRequestKey(merchantID, key))
+
+	return nil
+}
+
+func idempotentRequestKey(merchantID, key string) string {
+	return merchantID + "/" + key
+}
+
+func copyIdempotentRequest(request *models.IdempotentRequest) *models.IdempotentRequest {
+	c := *request
+	c.ResponseBody = slices.Clone(request.ResponseBody)
+
+	return &c
+}
+
+func (r *MemoryRepository) CreateStandInAdvice(advice *models.StandInAdvice, payment *models.Payment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.standInAdvices {
+		if existing.AuthorizationCode == advice.AuthorizationCode {
+			return models.ErrAuthorizationCodeExists
+		}
+	}
+
+	if err := r.updatePayment(payment); err != nil {
+		return err
+	}
+
+	r.standInAdvices[advice.PaymentID] = copyStandInAdvice(advice)
+
+	return nil
+}
+
+func (r *MemoryRepository) GetStandInAdvice(paymentID string) (*models.StandInAdvice, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	advice, ok := r.standInAdvices[paymentID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return copyStandInAdvice(advice), nil
+}
+
+func (r *MemoryRepository) GetPendingStandInAdvices() ([]*models.StandInAdvice, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var advices []*models.StandInAdvice
+	for _, advice := range r.standInAdvices {
+		if advice.Status == models.AdviceStatusPending {
+			advices = append(advices, copyStandInAdvice(advice))
+		}
+	}
+
+	slices.SortFunc(advices, func(a, b *models.StandInAdvice) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return advices, nil
+}
+
+func (r *MemoryRepository) UpdateStandInAdvice(advice *models.StandInAdvice) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.standInAdvices[advice.PaymentID]; !ok {
+		return ErrNotFound
+	}
+
+	r.standInAdvices[advice.PaymentID] = copyStandInAdvice(advice)
+
+	return nil
+}
+
+func copyStandInAdvice(advice *models.StandInAdvice) *models.StandInAdvice {
+	c := *advice
+	c.EMVPayload = slices.Clone(advice.EMVPayload)
+
+	return &c
+}
+
+func (r *MemoryRepository) GetLastSTAN() (int, error) {
+	r.stanMu.Lock()
+	defer r.stanMu.Unlock()
+
+	return r.lastSTAN, nil
+}
+
+// SaveLastSTAN saves the STAN before it's sent. The other data is saved on
+// Close, but the STAN is saved to its own file right away, so the STANs sent
+// before a crash are not sent again.
+func (r *MemoryRepository) SaveLastSTAN(stan int) error {
+	r.stanMu.Lock()
+	defer r.stanMu.Unlock()
+
+	if r.path != "" {
+		if err := writeFile(stanFilePath(r.path), []byte(strconv.Itoa(stan))); err != nil {
+			return fmt.Errorf("saving last stan: %w", err)
+		}
+	}
+
+	r.lastSTAN = stan
+
+	return nil
+}
+
+// stanFilePath returns the path of the file with the last STAN next to the
+// data file at path
+func stanFilePath(path string) string {
+	return path + ".stan"
+}
+
+// readLastSTAN reads the last STAN from the file at path. It returns false if
+// the file doesn't exist, e.g. the data was saved before the STAN got its own
+// file.
+func readLastSTAN(path string) (int, bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+
+	stan, err := strconv.Atoi(string(data))
+	if err != nil {
+		return 0, false, fmt.Errorf("parsing last stan: %w", err)
+	}
+
+	return stan, true, nil
+}
+
+func copyBatch(batch *models.Batch) *models.Batch {
+	c := *batch
+	c.Records = slices.Clone(batch.Records)
+
+	return &c
+}
+
+// copyPayment copies the payment with its history and chip data, so the stored payment
+// doesn't change with the copy.
+func copyPayment(payment *models.Payment) *models.Payment {
+	c := *payment
+	c.History = slices.Clone(payment.History)
+	c.IssuerAuthenticationData = slices.Clone(payment.IssuerAuthenticationData)
+
+	return &c
+}
+
+// Close saves the data to the file the repository was loaded from.
+func (r *MemoryRepository) Close() error {
+	if r.path == "" {
+		return nil
+	}
+
+	return r.SaveToFile(r.path)
+}
+
+func (r *MemoryRepository) SaveToFile(path string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.saveToFile(path)
+}
+
+func (r *MemoryRepository) saveToFile(path string) error {
+	r.stanMu.Lock()
+	lastSTAN := r.lastSTAN
+	r.stanMu.Unlock()
+
+	data := persistedData{
+		Merchants: r.merchants,
+		Payments:  r.payments,
+		Refunds:   r.refunds,
+		Batches:   r.batches,
+		LastSTAN:  lastSTAN,
+
+		IdempotentRequests: r.idempotentRequests,
+		StandInAdvices:     r.standInAdvices,
+	}
+
+	jsonData, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(path, jsonData)
+}
+
+// writeFile writes the data to a temporary file first and replaces the file
+// at path with it, so a crash while writing doesn't leave the file cut off.
+func writeFile(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path)
+}
+
+// LoadFromFile loads the data from the JSON file at path. The file is
+// remembered, so Close saves the data back to it.
+func (r *MemoryRepository) LoadFromFile(path string) error {
+	r.path = path
+
+	lastSTAN, found, err := readLastSTAN(stanFilePath(path))
+	if err != nil {
+		return err
+	}
+
+	var persisted persistedData
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// the file doesn't exist yet, that's okay
+	if err == nil {
+		if err := json.Unmarshal(data, &persisted); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Initialize maps if they're nil
+	if persisted.Merchants != nil {
+		r.merchants = persisted.Merchants
+	} else {
+		r.merchants = make(map[string]*models.Merchant)
+	}
+
+	if persisted.Payments != nil {
+		r.payments = persisted.Payments
+	} else {
+		r.payments = make(map[string]*models.Payment)
+	}
+
+	if persisted.Refunds != nil {
+		r.refunds = persisted.Refunds
+	} else {
+		r.refunds = make(map[string]*models.Refund)
+	}
+
+	if persisted.Batches != nil {
+		r.batches = persisted.Batches
+	} else {
+		r.batches = make(map[string]*models.Batch)
+	}
+
+	if persisted.IdempotentRequests != nil {
+		r.idempotentRequests = persisted.IdempotentRequests
+	} else {
+		r.idempotentRequests = make(map[string]*models.IdempotentRequest)
+	}
+
+	if persisted.StandInAdvices != nil {
+		r.standInAdvices = persisted.StandInAdvices
+	} else {
+		r.standInAdvices = make(map[string]*models.StandInAdvice)
+	}
+
+	// the STAN file is saved before each STAN is sent, so it's never
+	// behind the data file
+	r.stanMu.Lock()
+	defer r.stanMu.Unlock()
+
+	if found {
+		r.lastSTAN = lastSTAN
+	} else {
+		r.lastSTAN = persisted.LastSTAN
+	}
+
+	return nil
+}
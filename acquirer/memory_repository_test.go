@@ -0,0 +1,41 @@
+package acquirer_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryRepositorySavesLastSTANBeforeClose(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "acquirer.json")
+
+	repo := acquirer.NewMemoryRepository()
+	require.NoError(t, repo.LoadFromFile(path))
+	require.NoError(t, repo.SaveLastSTAN(42))
+
+	// only the STAN is saved, the data is saved on close
+	_, err := os.Stat(path)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	// the acquirer crashed, the repository was not closed
+	reloaded := acquirer.NewMemoryRepository()
+	require.NoError(t, reloaded.LoadFromFile(path))
+
+	stan, err := reloaded.GetLastSTAN()
+	require.NoError(t, err)
+	require.Equal(t, 42, stan)
+
+	// the STAN saved after the data is not taken from the data file
+	require.NoError(t, reloaded.Close())
+	require.NoError(t, reloaded.SaveLastSTAN(43))
+
+	reloaded = acquirer.NewMemoryRepository()
+	require.NoError(t, reloaded.LoadFromFile(path))
+
+	stan, err = reloaded.GetLastSTAN()
+	require.NoError(t, err)
+	require.Equal(t, 43, stan)
+}
@@ -0,0 +1,26 @@
+CREATE TABLE merchants (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	mcc TEXT NOT NULL,
+	postal_code TEXT NOT NULL,
+	web_site TEXT NOT NULL
+);
+
+CREATE TABLE payments (
+	id TEXT PRIMARY KEY,
+	merchant_id TEXT NOT NULL REFERENCES merchants (id),
+	amount INTEGER NOT NULL,
+	captured_amount INTEGER NOT NULL,
+	currency TEXT NOT NULL,
+	card_first6 TEXT NOT NULL,
+	card_last4 TEXT NOT NULL,
+	card_expiration_date TEXT NOT NULL,
+	status TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	authorization_code TEXT NOT NULL,
+	response_code TEXT NOT NULL,
+	response_description TEXT NOT NULL,
+	stan TEXT NOT NULL
+);
+
+CREATE INDEX payments_merchant_id ON payments (merchant_id);
@@ -0,0 +1,11 @@
+CREATE TABLE payment_status_changes (
+	payment_id TEXT NOT NULL REFERENCES payments (id),
+	status TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+
+CREATE INDEX payment_status_changes_payment_id ON payment_status_changes (payment_id);
+
+-- payments created before the history have only their current status
+INSERT INTO payment_status_changes (payment_id, status, created_at)
+SELECT id, status, created_at FROM payments;
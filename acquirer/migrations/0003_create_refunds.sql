@@ -0,0 +1,16 @@
+ALTER TABLE payments ADD COLUMN refunded_amount INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE refunds (
+	id TEXT PRIMARY KEY,
+	payment_id TEXT NOT NULL REFERENCES payments (id),
+	merchant_id TEXT NOT NULL REFERENCES merchants (id),
+	amount INTEGER NOT NULL,
+	currency TEXT NOT NULL,
+	status TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	response_code TEXT NOT NULL,
+	response_description TEXT NOT NULL,
+	stan TEXT NOT NULL
+);
+
+CREATE INDEX refunds_payment_id ON refunds (payment_id);
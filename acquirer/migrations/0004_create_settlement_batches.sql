@@ -0,0 +1,31 @@
+ALTER TABLE payments ADD COLUMN settlement_batch_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE refunds ADD COLUMN settlement_batch_id TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE settlement_batches (
+	id TEXT PRIMARY KEY,
+	merchant_id TEXT NOT NULL REFERENCES merchants (id),
+	currency TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	capture_count INTEGER NOT NULL,
+	capture_amount INTEGER NOT NULL,
+	refund_count INTEGER NOT NULL,
+	refund_amount INTEGER NOT NULL,
+	fee_amount INTEGER NOT NULL,
+	net_amount INTEGER NOT NULL
+);
+
+CREATE INDEX settlement_batches_merchant_id ON settlement_batches (merchant_id);
+
+CREATE TABLE settlement_batch_records (
+	batch_id TEXT NOT NULL REFERENCES settlement_batches (id),
+	type TEXT NOT NULL,
+	payment_id TEXT NOT NULL,
+	refund_id TEXT NOT NULL,
+	stan TEXT NOT NULL,
+	transmission_date_time TEXT NOT NULL,
+	authorization_code TEXT NOT NULL,
+	amount INTEGER NOT NULL,
+	fee INTEGER NOT NULL
+);
+
+CREATE INDEX settlement_batch_records_batch_id ON settlement_batch_records (batch_id);
@@ -0,0 +1,13 @@
+ALTER TABLE payments ADD COLUMN transmission_date_time TEXT NOT NULL DEFAULT '';
+
+-- the payments authorized before were sent with their creation time
+UPDATE payments SET transmission_date_time = strftime('%Y-%m-%dT%H:%M:%SZ', created_at) WHERE stan != '';
+
+ALTER TABLE settlement_batches ADD COLUMN acquirer_id TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE stan_counter (
+	id INTEGER PRIMARY KEY CHECK (id = 1),
+	last_stan INTEGER NOT NULL
+);
+
+INSERT INTO stan_counter (id, last_stan) VALUES (1, 0);
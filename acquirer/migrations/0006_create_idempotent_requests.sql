@@ -0,0 +1,10 @@
+CREATE TABLE idempotent_requests (
+	merchant_id TEXT NOT NULL,
+	idempotency_key TEXT NOT NULL,
+	fingerprint TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	response_status INTEGER NOT NULL DEFAULT 0,
+	response_content_type TEXT NOT NULL DEFAULT '',
+	response_body BLOB NOT NULL DEFAULT x'',
+	PRIMARY KEY (merchant_id, idempotency_key)
+);
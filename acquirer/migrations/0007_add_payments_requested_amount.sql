@@ -0,0 +1,5 @@
+-- amount is what the issuer approved, which is less than the requested
+-- amount for partial approvals
+ALTER TABLE payments ADD COLUMN requested_amount INTEGER NOT NULL DEFAULT 0;
+
+UPDATE payments SET requested_amount = amount;
@@ -0,0 +1,18 @@
+ALTER TABLE payments ADD COLUMN stand_in BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- advices of the payments approved in stand-in, the card details are cleared
+-- once the advice is forwarded to the issuer
+CREATE TABLE stand_in_advices (
+	payment_id TEXT PRIMARY KEY REFERENCES payments (id),
+	merchant_id TEXT NOT NULL,
+	amount INTEGER NOT NULL,
+	card_number TEXT NOT NULL,
+	card_expiration_date TEXT NOT NULL,
+	emv_payload BLOB,
+	status TEXT NOT NULL,
+	response_code TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	forwarded_at TEXT NOT NULL
+);
+
+CREATE INDEX stand_in_advices_status ON stand_in_advices (status);
@@ -0,0 +1,3 @@
+-- the issuer route the payment was sent to, empty for the payments made
+-- before the acquirer routed by BIN
+ALTER TABLE payments ADD COLUMN route TEXT NOT NULL DEFAULT '';
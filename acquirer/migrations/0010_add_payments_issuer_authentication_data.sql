@@ -0,0 +1,3 @@
+-- the EMV data with the response cryptogram (ARPC) the issuer sent back for
+-- chip payments
+ALTER TABLE payments ADD COLUMN issuer_authentication_data BLOB;
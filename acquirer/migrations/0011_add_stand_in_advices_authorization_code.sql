@@ -0,0 +1,15 @@
+-- the authorization codes of the payments approved in stand-in, they are
+-- unique so the issuer and the switch can find the payments by them
+ALTER TABLE stand_in_advices ADD COLUMN authorization_code TEXT;
+
+UPDATE stand_in_advices SET authorization_code = (
+	SELECT authorization_code FROM payments WHERE payments.id = stand_in_advices.payment_id
+);
+
+-- the codes given to several payments before they were unique are kept by
+-- the first advice only
+UPDATE stand_in_advices SET authorization_code = NULL WHERE rowid NOT IN (
+	SELECT MIN(rowid) FROM stand_in_advices GROUP BY authorization_code
+);
+
+CREATE UNIQUE INDEX stand_in_advices_authorization_code ON stand_in_advices (authorization_code);
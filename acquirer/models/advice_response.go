@@ -0,0 +1,5 @@
+package models
+
+type AdviceResponse struct {
+	ResponseCode string
+}
@@ -1,6 +1,13 @@
 package models
 
 type AuthorizationResponse struct {
-	ApprovalCode      string
+	ResponseCode      string
 	AuthorizationCode string
+
+	// ApprovedAmount is set for partial approvals (response code 10)
+	ApprovedAmount int64
+
+	// IssuerAuthenticationData is the EMV data with the ARPC of chip
+	// payments with a verified cryptogram
+	IssuerAuthenticationData []byte
 }
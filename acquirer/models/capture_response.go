@@ -0,0 +1,5 @@
+package models
+
+type CaptureResponse struct {
+	ResponseCode string
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrIdempotencyKeyExists  = errors.New("idempotency key exists")
+	ErrIdempotencyKeyReused  = errors.New("idempotency key was used for another request")
+	ErrIdempotencyInProgress = errors.New("request with the idempotency key is in progress")
+)
+
+// IdempotentRequest is the merchant's request made with an idempotency key.
+// Its response is saved, so a retry with the same key gets the same response
+// instead of being processed again.
+type IdempotentRequest struct {
+	MerchantID string
+	Key        string
+
+	// Fingerprint of the request body, a retry must have the same body
+	Fingerprint string
+	CreatedAt   time.Time
+
+	// Response of the request, zero status until the request is completed
+	ResponseStatus      int
+	ResponseContentType string
+	ResponseBody        []byte
+}
+
+// Completed returns true if the response of the request was saved.
+func (r *IdempotentRequest) Completed() bool {
+	return r.ResponseStatus != 0
+}
+
+// Fingerprint returns the SHA-256 hash of the JSON encoded request.
+func Fingerprint(request any) (string, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("marshaling request: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:]), nil
+}
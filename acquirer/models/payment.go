@@ -1,31 +1,110 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/responsecode"
+)
 
 type CreatePayment struct {
 	Amount     int64
 	Currency   string
 	Card       Card
 	EMVPayload []byte
+
+	// PartialApproval is set when the merchant accepts an approval for less
+	// than the amount and collects the balance due another way
+	PartialApproval bool
 }
 
-type PaymentStatus string
+// CreateCapture captures an authorized payment. Amount may be less than the
+// authorized amount; zero captures the full authorized amount.
+type CreateCapture struct {
+	Amount int64
+}
 
-const (
-	PaymentStatusPending    PaymentStatus = "pending"
-	PaymentStatusError      PaymentStatus = "error"
-	PaymentStatusAuthorized PaymentStatus = "authorized"
-	PaymentStatusDeclined   PaymentStatus = "declined"
-)
+// CreateIncrement increases the authorized amount of an authorized payment,
+// e.g. when a hotel stay is extended.
+type CreateIncrement struct {
+	Amount int64
+}
+
+// CreateCompletion captures the final amount of an authorized payment, e.g.
+// at hotel check-out. Amount may be less than the authorized amount; zero
+// completes the full authorized amount.
+type CreateCompletion struct {
+	Amount int64
+}
 
 type Payment struct {
-	ID                string
-	MerchantID        string
-	Amount            int64
+	ID         string
+	MerchantID string
+
+	// RequestedAmount is the amount the merchant asked for. Amount is what
+	// the issuer authorized, which is less for partial approvals.
+	RequestedAmount int64
+	Amount          int64
+
+	CapturedAmount    int64
+	RefundedAmount    int64
 	Currency          string
 	Card              SafeCard
 	Status            PaymentStatus
 	CreatedAt         time.Time
 	AuthorizationCode string
 	ResponseCode      string
+
+	// ResponseDescription is the human-readable description of ResponseCode
+	ResponseDescription string
+
+	// STAN and TransmissionDateTime of the authorization request, used to
+	// reference it in reversals, refunds and clearing files
+	STAN                 string
+	TransmissionDateTime string
+
+	// Route is the name of the issuer route the payment was sent to, its
+	// follow-up messages are sent to the same issuer
+	Route string
+
+	// StandIn is set when we approved the payment ourselves because the
+	// issuer was unreachable. The issuer is advised of it later.
+	StandIn bool
+
+	// IssuerAuthenticationData is the EMV data of the issuer's response to
+	// a chip payment (tags 91 and 8A with the ARPC). The terminal passes it
+	// to the card in the second GENERATE AC.
+	IssuerAuthenticationData []byte
+
+	// SettlementBatchID is the batch the capture was settled in, empty
+	// until the payment is settled
+	SettlementBatchID string
+
+	// History lists the statuses of the payment in the order they were
+	// reached, starting with pending
+	History []PaymentStatusChange
+}
+
+// BalanceDue returns the part of the requested amount the issuer didn't
+// approve, which the customer has to pay another way.
+func (p *Payment) BalanceDue() int64 {
+	if p.ResponseCode != responsecode.PartiallyApproved || p.Amount >= p.RequestedAmount {
+		return 0
+	}
+
+	return p.RequestedAmount - p.Amount
+}
+
+// PaymentStatusFromResponseCode returns the status of the payment authorized
+// with the given response code (field 39).
+func PaymentStatusFromResponseCode(code string) PaymentStatus {
+	switch responsecode.GetInfo(code).Category {
+	case responsecode.CategoryApprove:
+		return PaymentStatusAuthorized
+	case responsecode.CategoryRetry:
+		// issuer couldn't process the payment, it may be sent again
+		return PaymentStatusError
+	default:
+		// declines and pick-ups
+		return PaymentStatusDeclined
+	}
 }
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidPaymentStatusTransition = errors.New("invalid payment status transition")
+
+type PaymentStatus string
+
+const (
+	PaymentStatusPending    PaymentStatus = "pending"
+	PaymentStatusError      PaymentStatus = "error"
+	PaymentStatusAuthorized PaymentStatus = "authorized"
+	PaymentStatusDeclined   PaymentStatus = "declined"
+	PaymentStatusCaptured   PaymentStatus = "captured"
+	PaymentStatusVoided     PaymentStatus = "voided"
+	PaymentStatusRefunded   PaymentStatus = "refunded"
+	PaymentStatusReversed   PaymentStatus = "reversed"
+)
+
+// paymentStatusTransitions lists the statuses the payment can move to from
+// each status. Payments in error may have been authorized by the issuer
+// without us getting the response, so they can be reversed. Captured payments
+// can be voided until they are refunded. Declined, voided, refunded and
+// reversed payments are final.
+var paymentStatusTransitions = map[PaymentStatus][]PaymentStatus{
+	PaymentStatusPending:    {PaymentStatusAuthorized, PaymentStatusDeclined, PaymentStatusError},
+	PaymentStatusError:      {PaymentStatusReversed},
+	PaymentStatusAuthorized: {PaymentStatusCaptured, PaymentStatusVoided, PaymentStatusReversed},
+	PaymentStatusCaptured:   {PaymentStatusRefunded, PaymentStatusVoided},
+}
+
+// CanTransitionTo returns true if the payment in status s can move to status
+// to.
+func (s PaymentStatus) CanTransitionTo(to PaymentStatus) bool {
+	for _, status := range paymentStatusTransitions[s] {
+		if status == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PaymentStatusChange records when the payment reached the status.
+type PaymentStatusChange struct {
+	Status    PaymentStatus
+	CreatedAt time.Time
+}
+
+// TransitionTo moves the payment to the given status if the transition is
+// allowed and records the change in the payment's history.
+func (p *Payment) TransitionTo(to PaymentStatus) error {
+	if !p.Status.CanTransitionTo(to) {
+		return fmt.Errorf("%w: from %s to %s", ErrInvalidPaymentStatusTransition, p.Status, to)
+	}
+
+	p.Status = to
+	p.History = append(p.History, PaymentStatusChange{Status: to, CreatedAt: time.Now()})
+
+	return nil
+}
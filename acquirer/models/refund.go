@@ -0,0 +1,53 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrRefundExceedsCapturedAmount = errors.New("refund exceeds captured amount")
+
+// CreateRefund refunds the captured payment. Amount may be less than what is
+// left of the captured amount, so the payment can be refunded several times;
+// zero refunds all of it.
+type CreateRefund struct {
+	Amount int64
+}
+
+type RefundStatus string
+
+const (
+	RefundStatusPending  RefundStatus = "pending"
+	RefundStatusApproved RefundStatus = "approved"
+	RefundStatusDeclined RefundStatus = "declined"
+	RefundStatusError    RefundStatus = "error"
+)
+
+// Refund returns the amount of the captured payment to the cardholder.
+type Refund struct {
+	ID         string
+	PaymentID  string
+	MerchantID string
+	Amount     int64
+	Currency   string
+	Status     RefundStatus
+	CreatedAt  time.Time
+
+	ResponseCode string
+
+	// ResponseDescription is the human-readable description of ResponseCode
+	ResponseDescription string
+
+	// STAN of the refund request
+	STAN string
+
+	// SettlementBatchID is the batch the refund was settled in, empty until
+	// the refund is settled
+	SettlementBatchID string
+}
+
+// Holds returns true if the refund takes (or may take) a part of the captured
+// amount of the payment.
+func (r *Refund) Holds() bool {
+	return r.Status == RefundStatusPending || r.Status == RefundStatusApproved
+}
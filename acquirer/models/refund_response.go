@@ -0,0 +1,5 @@
+package models
+
+type RefundResponse struct {
+	ResponseCode string
+}
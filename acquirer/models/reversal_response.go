@@ -0,0 +1,5 @@
+package models
+
+type ReversalResponse struct {
+	ResponseCode string
+}
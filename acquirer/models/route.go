@@ -0,0 +1,17 @@
+package models
+
+import "github.com/moov-io/ftdc-from-tap-to-auth/internal/bin"
+
+type RouteHealth string
+
+const (
+	RouteHealthUp   RouteHealth = "up"
+	RouteHealthDown RouteHealth = "down"
+)
+
+// RouteStatus is the health of the connection to the issuer of a route.
+type RouteStatus struct {
+	Name      string
+	BINRanges []bin.Range
+	Health    RouteHealth
+}
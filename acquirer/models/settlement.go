@@ -0,0 +1,60 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/clearing"
+)
+
+var (
+	ErrNothingToSettle = errors.New("nothing to settle")
+	ErrAlreadySettled  = errors.New("already settled")
+)
+
+// Fee is charged to the merchant for each settled capture.
+type Fee struct {
+	// BasisPoints of the captured amount, 100 is 1%
+	BasisPoints int64 `yaml:"basis_points"`
+	Fixed       int64 `yaml:"fixed"`
+}
+
+// Calculate returns the fee for the captured amount.
+func (f Fee) Calculate(amount int64) int64 {
+	return f.Fixed + amount*f.BasisPoints/10_000
+}
+
+// Batch is the closed settlement batch of the merchant's captures and refunds
+// in one currency. The records and the totals are the ones written to the
+// batch's clearing file.
+type Batch struct {
+	ID         string
+	MerchantID string
+
+	// AcquirerID is the one the captures and refunds were sent with, the
+	// issuer needs it to find the transactions
+	AcquirerID string
+	Currency   string
+	CreatedAt  time.Time
+	Records    []clearing.Record
+	Totals     clearing.Totals
+}
+
+// Add adds the capture or the refund to the batch.
+func (b *Batch) Add(record clearing.Record) {
+	b.Records = append(b.Records, record)
+	b.Totals.Add(record)
+}
+
+// ClearingFile returns the clearing file of the batch.
+func (b *Batch) ClearingFile() *clearing.File {
+	return &clearing.File{
+		BatchID:    b.ID,
+		MerchantID: b.MerchantID,
+		AcquirerID: b.AcquirerID,
+		Currency:   b.Currency,
+		CreatedAt:  b.CreatedAt,
+		Records:    b.Records,
+		Totals:     b.Totals,
+	}
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrStandInLimitExceeded = errors.New("stand-in limit exceeded")
+
+	// ErrAuthorizationCodeExists is returned when the authorization code was
+	// already given to another payment approved in stand-in.
+	ErrAuthorizationCodeExists = errors.New("authorization code exists")
+)
+
+// StandInLimits cap what we approve for the merchant in stand-in while the
+// issuer is unreachable. Zero limits disable stand-in for the merchant.
+type StandInLimits struct {
+	// MaxAmount of a single payment
+	MaxAmount int64 `yaml:"max_amount"`
+
+	// MaxTotalAmount of the merchant's payments approved in stand-in that
+	// the issuer wasn't advised of yet
+	MaxTotalAmount int64 `yaml:"max_total_amount"`
+}
+
+// Allows returns true if a payment of amount can be approved in stand-in when
+// the merchant already has pending advices for pendingAmount.
+func (l StandInLimits) Allows(amount, pendingAmount int64) bool {
+	return amount > 0 && amount <= l.MaxAmount && pendingAmount+amount <= l.MaxTotalAmount
+}
+
+type AdviceStatus string
+
+const (
+	// AdviceStatusPending advices are waiting for the issuer to come back
+	AdviceStatusPending AdviceStatus = "pending"
+
+	// AdviceStatusAccepted advices were applied by the issuer
+	AdviceStatusAccepted AdviceStatus = "accepted"
+
+	// AdviceStatusRejected advices were declined by the issuer, their
+	// payments are not held on the card's account
+	AdviceStatusRejected AdviceStatus = "rejected"
+)
+
+// StandInAdvice is the advice (0120) of the payment we approved in stand-in.
+// It's queued until the issuer can be reached again. The card details are
+// kept only until the advice is forwarded, the CVV is never kept.
+type StandInAdvice struct {
+	PaymentID  string
+	MerchantID string
+	Amount     int64
+
+	// AuthorizationCode the payment was approved with, it's unique among
+	// the advices
+	AuthorizationCode string
+
+	Card       Card
+	EMVPayload []byte
+
+	Status       AdviceStatus
+	ResponseCode string
+	CreatedAt    time.Time
+	ForwardedAt  time.Time
+}
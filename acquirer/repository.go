@@ -1,143 +1,124 @@
 package acquirer
 
 import (
-	"encoding/json"
 	"fmt"
-	"os"
-	"sync"
+	"time"
 
 	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer/models"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/storage"
 )
 
 var ErrNotFound = fmt.Errorf("not found")
 
-type persistedData struct {
-	Merchants map[string]*models.Merchant `json:"merchants"`
-	Payments  map[string]*models.Payment  `json:"payments"`
+// Repository stores the merchants and the payments of the acquirer. Returned
+// values are copies; changes to them are saved with the update methods.
+type Repository interface {
+	CreateMerchant(merchant *models.Merchant) error
+	GetMerchant(merchantID string) (*models.Merchant, error)
+	GetMerchants() ([]*models.Merchant, error)
+
+	CreatePayment(payment *models.Payment) error
+
+	// UpdatePayment saves the changes of the payment. The refunded amount
+	// and the settlement batch are kept, they are saved with the refunds
+	// and the batches.
+	UpdatePayment(payment *models.Payment) error
+	GetPayment(merchantID, paymentID string) (*models.Payment, error)
+	GetPayments(merchantID string) ([]*models.Payment, error)
+
+	// CreateRefund saves the pending refund. The refund is rejected with
+	// models.ErrRefundExceedsCapturedAmount if together with the pending and
+	// approved refunds of the payment it exceeds the captured amount.
+	CreateRefund(refund *models.Refund) error
+
+	// UpdateRefund saves the refund and sets the refunded amount of its
+	// payment to the sum of the payment's approved refunds.
+	UpdateRefund(refund *models.Refund) error
+	GetRefunds(merchantID, paymentID string) ([]*models.Refund, error)
+
+	// GetUnsettled returns the merchant's captured payments and approved
+	// refunds that are not settled yet.
+	GetUnsettled(merchantID string) ([]*models.Payment, []*models.Refund, error)
+
+	// CreateBatch saves the batch and marks its payments and refunds as
+	// settled in it. The batch is rejected with models.ErrAlreadySettled if
+	// any of them was settled, or is not captured or approved anymore.
+	CreateBatch(batch *models.Batch) error
+	GetBatch(merchantID, batchID string) (*models.Batch, error)
+	GetBatches(merchantID string) ([]*models.Batch, error)
+
+	// CreateIdempotentRequest saves the request made with the idempotency
+	// key. The request is rejected with models.ErrIdempotencyKeyExists if the
+	// merchant already used the key.
+	CreateIdempotentRequest(request *models.IdempotentRequest) error
+	GetIdempotentRequest(merchantID, key string) (*models.IdempotentRequest, error)
+
+	// UpdateIdempotentRequest saves the response of the request.
+	UpdateIdempotentRequest(request *models.IdempotentRequest) error
+
+	// ReclaimIdempotentRequest replaces the request with the key that was
+	// not completed and was created at claimedAt. It returns ErrNotFound if
+	// the request was completed or reclaimed in the meantime.
+	ReclaimIdempotentRequest(request *models.IdempotentRequest, claimedAt time.Time) error
+
+	// DeleteIdempotentRequest deletes the request with the key, so the key
+	// can be used again.
+	DeleteIdempotentRequest(merchantID, key string) error
+
+	// CreateStandInAdvice saves the advice of the payment approved in
+	// stand-in together with the payment. The advice is rejected with
+	// models.ErrAuthorizationCodeExists if another advice has its
+	// authorization code.
+	CreateStandInAdvice(advice *models.StandInAdvice, payment *models.Payment) error
+	GetStandInAdvice(paymentID string) (*models.StandInAdvice, error)
+
+	// GetPendingStandInAdvices returns the advices of all merchants the
+	// issuer wasn't advised of yet, the oldest first.
+	GetPendingStandInAdvices() ([]*models.StandInAdvice, error)
+	UpdateStandInAdvice(advice *models.StandInAdvice) error
+
+	// GetLastSTAN returns the STAN of the last request sent to the issuer,
+	// zero if nothing was sent yet.
+	GetLastSTAN() (int, error)
+	SaveLastSTAN(stan int) error
+
+	Close() error
 }
 
-type Repository struct {
-	mu sync.RWMutex
-
-	merchants map[string]*models.Merchant
-	payments  map[string]*models.Payment
-}
-
-func NewRepository() *Repository {
-	return &Repository{
-		merchants: make(map[string]*models.Merchant),
-		payments:  make(map[string]*models.Payment),
-	}
-}
-
-func (r *Repository) CreateMerchant(merchant *models.Merchant) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	r.merchants[merchant.ID] = merchant
-
-	return nil
-}
-
-func (r *Repository) GetMerchant(merchantID string) (*models.Merchant, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	merchant, ok := r.merchants[merchantID]
-	if !ok {
-		return nil, ErrNotFound
-	}
-
-	return merchant, nil
-}
-
-func (r *Repository) CreatePayment(payment *models.Payment) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	r.payments[payment.ID] = payment
-
-	return nil
-}
-
-func (r *Repository) GetPayment(merchantID, paymentID string) (*models.Payment, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	payment, ok := r.payments[paymentID]
-	if !ok {
-		return nil, ErrNotFound
-	}
-
-	if payment.MerchantID != merchantID {
-		return nil, ErrNotFound
-	}
-
-	return payment, nil
-}
-
-func (r *Repository) GetPayments(merchantID string) ([]*models.Payment, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+// default files of the memory and the sqlite backends
+const (
+	defaultDataFile     = "db/acquirer_data.json"
+	defaultDatabaseFile = "db/acquirer.db"
+)
 
-	var payments []*models.Payment
-	for _, payment := range r.payments {
-		if payment.MerchantID == merchantID {
-			payments = append(payments, payment)
+// OpenRepository opens the repository with the configured backend.
+func OpenRepository(config storage.Config) (Repository, error) {
+	switch config.Backend {
+	case "", storage.BackendMemory:
+		path := config.Path
+		if path == "" {
+			path = defaultDataFile
 		}
-	}
-
-	return payments, nil
-}
-
-const filename = "db/acquirer_data.json"
-
-func (r *Repository) SaveToFile() error {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	data := persistedData{
-		Merchants: r.merchants,
-		Payments:  r.payments,
-	}
 
-	jsonData, err := json.MarshalIndent(data, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	return os.WriteFile(filename, jsonData, 0644)
-}
-
-func (r *Repository) LoadFromFile() error {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil // File doesn't exist yet, that's okay
+		repo := NewMemoryRepository()
+		if err := repo.LoadFromFile(path); err != nil {
+			return nil, fmt.Errorf("loading repository from file: %w", err)
 		}
-		return err
-	}
 
-	var persisted persistedData
-	if err := json.Unmarshal(data, &persisted); err != nil {
-		return err
-	}
-
-	r.mu.Lock()
-	defer r.mu.Unlock()
+		return repo, nil
+	case storage.BackendSQLite:
+		path := config.Path
+		if path == "" {
+			path = defaultDatabaseFile
+		}
 
-	// Initialize maps if they're nil
-	if persisted.Merchants != nil {
-		r.merchants = persisted.Merchants
-	} else {
-		r.merchants = make(map[string]*models.Merchant)
-	}
+		repo, err := NewSQLiteRepository(path)
+		if err != nil {
+			return nil, fmt.Errorf("opening sqlite repository: %w", err)
+		}
 
-	if persisted.Payments != nil {
-		r.payments = persisted.Payments
-	} else {
-		r.payments = make(map[string]*models.Payment)
+		return repo, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", config.Backend)
 	}
-
-	return nil
 }
@@ -0,0 +1,79 @@
+package acquirer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer/models"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/bin"
+)
+
+// ErrNoRoute is returned when no issuer serves the card number.
+var ErrNoRoute = errors.New("no route to issuer")
+
+// Route is an issuer and the BIN ranges of the cards it issued. A route
+// without BIN ranges is the default route of the cards no other route
+// serves.
+type Route struct {
+	Name      string
+	BINRanges []bin.Range
+	Client    ISO8583Client
+}
+
+// Router picks the issuer the payment is sent to by the BIN of the card.
+type Router struct {
+	routes []*Route
+}
+
+func NewRouter(routes ...*Route) *Router {
+	return &Router{routes: routes}
+}
+
+// Route returns the route of the card number. When ranges of several routes
+// contain it, the most specific range wins, so a route can take over a part
+// of the range of another one.
+func (r *Router) Route(pan string) (*Route, error) {
+	found, ok := bin.MostSpecific(pan, r.routes, func(route *Route) []bin.Range {
+		return route.BINRanges
+	})
+	if !ok {
+		return nil, fmt.Errorf("%w: card %s", ErrNoRoute, bin.MaskPAN(pan))
+	}
+
+	return found, nil
+}
+
+// RouteByName returns the route with the name.
+func (r *Router) RouteByName(name string) (*Route, error) {
+	for _, route := range r.routes {
+		if route.Name == name {
+			return route, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: route %q", ErrNoRoute, name)
+}
+
+// Routes returns the routes in the order they were added.
+func (r *Router) Routes() []*Route {
+	return r.routes
+}
+
+// Status returns the health of the connections to the issuers of the routes.
+func (r *Router) Status() []models.RouteStatus {
+	statuses := make([]models.RouteStatus, 0, len(r.routes))
+	for _, route := range r.routes {
+		health := models.RouteHealthDown
+		if route.Client.Connected() {
+			health = models.RouteHealthUp
+		}
+
+		statuses = append(statuses, models.RouteStatus{
+			Name:      route.Name,
+			BINRanges: route.BINRanges,
+			Health:    health,
+		})
+	}
+
+	return statuses
+}
@@ -1,30 +1,58 @@
 package acquirer
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/moov-io/bertlv"
+	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer/iso8583"
 	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer/models"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/responsecode"
+)
+
+var (
+	ErrInvalidPaymentStatus = errors.New("invalid payment status")
+	ErrInvalidAmount        = errors.New("invalid amount")
+	ErrDeclined             = errors.New("declined by issuer")
 )
 
 type Service struct {
-	logger        *slog.Logger
-	repo          *Repository
-	iso8583Client ISO8583Client
+	logger  *slog.Logger
+	repo    Repository
+	router  *Router
+	standIn StandInConfig
+
+	// standInMu makes the check of the stand-in limits and the saving of
+	// the advice atomic, forwardMu keeps the advices from being forwarded
+	// twice
+	standInMu sync.Mutex
+	forwardMu sync.Mutex
 }
 
 type ISO8583Client interface {
 	AuthorizePayment(payment *models.Payment, card models.CreatePayment, merchant models.Merchant) (models.AuthorizationResponse, error)
+	IncrementAuthorization(payment *models.Payment, amount int64) (models.AuthorizationResponse, error)
+	CapturePayment(payment *models.Payment, amount int64) (models.CaptureResponse, error)
+	CompletePayment(payment *models.Payment, amount int64) (models.CaptureResponse, error)
+	ReversePayment(payment *models.Payment) (models.ReversalResponse, error)
+	RefundPayment(payment *models.Payment, refund *models.Refund) (models.RefundResponse, error)
+	SendAdvice(payment *models.Payment, advice *models.StandInAdvice, merchant models.Merchant) (models.AdviceResponse, error)
+
+	// Connected returns true while we are connected to the issuer
+	Connected() bool
 }
 
-func NewService(logger *slog.Logger, repo *Repository, iso8583Client ISO8583Client) *Service {
+func NewService(logger *slog.Logger, repo Repository, router *Router, standIn StandInConfig) *Service {
 	return &Service{
-		logger:        logger,
-		repo:          repo,
-		iso8583Client: iso8583Client,
+		logger:  logger,
+		repo:    repo,
+		router:  router,
+		standIn: standIn,
 	}
 }
 
@@ -54,15 +82,23 @@ type card struct {
 }
 
 func (a *Service) CreatePayment(merchantID string, create models.CreatePayment) (*models.Payment, error) {
+	now := time.Now()
 	payment := &models.Payment{
 		ID:         uuid.New().String(),
 		MerchantID: merchantID,
 		Amount:     create.Amount,
 		Currency:   create.Currency,
 		Status:     models.PaymentStatusPending,
-		CreatedAt:  time.Now(),
+		CreatedAt:  now,
+
+		RequestedAmount: create.Amount,
+		History: []models.PaymentStatusChange{
+			{Status: models.PaymentStatusPending, CreatedAt: now},
+		},
 	}
 
+	var pan string
+
 	// if we have emv payload, we will use it to extract card details
 	if len(create.EMVPayload) != 0 {
 		emvTags, err := bertlv.Decode(create.EMVPayload)
@@ -85,6 +121,7 @@ func (a *Service) CreatePayment(merchantID string, create models.CreatePayment)
 			slog.String("application label", c.ApplicationLabel),
 		)
 
+		pan = c.PAN
 		payment.Card = models.SafeCard{
 			First6:         c.PAN[:6],
 			Last4:          c.PAN[len(c.PAN)-4:],
@@ -92,6 +129,7 @@ func (a *Service) CreatePayment(merchantID string, create models.CreatePayment)
 		}
 	} else {
 		// then it's e-commerce payment
+		pan = create.Card.Number
 		payment.Card = models.SafeCard{
 			First6:         create.Card.Number[:6],
 			Last4:          create.Card.Number[len(create.Card.Number)-4:],
@@ -99,35 +137,512 @@ func (a *Service) CreatePayment(merchantID string, create models.CreatePayment)
 		}
 	}
 
+	route, routeErr := a.router.Route(pan)
+	if routeErr == nil {
+		payment.Route = route.Name
+	}
+
 	err := a.repo.CreatePayment(payment)
 	if err != nil {
 		return nil, fmt.Errorf("creating payment: %w", err)
 	}
 
+	// no issuer serves the card, so there is no one to ask
+	if routeErr != nil {
+		a.logger.Warn("payment declined", slog.String("payment_id", payment.ID), slog.String("error", routeErr.Error()))
+
+		payment.ResponseCode = responsecode.NoSuchIssuer
+		payment.ResponseDescription = responsecode.GetInfo(responsecode.NoSuchIssuer).Description
+
+		if err := a.updateStatus(payment, models.PaymentStatusDeclined); err != nil {
+			return nil, err
+		}
+
+		return payment, nil
+	}
+
 	merchant, err := a.repo.GetMerchant(merchantID)
 	if err != nil {
 		return nil, fmt.Errorf("getting merchant: %w", err)
 	}
 
-	response, err := a.iso8583Client.AuthorizePayment(payment, create, *merchant)
+	response, err := route.Client.AuthorizePayment(payment, create, *merchant)
+	if errors.Is(err, iso8583.ErrIssuerUnavailable) && a.standIn.Enabled {
+		approved, standInErr := a.authorizeInStandIn(payment, create)
+		if standInErr != nil {
+			return nil, fmt.Errorf("authorizing payment in stand-in: %w", standInErr)
+		}
+
+		if approved {
+			return payment, nil
+		}
+	}
+
 	if err != nil {
-		payment.Status = models.PaymentStatusError
-		// update payment details
+		a.failPayment(payment, err)
+
 		return nil, fmt.Errorf("authorizing payment: %w", err)
 	}
 
 	payment.AuthorizationCode = response.AuthorizationCode
-	payment.ResponseCode = response.ApprovalCode
+	payment.ResponseCode = response.ResponseCode
+	payment.ResponseDescription = responsecode.GetInfo(response.ResponseCode).Description
+	payment.IssuerAuthenticationData = response.IssuerAuthenticationData
 
-	if response.ApprovalCode == "00" {
-		payment.Status = models.PaymentStatusAuthorized
-	} else {
-		payment.Status = models.PaymentStatusDeclined
+	// the issuer holds only the approved amount, the merchant collects the
+	// balance due another way
+	if response.ResponseCode == responsecode.PartiallyApproved && response.ApprovedAmount > 0 {
+		payment.Amount = response.ApprovedAmount
+	}
+
+	err = a.updateStatus(payment, models.PaymentStatusFromResponseCode(response.ResponseCode))
+	if err != nil {
+		return nil, err
 	}
 
 	return payment, nil
 }
 
+// idempotentRequestTimeout is how long the first request with an idempotency
+// key holds the key. The request is processed in a few seconds, a request
+// holding the key for longer was lost (e.g. the acquirer crashed), and a
+// retry takes the key over.
+const idempotentRequestTimeout = time.Minute
+
+// BeginIdempotentRequest saves the merchant's request made with the
+// idempotency key. If the key was used before for the same request, the saved
+// request is returned and its response should be replayed. A key used for
+// another request is rejected with models.ErrIdempotencyKeyReused, and while
+// the first request with the key is processed, the retries are rejected with
+// models.ErrIdempotencyInProgress. A retry takes over the key of a request
+// that didn't complete within idempotentRequestTimeout.
+func (a *Service) BeginIdempotentRequest(merchantID, key string, request any) (*models.IdempotentRequest, error) {
+	fingerprint, err := models.Fingerprint(request)
+	if err != nil {
+		return nil, fmt.Errorf("fingerprinting request: %w", err)
+	}
+
+	idempotentRequest := &models.IdempotentRequest{
+		MerchantID:  merchantID,
+		Key:         key,
+		Fingerprint: fingerprint,
+		CreatedAt:   time.Now(),
+	}
+
+	err = a.repo.CreateIdempotentRequest(idempotentRequest)
+	if err == nil {
+		return idempotentRequest, nil
+	}
+
+	if !errors.Is(err, models.ErrIdempotencyKeyExists) {
+		return nil, fmt.Errorf("creating idempotent request: %w", err)
+	}
+
+	saved, err := a.repo.GetIdempotentRequest(merchantID, key)
+	if err != nil {
+		return nil, fmt.Errorf("getting idempotent request: %w", err)
+	}
+
+	if saved.Fingerprint != fingerprint {
+		return nil, models.ErrIdempotencyKeyReused
+	}
+
+	if !saved.Completed() {
+		if time.Since(saved.CreatedAt) < idempotentRequestTimeout {
+			return nil, models.ErrIdempotencyInProgress
+		}
+
+		// only one of the retries gets the key of the lost request
+		err = a.repo.ReclaimIdempotentRequest(idempotentRequest, saved.CreatedAt)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return nil, models.ErrIdempotencyInProgress
+			}
+
+			return nil, fmt.Errorf("reclaiming idempotent request: %w", err)
+		}
+
+		a.logger.Warn("idempotent request was not completed, processing it again",
+			slog.String("merchant_id", merchantID), slog.String("key", key))
+
+		return idempotentRequest, nil
+	}
+
+	a.logger.Info("replaying idempotent request", slog.String("merchant_id", merchantID), slog.String("key", key))
+
+	return saved, nil
+}
+
+// CompleteIdempotentRequest saves the response of the request, so the retries
+// get it. Server errors are not final: the key is deleted instead, so the
+// retries are processed again.
+func (a *Service) CompleteIdempotentRequest(request *models.IdempotentRequest, status int, contentType string, body []byte) error {
+	if status >= http.StatusInternalServerError {
+		if err := a.repo.DeleteIdempotentRequest(request.MerchantID, request.Key); err != nil {
+			return fmt.Errorf("deleting idempotent request: %w", err)
+		}
+
+		return nil
+	}
+
+	request.ResponseStatus = status
+	request.ResponseContentType = contentType
+	request.ResponseBody = body
+
+	if err := a.repo.UpdateIdempotentRequest(request); err != nil {
+		return fmt.Errorf("updating idempotent request: %w", err)
+	}
+
+	return nil
+}
+
+// CapturePayment captures the authorized payment in full or in part. The
+// issuer posts the captured amount and releases the rest of the hold.
+func (a *Service) CapturePayment(merchantID, paymentID string, create models.CreateCapture) (*models.Payment, error) {
+	return a.capture(merchantID, paymentID, create.Amount, ISO8583Client.CapturePayment)
+}
+
+// CompletePayment captures the final amount of the authorized payment, e.g.
+// at hotel check-out after the authorization was incremented. Unlike a
+// capture, the completion references the original authorization by its STAN
+// and transmission date & time.
+func (a *Service) CompletePayment(merchantID, paymentID string, create models.CreateCompletion) (*models.Payment, error) {
+	return a.capture(merchantID, paymentID, create.Amount, ISO8583Client.CompletePayment)
+}
+
+// capture sends the capture of the amount of the authorized payment with send
+// to the payment's issuer and moves the payment to captured when the issuer
+// approves it.
+func (a *Service) capture(merchantID, paymentID string, amount int64, send func(ISO8583Client, *models.Payment, int64) (models.CaptureResponse, error)) (*models.Payment, error) {
+	payment, err := a.repo.GetPayment(merchantID, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("getting payment: %w", err)
+	}
+
+	if !payment.Status.CanTransitionTo(models.PaymentStatusCaptured) {
+		return nil, fmt.Errorf("%w: payment is %s", ErrInvalidPaymentStatus, payment.Status)
+	}
+
+	if err := a.checkAdvised(payment); err != nil {
+		return nil, err
+	}
+
+	if amount == 0 {
+		amount = payment.Amount
+	}
+
+	if amount < 0 || amount > payment.Amount {
+		return nil, fmt.Errorf("%w: capture amount %d, authorized amount %d", ErrInvalidAmount, amount, payment.Amount)
+	}
+
+	client, err := a.issuer(payment)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := send(client, payment, amount)
+	if err != nil {
+		return nil, fmt.Errorf("capturing payment: %w", err)
+	}
+
+	if info := responsecode.GetInfo(response.ResponseCode); !info.IsApproved() {
+		return nil, fmt.Errorf("%w: response code %s (%s)", ErrDeclined, info.Code, info.Description)
+	}
+
+	payment.CapturedAmount = amount
+
+	err = a.updateStatus(payment, models.PaymentStatusCaptured)
+	if err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+// IncrementAuthorization increases the authorized amount of the authorized
+// payment, e.g. when a hotel stay is extended. The issuer adds the amount to
+// the hold of the original authorization. A declined increment leaves the
+// payment and its hold as they were.
+func (a *Service) IncrementAuthorization(merchantID, paymentID string, create models.CreateIncrement) (*models.Payment, error) {
+	payment, err := a.repo.GetPayment(merchantID, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("getting payment: %w", err)
+	}
+
+	if payment.Status != models.PaymentStatusAuthorized {
+		return nil, fmt.Errorf("%w: payment is %s", ErrInvalidPaymentStatus, payment.Status)
+	}
+
+	if err := a.checkAdvised(payment); err != nil {
+		return nil, err
+	}
+
+	if create.Amount <= 0 {
+		return nil, fmt.Errorf("%w: increment amount %d", ErrInvalidAmount, create.Amount)
+	}
+
+	client, err := a.issuer(payment)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := client.IncrementAuthorization(payment, create.Amount)
+	if err != nil {
+		return nil, fmt.Errorf("incrementing authorization: %w", err)
+	}
+
+	if info := responsecode.GetInfo(response.ResponseCode); !info.IsApproved() {
+		return nil, fmt.Errorf("%w: response code %s (%s)", ErrDeclined, info.Code, info.Description)
+	}
+
+	payment.Amount += create.Amount
+
+	if err := a.repo.UpdatePayment(payment); err != nil {
+		return nil, fmt.Errorf("updating payment: %w", err)
+	}
+
+	return payment, nil
+}
+
+// VoidPayment cancels the authorized or captured payment before it's
+// settled. The issuer releases the hold or returns the captured amount to the
+// account. Payments with refunds can't be voided.
+func (a *Service) VoidPayment(merchantID, paymentID string) (*models.Payment, error) {
+	payment, err := a.repo.GetPayment(merchantID, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("getting payment: %w", err)
+	}
+
+	if !payment.Status.CanTransitionTo(models.PaymentStatusVoided) {
+		return nil, fmt.Errorf("%w: payment is %s", ErrInvalidPaymentStatus, payment.Status)
+	}
+
+	if payment.SettlementBatchID != "" {
+		return nil, fmt.Errorf("%w: payment is settled", ErrInvalidPaymentStatus)
+	}
+
+	if err := a.checkAdvised(payment); err != nil {
+		return nil, err
+	}
+
+	refunds, err := a.repo.GetRefunds(merchantID, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("getting refunds: %w", err)
+	}
+
+	for _, refund := range refunds {
+		if refund.Holds() {
+			return nil, fmt.Errorf("%w: payment has refunds", ErrInvalidPaymentStatus)
+		}
+	}
+
+	client, err := a.issuer(payment)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := client.ReversePayment(payment)
+	if err != nil {
+		return nil, fmt.Errorf("voiding payment: %w", err)
+	}
+
+	if info := responsecode.GetInfo(response.ResponseCode); !info.IsApproved() {
+		return nil, fmt.Errorf("%w: response code %s (%s)", ErrDeclined, info.Code, info.Description)
+	}
+
+	err = a.updateStatus(payment, models.PaymentStatusVoided)
+	if err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+// RefundPayment refunds the captured payment in full or in part. Every
+// refund is kept as its own record, declined and failed ones included. The
+// payment is refunded when its whole captured amount is refunded.
+func (a *Service) RefundPayment(merchantID, paymentID string, create models.CreateRefund) (*models.Refund, error) {
+	payment, err := a.repo.GetPayment(merchantID, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("getting payment: %w", err)
+	}
+
+	if payment.Status != models.PaymentStatusCaptured {
+		return nil, fmt.Errorf("%w: payment is %s", ErrInvalidPaymentStatus, payment.Status)
+	}
+
+	client, err := a.issuer(payment)
+	if err != nil {
+		return nil, err
+	}
+
+	amount := create.Amount
+	if amount == 0 {
+		amount = payment.CapturedAmount - payment.RefundedAmount
+	}
+
+	if amount <= 0 {
+		return nil, fmt.Errorf("%w: refund amount %d", ErrInvalidAmount, amount)
+	}
+
+	refund := &models.Refund{
+		ID:         uuid.New().String(),
+		PaymentID:  payment.ID,
+		MerchantID: merchantID,
+		Amount:     amount,
+		Currency:   payment.Currency,
+		Status:     models.RefundStatusPending,
+		CreatedAt:  time.Now(),
+	}
+
+	// the repository checks the amount against the other refunds, so
+	// concurrent refunds can't exceed the captured amount
+	err = a.repo.CreateRefund(refund)
+	if err != nil {
+		return nil, fmt.Errorf("creating refund: %w", err)
+	}
+
+	response, err := client.RefundPayment(payment, refund)
+	if err != nil {
+		refund.Status = models.RefundStatusError
+		if updateErr := a.repo.UpdateRefund(refund); updateErr != nil {
+			a.logger.Error("failed to update refund", slog.String("refund_id", refund.ID), slog.String("error", updateErr.Error()))
+		}
+
+		return nil, fmt.Errorf("refunding payment: %w", err)
+	}
+
+	info := responsecode.GetInfo(response.ResponseCode)
+
+	refund.ResponseCode = response.ResponseCode
+	refund.ResponseDescription = info.Description
+	refund.Status = models.RefundStatusApproved
+	if !info.IsApproved() {
+		refund.Status = models.RefundStatusDeclined
+	}
+
+	err = a.repo.UpdateRefund(refund)
+	if err != nil {
+		return nil, fmt.Errorf("updating refund: %w", err)
+	}
+
+	if refund.Status == models.RefundStatusDeclined {
+		return nil, fmt.Errorf("%w: response code %s (%s)", ErrDeclined, info.Code, info.Description)
+	}
+
+	// the refunded amount of the payment is updated with the refund
+	payment, err = a.repo.GetPayment(merchantID, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("getting payment: %w", err)
+	}
+
+	if payment.RefundedAmount == payment.CapturedAmount && payment.Status == models.PaymentStatusCaptured {
+		err = a.updateStatus(payment, models.PaymentStatusRefunded)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return refund, nil
+}
+
+func (a *Service) GetRefunds(merchantID, paymentID string) ([]*models.Refund, error) {
+	refunds, err := a.repo.GetRefunds(merchantID, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("getting refunds: %w", err)
+	}
+
+	return refunds, nil
+}
+
+// issuer returns the client of the issuer the payment was sent to. The
+// payments made before we routed by BIN are routed by their BIN now.
+func (a *Service) issuer(payment *models.Payment) (ISO8583Client, error) {
+	var (
+		route *Route
+		err   error
+	)
+
+	if payment.Route != "" {
+		route, err = a.router.RouteByName(payment.Route)
+	} else {
+		route, err = a.router.Route(payment.Card.First6)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("routing payment: %w", err)
+	}
+
+	return route.Client, nil
+}
+
+// Routes returns the health of the routes to the issuers.
+func (a *Service) Routes() []models.RouteStatus {
+	return a.router.Status()
+}
+
+// updateStatus moves the payment to the status and saves it.
+func (a *Service) updateStatus(payment *models.Payment, status models.PaymentStatus) error {
+	if err := payment.TransitionTo(status); err != nil {
+		return err
+	}
+
+	if err := a.repo.UpdatePayment(payment); err != nil {
+		return fmt.Errorf("updating payment: %w", err)
+	}
+
+	return nil
+}
+
+// failPayment moves the payment that failed to be authorized to error and
+// saves it. The issuer may have authorized the payment without us getting the
+// response, so we reverse it to release the hold.
+func (a *Service) failPayment(payment *models.Payment, authErr error) {
+	logger := a.logger.With(slog.String("payment_id", payment.ID))
+
+	if err := payment.TransitionTo(models.PaymentStatusError); err != nil {
+		logger.Error("failed to move payment to error", slog.String("error", err.Error()))
+		return
+	}
+
+	if errors.Is(authErr, iso8583.ErrNoResponse) {
+		a.reversePayment(payment)
+	}
+
+	if err := a.repo.UpdatePayment(payment); err != nil {
+		logger.Error("failed to update payment", slog.String("error", err.Error()))
+	}
+}
+
+// reversePayment reverses the payment authorization that got no response.
+func (a *Service) reversePayment(payment *models.Payment) {
+	logger := a.logger.With(slog.String("payment_id", payment.ID), slog.String("stan", payment.STAN))
+
+	client, err := a.issuer(payment)
+	if err != nil {
+		logger.Error("failed to reverse payment", slog.String("error", err.Error()))
+		return
+	}
+
+	response, err := client.ReversePayment(payment)
+	if err != nil {
+		logger.Error("failed to reverse payment", slog.String("error", err.Error()))
+		return
+	}
+
+	if !responsecode.GetInfo(response.ResponseCode).IsApproved() {
+		logger.Warn("reversal was not approved", slog.String("response_code", response.ResponseCode))
+		return
+	}
+
+	if err := payment.TransitionTo(models.PaymentStatusReversed); err != nil {
+		logger.Error("failed to move payment to reversed", slog.String("error", err.Error()))
+		return
+	}
+
+	logger.Info("payment reversed")
+}
+
 func (a *Service) GetPayment(merchantID, paymentID string) (*models.Payment, error) {
 	payment, err := a.repo.GetPayment(merchantID, paymentID)
 	if err != nil {
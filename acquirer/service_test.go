@@ -0,0 +1,602 @@
+package acquirer_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer"
+	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer/iso8583"
+	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer/models"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/bin"
+	"github.com/moov-io/ftdc-from-tap-to-auth/log"
+	"github.com/stretchr/testify/require"
+)
+
+// iso8583ClientMock lets tests control the issuer responses
+type iso8583ClientMock struct {
+	authorizeErr          error
+	reversed              []*models.Payment
+	refundResponseCode    string
+	incrementResponseCode string
+	completed             []int64
+	adviceResponseCode    string
+	advised               []models.StandInAdvice
+	authorized            []*models.Payment
+	disconnected          bool
+}
+
+// singleRoute returns the router that sends all payments to the client
+func singleRoute(client acquirer.ISO8583Client) *acquirer.Router {
+	return acquirer.NewRouter(&acquirer.Route{Name: "issuer", Client: client})
+}
+
+func (m *iso8583ClientMock) AuthorizePayment(payment *models.Payment, create models.CreatePayment, merchant models.Merchant) (models.AuthorizationResponse, error) {
+	payment.STAN = "000001"
+	payment.TransmissionDateTime = payment.CreatedAt.UTC().Format(time.RFC3339)
+	m.authorized = append(m.authorized, payment)
+
+	if m.authorizeErr != nil {
+		return models.AuthorizationResponse{}, m.authorizeErr
+	}
+
+	return models.AuthorizationResponse{ResponseCode: "00", AuthorizationCode: "123456"}, nil
+}
+
+func (m *iso8583ClientMock) IncrementAuthorization(payment *models.Payment, amount int64) (models.AuthorizationResponse, error) {
+	if m.incrementResponseCode != "" {
+		return models.AuthorizationResponse{ResponseCode: m.incrementResponseCode}, nil
+	}
+
+	return models.AuthorizationResponse{ResponseCode: "00", AuthorizationCode: payment.AuthorizationCode}, nil
+}
+
+func (m *iso8583ClientMock) CapturePayment(payment *models.Payment, amount int64) (models.CaptureResponse, error) {
+	return models.CaptureResponse{ResponseCode: "00"}, nil
+}
+
+func (m *iso8583ClientMock) CompletePayment(payment *models.Payment, amount int64) (models.CaptureResponse, error) {
+	m.completed = append(m.completed, amount)
+
+	return models.CaptureResponse{ResponseCode: "00"}, nil
+}
+
+func (m *iso8583ClientMock) ReversePayment(payment *models.Payment) (models.ReversalResponse, error) {
+	m.reversed = append(m.reversed, payment)
+
+	return models.ReversalResponse{ResponseCode: "00"}, nil
+}
+
+func (m *iso8583ClientMock) RefundPayment(payment *models.Payment, refund *models.Refund) (models.RefundResponse, error) {
+	refund.STAN = "000002"
+
+	if m.refundResponseCode != "" {
+		return models.RefundResponse{ResponseCode: m.refundResponseCode}, nil
+	}
+
+	return models.RefundResponse{ResponseCode: "00"}, nil
+}
+
+func (m *iso8583ClientMock) SendAdvice(payment *models.Payment, advice *models.StandInAdvice, merchant models.Merchant) (models.AdviceResponse, error) {
+	m.advised = append(m.advised, *advice)
+
+	if m.adviceResponseCode != "" {
+		return models.AdviceResponse{ResponseCode: m.adviceResponseCode}, nil
+	}
+
+	return models.AdviceResponse{ResponseCode: "00"}, nil
+}
+
+func (m *iso8583ClientMock) Connected() bool {
+	return !m.disconnected
+}
+
+func TestCreatePaymentReversesWhenIssuerDoesNotRespond(t *testing.T) {
+	repo := acquirer.NewMemoryRepository()
+	client := &iso8583ClientMock{
+		authorizeErr: fmt.Errorf("sending message: %w", iso8583.ErrNoResponse),
+	}
+	service := acquirer.NewService(log.New(), repo, singleRoute(client), acquirer.StandInConfig{})
+
+	merchant, err := service.CreateMerchant(models.CreateMerchant{Name: "Demo Merchant", MCC: "5411"})
+	require.NoError(t, err)
+
+	_, err = service.CreatePayment(merchant.ID, models.CreatePayment{
+		Amount:   10_00,
+		Currency: "USD",
+		Card: models.Card{
+			Number:         "4242424242424242",
+			ExpirationDate: "1230",
+		},
+	})
+	require.ErrorIs(t, err, iso8583.ErrNoResponse)
+
+	require.Len(t, client.reversed, 1)
+	require.Equal(t, "000001", client.reversed[0].STAN)
+	require.Equal(t, models.PaymentStatusReversed, client.reversed[0].Status)
+
+	// the reversal is saved with the payment history
+	payment, err := repo.GetPayment(merchant.ID, client.reversed[0].ID)
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusReversed, payment.Status)
+	require.Equal(t, []models.PaymentStatus{
+		models.PaymentStatusPending,
+		models.PaymentStatusError,
+		models.PaymentStatusReversed,
+	}, historyStatuses(payment))
+}
+
+func TestPaymentStatusChangesArePersisted(t *testing.T) {
+	repo, err := acquirer.NewSQLiteRepository(filepath.Join(t.TempDir(), "acquirer.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { repo.Close() })
+
+	service := acquirer.NewService(log.New(), repo, singleRoute(&iso8583ClientMock{}), acquirer.StandInConfig{})
+
+	merchant, err := service.CreateMerchant(models.CreateMerchant{Name: "Demo Merchant", MCC: "5411"})
+	require.NoError(t, err)
+
+	payment, err := service.CreatePayment(merchant.ID, models.CreatePayment{
+		Amount:   10_00,
+		Currency: "USD",
+		Card: models.Card{
+			Number:         "4242424242424242",
+			ExpirationDate: "1230",
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = service.CapturePayment(merchant.ID, payment.ID, models.CreateCapture{})
+	require.NoError(t, err)
+
+	// captured payments can't be captured again
+	_, err = service.CapturePayment(merchant.ID, payment.ID, models.CreateCapture{})
+	require.ErrorIs(t, err, acquirer.ErrInvalidPaymentStatus)
+
+	payment, err = repo.GetPayment(merchant.ID, payment.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusCaptured, payment.Status)
+	require.Equal(t, "000001", payment.STAN)
+	require.Equal(t, []models.PaymentStatus{
+		models.PaymentStatusPending,
+		models.PaymentStatusAuthorized,
+		models.PaymentStatusCaptured,
+	}, historyStatuses(payment))
+}
+
+func TestPaymentStatusTransitions(t *testing.T) {
+	payment := &models.Payment{Status: models.PaymentStatusPending}
+
+	require.NoError(t, payment.TransitionTo(models.PaymentStatusDeclined))
+
+	// declined payments are final
+	err := payment.TransitionTo(models.PaymentStatusCaptured)
+	require.ErrorIs(t, err, models.ErrInvalidPaymentStatusTransition)
+	require.Equal(t, models.PaymentStatusDeclined, payment.Status)
+	require.Len(t, payment.History, 1)
+}
+
+func historyStatuses(payment *models.Payment) []models.PaymentStatus {
+	var statuses []models.PaymentStatus
+	for _, change := range payment.History {
+		statuses = append(statuses, change.Status)
+	}
+
+	return statuses
+}
+
+func TestIncrementAndCompletePayment(t *testing.T) {
+	for _, backend := range []string{"memory", "sqlite"} {
+		t.Run(backend, func(t *testing.T) {
+			var repo acquirer.Repository = acquirer.NewMemoryRepository()
+			if backend == "sqlite" {
+				sqliteRepo, err := acquirer.NewSQLiteRepository(filepath.Join(t.TempDir(), "acquirer.db"))
+				require.NoError(t, err)
+				t.Cleanup(func() { sqliteRepo.Close() })
+
+				repo = sqliteRepo
+			}
+
+			client := &iso8583ClientMock{}
+			service := acquirer.NewService(log.New(), repo, singleRoute(client), acquirer.StandInConfig{})
+
+			merchant, err := service.CreateMerchant(models.CreateMerchant{Name: "Demo Hotel", MCC: "7011"})
+			require.NoError(t, err)
+
+			payment, err := service.CreatePayment(merchant.ID, models.CreatePayment{
+				Amount:   100_00,
+				Currency: "USD",
+				Card: models.Card{
+					Number:         "4242424242424242",
+					ExpirationDate: "1230",
+				},
+			})
+			require.NoError(t, err)
+
+			_, err = service.IncrementAuthorization(merchant.ID, payment.ID, models.CreateIncrement{Amount: 0})
+			require.ErrorIs(t, err, acquirer.ErrInvalidAmount)
+
+			payment, err = service.IncrementAuthorization(merchant.ID, payment.ID, models.CreateIncrement{Amount: 50_00})
+			require.NoError(t, err)
+			require.Equal(t, int64(150_00), payment.Amount)
+			require.Equal(t, models.PaymentStatusAuthorized, payment.Status)
+
+			// declined increments leave the authorized amount as it was
+			client.incrementResponseCode = "51"
+			_, err = service.IncrementAuthorization(merchant.ID, payment.ID, models.CreateIncrement{Amount: 1000_00})
+			require.ErrorIs(t, err, acquirer.ErrDeclined)
+
+			_, err = service.CompletePayment(merchant.ID, payment.ID, models.CreateCompletion{Amount: 160_00})
+			require.ErrorIs(t, err, acquirer.ErrInvalidAmount)
+
+			_, err = service.CompletePayment(merchant.ID, payment.ID, models.CreateCompletion{Amount: 120_00})
+			require.NoError(t, err)
+			require.Equal(t, []int64{120_00}, client.completed)
+
+			got, err := service.GetPayment(merchant.ID, payment.ID)
+			require.NoError(t, err)
+			require.Equal(t, models.PaymentStatusCaptured, got.Status)
+			require.Equal(t, int64(150_00), got.Amount)
+			require.Equal(t, int64(120_00), got.CapturedAmount)
+
+			// completed payments can't be incremented
+			client.incrementResponseCode = ""
+			_, err = service.IncrementAuthorization(merchant.ID, payment.ID, models.CreateIncrement{Amount: 10_00})
+			require.ErrorIs(t, err, acquirer.ErrInvalidPaymentStatus)
+		})
+	}
+}
+
+func TestRefundPayment(t *testing.T) {
+	for _, backend := range []string{"memory", "sqlite"} {
+		t.Run(backend, func(t *testing.T) {
+			var repo acquirer.Repository = acquirer.NewMemoryRepository()
+			if backend == "sqlite" {
+				sqliteRepo, err := acquirer.NewSQLiteRepository(filepath.Join(t.TempDir(), "acquirer.db"))
+				require.NoError(t, err)
+				t.Cleanup(func() { sqliteRepo.Close() })
+
+				repo = sqliteRepo
+			}
+
+			client := &iso8583ClientMock{}
+			service := acquirer.NewService(log.New(), repo, singleRoute(client), acquirer.StandInConfig{})
+
+			merchant, err := service.CreateMerchant(models.CreateMerchant{Name: "Demo Merchant", MCC: "5411"})
+			require.NoError(t, err)
+
+			payment, err := service.CreatePayment(merchant.ID, models.CreatePayment{
+				Amount:   10_00,
+				Currency: "USD",
+				Card: models.Card{
+					Number:         "4242424242424242",
+					ExpirationDate: "1230",
+				},
+			})
+			require.NoError(t, err)
+
+			// authorized payments can't be refunded
+			_, err = service.RefundPayment(merchant.ID, payment.ID, models.CreateRefund{Amount: 4_00})
+			require.ErrorIs(t, err, acquirer.ErrInvalidPaymentStatus)
+
+			_, err = service.CapturePayment(merchant.ID, payment.ID, models.CreateCapture{})
+			require.NoError(t, err)
+
+			refund, err := service.RefundPayment(merchant.ID, payment.ID, models.CreateRefund{Amount: 4_00})
+			require.NoError(t, err)
+			require.Equal(t, models.RefundStatusApproved, refund.Status)
+			require.Equal(t, "000002", refund.STAN)
+
+			_, err = service.RefundPayment(merchant.ID, payment.ID, models.CreateRefund{Amount: 7_00})
+			require.ErrorIs(t, err, models.ErrRefundExceedsCapturedAmount)
+
+			// declined refunds are kept, but don't count
+			client.refundResponseCode = "05"
+			_, err = service.RefundPayment(merchant.ID, payment.ID, models.CreateRefund{Amount: 6_00})
+			require.ErrorIs(t, err, acquirer.ErrDeclined)
+
+			got, err := service.GetPayment(merchant.ID, payment.ID)
+			require.NoError(t, err)
+			require.Equal(t, models.PaymentStatusCaptured, got.Status)
+			require.Equal(t, int64(4_00), got.RefundedAmount)
+
+			// refunded payments can't be voided
+			_, err = service.VoidPayment(merchant.ID, payment.ID)
+			require.ErrorIs(t, err, acquirer.ErrInvalidPaymentStatus)
+
+			// the rest of the captured amount is refunded
+			client.refundResponseCode = ""
+			refund, err = service.RefundPayment(merchant.ID, payment.ID, models.CreateRefund{})
+			require.NoError(t, err)
+			require.Equal(t, int64(6_00), refund.Amount)
+
+			got, err = service.GetPayment(merchant.ID, payment.ID)
+			require.NoError(t, err)
+			require.Equal(t, models.PaymentStatusRefunded, got.Status)
+			require.Equal(t, int64(10_00), got.RefundedAmount)
+
+			refunds, err := service.GetRefunds(merchant.ID, payment.ID)
+			require.NoError(t, err)
+			require.Len(t, refunds, 3)
+			require.Equal(t, models.RefundStatusDeclined, refunds[1].Status)
+		})
+	}
+}
+
+func TestIdempotentRequest(t *testing.T) {
+	for _, backend := range []string{"memory", "sqlite"} {
+		t.Run(backend, func(t *testing.T) {
+			var repo acquirer.Repository = acquirer.NewMemoryRepository()
+			if backend == "sqlite" {
+				sqliteRepo, err := acquirer.NewSQLiteRepository(filepath.Join(t.TempDir(), "acquirer.db"))
+				require.NoError(t, err)
+				t.Cleanup(func() { sqliteRepo.Close() })
+
+				repo = sqliteRepo
+			}
+
+			service := acquirer.NewService(log.New(), repo, singleRoute(&iso8583ClientMock{}), acquirer.StandInConfig{})
+
+			create := models.CreatePayment{Amount: 10_00, Currency: "USD"}
+
+			request, err := service.BeginIdempotentRequest("merchant-1", "key-1", create)
+			require.NoError(t, err)
+			require.False(t, request.Completed())
+
+			// the retry comes while the first request is processed
+			_, err = service.BeginIdempotentRequest("merchant-1", "key-1", create)
+			require.ErrorIs(t, err, models.ErrIdempotencyInProgress)
+
+			err = service.CompleteIdempotentRequest(request, 201, "application/json", []byte(`{"ID":"payment-1"}`))
+			require.NoError(t, err)
+
+			// the retry gets the saved response
+			replayed, err := service.BeginIdempotentRequest("merchant-1", "key-1", create)
+			require.NoError(t, err)
+			require.True(t, replayed.Completed())
+			require.Equal(t, 201, replayed.ResponseStatus)
+			require.Equal(t, "application/json", replayed.ResponseContentType)
+			require.Equal(t, []byte(`{"ID":"payment-1"}`), replayed.ResponseBody)
+
+			// the key can't be used for another request
+			_, err = service.BeginIdempotentRequest("merchant-1", "key-1", models.CreatePayment{Amount: 20_00, Currency: "USD"})
+			require.ErrorIs(t, err, models.ErrIdempotencyKeyReused)
+
+			// keys are scoped to the merchant
+			request, err = service.BeginIdempotentRequest("merchant-2", "key-1", create)
+			require.NoError(t, err)
+			require.False(t, request.Completed())
+
+			// server errors are not saved, the retry is processed again
+			request, err = service.BeginIdempotentRequest("merchant-1", "key-2", create)
+			require.NoError(t, err)
+
+			err = service.CompleteIdempotentRequest(request, 500, "text/plain", []byte("issuer unavailable"))
+			require.NoError(t, err)
+
+			request, err = service.BeginIdempotentRequest("merchant-1", "key-2", create)
+			require.NoError(t, err)
+			require.False(t, request.Completed())
+
+			// the retry takes over the key of a request that was lost
+			fingerprint, err := models.Fingerprint(create)
+			require.NoError(t, err)
+
+			err = repo.CreateIdempotentRequest(&models.IdempotentRequest{
+				MerchantID:  "merchant-1",
+				Key:         "key-3",
+				Fingerprint: fingerprint,
+				CreatedAt:   time.Now().Add(-2 * time.Minute),
+			})
+			require.NoError(t, err)
+
+			request, err = service.BeginIdempotentRequest("merchant-1", "key-3", create)
+			require.NoError(t, err)
+			require.False(t, request.Completed())
+
+			_, err = service.BeginIdempotentRequest("merchant-1", "key-3", create)
+			require.ErrorIs(t, err, models.ErrIdempotencyInProgress)
+		})
+	}
+}
+
+func TestStandIn(t *testing.T) {
+	for _, backend := range []string{"memory", "sqlite"} {
+		t.Run(backend, func(t *testing.T) {
+			var repo acquirer.Repository = acquirer.NewMemoryRepository()
+			if backend == "sqlite" {
+				sqliteRepo, err := acquirer.NewSQLiteRepository(filepath.Join(t.TempDir(), "acquirer.db"))
+				require.NoError(t, err)
+				t.Cleanup(func() { sqliteRepo.Close() })
+
+				repo = sqliteRepo
+			}
+
+			client := &iso8583ClientMock{
+				authorizeErr: fmt.Errorf("sending message: %w", iso8583.ErrIssuerUnavailable),
+			}
+			service := acquirer.NewService(log.New(), repo, singleRoute(client), acquirer.StandInConfig{
+				Enabled: true,
+				Limits:  models.StandInLimits{MaxAmount: 20_00, MaxTotalAmount: 30_00},
+			})
+
+			merchant, err := service.CreateMerchant(models.CreateMerchant{Name: "Demo Merchant", MCC: "5411"})
+			require.NoError(t, err)
+
+			create := func(amount int64) (*models.Payment, error) {
+				return service.CreatePayment(merchant.ID, models.CreatePayment{
+					Amount:   amount,
+					Currency: "USD",
+					Card: models.Card{
+						Number:                "4242424242424242",
+						ExpirationDate:        "1230",
+						CardVerificationValue: "123",
+					},
+				})
+			}
+
+			payment, err := create(15_00)
+			require.NoError(t, err)
+			require.Equal(t, models.PaymentStatusAuthorized, payment.Status)
+			require.True(t, payment.StandIn)
+			require.Equal(t, "00", payment.ResponseCode)
+			require.Regexp(t, `^S[0-9A-Z]{5}$`, payment.AuthorizationCode)
+
+			// over the limit of a single payment
+			_, err = create(25_00)
+			require.ErrorIs(t, err, iso8583.ErrIssuerUnavailable)
+
+			// over the total of the pending advices
+			_, err = create(20_00)
+			require.ErrorIs(t, err, iso8583.ErrIssuerUnavailable)
+
+			// the issuer doesn't know the payment until it's advised of it
+			_, err = service.CapturePayment(merchant.ID, payment.ID, models.CreateCapture{})
+			require.ErrorIs(t, err, acquirer.ErrInvalidPaymentStatus)
+
+			require.NoError(t, service.ForwardStandInAdvices())
+
+			require.Len(t, client.advised, 1)
+			require.Equal(t, payment.ID, client.advised[0].PaymentID)
+			require.Equal(t, "4242424242424242", client.advised[0].Card.Number)
+			require.Empty(t, client.advised[0].Card.CardVerificationValue)
+
+			// the card details are not kept after the advice is forwarded
+			advice, err := repo.GetStandInAdvice(payment.ID)
+			require.NoError(t, err)
+			require.Equal(t, models.AdviceStatusAccepted, advice.Status)
+			require.Empty(t, advice.Card.Number)
+
+			// forwarded advices are sent only once
+			require.NoError(t, service.ForwardStandInAdvices())
+			require.Len(t, client.advised, 1)
+
+			_, err = service.CapturePayment(merchant.ID, payment.ID, models.CreateCapture{})
+			require.NoError(t, err)
+
+			// the advised payment doesn't count towards the total anymore
+			payment, err = create(20_00)
+			require.NoError(t, err)
+			require.True(t, payment.StandIn)
+
+			client.adviceResponseCode = "14"
+			require.NoError(t, service.ForwardStandInAdvices())
+
+			advice, err = repo.GetStandInAdvice(payment.ID)
+			require.NoError(t, err)
+			require.Equal(t, models.AdviceStatusRejected, advice.Status)
+			require.Equal(t, "14", advice.ResponseCode)
+			require.Equal(t, payment.AuthorizationCode, advice.AuthorizationCode)
+
+			// the authorization code is not given to another payment
+			other := &models.Payment{ID: "other-payment", MerchantID: merchant.ID, Amount: 10_00, Currency: "USD",
+				Status: models.PaymentStatusPending, CreatedAt: time.Now()}
+			require.NoError(t, repo.CreatePayment(other))
+
+			other.StandIn = true
+			other.AuthorizationCode = payment.AuthorizationCode
+			err = repo.CreateStandInAdvice(&models.StandInAdvice{
+				PaymentID:         other.ID,
+				MerchantID:        merchant.ID,
+				Amount:            other.Amount,
+				AuthorizationCode: other.AuthorizationCode,
+				Status:            models.AdviceStatusPending,
+				CreatedAt:         time.Now(),
+			}, other)
+			require.ErrorIs(t, err, models.ErrAuthorizationCodeExists)
+
+			other, err = repo.GetPayment(merchant.ID, other.ID)
+			require.NoError(t, err)
+			require.False(t, other.StandIn)
+			require.Empty(t, other.AuthorizationCode)
+		})
+	}
+}
+
+func TestRouting(t *testing.T) {
+	visa := &iso8583ClientMock{}
+	demo := &iso8583ClientMock{}
+
+	router := acquirer.NewRouter(
+		&acquirer.Route{
+			Name:      "visa",
+			BINRanges: []bin.Range{{Start: "400000", End: "499999"}},
+			Client:    visa,
+		},
+		&acquirer.Route{
+			Name:      "demo",
+			BINRanges: []bin.Range{{Start: "424242"}},
+			Client:    demo,
+		},
+	)
+
+	repo := acquirer.NewMemoryRepository()
+	service := acquirer.NewService(log.New(), repo, router, acquirer.StandInConfig{
+		Enabled: true,
+		Limits:  models.StandInLimits{MaxAmount: 20_00, MaxTotalAmount: 20_00},
+	})
+
+	merchant, err := service.CreateMerchant(models.CreateMerchant{Name: "Demo Merchant", MCC: "5411"})
+	require.NoError(t, err)
+
+	create := func(number string) (*models.Payment, error) {
+		return service.CreatePayment(merchant.ID, models.CreatePayment{
+			Amount:   10_00,
+			Currency: "USD",
+			Card:     models.Card{Number: number, ExpirationDate: "1230"},
+		})
+	}
+
+	t.Run("the most specific bin range wins", func(t *testing.T) {
+		payment, err := create("4242424242424242")
+		require.NoError(t, err)
+		require.Equal(t, "demo", payment.Route)
+		require.Len(t, demo.authorized, 1)
+
+		payment, err = create("4111111111111111")
+		require.NoError(t, err)
+		require.Equal(t, "visa", payment.Route)
+		require.Len(t, visa.authorized, 1)
+
+		// the follow-ups go to the issuer that authorized the payment
+		_, err = service.VoidPayment(merchant.ID, payment.ID)
+		require.NoError(t, err)
+		require.Len(t, visa.reversed, 1)
+		require.Empty(t, demo.reversed)
+	})
+
+	t.Run("unroutable card is declined", func(t *testing.T) {
+		payment, err := create("5555555555554444")
+		require.NoError(t, err)
+		require.Equal(t, models.PaymentStatusDeclined, payment.Status)
+		require.Equal(t, "15", payment.ResponseCode)
+		require.Empty(t, payment.Route)
+
+		require.Len(t, visa.authorized, 1)
+		require.Len(t, demo.authorized, 1)
+	})
+
+	t.Run("each route has its own health", func(t *testing.T) {
+		demo.disconnected = true
+		demo.authorizeErr = fmt.Errorf("sending message: %w", iso8583.ErrIssuerUnavailable)
+
+		require.Equal(t, []models.RouteStatus{
+			{Name: "visa", BINRanges: []bin.Range{{Start: "400000", End: "499999"}}, Health: models.RouteHealthUp},
+			{Name: "demo", BINRanges: []bin.Range{{Start: "424242"}}, Health: models.RouteHealthDown},
+		}, service.Routes())
+
+		payment, err := create("4242424242424242")
+		require.NoError(t, err)
+		require.True(t, payment.StandIn)
+
+		// the advice waits until we connect to its issuer again
+		require.NoError(t, service.ForwardStandInAdvices())
+		require.Empty(t, demo.advised)
+
+		demo.disconnected = false
+		require.NoError(t, service.ForwardStandInAdvices())
+		require.Len(t, demo.advised, 1)
+		require.Empty(t, visa.advised)
+	})
+}
@@ -0,0 +1,183 @@
+package acquirer
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer/models"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/clearing"
+)
+
+// SettlementService closes the settlement batches of the merchants and
+// writes their clearing files for the issuer.
+type SettlementService struct {
+	logger     *slog.Logger
+	repo       Repository
+	acquirerID string
+	config     SettlementConfig
+}
+
+func NewSettlementService(logger *slog.Logger, repo Repository, acquirerID string, config SettlementConfig) *SettlementService {
+	return &SettlementService{
+		logger:     logger,
+		repo:       repo,
+		acquirerID: acquirerID,
+		config:     config,
+	}
+}
+
+// CloseBatches closes a batch for each currency of the merchant's unsettled
+// captures and refunds. The captures are charged the configured fee. The
+// clearing file of each batch is written to the clearing directory.
+func (s *SettlementService) CloseBatches(merchantID string) ([]*models.Batch, error) {
+	if _, err := s.repo.GetMerchant(merchantID); err != nil {
+		return nil, fmt.Errorf("getting merchant: %w", err)
+	}
+
+	payments, refunds, err := s.repo.GetUnsettled(merchantID)
+	if err != nil {
+		return nil, fmt.Errorf("getting unsettled payments: %w", err)
+	}
+
+	if len(payments) == 0 && len(refunds) == 0 {
+		return nil, models.ErrNothingToSettle
+	}
+
+	now := time.Now()
+	batches := make(map[string]*models.Batch)
+	var closed []*models.Batch
+
+	batchFor := func(currency string) *models.Batch {
+		batch, ok := batches[currency]
+		if !ok {
+			batch = &models.Batch{
+				ID:         uuid.New().String(),
+				MerchantID: merchantID,
+				AcquirerID: s.acquirerID,
+				Currency:   currency,
+				CreatedAt:  now,
+			}
+			batches[currency] = batch
+			closed = append(closed, batch)
+		}
+
+		return batch
+	}
+
+	for _, payment := range payments {
+		batchFor(payment.Currency).Add(clearing.Record{
+			Type:                 clearing.RecordTypeCapture,
+			PaymentID:            payment.ID,
+			STAN:                 payment.STAN,
+			TransmissionDateTime: payment.TransmissionDateTime,
+			AuthorizationCode:    payment.AuthorizationCode,
+			Amount:               payment.CapturedAmount,
+			Fee:                  s.config.Fee.Calculate(payment.CapturedAmount),
+		})
+	}
+
+	for _, refund := range refunds {
+		// the refunded payment may have been settled in an earlier batch
+		payment, err := s.repo.GetPayment(merchantID, refund.PaymentID)
+		if err != nil {
+			return nil, fmt.Errorf("getting refunded payment: %w", err)
+		}
+
+		batchFor(refund.Currency).Add(clearing.Record{
+			Type:                 clearing.RecordTypeRefund,
+			PaymentID:            payment.ID,
+			RefundID:             refund.ID,
+			STAN:                 payment.STAN,
+			TransmissionDateTime: payment.TransmissionDateTime,
+			AuthorizationCode:    payment.AuthorizationCode,
+			Amount:               refund.Amount,
+		})
+	}
+
+	for _, batch := range closed {
+		if err := s.repo.CreateBatch(batch); err != nil {
+			return nil, fmt.Errorf("creating batch: %w", err)
+		}
+
+		s.logger.Info("settlement batch closed",
+			slog.String("merchant_id", merchantID),
+			slog.String("batch_id", batch.ID),
+			slog.Int64("net_amount", batch.Totals.NetAmount),
+		)
+
+		// the batch is closed already, the file can still be downloaded
+		// through the API if it can't be written
+		if err := s.writeClearingFile(batch); err != nil {
+			s.logger.Error("failed to write clearing file", slog.String("batch_id", batch.ID), slog.String("error", err.Error()))
+		}
+	}
+
+	return closed, nil
+}
+
+// CloseAllBatches closes the batches of all merchants that have something to
+// settle.
+func (s *SettlementService) CloseAllBatches() error {
+	merchants, err := s.repo.GetMerchants()
+	if err != nil {
+		return fmt.Errorf("getting merchants: %w", err)
+	}
+
+	var errs []error
+	for _, merchant := range merchants {
+		_, err := s.CloseBatches(merchant.ID)
+		if err != nil && !errors.Is(err, models.ErrNothingToSettle) {
+			errs = append(errs, fmt.Errorf("merchant %s: %w", merchant.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// writeClearingFile writes the clearing file of the batch to
+// <clearing dir>/<batch id>.csv. Nothing is written if the directory is not
+// configured.
+func (s *SettlementService) writeClearingFile(batch *models.Batch) error {
+	if s.config.ClearingDir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(s.config.ClearingDir, 0755); err != nil {
+		return fmt.Errorf("creating clearing directory: %w", err)
+	}
+
+	file, err := os.Create(filepath.Join(s.config.ClearingDir, batch.ID+".csv"))
+	if err != nil {
+		return fmt.Errorf("creating clearing file: %w", err)
+	}
+	defer file.Close()
+
+	if err := clearing.Write(file, batch.ClearingFile()); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+func (s *SettlementService) GetBatch(merchantID, batchID string) (*models.Batch, error) {
+	batch, err := s.repo.GetBatch(merchantID, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("getting batch: %w", err)
+	}
+
+	return batch, nil
+}
+
+func (s *SettlementService) GetBatches(merchantID string) ([]*models.Batch, error) {
+	batches, err := s.repo.GetBatches(merchantID)
+	if err != nil {
+		return nil, fmt.Errorf("getting batches: %w", err)
+	}
+
+	return batches, nil
+}
@@ -0,0 +1,84 @@
+package acquirer_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer"
+	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer/models"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/clearing"
+	"github.com/moov-io/ftdc-from-tap-to-auth/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloseBatches(t *testing.T) {
+	for _, backend := range []string{"memory", "sqlite"} {
+		t.Run(backend, func(t *testing.T) {
+			var repo acquirer.Repository = acquirer.NewMemoryRepository()
+			if backend == "sqlite" {
+				sqliteRepo, err := acquirer.NewSQLiteRepository(filepath.Join(t.TempDir(), "acquirer.db"))
+				require.NoError(t, err)
+				t.Cleanup(func() { sqliteRepo.Close() })
+
+				repo = sqliteRepo
+			}
+
+			service := acquirer.NewService(log.New(), repo, singleRoute(&iso8583ClientMock{}), acquirer.StandInConfig{})
+			settlement := acquirer.NewSettlementService(log.New(), repo, "000001", acquirer.SettlementConfig{
+				Fee: models.Fee{BasisPoints: 150, Fixed: 10},
+			})
+
+			merchant, err := service.CreateMerchant(models.CreateMerchant{Name: "Demo Merchant", MCC: "5411"})
+			require.NoError(t, err)
+
+			_, err = settlement.CloseBatches(merchant.ID)
+			require.ErrorIs(t, err, models.ErrNothingToSettle)
+
+			payment, err := service.CreatePayment(merchant.ID, models.CreatePayment{
+				Amount:   20_00,
+				Currency: "USD",
+				Card: models.Card{
+					Number:         "4242424242424242",
+					ExpirationDate: "1230",
+				},
+			})
+			require.NoError(t, err)
+
+			_, err = service.CapturePayment(merchant.ID, payment.ID, models.CreateCapture{})
+			require.NoError(t, err)
+
+			batches, err := settlement.CloseBatches(merchant.ID)
+			require.NoError(t, err)
+			require.Len(t, batches, 1)
+			require.Equal(t, int64(10+30), batches[0].Totals.FeeAmount)
+
+			// the refund of the settled payment goes to the next batch
+			refund, err := service.RefundPayment(merchant.ID, payment.ID, models.CreateRefund{Amount: 5_00})
+			require.NoError(t, err)
+
+			batches, err = settlement.CloseBatches(merchant.ID)
+			require.NoError(t, err)
+			require.Len(t, batches, 1)
+			require.Equal(t, []clearing.Record{{
+				Type:                 clearing.RecordTypeRefund,
+				PaymentID:            payment.ID,
+				RefundID:             refund.ID,
+				STAN:                 "000001",
+				TransmissionDateTime: payment.TransmissionDateTime,
+				AuthorizationCode:    "123456",
+				Amount:               5_00,
+			}}, batches[0].Records)
+
+			saved, err := settlement.GetBatches(merchant.ID)
+			require.NoError(t, err)
+			require.Len(t, saved, 2)
+			require.Equal(t, batches[0].ID, saved[1].ID)
+			require.Equal(t, batches[0].Totals, saved[1].Totals)
+			require.Equal(t, batches[0].Records, saved[1].Records)
+
+			got, err := service.GetPayment(merchant.ID, payment.ID)
+			require.NoError(t, err)
+			require.Equal(t, saved[0].ID, got.SettlementBatchID)
+		})
+	}
+}
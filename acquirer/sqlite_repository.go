@@ -0,0 +1,774 @@
+package acquirer
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer/models"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/clearing"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/storage"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// SQLiteRepository keeps the data in the embedded SQLite database.
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+var _ Repository = (*SQLiteRepository)(nil)
+
+// NewSQLiteRepository opens the database at path and migrates it to the
+// latest schema version.
+func NewSQLiteRepository(path string) (*SQLiteRepository, error) {
+	db, err := storage.OpenSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := storage.Migrate(db, migrations, "migrations"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating database: %w", err)
+	}
+
+	return &SQLiteRepository{db: db}, nil
+}
+
+func (r *SQLiteRepository) Close() error {
+	return r.db.Close()
+}
+
+func (r *SQLiteRepository) CreateMerchant(merchant *models.Merchant) error {
+	_, err := r.db.Exec(`INSERT INTO merchants (id, name, mcc, postal_code, web_site) VALUES (?, ?, ?, ?, ?)`,
+		merchant.ID, merchant.Name, merchant.MCC, merchant.PostalCode, merchant.WebSite)
+	if err != nil {
+		return fmt.Errorf("inserting merchant: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) GetMerchant(merchantID string) (*models.Merchant, error) {
+	var merchant models.Merchant
+
+	err := r.db.QueryRow(`SELECT id, name, mcc, postal_code, web_site FROM merchants WHERE id = ?`, merchantID).
+		Scan(&merchant.ID, &merchant.Name, &merchant.MCC, &merchant.PostalCode, &merchant.WebSite)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("querying merchant: %w", err)
+	}
+
+	return &merchant, nil
+}
+
+func (r *SQLiteRepository) GetMerchants() ([]*models.Merchant, error) {
+	rows, err := r.db.Query(`SELECT id, name, mcc, postal_code, web_site FROM merchants ORDER BY rowid`)
+	if err != nil {
+		return nil, fmt.Errorf("querying merchants: %w", err)
+	}
+	defer rows.Close()
+
+	merchants := make([]*models.Merchant, 0)
+	for rows.Next() {
+		var merchant models.Merchant
+
+		err := rows.Scan(&merchant.ID, &merchant.Name, &merchant.MCC, &merchant.PostalCode, &merchant.WebSite)
+		if err != nil {
+			return nil, fmt.Errorf("scanning merchant: %w", err)
+		}
+
+		merchants = append(merchants, &merchant)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading merchants: %w", err)
+	}
+
+	return merchants, nil
+}
+
+func (r *SQLiteRepository) CreatePayment(payment *models.Payment) error {
+	return storage.WithTx(r.db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO payments (id, merchant_id, amount, captured_amount, currency,
+			card_first6, card_last4, card_expiration_date, status, created_at, authorization_code,
+			response_code, response_description, stan, transmission_date_time, requested_amount, stand_in, route,
+			issuer_authentication_data)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			payment.ID, payment.MerchantID, payment.Amount, payment.CapturedAmount, payment.Currency,
+			payment.Card.First6, payment.Card.Last4, payment.Card.ExpirationDate, payment.Status,
+			storage.FormatTime(payment.CreatedAt), payment.AuthorizationCode, payment.ResponseCode,
+			payment.ResponseDescription, payment.STAN, payment.TransmissionDateTime, payment.RequestedAmount,
+			payment.StandIn, payment.Route, payment.IssuerAuthenticationData,
+		)
+		if err != nil {
+			return fmt.Errorf("inserting payment: %w", err)
+		}
+
+		return insertStatusChanges(tx, payment.ID, payment.History)
+	})
+}
+
+// UpdatePayment saves the payment and the status changes added to its
+// history since it was read.
+func (r *SQLiteRepository) UpdatePayment(payment *models.Payment) error {
+	return storage.WithTx(r.db, func(tx *sql.Tx) error {
+		return updatePayment(tx, payment)
+	})
+}
+
+func updatePayment(tx *sql.Tx, payment *models.Payment) error {
+	result, err := tx.Exec(`UPDATE payments SET amount = ?, captured_amount = ?, status = ?, authorization_code = ?,
+		response_code = ?, response_description = ?, stan = ?, transmission_date_time = ?, stand_in = ?,
+		issuer_authentication_data = ? WHERE id = ?`,
+		payment.Amount, payment.CapturedAmount, payment.Status, payment.AuthorizationCode, payment.ResponseCode,
+		payment.ResponseDescription, payment.STAN, payment.TransmissionDateTime, payment.StandIn,
+		payment.IssuerAuthenticationData, payment.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("updating payment: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting affected rows: %w", err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	// the history is append-only, so only the new changes are inserted
+	var saved int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM payment_status_changes WHERE payment_id = ?`, payment.ID).Scan(&saved)
+	if err != nil {
+		return fmt.Errorf("counting status changes: %w", err)
+	}
+
+	if saved > len(payment.History) {
+		saved = len(payment.History)
+	}
+
+	return insertStatusChanges(tx, payment.ID, payment.History[saved:])
+}
+
+func insertStatusChanges(tx *sql.Tx, paymentID string, changes []models.PaymentStatusChange) error {
+	for _, change := range changes {
+		_, err := tx.Exec(`INSERT INTO payment_status_changes (payment_id, status, created_at) VALUES (?, ?, ?)`,
+			paymentID, change.Status, storage.FormatTime(change.CreatedAt))
+		if err != nil {
+			return fmt.Errorf("inserting status change: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) GetPayment(merchantID, paymentID string) (*models.Payment, error) {
+	payments, err := r.queryPayments(`SELECT `+paymentColumns+` FROM payments WHERE id = ? AND merchant_id = ?`, paymentID, merchantID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payments) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return payments[0], nil
+}
+
+func (r *SQLiteRepository) GetPayments(merchantID string) ([]*models.Payment, error) {
+	return r.queryPayments(`SELECT `+paymentColumns+` FROM payments WHERE merchant_id = ? ORDER BY rowid`, merchantID)
+}
+
+const paymentColumns = `id, merchant_id, amount, captured_amount, refunded_amount, currency, card_first6,
+	card_last4, card_expiration_date, status, created_at, authorization_code, response_code,
+	response_description, stan, transmission_date_time, settlement_batch_id, requested_amount, stand_in, route,
+	issuer_authentication_data`
+
+func (r *SQLiteRepository) CreateIdempotentRequest(request *models.IdempotentRequest) error {
+	// the response is saved when the request is completed
+	result, err := r.db.Exec(`INSERT INTO idempotent_requests (merchant_id, idempotency_key, fingerprint, created_at)
+		VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING`,
+		request.MerchantID, request.Key, request.Fingerprint, storage.FormatTime(request.CreatedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("inserting idempotent request: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting affected rows: %w", err)
+	}
+
+	if n == 0 {
+		return models.ErrIdempotencyKeyExists
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) GetIdempotentRequest(merchantID, key string) (*models.IdempotentRequest, error) {
+	var (
+		request   models.IdempotentRequest
+		createdAt string
+	)
+
+	err := r.db.QueryRow(`SELECT merchant_id, idempotency_key, fingerprint, created_at, response_status,
+		response_content_type, response_body FROM idempotent_requests WHERE merchant_id = ? AND idempotency_key = ?`,
+		merchantID, key,
+	).Scan(&request.MerchantID, &request.Key, &request.Fingerprint, &createdAt, &request.ResponseStatus,
+		&request.ResponseContentType, &request.ResponseBody)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("querying idempotent request: %w", err)
+	}
+
+	if request.CreatedAt, err = storage.ParseTime(createdAt); err != nil {
+		return nil, err
+	}
+
+	return &request, nil
+}
+
+func (r *SQLiteRepository) UpdateIdempotentRequest(request *models.IdempotentRequest) error {
+	result, err := r.db.Exec(`UPDATE idempotent_requests SET response_status = ?, response_content_type = ?,
+		response_body = ? WHERE merchant_id = ? AND idempotency_key = ?`,
+		request.ResponseStatus, request.ResponseContentType, request.ResponseBody, request.MerchantID, request.Key,
+	)
+	if err != nil {
+		return fmt.Errorf("updating idempotent request: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting affected rows: %w", err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) ReclaimIdempotentRequest(request *models.IdempotentRequest, claimedAt time.Time) error {
+	result, err := r.db.Exec(`UPDATE idempotent_requests SET fingerprint = ?, created_at = ?
+		WHERE merchant_id = ? AND idempotency_key = ? AND response_status = 0 AND created_at = ?`,
+		request.Fingerprint, storage.FormatTime(request.CreatedAt), request.MerchantID, request.Key,
+		storage.FormatTime(claimedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("reclaiming idempotent request: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting affected rows: %w", err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) DeleteIdempotentRequest(merchantID, key string) error {
+	_, err := r.db.Exec(`DELETE FROM idempotent_requests WHERE merchant_id = ? AND idempotency_key = ?`, merchantID, key)
+	if err != nil {
+		return fmt.Errorf("deleting idempotent request: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) CreateStandInAdvice(advice *models.StandInAdvice, payment *models.Payment) error {
+	return storage.WithTx(r.db, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`INSERT INTO stand_in_advices (payment_id, merchant_id, amount, authorization_code,
+			card_number, card_expiration_date, emv_payload, status, response_code, created_at, forwarded_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (authorization_code) DO NOTHING`,
+			advice.PaymentID, advice.MerchantID, advice.Amount, advice.AuthorizationCode, advice.Card.Number,
+			advice.Card.ExpirationDate, advice.EMVPayload, advice.Status, advice.ResponseCode,
+			storage.FormatTime(advice.CreatedAt), storage.FormatTime(advice.ForwardedAt),
+		)
+		if err != nil {
+			return fmt.Errorf("inserting stand-in advice: %w", err)
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("getting affected rows: %w", err)
+		}
+
+		if n == 0 {
+			return models.ErrAuthorizationCodeExists
+		}
+
+		return updatePayment(tx, payment)
+	})
+}
+
+func (r *SQLiteRepository) GetStandInAdvice(paymentID string) (*models.StandInAdvice, error) {
+	advices, err := r.queryStandInAdvices(`SELECT `+standInAdviceColumns+` FROM stand_in_advices WHERE payment_id = ?`, paymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(advices) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return advices[0], nil
+}
+
+func (r *SQLiteRepository) GetPendingStandInAdvices() ([]*models.StandInAdvice, error) {
+	return r.queryStandInAdvices(`SELECT `+standInAdviceColumns+` FROM stand_in_advices
+		WHERE status = ? ORDER BY created_at, rowid`, models.AdviceStatusPending)
+}
+
+func (r *SQLiteRepository) UpdateStandInAdvice(advice *models.StandInAdvice) error {
+	result, err := r.db.Exec(`UPDATE stand_in_advices SET card_number = ?, card_expiration_date = ?, emv_payload = ?,
+		status = ?, response_code = ?, forwarded_at = ? WHERE payment_id = ?`,
+		advice.Card.Number, advice.Card.ExpirationDate, advice.EMVPayload, advice.Status, advice.ResponseCode,
+		storage.FormatTime(advice.ForwardedAt), advice.PaymentID,
+	)
+	if err != nil {
+		return fmt.Errorf("updating stand-in advice: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting affected rows: %w", err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+const standInAdviceColumns = `payment_id, merchant_id, amount, COALESCE(authorization_code, ''), card_number,
+	card_expiration_date, emv_payload, status, response_code, created_at, forwarded_at`
+
+func (r *SQLiteRepository) queryStandInAdvices(query string, args ...any) ([]*models.StandInAdvice, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying stand-in advices: %w", err)
+	}
+	defer rows.Close()
+
+	var advices []*models.StandInAdvice
+	for rows.Next() {
+		var (
+			advice                 models.StandInAdvice
+			createdAt, forwardedAt string
+		)
+
+		err := rows.Scan(&advice.PaymentID, &advice.MerchantID, &advice.Amount, &advice.AuthorizationCode,
+			&advice.Card.Number, &advice.Card.ExpirationDate, &advice.EMVPayload, &advice.Status, &advice.ResponseCode, &createdAt,
+			&forwardedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scanning stand-in advice: %w", err)
+		}
+
+		if advice.CreatedAt, err = storage.ParseTime(createdAt); err != nil {
+			return nil, err
+		}
+
+		if advice.ForwardedAt, err = storage.ParseTime(forwardedAt); err != nil {
+			return nil, err
+		}
+
+		advices = append(advices, &advice)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading stand-in advices: %w", err)
+	}
+
+	return advices, nil
+}
+
+func (r *SQLiteRepository) GetLastSTAN() (int, error) {
+	var stan int
+
+	err := r.db.QueryRow(`SELECT last_stan FROM stan_counter WHERE id = 1`).Scan(&stan)
+	if err != nil {
+		return 0, fmt.Errorf("querying last stan: %w", err)
+	}
+
+	return stan, nil
+}
+
+func (r *SQLiteRepository) SaveLastSTAN(stan int) error {
+	_, err := r.db.Exec(`UPDATE stan_counter SET last_stan = ? WHERE id = 1`, stan)
+	if err != nil {
+		return fmt.Errorf("updating last stan: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) queryPayments(query string, args ...any) ([]*models.Payment, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying payments: %w", err)
+	}
+	defer rows.Close()
+
+	var payments []*models.Payment
+	for rows.Next() {
+		var (
+			payment   models.Payment
+			createdAt string
+		)
+
+		err := rows.Scan(&payment.ID, &payment.MerchantID, &payment.Amount, &payment.CapturedAmount,
+			&payment.RefundedAmount, &payment.Currency, &payment.Card.First6, &payment.Card.Last4, &payment.Card.ExpirationDate,
+			&payment.Status, &createdAt, &payment.AuthorizationCode, &payment.ResponseCode,
+			&payment.ResponseDescription, &payment.STAN, &payment.TransmissionDateTime, &payment.SettlementBatchID,
+			&payment.RequestedAmount, &payment.StandIn, &payment.Route, &payment.IssuerAuthenticationData)
+		if err != nil {
+			return nil, fmt.Errorf("scanning payment: %w", err)
+		}
+
+		if payment.CreatedAt, err = storage.ParseTime(createdAt); err != nil {
+			return nil, err
+		}
+
+		payments = append(payments, &payment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading payments: %w", err)
+	}
+
+	for _, payment := range payments {
+		if payment.History, err = r.getStatusChanges(payment.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return payments, nil
+}
+
+func (r *SQLiteRepository) getStatusChanges(paymentID string) ([]models.PaymentStatusChange, error) {
+	rows, err := r.db.Query(`SELECT status, created_at FROM payment_status_changes
+		WHERE payment_id = ? ORDER BY rowid`, paymentID)
+	if err != nil {
+		return nil, fmt.Errorf("querying status changes: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []models.PaymentStatusChange
+	for rows.Next() {
+		var (
+			change    models.PaymentStatusChange
+			createdAt string
+		)
+
+		if err := rows.Scan(&change.Status, &createdAt); err != nil {
+			return nil, fmt.Errorf("scanning status change: %w", err)
+		}
+
+		if change.CreatedAt, err = storage.ParseTime(createdAt); err != nil {
+			return nil, err
+		}
+
+		changes = append(changes, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading status changes: %w", err)
+	}
+
+	return changes, nil
+}
+
+func (r *SQLiteRepository) CreateRefund(refund *models.Refund) error {
+	return storage.WithTx(r.db, func(tx *sql.Tx) error {
+		var capturedAmount, refundedAmount int64
+
+		err := tx.QueryRow(`SELECT captured_amount FROM payments WHERE id = ?`, refund.PaymentID).Scan(&capturedAmount)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrNotFound
+			}
+
+			return fmt.Errorf("querying payment: %w", err)
+		}
+
+		err = tx.QueryRow(`SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE payment_id = ? AND status IN (?, ?)`,
+			refund.PaymentID, models.RefundStatusPending, models.RefundStatusApproved).Scan(&refundedAmount)
+		if err != nil {
+			return fmt.Errorf("querying refunded amount: %w", err)
+		}
+
+		if refundedAmount+refund.Amount > capturedAmount {
+			return models.ErrRefundExceedsCapturedAmount
+		}
+
+		_, err = tx.Exec(`INSERT INTO refunds (id, payment_id, merchant_id, amount, currency, status, created_at,
+			response_code, response_description, stan)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			refund.ID, refund.PaymentID, refund.MerchantID, refund.Amount, refund.Currency, refund.Status,
+			storage.FormatTime(refund.CreatedAt), refund.ResponseCode, refund.ResponseDescription, refund.STAN,
+		)
+		if err != nil {
+			return fmt.Errorf("inserting refund: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (r *SQLiteRepository) UpdateRefund(refund *models.Refund) error {
+	return storage.WithTx(r.db, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`UPDATE refunds SET status = ?, response_code = ?, response_description = ?, stan = ?
+			WHERE id = ?`,
+			refund.Status, refund.ResponseCode, refund.ResponseDescription, refund.STAN, refund.ID,
+		)
+		if err != nil {
+			return fmt.Errorf("updating refund: %w", err)
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("getting affected rows: %w", err)
+		}
+
+		if n == 0 {
+			return ErrNotFound
+		}
+
+		_, err = tx.Exec(`UPDATE payments SET refunded_amount = (
+				SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE payment_id = ? AND status = ?
+			) WHERE id = ?`,
+			refund.PaymentID, models.RefundStatusApproved, refund.PaymentID,
+		)
+		if err != nil {
+			return fmt.Errorf("updating refunded amount: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (r *SQLiteRepository) GetRefunds(merchantID, paymentID string) ([]*models.Refund, error) {
+	if _, err := r.GetPayment(merchantID, paymentID); err != nil {
+		return nil, err
+	}
+
+	return r.queryRefunds(`SELECT `+refundColumns+` FROM refunds WHERE payment_id = ? ORDER BY rowid`, paymentID)
+}
+
+const refundColumns = `id, payment_id, merchant_id, amount, currency, status, created_at, response_code,
+	response_description, stan, settlement_batch_id`
+
+func (r *SQLiteRepository) queryRefunds(query string, args ...any) ([]*models.Refund, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying refunds: %w", err)
+	}
+	defer rows.Close()
+
+	refunds := make([]*models.Refund, 0)
+	for rows.Next() {
+		var (
+			refund    models.Refund
+			createdAt string
+		)
+
+		err := rows.Scan(&refund.ID, &refund.PaymentID, &refund.MerchantID, &refund.Amount, &refund.Currency,
+			&refund.Status, &createdAt, &refund.ResponseCode, &refund.ResponseDescription, &refund.STAN,
+			&refund.SettlementBatchID)
+		if err != nil {
+			return nil, fmt.Errorf("scanning refund: %w", err)
+		}
+
+		if refund.CreatedAt, err = storage.ParseTime(createdAt); err != nil {
+			return nil, err
+		}
+
+		refunds = append(refunds, &refund)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading refunds: %w", err)
+	}
+
+	return refunds, nil
+}
+
+func (r *SQLiteRepository) GetUnsettled(merchantID string) ([]*models.Payment, []*models.Refund, error) {
+	payments, err := r.queryPayments(`SELECT `+paymentColumns+` FROM payments
+		WHERE merchant_id = ? AND settlement_batch_id = '' AND status IN (?, ?) ORDER BY rowid`,
+		merchantID, models.PaymentStatusCaptured, models.PaymentStatusRefunded)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refunds, err := r.queryRefunds(`SELECT `+refundColumns+` FROM refunds
+		WHERE merchant_id = ? AND settlement_batch_id = '' AND status = ? ORDER BY rowid`,
+		merchantID, models.RefundStatusApproved)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return payments, refunds, nil
+}
+
+func (r *SQLiteRepository) CreateBatch(batch *models.Batch) error {
+	return storage.WithTx(r.db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO settlement_batches (id, merchant_id, acquirer_id, currency, created_at,
+			capture_count, capture_amount, refund_count, refund_amount, fee_amount, net_amount)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			batch.ID, batch.MerchantID, batch.AcquirerID, batch.Currency, storage.FormatTime(batch.CreatedAt),
+			batch.Totals.CaptureCount, batch.Totals.CaptureAmount, batch.Totals.RefundCount,
+			batch.Totals.RefundAmount, batch.Totals.FeeAmount, batch.Totals.NetAmount,
+		)
+		if err != nil {
+			return fmt.Errorf("inserting batch: %w", err)
+		}
+
+		for _, record := range batch.Records {
+			var result sql.Result
+
+			switch record.Type {
+			case clearing.RecordTypeCapture:
+				result, err = tx.Exec(`UPDATE payments SET settlement_batch_id = ?
+					WHERE id = ? AND settlement_batch_id = '' AND status IN (?, ?)`,
+					batch.ID, record.PaymentID, models.PaymentStatusCaptured, models.PaymentStatusRefunded)
+			case clearing.RecordTypeRefund:
+				result, err = tx.Exec(`UPDATE refunds SET settlement_batch_id = ?
+					WHERE id = ? AND settlement_batch_id = '' AND status = ?`,
+					batch.ID, record.RefundID, models.RefundStatusApproved)
+			default:
+				return fmt.Errorf("unknown record type %q", record.Type)
+			}
+			if err != nil {
+				return fmt.Errorf("settling %s: %w", record.Type, err)
+			}
+
+			n, err := result.RowsAffected()
+			if err != nil {
+				return fmt.Errorf("getting affected rows: %w", err)
+			}
+
+			if n == 0 {
+				return fmt.Errorf("%w: %s of payment %s", models.ErrAlreadySettled, record.Type, record.PaymentID)
+			}
+
+			_, err = tx.Exec(`INSERT INTO settlement_batch_records (batch_id, type, payment_id, refund_id, stan,
+				transmission_date_time, authorization_code, amount, fee) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				batch.ID, record.Type, record.PaymentID, record.RefundID, record.STAN,
+				record.TransmissionDateTime, record.AuthorizationCode, record.Amount, record.Fee,
+			)
+			if err != nil {
+				return fmt.Errorf("inserting batch record: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *SQLiteRepository) GetBatch(merchantID, batchID string) (*models.Batch, error) {
+	batches, err := r.queryBatches(`SELECT `+batchColumns+` FROM settlement_batches WHERE id = ? AND merchant_id = ?`, batchID, merchantID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(batches) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return batches[0], nil
+}
+
+func (r *SQLiteRepository) GetBatches(merchantID string) ([]*models.Batch, error) {
+	return r.queryBatches(`SELECT `+batchColumns+` FROM settlement_batches WHERE merchant_id = ? ORDER BY rowid`, merchantID)
+}
+
+const batchColumns = `id, merchant_id, acquirer_id, currency, created_at, capture_count, capture_amount, refund_count,
+	refund_amount, fee_amount, net_amount`
+
+func (r *SQLiteRepository) queryBatches(query string, args ...any) ([]*models.Batch, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying batches: %w", err)
+	}
+	defer rows.Close()
+
+	batches := make([]*models.Batch, 0)
+	for rows.Next() {
+		var (
+			batch     models.Batch
+			createdAt string
+		)
+
+		err := rows.Scan(&batch.ID, &batch.MerchantID, &batch.AcquirerID, &batch.Currency, &createdAt, &batch.Totals.CaptureCount,
+			&batch.Totals.CaptureAmount, &batch.Totals.RefundCount, &batch.Totals.RefundAmount,
+			&batch.Totals.FeeAmount, &batch.Totals.NetAmount)
+		if err != nil {
+			return nil, fmt.Errorf("scanning batch: %w", err)
+		}
+
+		if batch.CreatedAt, err = storage.ParseTime(createdAt); err != nil {
+			return nil, err
+		}
+
+		batches = append(batches, &batch)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading batches: %w", err)
+	}
+
+	for _, batch := range batches {
+		if batch.Records, err = r.getBatchRecords(batch.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return batches, nil
+}
+
+func (r *SQLiteRepository) getBatchRecords(batchID string) ([]clearing.Record, error) {
+	rows, err := r.db.Query(`SELECT type, payment_id, refund_id, stan, transmission_date_time, authorization_code,
+		amount, fee FROM settlement_batch_records WHERE batch_id = ? ORDER BY rowid`, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("querying batch records: %w", err)
+	}
+	defer rows.Close()
+
+	var records []clearing.Record
+	for rows.Next() {
+		var record clearing.Record
+
+		err := rows.Scan(&record.Type, &record.PaymentID, &record.RefundID, &record.STAN,
+			&record.TransmissionDateTime, &record.AuthorizationCode, &record.Amount, &record.Fee)
+		if err != nil {
+			return nil, fmt.Errorf("scanning batch record: %w", err)
+		}
+
+		records = append(records, record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading batch records: %w", err)
+	}
+
+	return records, nil
+}
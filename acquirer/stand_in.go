@@ -0,0 +1,217 @@
+package acquirer
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"time"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer/models"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/responsecode"
+)
+
+// authorizeInStandIn approves the payment the issuer couldn't be asked about
+// if it's within the merchant's stand-in limits. The payment gets a local
+// authorization code and its advice is queued, so the issuer is advised of it
+// once it's back. It returns false if the payment is over the limits.
+func (a *Service) authorizeInStandIn(payment *models.Payment, create models.CreatePayment) (bool, error) {
+	logger := a.logger.With(slog.String("payment_id", payment.ID), slog.String("merchant_id", payment.MerchantID))
+
+	a.standInMu.Lock()
+	defer a.standInMu.Unlock()
+
+	pending, err := a.repo.GetPendingStandInAdvices()
+	if err != nil {
+		return false, fmt.Errorf("getting pending advices: %w", err)
+	}
+
+	var pendingAmount int64
+	for _, advice := range pending {
+		if advice.MerchantID == payment.MerchantID {
+			pendingAmount += advice.Amount
+		}
+	}
+
+	if !a.standIn.MerchantLimits(payment.MerchantID).Allows(payment.Amount, pendingAmount) {
+		logger.Warn("payment exceeds stand-in limits",
+			slog.Int64("amount", payment.Amount),
+			slog.Int64("pending_amount", pendingAmount),
+		)
+
+		return false, nil
+	}
+
+	payment.StandIn = true
+	payment.ResponseCode = responsecode.Approved
+	payment.ResponseDescription = responsecode.GetInfo(responsecode.Approved).Description
+
+	if err := payment.TransitionTo(models.PaymentStatusAuthorized); err != nil {
+		return false, err
+	}
+
+	// the CVV is checked by the issuer only online, it's not kept
+	advice := &models.StandInAdvice{
+		PaymentID:  payment.ID,
+		MerchantID: payment.MerchantID,
+		Amount:     payment.Amount,
+		Card: models.Card{
+			Number:         create.Card.Number,
+			ExpirationDate: create.Card.ExpirationDate,
+		},
+		EMVPayload: create.EMVPayload,
+		Status:     models.AdviceStatusPending,
+		CreatedAt:  time.Now(),
+	}
+
+	// the code is generated again if another payment got it
+	for attempt := 1; ; attempt++ {
+		code, err := generateStandInAuthorizationCode()
+		if err != nil {
+			return false, fmt.Errorf("generating authorization code: %w", err)
+		}
+
+		payment.AuthorizationCode, advice.AuthorizationCode = code, code
+
+		err = a.repo.CreateStandInAdvice(advice, payment)
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, models.ErrAuthorizationCodeExists) || attempt == maxStandInAuthorizationCodeAttempts {
+			return false, fmt.Errorf("creating stand-in advice: %w", err)
+		}
+	}
+
+	logger.Warn("payment approved in stand-in", slog.String("authorization_code", payment.AuthorizationCode))
+
+	return true, nil
+}
+
+// maxStandInAuthorizationCodeAttempts is how many codes are generated for the
+// payment approved in stand-in before we give up finding a unique one
+const maxStandInAuthorizationCodeAttempts = 5
+
+// standInAuthorizationCodeChars are the characters of the codes after the
+// prefix
+const standInAuthorizationCodeChars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// generateStandInAuthorizationCode returns a random authorization code of a
+// payment approved in stand-in. The issuer's codes are numeric, so the
+// prefix keeps ours apart from them.
+func generateStandInAuthorizationCode() (string, error) {
+	code := []byte("S00000")
+
+	for i := 1; i < len(code); i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(standInAuthorizationCodeChars))))
+		if err != nil {
+			return "", err
+		}
+
+		code[i] = standInAuthorizationCodeChars[n.Int64()]
+	}
+
+	return string(code), nil
+}
+
+// ForwardStandInAdvices sends the pending advices to the issuers of their
+// payments, the oldest first. The advices of an issuer we are not connected
+// to are skipped, and the first advice that can't be sent stops the
+// forwarding to its issuer; they are sent the next time we connect to it.
+// Once forwarded, the card details of the advice are cleared. The payments of
+// the advices the issuer rejected are not held on the card's account, they
+// are logged for follow-up.
+func (a *Service) ForwardStandInAdvices() error {
+	a.forwardMu.Lock()
+	defer a.forwardMu.Unlock()
+
+	advices, err := a.repo.GetPendingStandInAdvices()
+	if err != nil {
+		return fmt.Errorf("getting pending advices: %w", err)
+	}
+
+	// down keeps the issuers the advices can't be sent to now
+	down := make(map[ISO8583Client]bool)
+
+	var errs []error
+
+	for _, advice := range advices {
+		logger := a.logger.With(slog.String("payment_id", advice.PaymentID), slog.String("merchant_id", advice.MerchantID))
+
+		payment, err := a.repo.GetPayment(advice.MerchantID, advice.PaymentID)
+		if err != nil {
+			return fmt.Errorf("getting payment %s: %w", advice.PaymentID, err)
+		}
+
+		merchant, err := a.repo.GetMerchant(advice.MerchantID)
+		if err != nil {
+			return fmt.Errorf("getting merchant %s: %w", advice.MerchantID, err)
+		}
+
+		client, err := a.issuer(payment)
+		if err != nil {
+			return fmt.Errorf("forwarding advice of payment %s: %w", advice.PaymentID, err)
+		}
+
+		if down[client] || !client.Connected() {
+			down[client] = true
+			continue
+		}
+
+		response, err := client.SendAdvice(payment, advice, *merchant)
+		if err != nil {
+			down[client] = true
+			errs = append(errs, fmt.Errorf("sending advice of payment %s: %w", advice.PaymentID, err))
+			continue
+		}
+
+		info := responsecode.GetInfo(response.ResponseCode)
+		if info.Category == responsecode.CategoryRetry {
+			logger.Warn("issuer asked to send the stand-in advice again", slog.String("response_code", info.Code))
+			continue
+		}
+
+		advice.ResponseCode = response.ResponseCode
+		advice.ForwardedAt = time.Now()
+		advice.Card = models.Card{}
+		advice.EMVPayload = nil
+
+		if info.IsApproved() {
+			advice.Status = models.AdviceStatusAccepted
+		} else {
+			advice.Status = models.AdviceStatusRejected
+
+			logger.Error("stand-in advice rejected by issuer",
+				slog.String("response_code", info.Code),
+				slog.String("description", info.Description),
+			)
+		}
+
+		if err := a.repo.UpdateStandInAdvice(advice); err != nil {
+			return fmt.Errorf("updating advice of payment %s: %w", advice.PaymentID, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkAdvised rejects the follow-up messages of the payment approved in
+// stand-in until the issuer was advised of it, the issuer doesn't know the
+// payment before that.
+func (a *Service) checkAdvised(payment *models.Payment) error {
+	if !payment.StandIn {
+		return nil
+	}
+
+	advice, err := a.repo.GetStandInAdvice(payment.ID)
+	if err != nil {
+		return fmt.Errorf("getting stand-in advice: %w", err)
+	}
+
+	if advice.Status == models.AdviceStatusPending {
+		return fmt.Errorf("%w: issuer was not advised of the stand-in approval yet", ErrInvalidPaymentStatus)
+	}
+
+	return nil
+}
@@ -173,6 +173,47 @@ func UpdateEMVStaticData(operations []Operation, requestID string) error {
 	return nil
 }
 
+// UpdateMasterKey replaces the master key the applet computes its
+// cryptograms with in the EMVCrypto.java file of the workspace, which
+// UpdateEMVStaticData creates
+func UpdateMasterKey(masterKey []byte, requestID string) error {
+	workspaceDir := fmt.Sprintf("javacard_%s", requestID)
+	filePath := filepath.Join(workspaceDir, "src/openemv/EMVCrypto.java")
+
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %v", err)
+	}
+
+	// the key is the array literal passed to mk.setKey
+	const keyPrefix = "mk.setKey(new byte[] {"
+	start := strings.Index(string(content), keyPrefix)
+	if start < 0 {
+		return fmt.Errorf("master key not found in %s", filePath)
+	}
+	start += len(keyPrefix)
+
+	end := strings.Index(string(content[start:]), "}")
+	if end < 0 {
+		return fmt.Errorf("end of master key not found in %s", filePath)
+	}
+	end += start
+
+	keyBytes := make([]string, len(masterKey))
+	for i, b := range masterKey {
+		keyBytes[i] = fmt.Sprintf("(byte)0x%02X", b)
+	}
+
+	newContent := string(content[:start]) + " " + strings.Join(keyBytes, ", ") + " " + string(content[end:])
+	err = os.WriteFile(filePath, []byte(newContent), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write file: %v", err)
+	}
+
+	log.Printf("Successfully updated the master key in EMVCrypto.java in workspace %s", workspaceDir)
+	return nil
+}
+
 // FlashCardWithBinary runs the ant reinstall command in the isolated workspace
 func FlashCardWithBinary(requestID string) error {
 	workspaceDir := fmt.Sprintf("javacard_%s", requestID)
@@ -29,6 +29,11 @@ type CardRequest struct {
 	PAN        string `json:"pan"`
 	ExpiryDate string `json:"expiry"`
 	PIN        string `json:"pin"`
+
+	// MasterKey is the hex encoded 3DES key the card computes its
+	// cryptograms with, derived by the issuer for the PAN. The card keeps
+	// the key built into the applet without it.
+	MasterKey string `json:"master_key,omitempty"`
 }
 
 // Validate validates the CardRequest struct
@@ -44,6 +49,7 @@ func (c CardRequest) Validate() error {
 		validation.Field(&c.PAN, validation.Length(13, 19), validation.Match(regexp.MustCompile(`^[0-9]*$`))),
 		validation.Field(&c.ExpiryDate, validation.Required, validation.Match(regexp.MustCompile(`^(0[1-9]|1[0-2])([0-9]{2})$`)).Error("must be in MMYY format")),
 		validation.Field(&c.PIN, validation.Required, validation.Length(4, 4), validation.Match(regexp.MustCompile(`^[0-9]*$`))),
+		validation.Field(&c.MasterKey, validation.Length(32, 32), validation.Match(regexp.MustCompile(`^[0-9A-Fa-f]*$`))),
 	)
 }
 
@@ -2,6 +2,7 @@ package cardpersonalizer
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
 	"log/slog"
 	"strings"
@@ -283,6 +284,14 @@ func (s *Service) PersonalizeCard(cardReq models.CardRequest) (models.CardRespon
 		return models.CardResponse{}, fmt.Errorf("updating EMV data: %w", err)
 	}
 
+	if cardReq.MasterKey != "" {
+		// the key is valid hex, see CardRequest.Validate
+		masterKey, _ := hex.DecodeString(cardReq.MasterKey)
+		if err := card.UpdateMasterKey(masterKey, requestID); err != nil {
+			return models.CardResponse{}, fmt.Errorf("updating master key: %w", err)
+		}
+	}
+
 	if err := card.FlashCardWithBinary(requestID); err != nil {
 		return models.CardResponse{}, fmt.Errorf("flashing card: %w", err)
 	}
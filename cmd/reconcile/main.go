@@ -0,0 +1,138 @@
+// Command reconcile matches the acquirer's payments to the issuer's
+// transactions and writes the report of the discrepancies. It reads the JSON
+// snapshots of the memory storage (.json files) or the SQLite databases.
+//
+// The command exits with 1 if any payment or transaction didn't match and
+// with 2 if the reconciliation failed.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/reconcile"
+	"github.com/moov-io/ftdc-from-tap-to-auth/issuer"
+	"github.com/moov-io/ftdc-from-tap-to-auth/log"
+)
+
+func main() {
+	issuerPath := flag.String("issuer", "db/issuer_data.json", "issuer JSON snapshot or SQLite database")
+	acquirerPath := flag.String("acquirer", "db/acquirer_data.json", "acquirer JSON snapshot or SQLite database")
+	reportPath := flag.String("report", "db/reconciliation_report.txt", "report file, - for stdout")
+	flag.Parse()
+
+	report, err := run(*issuerPath, *acquirerPath, *reportPath)
+	if err != nil {
+		log.New().Error("Error reconciling", "err", err)
+		os.Exit(2)
+	}
+
+	if report.HasDiscrepancies() {
+		os.Exit(1)
+	}
+}
+
+func run(issuerPath, acquirerPath, reportPath string) (*reconcile.Report, error) {
+	issuerRepo, err := openIssuerRepository(issuerPath)
+	if err != nil {
+		return nil, err
+	}
+	defer issuerRepo.Close()
+
+	acquirerRepo, err := openAcquirerRepository(acquirerPath)
+	if err != nil {
+		return nil, err
+	}
+	defer acquirerRepo.Close()
+
+	transactions, err := reconcile.TransactionRecords(issuerRepo)
+	if err != nil {
+		return nil, fmt.Errorf("reading issuer transactions: %w", err)
+	}
+
+	payments, err := reconcile.PaymentRecords(acquirerRepo)
+	if err != nil {
+		return nil, fmt.Errorf("reading acquirer payments: %w", err)
+	}
+
+	report := reconcile.Reconcile(payments, transactions)
+
+	var w io.Writer = os.Stdout
+	if reportPath != "-" {
+		file, err := os.Create(reportPath)
+		if err != nil {
+			return nil, fmt.Errorf("creating report file: %w", err)
+		}
+		defer file.Close()
+
+		w = file
+	}
+
+	if err := report.Write(w); err != nil {
+		return nil, fmt.Errorf("writing report: %w", err)
+	}
+
+	return report, nil
+}
+
+// snapshots don't save the data back on close, the memory repositories do
+// that otherwise
+type issuerSnapshot struct {
+	*issuer.MemoryRepository
+}
+
+func (issuerSnapshot) Close() error { return nil }
+
+type acquirerSnapshot struct {
+	*acquirer.MemoryRepository
+}
+
+func (acquirerSnapshot) Close() error { return nil }
+
+func openIssuerRepository(path string) (issuer.Repository, error) {
+	if filepath.Ext(path) != ".json" {
+		return issuer.NewSQLiteRepository(path)
+	}
+
+	if err := requireFile(path); err != nil {
+		return nil, err
+	}
+
+	repo := issuer.NewMemoryRepository()
+	if err := repo.LoadFromFile(path); err != nil {
+		return nil, fmt.Errorf("loading issuer snapshot: %w", err)
+	}
+
+	return issuerSnapshot{MemoryRepository: repo}, nil
+}
+
+func openAcquirerRepository(path string) (acquirer.Repository, error) {
+	if filepath.Ext(path) != ".json" {
+		return acquirer.NewSQLiteRepository(path)
+	}
+
+	if err := requireFile(path); err != nil {
+		return nil, err
+	}
+
+	repo := acquirer.NewMemoryRepository()
+	if err := repo.LoadFromFile(path); err != nil {
+		return nil, fmt.Errorf("loading acquirer snapshot: %w", err)
+	}
+
+	return acquirerSnapshot{MemoryRepository: repo}, nil
+}
+
+// requireFile returns an error if the file doesn't exist, the memory
+// repositories start empty without it.
+func requireFile(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("opening snapshot: %w", err)
+	}
+
+	return nil
+}
@@ -19,8 +19,9 @@ func main() {
 }
 
 func runTerminal() error {
-	// kernel flag
-	kernel := flag.String("kernel", "", "Kernel to use for the terminal (e.g., 'universal' or 'ftdc')")
+	cardProfile := flag.String("card", "", "Profile of the emulated card to use instead of the NFC reader (e.g., 'configs/card.yaml')")
+	apduTrace := flag.String("trace", "", "File to record the APDUs exchanged with the card to (e.g., 'card.jsonl')")
+	replayTrace := flag.String("replay", "", "Recorded APDU trace to replay instead of reading a card")
 	flag.Parse()
 
 	// we should read the config and flags and pass them to the terminal
@@ -31,8 +32,16 @@ func runTerminal() error {
 		return fmt.Errorf("loading config: %w", err)
 	}
 
-	if *kernel != "" {
-		cfg.Kernel = *kernel
+	if *cardProfile != "" {
+		cfg.CardProfile = *cardProfile
+	}
+
+	if *apduTrace != "" {
+		cfg.APDUTrace = *apduTrace
+	}
+
+	if *replayTrace != "" {
+		cfg.ReplayTrace = *replayTrace
 	}
 
 	terminal, err := tm.NewTerminal(cfg)
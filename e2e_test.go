@@ -1,16 +1,28 @@
 package main_test
 
 import (
+	"encoding/hex"
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/moov-io/bertlv"
 	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer"
 	acquirerClient "github.com/moov-io/ftdc-from-tap-to-auth/acquirer/client"
+	acquirer8583 "github.com/moov-io/ftdc-from-tap-to-auth/acquirer/iso8583"
 	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer/models"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/bin"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/clearing"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/emv"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/reconcile"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/storage"
 	"github.com/moov-io/ftdc-from-tap-to-auth/issuer"
 	issuerClient "github.com/moov-io/ftdc-from-tap-to-auth/issuer/client"
 	issuerModels "github.com/moov-io/ftdc-from-tap-to-auth/issuer/models"
 	"github.com/moov-io/ftdc-from-tap-to-auth/log"
+	cardswitch "github.com/moov-io/ftdc-from-tap-to-auth/switch"
 	"github.com/stretchr/testify/require"
 )
 
@@ -60,6 +72,8 @@ func TestEndToEndTransaction(t *testing.T) {
 	payment, err = acquirerClient.GetPayment(merchant.ID, payment.ID)
 	require.NoError(t, err)
 	require.Equal(t, models.PaymentStatusAuthorized, payment.Status)
+	require.Equal(t, "00", payment.ResponseCode)
+	require.Equal(t, "Approved or completed successfully", payment.ResponseDescription)
 
 	// In the issuer, there should be an authorized transaction for the card
 	transactions, err := issuerClient.GetTransactions(accountID)
@@ -73,6 +87,8 @@ func TestEndToEndTransaction(t *testing.T) {
 	require.Equal(t, "USD", transactions[0].Currency)
 	require.Equal(t, issuerModels.TransactionStatusAuthorized, transactions[0].Status)
 	require.Equal(t, payment.AuthorizationCode, transactions[0].AuthorizationCode)
+	require.Equal(t, issuerModels.VerificationResultMatch, transactions[0].ExpirationDateVerification)
+	require.Equal(t, issuerModels.VerificationResultMatch, transactions[0].CardVerificationValueVerification)
 
 	// check the merchant details
 	require.Equal(t, merchant.Name, transactions[0].Merchant.Name)
@@ -86,12 +102,1925 @@ func TestEndToEndTransaction(t *testing.T) {
 
 	require.Equal(t, int64(100_00-10_00), account.AvailableBalance)
 	require.Equal(t, int64(10_00), account.HoldBalance)
+
+	// When: the next payment exceeds the available balance
+	payment, err = acquirerClient.CreatePayment(merchant.ID, models.CreatePayment{
+		Card: models.Card{
+			Number:                card.Number,
+			CardVerificationValue: card.CardVerificationValue,
+			ExpirationDate:        card.ExpirationDate,
+		},
+		Amount:   100_00, // $100
+		Currency: "USD",
+	})
+	require.NoError(t, err)
+
+	// Then: it's declined with the insufficient funds response code
+	require.Equal(t, models.PaymentStatusDeclined, payment.Status)
+	require.Equal(t, "51", payment.ResponseCode)
+	require.Equal(t, "Not enough funds on the account", payment.ResponseDescription)
+}
+
+func TestEndToEndCapture(t *testing.T) {
+	issuerBasePath, iso8583ServerAddr := setupIssuer(t)
+	acquirerBasePath := setupAcquirer(t, iso8583ServerAddr)
+
+	issuerClient := issuerClient.New(issuerBasePath)
+	acquirerClient := acquirerClient.New(acquirerBasePath)
+
+	// Given: an account with $100 balance, a card and a merchant
+	accountID, err := issuerClient.CreateAccount(issuerModels.CreateAccount{
+		OwnerName: "John Doe",
+		Balance:   100_00,
+		Currency:  "USD",
+	})
+	require.NoError(t, err)
+
+	card, err := issuerClient.IssueCard(accountID)
+	require.NoError(t, err)
+
+	merchant, err := acquirerClient.CreateMerchant(models.CreateMerchant{
+		Name:       "Demo Merchant",
+		MCC:        "5411",
+		PostalCode: "12345",
+		WebSite:    "https://demo.merchant.com",
+	})
+	require.NoError(t, err)
+
+	// And: an authorized $10 payment
+	payment, err := acquirerClient.CreatePayment(merchant.ID, models.CreatePayment{
+		Card: models.Card{
+			Number:                card.Number,
+			CardVerificationValue: card.CardVerificationValue,
+			ExpirationDate:        card.ExpirationDate,
+		},
+		Amount:   10_00,
+		Currency: "USD",
+	})
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusAuthorized, payment.Status)
+
+	// When: the merchant captures only $6 of it
+	payment, err = acquirerClient.CapturePayment(merchant.ID, payment.ID, models.CreateCapture{
+		Amount: 6_00,
+	})
+	require.NoError(t, err)
+
+	// Then: the payment is captured for $6
+	require.Equal(t, models.PaymentStatusCaptured, payment.Status)
+	require.Equal(t, int64(6_00), payment.CapturedAmount)
+
+	// And: the issuer transaction is captured
+	transactions, err := issuerClient.GetTransactions(accountID)
+	require.NoError(t, err)
+	require.Len(t, transactions, 1)
+	require.Equal(t, issuerModels.TransactionStatusCaptured, transactions[0].Status)
+	require.Equal(t, int64(6_00), transactions[0].CapturedAmount)
+
+	// And: $6 is posted, the remaining $4 of the hold is released
+	account, err := issuerClient.GetAccount(accountID)
+	require.NoError(t, err)
+	require.Equal(t, int64(100_00-6_00), account.AvailableBalance)
+	require.Equal(t, int64(0), account.HoldBalance)
+
+	// And: the payment can't be captured twice
+	_, err = acquirerClient.CapturePayment(merchant.ID, payment.ID, models.CreateCapture{})
+	require.Error(t, err)
+}
+
+func TestEndToEndCaptureAndCompletionMessages(t *testing.T) {
+	issuerBasePath, iso8583ServerAddr := setupIssuer(t)
+	issuerClient := issuerClient.New(issuerBasePath)
+
+	// Given: an account with $100 balance and a card
+	accountID, err := issuerClient.CreateAccount(issuerModels.CreateAccount{
+		OwnerName: "John Doe",
+		Balance:   100_00,
+		Currency:  "USD",
+	})
+	require.NoError(t, err)
+
+	card, err := issuerClient.IssueCard(accountID)
+	require.NoError(t, err)
+
+	stanGenerator, err := acquirer8583.NewStanGenerator(acquirer.NewMemoryRepository())
+	require.NoError(t, err)
+
+	client, err := acquirer8583.NewClient(log.New(), iso8583ServerAddr, "000003", stanGenerator)
+	require.NoError(t, err)
+	require.NoError(t, client.Connect())
+	t.Cleanup(func() { client.Close() })
+
+	authorize := func(id string) *models.Payment {
+		payment := &models.Payment{ID: id, Amount: 10_00, Currency: "USD", CreatedAt: time.Now()}
+
+		response, err := client.AuthorizePayment(payment, models.CreatePayment{
+			Card: models.Card{
+				Number:                card.Number,
+				CardVerificationValue: card.CardVerificationValue,
+				ExpirationDate:        card.ExpirationDate,
+			},
+		}, models.Merchant{Name: "Demo Merchant", MCC: "5411", PostalCode: "12345"})
+		require.NoError(t, err)
+		require.Equal(t, "00", response.ResponseCode)
+
+		payment.AuthorizationCode = response.AuthorizationCode
+
+		return payment
+	}
+
+	transaction := func(stan string) issuerModels.Transaction {
+		transactions, err := issuerClient.GetTransactions(accountID)
+		require.NoError(t, err)
+
+		for _, transaction := range transactions {
+			if transaction.STAN == stan {
+				return transaction
+			}
+		}
+
+		require.FailNow(t, "transaction not found", "stan %s", stan)
+
+		return issuerModels.Transaction{}
+	}
+
+	entryTypes := func(transactionID string) []issuerModels.JournalEntryType {
+		ledger, err := issuerClient.GetLedger(accountID)
+		require.NoError(t, err)
+
+		var types []issuerModels.JournalEntryType
+		for _, entry := range ledger.Entries {
+			if entry.TransactionID == transactionID {
+				types = append(types, entry.Type)
+			}
+		}
+
+		return types
+	}
+
+	// When: a capture with another authorization code is sent
+	captured := authorize("payment-1")
+	authorizationCode := captured.AuthorizationCode
+	captured.AuthorizationCode = "000000"
+
+	response, err := client.CapturePayment(captured, 6_00)
+	require.NoError(t, err)
+
+	// Then: the capture request doesn't match the authorization
+	require.Equal(t, "25", response.ResponseCode)
+	require.Equal(t, issuerModels.TransactionStatusAuthorized, transaction(captured.STAN).Status)
+
+	// When: the capture has the authorization code
+	captured.AuthorizationCode = authorizationCode
+
+	response, err = client.CapturePayment(captured, 6_00)
+	require.NoError(t, err)
+	require.Equal(t, "00", response.ResponseCode)
+
+	// Then: the hold is captured
+	capturedTransaction := transaction(captured.STAN)
+	require.Equal(t, issuerModels.TransactionStatusCaptured, capturedTransaction.Status)
+	require.Equal(t, int64(6_00), capturedTransaction.CapturedAmount)
+	require.Equal(t, []issuerModels.JournalEntryType{
+		issuerModels.JournalEntryTypeHold,
+		issuerModels.JournalEntryTypeCapture,
+	}, entryTypes(capturedTransaction.ID))
+
+	// And: the capture request doesn't match the captured authorization
+	// again, nothing else is posted
+	response, err = client.CapturePayment(captured, 6_00)
+	require.NoError(t, err)
+	require.Equal(t, "25", response.ResponseCode)
+	require.Len(t, entryTypes(capturedTransaction.ID), 2)
+
+	// When: another authorization is completed
+	completed := authorize("payment-2")
+
+	response, err = client.CompletePayment(completed, 8_00)
+	require.NoError(t, err)
+	require.Equal(t, "00", response.ResponseCode)
+
+	// Then: the hold is captured by the completion
+	completedTransaction := transaction(completed.STAN)
+	require.Equal(t, issuerModels.TransactionStatusCaptured, completedTransaction.Status)
+	require.Equal(t, int64(8_00), completedTransaction.CapturedAmount)
+	require.Equal(t, []issuerModels.JournalEntryType{
+		issuerModels.JournalEntryTypeHold,
+		issuerModels.JournalEntryTypeCapture,
+	}, entryTypes(completedTransaction.ID))
+
+	// And: the repeated completion is approved without posting it again
+	response, err = client.CompletePayment(completed, 8_00)
+	require.NoError(t, err)
+	require.Equal(t, "00", response.ResponseCode)
+	require.Len(t, entryTypes(completedTransaction.ID), 2)
+
+	account, err := issuerClient.GetAccount(accountID)
+	require.NoError(t, err)
+	require.Equal(t, int64(100_00-6_00-8_00), account.AvailableBalance)
+	require.Equal(t, int64(0), account.HoldBalance)
+}
+
+func TestEndToEndReversal(t *testing.T) {
+	issuerBasePath, iso8583ServerAddr := setupIssuer(t)
+	issuerClient := issuerClient.New(issuerBasePath)
+
+	// Given: an account with $100 balance and a card
+	accountID, err := issuerClient.CreateAccount(issuerModels.CreateAccount{
+		OwnerName: "John Doe",
+		Balance:   100_00,
+		Currency:  "USD",
+	})
+	require.NoError(t, err)
+
+	card, err := issuerClient.IssueCard(accountID)
+	require.NoError(t, err)
+
+	// And: an ISO 8583 client connected to the issuer
+	stanGenerator, err := acquirer8583.NewStanGenerator(acquirer.NewMemoryRepository())
+	require.NoError(t, err)
+
+	iso8583Client, err := acquirer8583.NewClient(log.New(), iso8583ServerAddr, "000001", stanGenerator)
+	require.NoError(t, err)
+	require.NoError(t, iso8583Client.Connect())
+
+	// And: an authorized $10 payment
+	payment := &models.Payment{
+		ID:        "payment-1",
+		Amount:    10_00,
+		Currency:  "USD",
+		CreatedAt: time.Now(),
+	}
+
+	response, err := iso8583Client.AuthorizePayment(payment, models.CreatePayment{
+		Card: models.Card{
+			Number:                card.Number,
+			CardVerificationValue: card.CardVerificationValue,
+			ExpirationDate:        card.ExpirationDate,
+		},
+	}, models.Merchant{
+		Name:       "Demo Merchant",
+		MCC:        "5411",
+		PostalCode: "12345",
+		WebSite:    "https://demo.merchant.com",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "00", response.ResponseCode)
+
+	// When: the acquirer reverses the payment
+	reversal, err := iso8583Client.ReversePayment(payment)
+	require.NoError(t, err)
+	require.Equal(t, "00", reversal.ResponseCode)
+
+	// Then: the issuer transaction is reversed and the hold is released
+	transactions, err := issuerClient.GetTransactions(accountID)
+	require.NoError(t, err)
+	require.Len(t, transactions, 1)
+	require.Equal(t, issuerModels.TransactionStatusReversed, transactions[0].Status)
+
+	account, err := issuerClient.GetAccount(accountID)
+	require.NoError(t, err)
+	require.Equal(t, int64(100_00), account.AvailableBalance)
+	require.Equal(t, int64(0), account.HoldBalance)
+}
+
+func TestEndToEndIdempotentPayment(t *testing.T) {
+	issuerBasePath, iso8583ServerAddr := setupIssuer(t)
+	acquirerBasePath := setupAcquirer(t, iso8583ServerAddr)
+
+	issuerClient := issuerClient.New(issuerBasePath)
+	acquirerClient := acquirerClient.New(acquirerBasePath)
+
+	// Given: an account with $100 balance, a card and a merchant
+	accountID, err := issuerClient.CreateAccount(issuerModels.CreateAccount{
+		OwnerName: "John Doe",
+		Balance:   100_00,
+		Currency:  "USD",
+	})
+	require.NoError(t, err)
+
+	card, err := issuerClient.IssueCard(accountID)
+	require.NoError(t, err)
+
+	merchant, err := acquirerClient.CreateMerchant(models.CreateMerchant{
+		Name:       "Demo Merchant",
+		MCC:        "5411",
+		PostalCode: "12345",
+		WebSite:    "https://demo.merchant.com",
+	})
+	require.NoError(t, err)
+
+	create := models.CreatePayment{
+		Card: models.Card{
+			Number:                card.Number,
+			CardVerificationValue: card.CardVerificationValue,
+			ExpirationDate:        card.ExpirationDate,
+		},
+		Amount:   10_00,
+		Currency: "USD",
+	}
+
+	payment, err := acquirerClient.CreatePaymentWithIdempotencyKey(merchant.ID, "key-1", create)
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusAuthorized, payment.Status)
+
+	// When: the payment creation is retried with the same key
+	retried, err := acquirerClient.CreatePaymentWithIdempotencyKey(merchant.ID, "key-1", create)
+	require.NoError(t, err)
+
+	// Then: the same payment is returned and the card is charged once
+	require.Equal(t, payment.ID, retried.ID)
+	require.Equal(t, payment.AuthorizationCode, retried.AuthorizationCode)
+
+	transactions, err := issuerClient.GetTransactions(accountID)
+	require.NoError(t, err)
+	require.Len(t, transactions, 1)
+
+	// When: the key is used for another payment
+	create.Amount = 20_00
+	_, err = acquirerClient.CreatePaymentWithIdempotencyKey(merchant.ID, "key-1", create)
+
+	// Then: the request is rejected
+	require.ErrorIs(t, err, models.ErrIdempotencyKeyReused)
+
+	transactions, err = issuerClient.GetTransactions(accountID)
+	require.NoError(t, err)
+	require.Len(t, transactions, 1)
+}
+
+// fixedSTANGenerator sends every request with the same STAN, so the requests
+// for the same payment are retransmissions
+type fixedSTANGenerator string
+
+func (g fixedSTANGenerator) Next() (string, error) {
+	return string(g), nil
+}
+
+func TestEndToEndRetransmission(t *testing.T) {
+	issuerBasePath, iso8583ServerAddr := setupIssuer(t)
+	issuerClient := issuerClient.New(issuerBasePath)
+
+	// Given: an account with $100 balance and a card
+	accountID, err := issuerClient.CreateAccount(issuerModels.CreateAccount{
+		OwnerName: "John Doe",
+		Balance:   100_00,
+		Currency:  "USD",
+	})
+	require.NoError(t, err)
+
+	card, err := issuerClient.IssueCard(accountID)
+	require.NoError(t, err)
+
+	// And: two acquirers that send the same STAN
+	connect := func(acquirerID string) *acquirer8583.Client {
+		client, err := acquirer8583.NewClient(log.New(), iso8583ServerAddr, acquirerID, fixedSTANGenerator("000042"))
+		require.NoError(t, err)
+		require.NoError(t, client.Connect())
+		t.Cleanup(func() { client.Close() })
+
+		return client
+	}
+
+	first, second := connect("000001"), connect("000002")
+
+	authorize := func(client *acquirer8583.Client, payment *models.Payment) models.AuthorizationResponse {
+		response, err := client.AuthorizePayment(payment, models.CreatePayment{
+			Card: models.Card{
+				Number:                card.Number,
+				CardVerificationValue: card.CardVerificationValue,
+				ExpirationDate:        card.ExpirationDate,
+			},
+		}, models.Merchant{
+			Name:       "Demo Merchant",
+			MCC:        "5411",
+			PostalCode: "12345",
+			WebSite:    "https://demo.merchant.com",
+		})
+		require.NoError(t, err)
+
+		return response
+	}
+
+	payment := &models.Payment{
+		ID:        "payment-1",
+		Amount:    10_00,
+		Currency:  "USD",
+		CreatedAt: time.Now(),
+	}
+
+	original := authorize(first, payment)
+	require.Equal(t, "00", original.ResponseCode)
+
+	// When: the authorization is retransmitted
+	retransmitted := authorize(first, payment)
+
+	// Then: it gets the original response and no second hold is placed
+	require.Equal(t, original, retransmitted)
+
+	account, err := issuerClient.GetAccount(accountID)
+	require.NoError(t, err)
+	require.Equal(t, int64(10_00), account.HoldBalance)
+
+	// When: a request with the same trace is for another amount
+	payment.Amount = 20_00
+
+	// Then: it's declined as a duplicate
+	require.Equal(t, "94", authorize(first, payment).ResponseCode)
+
+	// When: another acquirer sends a request with the same trace
+	// Then: it's a new authorization
+	require.Equal(t, "00", authorize(second, payment).ResponseCode)
+
+	transactions, err := issuerClient.GetTransactions(accountID)
+	require.NoError(t, err)
+	require.Len(t, transactions, 2)
+
+	account, err = issuerClient.GetAccount(accountID)
+	require.NoError(t, err)
+	require.Equal(t, int64(30_00), account.HoldBalance)
+}
+
+func TestEndToEndCardVerification(t *testing.T) {
+	issuerBasePath, iso8583ServerAddr := setupIssuer(t)
+	acquirerBasePath := setupAcquirer(t, iso8583ServerAddr)
+
+	issuerClient := issuerClient.New(issuerBasePath)
+	acquirerClient := acquirerClient.New(acquirerBasePath)
+
+	// Given: an account with $100 balance, a card and a merchant
+	accountID, err := issuerClient.CreateAccount(issuerModels.CreateAccount{
+		OwnerName: "John Doe",
+		Balance:   100_00,
+		Currency:  "USD",
+	})
+	require.NoError(t, err)
+
+	card, err := issuerClient.IssueCard(accountID)
+	require.NoError(t, err)
+	require.NotEmpty(t, card.ExpirationDate)
+	require.NotEmpty(t, card.CardVerificationValue)
+
+	merchant, err := acquirerClient.CreateMerchant(models.CreateMerchant{
+		Name: "Demo Merchant",
+		MCC:  "5411",
+	})
+	require.NoError(t, err)
+
+	// wrong CVV
+	payment, err := acquirerClient.CreatePayment(merchant.ID, models.CreatePayment{
+		Card: models.Card{
+			Number:                card.Number,
+			CardVerificationValue: "000",
+			ExpirationDate:        card.ExpirationDate,
+		},
+		Amount:   10_00,
+		Currency: "USD",
+	})
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusDeclined, payment.Status)
+	require.Equal(t, "82", payment.ResponseCode)
+
+	// wrong expiration date
+	payment, err = acquirerClient.CreatePayment(merchant.ID, models.CreatePayment{
+		Card: models.Card{
+			Number:                card.Number,
+			CardVerificationValue: card.CardVerificationValue,
+			ExpirationDate:        "0199",
+		},
+		Amount:   10_00,
+		Currency: "USD",
+	})
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusDeclined, payment.Status)
+	require.Equal(t, "54", payment.ResponseCode)
+
+	// the issuer keeps the results of the checks on declined transactions
+	transactions, err := issuerClient.GetTransactions(accountID)
+	require.NoError(t, err)
+	require.Len(t, transactions, 2)
+
+	require.Equal(t, issuerModels.TransactionStatusDeclined, transactions[0].Status)
+	require.Equal(t, issuerModels.VerificationResultMatch, transactions[0].ExpirationDateVerification)
+	require.Equal(t, issuerModels.VerificationResultMismatch, transactions[0].CardVerificationValueVerification)
+
+	require.Equal(t, issuerModels.TransactionStatusDeclined, transactions[1].Status)
+	require.Equal(t, issuerModels.VerificationResultMismatch, transactions[1].ExpirationDateVerification)
+
+	// nothing is held on the account
+	account, err := issuerClient.GetAccount(accountID)
+	require.NoError(t, err)
+	require.Equal(t, int64(100_00), account.AvailableBalance)
+	require.Equal(t, int64(0), account.HoldBalance)
+}
+
+func TestEndToEndChipCryptogram(t *testing.T) {
+	issuerBasePath, iso8583ServerAddr := setupIssuer(t)
+	acquirerBasePath := setupAcquirer(t, iso8583ServerAddr)
+
+	issuerClient := issuerClient.New(issuerBasePath)
+	acquirerClient := acquirerClient.New(acquirerBasePath)
+
+	// Given: an account with $100 balance, a chip card and a merchant
+	accountID, err := issuerClient.CreateAccount(issuerModels.CreateAccount{
+		OwnerName: "John Doe",
+		Balance:   100_00,
+		Currency:  "USD",
+	})
+	require.NoError(t, err)
+
+	card, err := issuerClient.IssueCard(accountID)
+	require.NoError(t, err)
+
+	merchant, err := acquirerClient.CreateMerchant(models.CreateMerchant{
+		Name: "Demo Merchant",
+		MCC:  "5411",
+	})
+	require.NoError(t, err)
+
+	// the card computes the cryptogram with the key derived from the
+	// issuer master key, the one it's personalized with
+	issuerMasterKey, err := hex.DecodeString(issuer.DefaultIssuerMasterKey)
+	require.NoError(t, err)
+
+	masterKey, err := emv.DeriveICCMasterKey(issuerMasterKey, card.Number, "01")
+	require.NoError(t, err)
+
+	atc := []byte{0x00, 0x01}
+	sessionKey, err := emv.DeriveSessionKey(masterKey, atc)
+	require.NoError(t, err)
+
+	pan := card.Number
+	if len(pan)%2 != 0 {
+		pan += "F"
+	}
+	panBytes, err := hex.DecodeString(pan)
+	require.NoError(t, err)
+
+	// chip has expiration date in YYMMDD format
+	expirationDate, err := hex.DecodeString(card.ExpirationDate[2:] + card.ExpirationDate[:2] + "31")
+	require.NoError(t, err)
+
+	tlvs := []bertlv.TLV{
+		bertlv.NewTag("5A", panBytes),
+		bertlv.NewTag("5F24", expirationDate),
+		bertlv.NewTag("5F34", []byte{0x01}),
+		bertlv.NewTag("82", []byte{0x58, 0x00}),
+		bertlv.NewTag("9F36", atc),
+		bertlv.NewTag("9F02", []byte{0x00, 0x00, 0x00, 0x00, 0x10, 0x00}),
+		bertlv.NewTag("9F03", make([]byte, 6)),
+		bertlv.NewTag("9F1A", []byte{0x08, 0x40}),
+		bertlv.NewTag("95", make([]byte, 5)),
+		bertlv.NewTag("5F2A", []byte{0x08, 0x40}),
+		bertlv.NewTag("9A", []byte{0x26, 0x10, 0x17}),
+		bertlv.NewTag("9C", []byte{0x00}),
+		bertlv.NewTag("9F37", []byte{0xA1, 0xB2, 0xC3, 0xD4}),
+		bertlv.NewTag("9F35", []byte{0x22}),
+		bertlv.NewTag("9F45", make([]byte, 2)),
+		bertlv.NewTag("9F4C", make([]byte, 8)),
+		bertlv.NewTag("9F34", []byte{0x42, 0x03, 0x00}),
+	}
+
+	cdolData, err := emv.CDOL1.Data(tlvs)
+	require.NoError(t, err)
+
+	arqc, err := emv.ApplicationCryptogram(sessionKey, emv.CryptogramData(cdolData, []byte{0x58, 0x00}, atc))
+	require.NoError(t, err)
+
+	emvPayload, err := bertlv.Encode(append(tlvs, bertlv.NewTag("9F26", arqc)))
+	require.NoError(t, err)
+
+	// When: the payment with the valid cryptogram is made
+	payment, err := acquirerClient.CreatePayment(merchant.ID, models.CreatePayment{
+		EMVPayload: emvPayload,
+		Amount:     10_00,
+		Currency:   "USD",
+	})
+	require.NoError(t, err)
+
+	// Then: it's approved with the response cryptogram for the card
+	require.Equal(t, models.PaymentStatusAuthorized, payment.Status)
+	require.NotEmpty(t, payment.IssuerAuthenticationData)
+
+	responseTags, err := bertlv.Decode(payment.IssuerAuthenticationData)
+	require.NoError(t, err)
+
+	arpc, err := emv.ARPC(sessionKey, arqc, []byte("00"))
+	require.NoError(t, err)
+
+	issuerAuthenticationData, found := bertlv.FindFirstTag(responseTags, "91")
+	require.True(t, found)
+	require.Equal(t, append(arpc, '0', '0'), issuerAuthenticationData.Value)
+
+	arc, found := bertlv.FindFirstTag(responseTags, "8A")
+	require.True(t, found)
+	require.Equal(t, []byte("00"), arc.Value)
+
+	// When: the cryptogram doesn't match the data of the payment
+	tampered := append([]byte{}, arqc...)
+	tampered[0] ^= 0xFF
+
+	emvPayload, err = bertlv.Encode(append(tlvs, bertlv.NewTag("9F26", tampered)))
+	require.NoError(t, err)
+
+	payment, err = acquirerClient.CreatePayment(merchant.ID, models.CreatePayment{
+		EMVPayload: emvPayload,
+		Amount:     10_00,
+		Currency:   "USD",
+	})
+	require.NoError(t, err)
+
+	// Then: it's declined and the card gets no response cryptogram
+	require.Equal(t, models.PaymentStatusDeclined, payment.Status)
+	require.Equal(t, "63", payment.ResponseCode)
+	require.Empty(t, payment.IssuerAuthenticationData)
+
+	// When: the cryptogram is stripped from the chip data
+	emvPayload, err = bertlv.Encode(tlvs)
+	require.NoError(t, err)
+
+	payment, err = acquirerClient.CreatePayment(merchant.ID, models.CreatePayment{
+		EMVPayload: emvPayload,
+		Amount:     10_00,
+		Currency:   "USD",
+	})
+	require.NoError(t, err)
+
+	// Then: it's declined too, as the chip of the card always computes one
+	require.Equal(t, models.PaymentStatusDeclined, payment.Status)
+	require.Equal(t, "63", payment.ResponseCode)
+	require.Empty(t, payment.IssuerAuthenticationData)
+
+	transactions, err := issuerClient.GetTransactions(accountID)
+	require.NoError(t, err)
+	require.Len(t, transactions, 3)
+	require.Equal(t, issuerModels.VerificationResultMatch, transactions[0].CryptogramVerification)
+	require.Equal(t, issuerModels.VerificationResultMismatch, transactions[1].CryptogramVerification)
+	require.Equal(t, issuerModels.VerificationResultMissing, transactions[2].CryptogramVerification)
+}
+
+func TestEndToEndCardLifecycle(t *testing.T) {
+	issuerBasePath, iso8583ServerAddr := setupIssuer(t)
+	acquirerBasePath := setupAcquirer(t, iso8583ServerAddr)
+
+	issuerClient := issuerClient.New(issuerBasePath)
+	acquirerClient := acquirerClient.New(acquirerBasePath)
+
+	// Given: an account with $100 balance, a card and a merchant
+	accountID, err := issuerClient.CreateAccount(issuerModels.CreateAccount{
+		OwnerName: "John Doe",
+		Balance:   100_00,
+		Currency:  "USD",
+	})
+	require.NoError(t, err)
+
+	card, err := issuerClient.IssueCard(accountID)
+	require.NoError(t, err)
+	require.Equal(t, issuerModels.CardStatusActive, card.Status)
+
+	merchant, err := acquirerClient.CreateMerchant(models.CreateMerchant{
+		Name: "Demo Merchant",
+		MCC:  "5411",
+	})
+	require.NoError(t, err)
+
+	pay := func(card issuerModels.Card) models.Payment {
+		payment, err := acquirerClient.CreatePayment(merchant.ID, models.CreatePayment{
+			Card: models.Card{
+				Number:                card.Number,
+				CardVerificationValue: card.CardVerificationValue,
+				ExpirationDate:        card.ExpirationDate,
+			},
+			Amount:   10_00,
+			Currency: "USD",
+		})
+		require.NoError(t, err)
+
+		return payment
+	}
+
+	// blocked card is declined
+	card, err = issuerClient.ChangeCardStatus(accountID, card.ID, "block")
+	require.NoError(t, err)
+	require.Equal(t, issuerModels.CardStatusBlocked, card.Status)
+
+	payment := pay(card)
+	require.Equal(t, models.PaymentStatusDeclined, payment.Status)
+	require.Equal(t, "62", payment.ResponseCode)
+
+	// unblocked card is approved
+	card, err = issuerClient.ChangeCardStatus(accountID, card.ID, "unblock")
+	require.NoError(t, err)
+
+	payment = pay(card)
+	require.Equal(t, models.PaymentStatusAuthorized, payment.Status)
+
+	// stolen card is declined and can't be unblocked
+	card, err = issuerClient.ChangeCardStatus(accountID, card.ID, "stolen")
+	require.NoError(t, err)
+
+	payment = pay(card)
+	require.Equal(t, models.PaymentStatusDeclined, payment.Status)
+	require.Equal(t, "43", payment.ResponseCode)
+
+	_, err = issuerClient.ChangeCardStatus(accountID, card.ID, "unblock")
+	require.ErrorContains(t, err, "409")
+
+	// replacement card has a new PAN and works after activation
+	newCard, err := issuerClient.ReplaceCard(accountID, card.ID)
+	require.NoError(t, err)
+	require.NotEqual(t, card.Number, newCard.Number)
+	require.Equal(t, card.ID, newCard.ReplacesCardID)
+	require.Equal(t, issuerModels.CardStatusInactive, newCard.Status)
+
+	payment = pay(newCard)
+	require.Equal(t, models.PaymentStatusDeclined, payment.Status)
+	require.Equal(t, "05", payment.ResponseCode)
+
+	newCard, err = issuerClient.ChangeCardStatus(accountID, newCard.ID, "activate")
+	require.NoError(t, err)
+
+	payment = pay(newCard)
+	require.Equal(t, models.PaymentStatusAuthorized, payment.Status)
+}
+
+func TestEndToEndSpendingControls(t *testing.T) {
+	issuerBasePath, iso8583ServerAddr := setupIssuer(t)
+	acquirerBasePath := setupAcquirer(t, iso8583ServerAddr)
+
+	issuerClient := issuerClient.New(issuerBasePath)
+	acquirerClient := acquirerClient.New(acquirerBasePath)
+
+	// Given: an account with $100 balance, a card and a grocery store merchant
+	accountID, err := issuerClient.CreateAccount(issuerModels.CreateAccount{
+		OwnerName: "John Doe",
+		Balance:   100_00,
+		Currency:  "USD",
+	})
+	require.NoError(t, err)
+
+	card, err := issuerClient.IssueCard(accountID)
+	require.NoError(t, err)
+
+	merchant, err := acquirerClient.CreateMerchant(models.CreateMerchant{
+		Name: "Demo Merchant",
+		MCC:  "5411",
+	})
+	require.NoError(t, err)
+
+	pay := func(amount int64) models.Payment {
+		payment, err := acquirerClient.CreatePayment(merchant.ID, models.CreatePayment{
+			Card: models.Card{
+				Number:                card.Number,
+				CardVerificationValue: card.CardVerificationValue,
+				ExpirationDate:        card.ExpirationDate,
+			},
+			Amount:   amount,
+			Currency: "USD",
+		})
+		require.NoError(t, err)
+
+		return payment
+	}
+
+	// grocery stores are blocked
+	_, err = issuerClient.UpdateSpendingControls(accountID, card.ID, issuerModels.SpendingControls{
+		BlockedMCCs: []issuerModels.MCCRange{{From: "5400", To: "5499"}},
+	})
+	require.NoError(t, err)
+
+	payment := pay(10_00)
+	require.Equal(t, models.PaymentStatusDeclined, payment.Status)
+	require.Equal(t, "57", payment.ResponseCode)
+
+	// at most $50 per transaction and two transactions a day
+	_, err = issuerClient.UpdateSpendingControls(accountID, card.ID, issuerModels.SpendingControls{
+		MaxTransactionAmount: 50_00,
+		Daily:                issuerModels.VelocityLimit{MaxCount: 2},
+	})
+	require.NoError(t, err)
+
+	payment = pay(60_00)
+	require.Equal(t, models.PaymentStatusDeclined, payment.Status)
+	require.Equal(t, "61", payment.ResponseCode)
+
+	require.Equal(t, models.PaymentStatusAuthorized, pay(10_00).Status)
+	require.Equal(t, models.PaymentStatusAuthorized, pay(10_00).Status)
+
+	payment = pay(10_00)
+	require.Equal(t, models.PaymentStatusDeclined, payment.Status)
+	require.Equal(t, "65", payment.ResponseCode)
+
+	// declined transactions name the rule that fired
+	transactions, err := issuerClient.GetTransactions(accountID)
+	require.NoError(t, err)
+	require.Len(t, transactions, 5)
+
+	require.Equal(t, "spending control blocked_mcc", transactions[0].DeclineReason)
+	require.Equal(t, "spending control max_transaction_amount", transactions[1].DeclineReason)
+	require.Empty(t, transactions[2].DeclineReason)
+	require.Empty(t, transactions[3].DeclineReason)
+	require.Equal(t, "spending control daily_count", transactions[4].DeclineReason)
+
+	// invalid controls are rejected
+	_, err = issuerClient.UpdateSpendingControls(accountID, card.ID, issuerModels.SpendingControls{
+		BlockedMCCs: []issuerModels.MCCRange{{From: "54", To: "5499"}},
+	})
+	require.ErrorContains(t, err, "400")
+}
+
+func TestEndToEndLedger(t *testing.T) {
+	issuerBasePath, iso8583ServerAddr := setupIssuer(t)
+	acquirerBasePath := setupAcquirer(t, iso8583ServerAddr)
+
+	issuerClient := issuerClient.New(issuerBasePath)
+	acquirerClient := acquirerClient.New(acquirerBasePath)
+
+	// Given: an account with $100 balance, a card and a merchant
+	accountID, err := issuerClient.CreateAccount(issuerModels.CreateAccount{
+		OwnerName: "John Doe",
+		Balance:   100_00,
+		Currency:  "USD",
+	})
+	require.NoError(t, err)
+
+	card, err := issuerClient.IssueCard(accountID)
+	require.NoError(t, err)
+
+	merchant, err := acquirerClient.CreateMerchant(models.CreateMerchant{
+		Name:       "Demo Merchant",
+		MCC:        "5411",
+		PostalCode: "12345",
+		WebSite:    "https://demo.merchant.com",
+	})
+	require.NoError(t, err)
+
+	// When: a $10 payment is authorized and $6 of it captured
+	payment, err := acquirerClient.CreatePayment(merchant.ID, models.CreatePayment{
+		Card: models.Card{
+			Number:                card.Number,
+			CardVerificationValue: card.CardVerificationValue,
+			ExpirationDate:        card.ExpirationDate,
+		},
+		Amount:   10_00,
+		Currency: "USD",
+	})
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusAuthorized, payment.Status)
+
+	_, err = acquirerClient.CapturePayment(merchant.ID, payment.ID, models.CreateCapture{
+		Amount: 6_00,
+	})
+	require.NoError(t, err)
+
+	// And: the account is adjusted by $5
+	adjustment, err := issuerClient.AdjustBalance(accountID, issuerModels.CreateAdjustment{
+		Amount:      5_00,
+		Description: "goodwill credit",
+	})
+	require.NoError(t, err)
+	require.Equal(t, issuerModels.JournalEntryTypeAdjustment, adjustment.Type)
+
+	// Then: the ledger has balanced entries for each balance change
+	ledger, err := issuerClient.GetLedger(accountID)
+	require.NoError(t, err)
+	require.Len(t, ledger.Entries, 4)
+
+	expectedTypes := []issuerModels.JournalEntryType{
+		issuerModels.JournalEntryTypeOpening,
+		issuerModels.JournalEntryTypeHold,
+		issuerModels.JournalEntryTypeCapture,
+		issuerModels.JournalEntryTypeAdjustment,
+	}
+	for i, entry := range ledger.Entries {
+		require.Equal(t, expectedTypes[i], entry.Type)
+		require.NoError(t, entry.Validate())
+	}
+
+	// And: the balances are derived from the ledger
+	require.Equal(t, int64(100_00-6_00+5_00), ledger.AvailableBalance)
+	require.Equal(t, int64(0), ledger.HoldBalance)
+
+	account, err := issuerClient.GetAccount(accountID)
+	require.NoError(t, err)
+	require.Equal(t, ledger.AvailableBalance, account.AvailableBalance)
+	require.Equal(t, ledger.HoldBalance, account.HoldBalance)
+
+	// And: the balance can't be adjusted below zero
+	_, err = issuerClient.AdjustBalance(accountID, issuerModels.CreateAdjustment{
+		Amount:      -200_00,
+		Description: "overdraft",
+	})
+	require.Error(t, err)
+}
+
+func TestEndToEndIncrementalAuthorization(t *testing.T) {
+	issuerBasePath, iso8583ServerAddr := setupIssuer(t)
+	acquirerBasePath := setupAcquirer(t, iso8583ServerAddr)
+
+	issuerClient := issuerClient.New(issuerBasePath)
+	acquirerClient := acquirerClient.New(acquirerBasePath)
+
+	// Given: an account with $300 balance, a card and a hotel
+	accountID, err := issuerClient.CreateAccount(issuerModels.CreateAccount{
+		OwnerName: "John Doe",
+		Balance:   300_00,
+		Currency:  "USD",
+	})
+	require.NoError(t, err)
+
+	card, err := issuerClient.IssueCard(accountID)
+	require.NoError(t, err)
+
+	merchant, err := acquirerClient.CreateMerchant(models.CreateMerchant{
+		Name:       "Demo Hotel",
+		MCC:        "7011",
+		PostalCode: "12345",
+		WebSite:    "https://demo.hotel.com",
+	})
+	require.NoError(t, err)
+
+	// When: $100 is authorized at check-in
+	payment, err := acquirerClient.CreatePayment(merchant.ID, models.CreatePayment{
+		Card: models.Card{
+			Number:                card.Number,
+			CardVerificationValue: card.CardVerificationValue,
+			ExpirationDate:        card.ExpirationDate,
+		},
+		Amount:   100_00,
+		Currency: "USD",
+	})
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusAuthorized, payment.Status)
+
+	// And: the stay is extended by $150
+	incremented, err := acquirerClient.IncrementAuthorization(merchant.ID, payment.ID, models.CreateIncrement{
+		Amount: 150_00,
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(250_00), incremented.Amount)
+	require.Equal(t, payment.AuthorizationCode, incremented.AuthorizationCode)
+
+	// Then: the hold of the original transaction is increased
+	account, err := issuerClient.GetAccount(accountID)
+	require.NoError(t, err)
+	require.Equal(t, int64(50_00), account.AvailableBalance)
+	require.Equal(t, int64(250_00), account.HoldBalance)
+
+	transactions, err := issuerClient.GetTransactions(accountID)
+	require.NoError(t, err)
+	require.Len(t, transactions, 1)
+	require.Equal(t, int64(250_00), transactions[0].Amount)
+
+	// And: an increment over the available balance is declined and the hold
+	// stays as it was
+	_, err = acquirerClient.IncrementAuthorization(merchant.ID, payment.ID, models.CreateIncrement{
+		Amount: 100_00,
+	})
+	require.ErrorContains(t, err, "422")
+
+	account, err = issuerClient.GetAccount(accountID)
+	require.NoError(t, err)
+	require.Equal(t, int64(250_00), account.HoldBalance)
+
+	// When: $220 is completed at check-out
+	completed, err := acquirerClient.CompletePayment(merchant.ID, payment.ID, models.CreateCompletion{
+		Amount: 220_00,
+	})
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusCaptured, completed.Status)
+	require.Equal(t, int64(220_00), completed.CapturedAmount)
+
+	// Then: the final amount is posted and the rest of the hold is released
+	account, err = issuerClient.GetAccount(accountID)
+	require.NoError(t, err)
+	require.Equal(t, int64(80_00), account.AvailableBalance)
+	require.Equal(t, int64(0), account.HoldBalance)
+
+	transactions, err = issuerClient.GetTransactions(accountID)
+	require.NoError(t, err)
+	require.Equal(t, issuerModels.TransactionStatusCaptured, transactions[0].Status)
+	require.Equal(t, int64(220_00), transactions[0].CapturedAmount)
+}
+
+func TestEndToEndPartialApproval(t *testing.T) {
+	issuerBasePath, iso8583ServerAddr := setupIssuer(t)
+	acquirerBasePath := setupAcquirer(t, iso8583ServerAddr)
+
+	issuerClient := issuerClient.New(issuerBasePath)
+	acquirerClient := acquirerClient.New(acquirerBasePath)
+
+	// Given: a prepaid account with $30 balance, a card and a merchant
+	accountID, err := issuerClient.CreateAccount(issuerModels.CreateAccount{
+		OwnerName: "John Doe",
+		Balance:   30_00,
+		Currency:  "USD",
+	})
+	require.NoError(t, err)
+
+	card, err := issuerClient.IssueCard(accountID)
+	require.NoError(t, err)
+
+	merchant, err := acquirerClient.CreateMerchant(models.CreateMerchant{
+		Name:       "Demo Merchant",
+		MCC:        "5411",
+		PostalCode: "12345",
+		WebSite:    "https://demo.merchant.com",
+	})
+	require.NoError(t, err)
+
+	paymentCard := models.Card{
+		Number:                card.Number,
+		CardVerificationValue: card.CardVerificationValue,
+		ExpirationDate:        card.ExpirationDate,
+	}
+
+	// When: a $50 payment is made by a merchant that doesn't accept partial
+	// approvals
+	payment, err := acquirerClient.CreatePayment(merchant.ID, models.CreatePayment{
+		Card:     paymentCard,
+		Amount:   50_00,
+		Currency: "USD",
+	})
+	require.NoError(t, err)
+
+	// Then: the payment is declined for insufficient funds
+	require.Equal(t, models.PaymentStatusDeclined, payment.Status)
+	require.Equal(t, "51", payment.ResponseCode)
+
+	// When: the merchant accepts partial approvals
+	payment, err = acquirerClient.CreatePayment(merchant.ID, models.CreatePayment{
+		Card:            paymentCard,
+		Amount:          50_00,
+		Currency:        "USD",
+		PartialApproval: true,
+	})
+	require.NoError(t, err)
+
+	// Then: the available $30 is approved and $20 is left to pay
+	require.Equal(t, models.PaymentStatusAuthorized, payment.Status)
+	require.Equal(t, "10", payment.ResponseCode)
+	require.Equal(t, int64(50_00), payment.RequestedAmount)
+	require.Equal(t, int64(30_00), payment.Amount)
+	require.Equal(t, int64(20_00), payment.BalanceDue())
+
+	account, err := issuerClient.GetAccount(accountID)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), account.AvailableBalance)
+	require.Equal(t, int64(30_00), account.HoldBalance)
+
+	transactions, err := issuerClient.GetTransactions(accountID)
+	require.NoError(t, err)
+	require.Len(t, transactions, 2)
+	require.Equal(t, int64(50_00), transactions[1].RequestedAmount)
+	require.Equal(t, int64(30_00), transactions[1].Amount)
+
+	// And: the approved amount can be captured
+	payment, err = acquirerClient.CapturePayment(merchant.ID, payment.ID, models.CreateCapture{})
+	require.NoError(t, err)
+	require.Equal(t, int64(30_00), payment.CapturedAmount)
+
+	// And: with nothing left on the account the payment is declined
+	payment, err = acquirerClient.CreatePayment(merchant.ID, models.CreatePayment{
+		Card:            paymentCard,
+		Amount:          10_00,
+		Currency:        "USD",
+		PartialApproval: true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusDeclined, payment.Status)
+	require.Equal(t, int64(0), payment.BalanceDue())
+}
+
+func TestEndToEndRefundAndVoid(t *testing.T) {
+	issuerBasePath, iso8583ServerAddr := setupIssuer(t)
+	acquirerBasePath := setupAcquirer(t, iso8583ServerAddr)
+
+	issuerClient := issuerClient.New(issuerBasePath)
+	acquirerClient := acquirerClient.New(acquirerBasePath)
+
+	// Given: an account with $100 balance, a card and a merchant
+	accountID, err := issuerClient.CreateAccount(issuerModels.CreateAccount{
+		OwnerName: "John Doe",
+		Balance:   100_00,
+		Currency:  "USD",
+	})
+	require.NoError(t, err)
+
+	card, err := issuerClient.IssueCard(accountID)
+	require.NoError(t, err)
+
+	merchant, err := acquirerClient.CreateMerchant(models.CreateMerchant{
+		Name:       "Demo Merchant",
+		MCC:        "5411",
+		PostalCode: "12345",
+		WebSite:    "https://demo.merchant.com",
+	})
+	require.NoError(t, err)
+
+	pay := func(amount int64) models.Payment {
+		payment, err := acquirerClient.CreatePayment(merchant.ID, models.CreatePayment{
+			Card: models.Card{
+				Number:                card.Number,
+				CardVerificationValue: card.CardVerificationValue,
+				ExpirationDate:        card.ExpirationDate,
+			},
+			Amount:   amount,
+			Currency: "USD",
+		})
+		require.NoError(t, err)
+		require.Equal(t, models.PaymentStatusAuthorized, payment.Status)
+
+		return payment
+	}
+
+	// And: a captured $10 payment
+	payment := pay(10_00)
+	_, err = acquirerClient.CapturePayment(merchant.ID, payment.ID, models.CreateCapture{})
+	require.NoError(t, err)
+
+	// When: the merchant refunds $4 and then the remaining $6
+	refund, err := acquirerClient.RefundPayment(merchant.ID, payment.ID, models.CreateRefund{Amount: 4_00})
+	require.NoError(t, err)
+	require.Equal(t, models.RefundStatusApproved, refund.Status)
+	require.Equal(t, payment.ID, refund.PaymentID)
+
+	refund, err = acquirerClient.RefundPayment(merchant.ID, payment.ID, models.CreateRefund{Amount: 6_00})
+	require.NoError(t, err)
+	require.Equal(t, models.RefundStatusApproved, refund.Status)
+
+	// Then: the payment is refunded and each refund has its own record
+	payment, err = acquirerClient.GetPayment(merchant.ID, payment.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusRefunded, payment.Status)
+	require.Equal(t, int64(10_00), payment.RefundedAmount)
+
+	refunds, err := acquirerClient.GetRefunds(merchant.ID, payment.ID)
+	require.NoError(t, err)
+	require.Len(t, refunds, 2)
+
+	// And: nothing more can be refunded
+	_, err = acquirerClient.RefundPayment(merchant.ID, payment.ID, models.CreateRefund{Amount: 1_00})
+	require.Error(t, err)
+
+	// And: the issuer returned the funds to the account
+	transactions, err := issuerClient.GetTransactions(accountID)
+	require.NoError(t, err)
+	require.Len(t, transactions, 1)
+	require.Equal(t, issuerModels.TransactionStatusRefunded, transactions[0].Status)
+	require.Equal(t, int64(10_00), transactions[0].RefundedAmount)
+
+	account, err := issuerClient.GetAccount(accountID)
+	require.NoError(t, err)
+	require.Equal(t, int64(100_00), account.AvailableBalance)
+
+	// When: an authorized $20 payment and a captured $30 payment are voided
+	authorized := pay(20_00)
+	authorized, err = acquirerClient.VoidPayment(merchant.ID, authorized.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusVoided, authorized.Status)
+
+	captured := pay(30_00)
+	_, err = acquirerClient.CapturePayment(merchant.ID, captured.ID, models.CreateCapture{})
+	require.NoError(t, err)
+
+	captured, err = acquirerClient.VoidPayment(merchant.ID, captured.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusVoided, captured.Status)
+
+	// Then: the hold is released and the captured amount returned
+	account, err = issuerClient.GetAccount(accountID)
+	require.NoError(t, err)
+	require.Equal(t, int64(100_00), account.AvailableBalance)
+	require.Equal(t, int64(0), account.HoldBalance)
+
+	// And: voided payments can't be refunded
+	_, err = acquirerClient.RefundPayment(merchant.ID, captured.ID, models.CreateRefund{})
+	require.Error(t, err)
+}
+
+func TestEndToEndSettlement(t *testing.T) {
+	issuerBasePath, iso8583ServerAddr := setupIssuer(t)
+
+	clearingDir := t.TempDir()
+	acquirerApp := acquirer.NewApp(log.New(), &acquirer.Config{
+		HTTPAddr:    "127.0.0.1:0",
+		ISO8583Addr: iso8583ServerAddr,
+		Settlement: acquirer.SettlementConfig{
+			ClearingDir: clearingDir,
+			Fee:         models.Fee{BasisPoints: 100, Fixed: 10},
+		},
+	})
+	require.NoError(t, acquirerApp.Start())
+	t.Cleanup(acquirerApp.Shutdown)
+
+	issuerClient := issuerClient.New(issuerBasePath)
+	acquirerClient := acquirerClient.New(fmt.Sprintf("http://%s", acquirerApp.Addr))
+
+	// Given: an account with $100 balance, a card and a merchant
+	accountID, err := issuerClient.CreateAccount(issuerModels.CreateAccount{
+		OwnerName: "John Doe",
+		Balance:   100_00,
+		Currency:  "USD",
+	})
+	require.NoError(t, err)
+
+	card, err := issuerClient.IssueCard(accountID)
+	require.NoError(t, err)
+
+	merchant, err := acquirerClient.CreateMerchant(models.CreateMerchant{
+		Name:       "Demo Merchant",
+		MCC:        "5411",
+		PostalCode: "12345",
+		WebSite:    "https://demo.merchant.com",
+	})
+	require.NoError(t, err)
+
+	pay := func(amount int64) models.Payment {
+		payment, err := acquirerClient.CreatePayment(merchant.ID, models.CreatePayment{
+			Card: models.Card{
+				Number:                card.Number,
+				CardVerificationValue: card.CardVerificationValue,
+				ExpirationDate:        card.ExpirationDate,
+			},
+			Amount:   amount,
+			Currency: "USD",
+		})
+		require.NoError(t, err)
+
+		return payment
+	}
+
+	// And: a captured $10 payment, a captured $20 payment refunded by $5
+	// and an authorized $30 payment that is not captured yet
+	first := pay(10_00)
+	_, err = acquirerClient.CapturePayment(merchant.ID, first.ID, models.CreateCapture{})
+	require.NoError(t, err)
+
+	second := pay(20_00)
+	_, err = acquirerClient.CapturePayment(merchant.ID, second.ID, models.CreateCapture{})
+	require.NoError(t, err)
+
+	_, err = acquirerClient.RefundPayment(merchant.ID, second.ID, models.CreateRefund{Amount: 5_00})
+	require.NoError(t, err)
+
+	pay(30_00)
+
+	// When: the merchant's batch is closed
+	batches, err := acquirerClient.CloseBatches(merchant.ID)
+	require.NoError(t, err)
+	require.Len(t, batches, 1)
+
+	// Then: the batch has the captures, the refund and the fees of 1% + $0.10
+	batch := batches[0]
+	require.Equal(t, clearing.Totals{
+		CaptureCount:  2,
+		CaptureAmount: 30_00,
+		RefundCount:   1,
+		RefundAmount:  5_00,
+		FeeAmount:     20 + 30,
+		NetAmount:     30_00 - 5_00 - 50,
+	}, batch.Totals)
+
+	// And: the clearing file is written
+	written, err := os.ReadFile(filepath.Join(clearingDir, batch.ID+".csv"))
+	require.NoError(t, err)
+
+	file, err := acquirerClient.GetClearingFile(merchant.ID, batch.ID)
+	require.NoError(t, err)
+	require.Equal(t, written, file)
+
+	// And: there is nothing more to settle and settled payments can't be voided
+	_, err = acquirerClient.CloseBatches(merchant.ID)
+	require.Error(t, err)
+
+	_, err = acquirerClient.VoidPayment(merchant.ID, first.ID)
+	require.Error(t, err)
+
+	// When: the issuer ingests the clearing file
+	clearingBatch, err := issuerClient.IngestClearingFile(file)
+	require.NoError(t, err)
+
+	// Then: all records match the transactions posted online
+	require.Equal(t, batch.ID, clearingBatch.ID)
+	require.Equal(t, batch.Totals, clearingBatch.Totals)
+	require.Equal(t, 3, clearingBatch.Matched)
+	require.Equal(t, 0, clearingBatch.Posted+clearingBatch.Unmatched)
+
+	// And: the batch totals reconcile with the issuer's transactions
+	transactions, err := issuerClient.GetTransactions(accountID)
+	require.NoError(t, err)
+
+	var capturedAmount, refundedAmount int64
+	for _, transaction := range transactions {
+		capturedAmount += transaction.CapturedAmount
+		refundedAmount += transaction.RefundedAmount
+	}
+	require.Equal(t, batch.Totals.CaptureAmount, capturedAmount)
+	require.Equal(t, batch.Totals.RefundAmount, refundedAmount)
+
+	// And: the file can't be ingested twice
+	_, err = issuerClient.IngestClearingFile(file)
+	require.Error(t, err)
+}
+
+func TestEndToEndReconciliation(t *testing.T) {
+	dir := t.TempDir()
+
+	issuerApp := issuer.NewApp(log.New(), &issuer.Config{
+		HTTPAddr:        "127.0.0.1:0", // use random port
+		ISO8583Addr:     "127.0.0.1:0", // use random port
+		IssuerMasterKey: issuer.DefaultIssuerMasterKey,
+		Storage: storage.Config{
+			Backend: storage.BackendSQLite,
+			Path:    filepath.Join(dir, "issuer.db"),
+		},
+	})
+	require.NoError(t, issuerApp.Start())
+
+	acquirerApp := acquirer.NewApp(log.New(), &acquirer.Config{
+		HTTPAddr:    "127.0.0.1:0", // use random port
+		ISO8583Addr: issuerApp.ISO8583ServerAddr,
+		Storage: storage.Config{
+			Backend: storage.BackendSQLite,
+			Path:    filepath.Join(dir, "acquirer.db"),
+		},
+	})
+	require.NoError(t, acquirerApp.Start())
+
+	issuerAPI := issuerClient.New(fmt.Sprintf("http://%s", issuerApp.Addr))
+	acquirerAPI := acquirerClient.New(fmt.Sprintf("http://%s", acquirerApp.Addr))
+
+	// Given: an account with $100 balance, a card and a merchant
+	accountID, err := issuerAPI.CreateAccount(issuerModels.CreateAccount{
+		OwnerName: "John Doe",
+		Balance:   100_00,
+		Currency:  "USD",
+	})
+	require.NoError(t, err)
+
+	card, err := issuerAPI.IssueCard(accountID)
+	require.NoError(t, err)
+
+	merchant, err := acquirerAPI.CreateMerchant(models.CreateMerchant{
+		Name:       "Demo Merchant",
+		MCC:        "5411",
+		PostalCode: "12345",
+		WebSite:    "https://demo.merchant.com",
+	})
+	require.NoError(t, err)
+
+	// And: an authorized, a captured and refunded, and a declined payment
+	for _, amount := range []int64{10_00, 20_00, 200_00} {
+		payment, err := acquirerAPI.CreatePayment(merchant.ID, models.CreatePayment{
+			Card: models.Card{
+				Number:                card.Number,
+				CardVerificationValue: card.CardVerificationValue,
+				ExpirationDate:        card.ExpirationDate,
+			},
+			Amount:   amount,
+			Currency: "USD",
+		})
+		require.NoError(t, err)
+
+		if amount == 20_00 {
+			_, err = acquirerAPI.CapturePayment(merchant.ID, payment.ID, models.CreateCapture{})
+			require.NoError(t, err)
+
+			_, err = acquirerAPI.RefundPayment(merchant.ID, payment.ID, models.CreateRefund{Amount: 5_00})
+			require.NoError(t, err)
+		}
+	}
+
+	acquirerApp.Shutdown()
+	issuerApp.Shutdown()
+
+	// When: the databases are reconciled
+	issuerRepo, err := issuer.NewSQLiteRepository(filepath.Join(dir, "issuer.db"))
+	require.NoError(t, err)
+	defer issuerRepo.Close()
+
+	acquirerRepo, err := acquirer.NewSQLiteRepository(filepath.Join(dir, "acquirer.db"))
+	require.NoError(t, err)
+	defer acquirerRepo.Close()
+
+	transactions, err := reconcile.TransactionRecords(issuerRepo)
+	require.NoError(t, err)
+
+	payments, err := reconcile.PaymentRecords(acquirerRepo)
+	require.NoError(t, err)
+
+	report := reconcile.Reconcile(payments, transactions)
+
+	// Then: every payment has its transaction
+	require.False(t, report.HasDiscrepancies())
+	require.Equal(t, 3, report.Count(reconcile.StatusMatched))
+}
+
+func TestEndToEndSQLiteStorage(t *testing.T) {
+	dir := t.TempDir()
+
+	issuerConfig := &issuer.Config{
+		HTTPAddr:        "127.0.0.1:0", // use random port
+		ISO8583Addr:     "127.0.0.1:0", // use random port
+		IssuerMasterKey: issuer.DefaultIssuerMasterKey,
+		Storage: storage.Config{
+			Backend: storage.BackendSQLite,
+			Path:    filepath.Join(dir, "issuer.db"),
+		},
+	}
+	issuerApp := issuer.NewApp(log.New(), issuerConfig)
+	require.NoError(t, issuerApp.Start())
+
+	acquirerConfig := &acquirer.Config{
+		HTTPAddr:    "127.0.0.1:0", // use random port
+		ISO8583Addr: issuerApp.ISO8583ServerAddr,
+		Storage: storage.Config{
+			Backend: storage.BackendSQLite,
+			Path:    filepath.Join(dir, "acquirer.db"),
+		},
+	}
+	acquirerApp := acquirer.NewApp(log.New(), acquirerConfig)
+	require.NoError(t, acquirerApp.Start())
+
+	issuerAPI := issuerClient.New(fmt.Sprintf("http://%s", issuerApp.Addr))
+	acquirerAPI := acquirerClient.New(fmt.Sprintf("http://%s", acquirerApp.Addr))
+
+	// Given: an account with $100 balance, a card and a merchant
+	accountID, err := issuerAPI.CreateAccount(issuerModels.CreateAccount{
+		OwnerName: "John Doe",
+		Balance:   100_00,
+		Currency:  "USD",
+	})
+	require.NoError(t, err)
+
+	card, err := issuerAPI.IssueCard(accountID)
+	require.NoError(t, err)
+
+	merchant, err := acquirerAPI.CreateMerchant(models.CreateMerchant{
+		Name:       "Demo Merchant",
+		MCC:        "5411",
+		PostalCode: "12345",
+		WebSite:    "https://demo.merchant.com",
+	})
+	require.NoError(t, err)
+
+	// When: a $10 payment is authorized and captured
+	payment, err := acquirerAPI.CreatePayment(merchant.ID, models.CreatePayment{
+		Card: models.Card{
+			Number:                card.Number,
+			CardVerificationValue: card.CardVerificationValue,
+			ExpirationDate:        card.ExpirationDate,
+		},
+		Amount:   10_00,
+		Currency: "USD",
+	})
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusAuthorized, payment.Status)
+
+	_, err = acquirerAPI.CapturePayment(merchant.ID, payment.ID, models.CreateCapture{})
+	require.NoError(t, err)
+
+	// And: both apps are restarted
+	acquirerApp.Shutdown()
+	issuerApp.Shutdown()
+
+	issuerApp = issuer.NewApp(log.New(), issuerConfig)
+	require.NoError(t, issuerApp.Start())
+	t.Cleanup(issuerApp.Shutdown)
+
+	acquirerConfig.ISO8583Addr = issuerApp.ISO8583ServerAddr
+	acquirerApp = acquirer.NewApp(log.New(), acquirerConfig)
+	require.NoError(t, acquirerApp.Start())
+	t.Cleanup(acquirerApp.Shutdown)
+
+	issuerAPI = issuerClient.New(fmt.Sprintf("http://%s", issuerApp.Addr))
+	acquirerAPI = acquirerClient.New(fmt.Sprintf("http://%s", acquirerApp.Addr))
+
+	// Then: the captured payment is still there
+	stored, err := acquirerAPI.GetPayment(merchant.ID, payment.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusCaptured, stored.Status)
+	require.Equal(t, int64(10_00), stored.CapturedAmount)
+
+	// And: so are the issuer transaction and the balance
+	transactions, err := issuerAPI.GetTransactions(accountID)
+	require.NoError(t, err)
+	require.Len(t, transactions, 1)
+	require.Equal(t, issuerModels.TransactionStatusCaptured, transactions[0].Status)
+
+	account, err := issuerAPI.GetAccount(accountID)
+	require.NoError(t, err)
+	require.Equal(t, int64(100_00-10_00), account.AvailableBalance)
+	require.Equal(t, int64(0), account.HoldBalance)
+
+	// And: the STANs continue where they stopped
+	next, err := acquirerAPI.CreatePayment(merchant.ID, models.CreatePayment{
+		Card: models.Card{
+			Number:                card.Number,
+			CardVerificationValue: card.CardVerificationValue,
+			ExpirationDate:        card.ExpirationDate,
+		},
+		Amount:   10_00,
+		Currency: "USD",
+	})
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusAuthorized, next.Status)
+	require.Greater(t, next.STAN, payment.STAN)
+}
+
+func TestEndToEndStandIn(t *testing.T) {
+	// the issuer is restarted, so its data is kept in the database
+	issuerConfig := &issuer.Config{
+		HTTPAddr:        "127.0.0.1:0", // use random port
+		ISO8583Addr:     "127.0.0.1:0", // use random port
+		IssuerMasterKey: issuer.DefaultIssuerMasterKey,
+		Storage: storage.Config{
+			Backend: storage.BackendSQLite,
+			Path:    filepath.Join(t.TempDir(), "issuer.db"),
+		},
+	}
+	issuerApp := issuer.NewApp(log.New(), issuerConfig)
+	require.NoError(t, issuerApp.Start())
+
+	acquirerApp := acquirer.NewApp(log.New(), &acquirer.Config{
+		HTTPAddr:          "127.0.0.1:0", // use random port
+		ISO8583Addr:       issuerApp.ISO8583ServerAddr,
+		ReconnectInterval: 50 * time.Millisecond,
+		StandIn: acquirer.StandInConfig{
+			Enabled: true,
+			Limits:  models.StandInLimits{MaxAmount: 50_00, MaxTotalAmount: 100_00},
+		},
+	})
+	require.NoError(t, acquirerApp.Start())
+	t.Cleanup(acquirerApp.Shutdown)
+
+	issuerAPI := issuerClient.New(fmt.Sprintf("http://%s", issuerApp.Addr))
+	acquirerAPI := acquirerClient.New(fmt.Sprintf("http://%s", acquirerApp.Addr))
+
+	// Given: an account with $30 balance, a card and a merchant
+	accountID, err := issuerAPI.CreateAccount(issuerModels.CreateAccount{
+		OwnerName: "John Doe",
+		Balance:   30_00,
+		Currency:  "USD",
+	})
+	require.NoError(t, err)
+
+	card, err := issuerAPI.IssueCard(accountID)
+	require.NoError(t, err)
+
+	merchant, err := acquirerAPI.CreateMerchant(models.CreateMerchant{
+		Name:       "Demo Merchant",
+		MCC:        "5411",
+		PostalCode: "12345",
+		WebSite:    "https://demo.merchant.com",
+	})
+	require.NoError(t, err)
+
+	createPayment := func(amount int64) (models.Payment, error) {
+		return acquirerAPI.CreatePayment(merchant.ID, models.CreatePayment{
+			Card: models.Card{
+				Number:                card.Number,
+				CardVerificationValue: card.CardVerificationValue,
+				ExpirationDate:        card.ExpirationDate,
+			},
+			Amount:   amount,
+			Currency: "USD",
+		})
+	}
+
+	// And: $10 is authorized online
+	online, err := createPayment(10_00)
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusAuthorized, online.Status)
+	require.False(t, online.StandIn)
+
+	// When: the issuer goes down
+	issuerApp.Shutdown()
+
+	// Then: the $25 payment is approved in stand-in, although only $20 is
+	// available on the account
+	payment, err := createPayment(25_00)
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusAuthorized, payment.Status)
+	require.True(t, payment.StandIn)
+	require.Equal(t, "00", payment.ResponseCode)
+
+	// And: payments over the stand-in limit fail
+	_, err = createPayment(60_00)
+	require.Error(t, err)
+
+	// And: the payment can't be captured until the issuer is advised of it
+	_, err = acquirerAPI.CapturePayment(merchant.ID, payment.ID, models.CreateCapture{})
+	require.Error(t, err)
+
+	// When: the issuer is back on the same address
+	issuerConfig.ISO8583Addr = issuerApp.ISO8583ServerAddr
+	issuerApp = issuer.NewApp(log.New(), issuerConfig)
+	require.NoError(t, issuerApp.Start())
+	t.Cleanup(issuerApp.Shutdown)
+
+	issuerAPI = issuerClient.New(fmt.Sprintf("http://%s", issuerApp.Addr))
+
+	// Then: the acquirer reconnects and advises it of the stand-in payment
+	var transactions []issuerModels.Transaction
+	require.Eventually(t, func() bool {
+		transactions, err = issuerAPI.GetTransactions(accountID)
+		return err == nil && len(transactions) == 2 && transactions[1].StandIn
+	}, 5*time.Second, 50*time.Millisecond)
+
+	standIn := transactions[1]
+	require.Equal(t, issuerModels.TransactionStatusAuthorized, standIn.Status)
+	require.Equal(t, payment.AuthorizationCode, standIn.AuthorizationCode)
+	require.Equal(t, int64(25_00), standIn.Amount)
+	require.Equal(t, int64(5_00), standIn.OverdraftAmount)
+
+	// And: the amount is held, overdrawing the account
+	account, err := issuerAPI.GetAccount(accountID)
+	require.NoError(t, err)
+	require.Equal(t, int64(30_00-10_00-25_00), account.AvailableBalance)
+	require.Equal(t, int64(35_00), account.HoldBalance)
+
+	// And: the issuer reports the overdraft
+	overdrafts, err := issuerAPI.GetStandInOverdrafts()
+	require.NoError(t, err)
+	require.Len(t, overdrafts, 1)
+	require.Equal(t, standIn.ID, overdrafts[0].ID)
+
+	// And: the advised payment can be captured
+	require.Eventually(t, func() bool {
+		_, err := acquirerAPI.CapturePayment(merchant.ID, payment.ID, models.CreateCapture{})
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+
+	account, err = issuerAPI.GetAccount(accountID)
+	require.NoError(t, err)
+	require.Equal(t, int64(10_00), account.HoldBalance)
+}
+
+func TestEndToEndRouting(t *testing.T) {
+	// Given: two issuers with their own BINs
+	startIssuer := func(cardBIN string) *issuer.App {
+		app := issuer.NewApp(log.New(), &issuer.Config{
+			HTTPAddr:        "127.0.0.1:0", // use random port
+			ISO8583Addr:     "127.0.0.1:0", // use random port
+			IssuerMasterKey: issuer.DefaultIssuerMasterKey,
+			CardBIN:         cardBIN,
+		})
+		require.NoError(t, app.Start())
+
+		return app
+	}
+
+	firstIssuer := startIssuer("71")
+	t.Cleanup(firstIssuer.Shutdown)
+
+	secondIssuer := startIssuer("72")
+
+	// And: the acquirer routes the cards to the issuers by BIN
+	acquirerApp := acquirer.NewApp(log.New(), &acquirer.Config{
+		HTTPAddr: "127.0.0.1:0", // use random port
+		Routes: []acquirer.RouteConfig{
+			{
+				Name:        "first",
+				ISO8583Addr: firstIssuer.ISO8583ServerAddr,
+				BINRanges:   []bin.Range{{Start: "710000", End: "719999"}},
+			},
+			{
+				Name:        "second",
+				ISO8583Addr: secondIssuer.ISO8583ServerAddr,
+				BINRanges:   []bin.Range{{Start: "72"}},
+			},
+		},
+		ReconnectInterval: 50 * time.Millisecond,
+	})
+	require.NoError(t, acquirerApp.Start())
+	t.Cleanup(acquirerApp.Shutdown)
+
+	acquirerAPI := acquirerClient.New(fmt.Sprintf("http://%s", acquirerApp.Addr))
+
+	merchant, err := acquirerAPI.CreateMerchant(models.CreateMerchant{
+		Name:       "Demo Merchant",
+		MCC:        "5411",
+		PostalCode: "12345",
+		WebSite:    "https://demo.merchant.com",
+	})
+	require.NoError(t, err)
+
+	firstAPI := issuerClient.New(fmt.Sprintf("http://%s", firstIssuer.Addr))
+	secondAPI := issuerClient.New(fmt.Sprintf("http://%s", secondIssuer.Addr))
+
+	createPayment := func(number string, card issuerModels.Card) (models.Payment, error) {
+		return acquirerAPI.CreatePayment(merchant.ID, models.CreatePayment{
+			Card: models.Card{
+				Number:                number,
+				CardVerificationValue: card.CardVerificationValue,
+				ExpirationDate:        card.ExpirationDate,
+			},
+			Amount:   10_00,
+			Currency: "USD",
+		})
+	}
+
+	firstAccountID, err := firstAPI.CreateAccount(issuerModels.CreateAccount{
+		OwnerName: "John Doe",
+		Balance:   100_00,
+		Currency:  "USD",
+	})
+	require.NoError(t, err)
+
+	firstCard, err := firstAPI.IssueCard(firstAccountID)
+	require.NoError(t, err)
+
+	secondAccountID, err := secondAPI.CreateAccount(issuerModels.CreateAccount{
+		OwnerName: "Jane Doe",
+		Balance:   100_00,
+		Currency:  "USD",
+	})
+	require.NoError(t, err)
+
+	secondCard, err := secondAPI.IssueCard(secondAccountID)
+	require.NoError(t, err)
+
+	// When: the cards of both issuers are used
+	payment, err := createPayment(firstCard.Number, firstCard)
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusAuthorized, payment.Status)
+	require.Equal(t, "first", payment.Route)
+
+	payment, err = createPayment(secondCard.Number, secondCard)
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusAuthorized, payment.Status)
+	require.Equal(t, "second", payment.Route)
+
+	// Then: each issuer got the payment of its card
+	transactions, err := firstAPI.GetTransactions(firstAccountID)
+	require.NoError(t, err)
+	require.Len(t, transactions, 1)
+
+	transactions, err = secondAPI.GetTransactions(secondAccountID)
+	require.NoError(t, err)
+	require.Len(t, transactions, 1)
+
+	// When: no issuer serves the card
+	payment, err = createPayment("4242424242424242", firstCard)
+
+	// Then: the payment is declined
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusDeclined, payment.Status)
+	require.Equal(t, "15", payment.ResponseCode)
+
+	// When: the second issuer goes down
+	secondIssuer.Shutdown()
+
+	// Then: only its route is down
+	require.Eventually(t, func() bool {
+		routes, err := acquirerAPI.GetRoutes()
+		require.NoError(t, err)
+		require.Len(t, routes, 2)
+
+		return routes[0].Health == models.RouteHealthUp && routes[1].Health == models.RouteHealthDown
+	}, 5*time.Second, 50*time.Millisecond)
+
+	_, err = createPayment(secondCard.Number, secondCard)
+	require.Error(t, err)
+
+	payment, err = createPayment(firstCard.Number, firstCard)
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusAuthorized, payment.Status)
+}
+
+func TestEndToEndSwitch(t *testing.T) {
+	// Given: two issuers with their own BINs
+	startIssuer := func(cardBIN string) *issuer.App {
+		app := issuer.NewApp(log.New(), &issuer.Config{
+			HTTPAddr:        "127.0.0.1:0", // use random port
+			ISO8583Addr:     "127.0.0.1:0", // use random port
+			IssuerMasterKey: issuer.DefaultIssuerMasterKey,
+			CardBIN:         cardBIN,
+		})
+		require.NoError(t, app.Start())
+		t.Cleanup(app.Shutdown)
+
+		return app
+	}
+
+	firstIssuer := startIssuer("71")
+	secondIssuer := startIssuer("72")
+
+	// And: the switch routes the requests to the issuers by BIN
+	switchApp := cardswitch.NewApp(log.New(), &cardswitch.Config{
+		ISO8583Addr:   "127.0.0.1:0", // use random port
+		InstitutionID: "000100",
+		Routes: []cardswitch.RouteConfig{
+			{
+				Name:        "first",
+				ISO8583Addr: firstIssuer.ISO8583ServerAddr,
+				BINRanges:   []bin.Range{{Start: "71"}},
+			},
+			{
+				Name:        "second",
+				ISO8583Addr: secondIssuer.ISO8583ServerAddr,
+				BINRanges:   []bin.Range{{Start: "72"}},
+			},
+		},
+	})
+	require.NoError(t, switchApp.Start())
+	t.Cleanup(switchApp.Shutdown)
+
+	// And: the acquirer is connected to the switch only
+	acquirerAPI := acquirerClient.New(setupAcquirer(t, switchApp.ISO8583ServerAddr))
+
+	merchant, err := acquirerAPI.CreateMerchant(models.CreateMerchant{
+		Name:       "Demo Merchant",
+		MCC:        "5411",
+		PostalCode: "12345",
+		WebSite:    "https://demo.merchant.com",
+	})
+	require.NoError(t, err)
+
+	firstAPI := issuerClient.New(fmt.Sprintf("http://%s", firstIssuer.Addr))
+	secondAPI := issuerClient.New(fmt.Sprintf("http://%s", secondIssuer.Addr))
+
+	issueCard := func(api interface {
+		CreateAccount(issuerModels.CreateAccount) (string, error)
+		IssueCard(string) (issuerModels.Card, error)
+	}) (string, issuerModels.Card) {
+		accountID, err := api.CreateAccount(issuerModels.CreateAccount{
+			OwnerName: "John Doe",
+			Balance:   100_00,
+			Currency:  "USD",
+		})
+		require.NoError(t, err)
+
+		card, err := api.IssueCard(accountID)
+		require.NoError(t, err)
+
+		return accountID, card
+	}
+
+	pay := func(card issuerModels.Card, amount int64) models.Payment {
+		payment, err := acquirerAPI.CreatePayment(merchant.ID, models.CreatePayment{
+			Card: models.Card{
+				Number:                card.Number,
+				CardVerificationValue: card.CardVerificationValue,
+				ExpirationDate:        card.ExpirationDate,
+			},
+			Amount:   amount,
+			Currency: "USD",
+		})
+		require.NoError(t, err)
+
+		return payment
+	}
+
+	firstAccountID, firstCard := issueCard(firstAPI)
+	secondAccountID, secondCard := issueCard(secondAPI)
+
+	// When: the card of the first issuer is authorized, captured and
+	// partially refunded through the switch
+	payment := pay(firstCard, 10_00)
+	require.Equal(t, models.PaymentStatusAuthorized, payment.Status)
+
+	_, err = acquirerAPI.CapturePayment(merchant.ID, payment.ID, models.CreateCapture{})
+	require.NoError(t, err)
+
+	refund, err := acquirerAPI.RefundPayment(merchant.ID, payment.ID, models.CreateRefund{Amount: 4_00})
+	require.NoError(t, err)
+	require.Equal(t, models.RefundStatusApproved, refund.Status)
+
+	// Then: the first issuer got all of them
+	transactions, err := firstAPI.GetTransactions(firstAccountID)
+	require.NoError(t, err)
+	require.Len(t, transactions, 1)
+	require.Equal(t, int64(4_00), transactions[0].RefundedAmount)
+
+	// When: the card of the second issuer is authorized and voided
+	payment = pay(secondCard, 20_00)
+	require.Equal(t, models.PaymentStatusAuthorized, payment.Status)
+
+	payment, err = acquirerAPI.VoidPayment(merchant.ID, payment.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.PaymentStatusVoided, payment.Status)
+
+	// Then: the second issuer released the hold
+	account, err := secondAPI.GetAccount(secondAccountID)
+	require.NoError(t, err)
+	require.Equal(t, int64(100_00), account.AvailableBalance)
+	require.Equal(t, int64(0), account.HoldBalance)
+
+	// When: no issuer serves the card
+	payment = pay(issuerModels.Card{Number: "4242424242424242", ExpirationDate: "1230"}, 10_00)
+
+	// Then: the switch declines the payment
+	require.Equal(t, models.PaymentStatusDeclined, payment.Status)
+	require.Equal(t, "15", payment.ResponseCode)
 }
 
 func setupIssuer(t *testing.T) (string, string) {
 	app := issuer.NewApp(log.New(), &issuer.Config{
-		HTTPAddr:    "127.0.0.1:0", // use random port
-		ISO8583Addr: "127.0.0.1:0", // use random port
+		HTTPAddr:        "127.0.0.1:0", // use random port
+		ISO8583Addr:     "127.0.0.1:0", // use random port
+		IssuerMasterKey: issuer.DefaultIssuerMasterKey,
 	})
 	err := app.Start()
 	require.NoError(t, err)
@@ -35,12 +35,6 @@ var spec *iso8583.MessageSpec = &iso8583.MessageSpec{
 			Enc:         encoding.ASCII,
 			Pref:        prefix.ASCII.Fixed,
 		}),
-		5: field.NewString(&field.Spec{
-			Length:      2,
-			Description: "Approval Code",
-			Enc:         encoding.ASCII,
-			Pref:        prefix.ASCII.Fixed,
-		}),
 		6: field.NewString(&field.Spec{
 			Length:      6,
 			Description: "Authorization Code",
@@ -57,7 +51,7 @@ var spec *iso8583.MessageSpec = &iso8583.MessageSpec{
 			Length:      4,
 			Description: "Card Verification Value",
 			Enc:         encoding.ASCII,
-			Pref:        prefix.ASCII.Fixed,
+			Pref:        prefix.ASCII.LL,
 		}),
 		9: field.NewString(&field.Spec{
 			Length:      4,
@@ -102,6 +96,12 @@ var spec *iso8583.MessageSpec = &iso8583.MessageSpec{
 			Enc:         encoding.ASCII,
 			Pref:        prefix.ASCII.Fixed,
 		}),
+		39: field.NewString(&field.Spec{
+			Length:      2,
+			Description: "Response Code",
+			Enc:         encoding.ASCII,
+			Pref:        prefix.ASCII.Fixed,
+		}),
 	},
 }
 
@@ -128,8 +128,8 @@ type AcceptorInfo struct {
 
 type AuthorizationResponse struct {
 	MTI               string `iso8583:"0"`
-	ApprovalCode      string `iso8583:"5"`
 	AuthorizationCode string `iso8583:"6"`
+	ResponseCode      string `iso8583:"39"`
 }
 
 func main() {
@@ -167,6 +167,8 @@ func main() {
 	// TODO: see fields in human-readable format
 
 	// Step 5. connect to the FTDC Issuer and send the message
+	// The playground issuer accepts it without signing on with 0800 first
+	// (sign_on_optional in configs/issuer.yaml)
 	issuerAddr := "localhost:8583"
 	conn, err := net.Dial("tcp", issuerAddr)
 	if err != nil {
@@ -0,0 +1,117 @@
+// Package bin matches card numbers to the BIN ranges of the issuers, so the
+// acquirer and the switch can route the payments to the issuer of the card.
+package bin
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Range is a range of card numbers by their leading digits, e.g. 400000 to
+// 499999. Start and End have the same number of digits; a range with only
+// Start is the single prefix.
+type Range struct {
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+}
+
+// Validate checks that the bounds are digits of the same length.
+func (r Range) Validate() error {
+	end := r.end()
+
+	if r.Start == "" || len(r.Start) != len(end) {
+		return fmt.Errorf("bin range %s-%s: start and end must have the same number of digits", r.Start, end)
+	}
+
+	if strings.Trim(r.Start+end, "0123456789") != "" {
+		return fmt.Errorf("bin range %s-%s: only digits are allowed", r.Start, end)
+	}
+
+	if r.Start > end {
+		return fmt.Errorf("bin range %s-%s: start is after end", r.Start, end)
+	}
+
+	return nil
+}
+
+// Contains returns true if the card number is in the range.
+func (r Range) Contains(pan string) bool {
+	if len(pan) < len(r.Start) {
+		return false
+	}
+
+	prefix := pan[:len(r.Start)]
+
+	// the bounds and the prefix have the same length, so they compare as
+	// numbers
+	return r.Start <= prefix && prefix <= r.end()
+}
+
+// Share returns the share of all card numbers in the range. Of the ranges
+// that contain a card number, the one with the smallest share is the most
+// specific.
+func (r Range) Share() float64 {
+	start, _ := strconv.ParseFloat(r.Start, 64)
+	end, _ := strconv.ParseFloat(r.end(), 64)
+
+	return (end - start + 1) / math.Pow10(len(r.Start))
+}
+
+func (r Range) end() string {
+	if r.End == "" {
+		return r.Start
+	}
+
+	return r.End
+}
+
+// Match returns the share of the most specific of the ranges that contains
+// the card number, and false if none of them does. No ranges match all card
+// numbers with the share of 1, so they are the default of the more specific
+// ones.
+func Match(pan string, ranges []Range) (float64, bool) {
+	if len(ranges) == 0 {
+		return 1, true
+	}
+
+	share, found := 0.0, false
+	for _, r := range ranges {
+		if r.Contains(pan) && (!found || r.Share() < share) {
+			share, found = r.Share(), true
+		}
+	}
+
+	return share, found
+}
+
+// MostSpecific returns the item with the most specific of the ranges that
+// contain the card number, and false if the ranges of none of the items
+// contain it. Of the items with equally specific ranges the first one wins,
+// so an item can take over a part of the ranges of another one.
+func MostSpecific[T any](pan string, items []T, ranges func(T) []Range) (T, bool) {
+	var (
+		found T
+		share float64
+		ok    bool
+	)
+
+	for _, item := range items {
+		if s, matched := Match(pan, ranges(item)); matched && (!ok || s < share) {
+			found, share, ok = item, s, true
+		}
+	}
+
+	return found, ok
+}
+
+// MaskPAN returns the card number with all but the first 6 and the last 4
+// digits masked, so it can be logged.
+func MaskPAN(pan string) string {
+	if len(pan) < 10 {
+		return "******"
+	}
+
+	return pan[:6] + "******" + pan[len(pan)-4:]
+}
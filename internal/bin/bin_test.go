@@ -0,0 +1,39 @@
+package bin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMostSpecific(t *testing.T) {
+	type route struct {
+		name   string
+		ranges []Range
+	}
+
+	routes := []route{
+		{name: "default"},
+		{name: "visa", ranges: []Range{{Start: "4"}}},
+		{name: "visa-platinum", ranges: []Range{{Start: "424242", End: "424299"}}},
+		{name: "visa-copy", ranges: []Range{{Start: "4"}}},
+	}
+
+	ranges := func(r route) []Range { return r.ranges }
+
+	tests := map[string]string{
+		"4242424242424242": "visa-platinum",
+		"4111111111111111": "visa",
+		"5555555555554444": "default",
+	}
+
+	for pan, name := range tests {
+		found, ok := MostSpecific(pan, routes, ranges)
+		require.True(t, ok)
+		require.Equal(t, name, found.name, pan)
+	}
+
+	// without the default route no route serves the card
+	_, ok := MostSpecific("5555555555554444", routes[1:], ranges)
+	require.False(t, ok)
+}
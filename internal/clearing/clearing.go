@@ -0,0 +1,248 @@
+// Package clearing reads and writes the clearing files the acquirer creates
+// for the closed settlement batches and the issuer ingests to post them.
+//
+// A clearing file is a CSV file with a header record, a detail record for
+// every capture and refund of the batch and a trailer record with the batch
+// totals:
+//
+//	H,<batch id>,<merchant id>,<currency>,<created at>,<acquirer id>
+//	D,capture,<payment id>,,<stan>,<transmission date & time>,<authorization code>,<amount>,<fee>
+//	D,refund,<payment id>,<refund id>,<stan>,<transmission date & time>,<authorization code>,<amount>,<fee>
+//	T,<capture count>,<capture amount>,<refund count>,<refund amount>,<fee amount>,<net amount>
+//
+// The STAN and the transmission date & time are the ones of the original
+// authorization (0100), so together with the acquirer ID the issuer can find
+// its transaction. Amounts are
+// in minor units, the created at time is in RFC 3339 format.
+package clearing
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+var ErrInvalidFile = errors.New("invalid clearing file")
+
+type RecordType string
+
+const (
+	RecordTypeCapture RecordType = "capture"
+	RecordTypeRefund  RecordType = "refund"
+)
+
+// record types of the lines of the file
+const (
+	headerRecord  = "H"
+	detailRecord  = "D"
+	trailerRecord = "T"
+)
+
+// File is the clearing file of a settlement batch.
+type File struct {
+	BatchID    string
+	MerchantID string
+	AcquirerID string
+	Currency   string
+	CreatedAt  time.Time
+	Records    []Record
+	Totals     Totals
+}
+
+// Record is a capture or a refund of the batch.
+type Record struct {
+	Type      RecordType
+	PaymentID string
+	RefundID  string
+
+	// STAN and TransmissionDateTime of the original authorization
+	STAN                 string
+	TransmissionDateTime string
+	AuthorizationCode    string
+
+	Amount int64
+	Fee    int64
+}
+
+// Totals sum up the records of the batch. NetAmount is what the merchant
+// gets: the captured amount less the refunds and the fees.
+type Totals struct {
+	CaptureCount  int
+	CaptureAmount int64
+	RefundCount   int
+	RefundAmount  int64
+	FeeAmount     int64
+	NetAmount     int64
+}
+
+// Add adds the record to the totals.
+func (t *Totals) Add(record Record) {
+	switch record.Type {
+	case RecordTypeCapture:
+		t.CaptureCount++
+		t.CaptureAmount += record.Amount
+	case RecordTypeRefund:
+		t.RefundCount++
+		t.RefundAmount += record.Amount
+	}
+
+	t.FeeAmount += record.Fee
+	t.NetAmount = t.CaptureAmount - t.RefundAmount - t.FeeAmount
+}
+
+// Validate checks that the records are complete and that the totals of the
+// file match its records.
+func (f *File) Validate() error {
+	if f.BatchID == "" || f.MerchantID == "" || f.Currency == "" {
+		return fmt.Errorf("%w: batch id, merchant id and currency are required", ErrInvalidFile)
+	}
+
+	var totals Totals
+	for i, record := range f.Records {
+		if record.Type != RecordTypeCapture && record.Type != RecordTypeRefund {
+			return fmt.Errorf("%w: record %d: unknown type %q", ErrInvalidFile, i+1, record.Type)
+		}
+
+		if record.STAN == "" || record.TransmissionDateTime == "" {
+			return fmt.Errorf("%w: record %d: original stan and transmission date & time are required", ErrInvalidFile, i+1)
+		}
+
+		if record.Amount <= 0 || record.Fee < 0 {
+			return fmt.Errorf("%w: record %d: invalid amount or fee", ErrInvalidFile, i+1)
+		}
+
+		totals.Add(record)
+	}
+
+	if totals != f.Totals {
+		return fmt.Errorf("%w: totals %+v don't match the records %+v", ErrInvalidFile, f.Totals, totals)
+	}
+
+	return nil
+}
+
+// Write writes the file in the CSV format described in the package
+// documentation.
+func Write(w io.Writer, f *File) error {
+	cw := csv.NewWriter(w)
+
+	lines := [][]string{
+		{headerRecord, f.BatchID, f.MerchantID, f.Currency, f.CreatedAt.UTC().Format(time.RFC3339), f.AcquirerID},
+	}
+
+	for _, record := range f.Records {
+		lines = append(lines, []string{
+			detailRecord,
+			string(record.Type),
+			record.PaymentID,
+			record.RefundID,
+			record.STAN,
+			record.TransmissionDateTime,
+			record.AuthorizationCode,
+			strconv.FormatInt(record.Amount, 10),
+			strconv.FormatInt(record.Fee, 10),
+		})
+	}
+
+	lines = append(lines, []string{
+		trailerRecord,
+		strconv.Itoa(f.Totals.CaptureCount),
+		strconv.FormatInt(f.Totals.CaptureAmount, 10),
+		strconv.Itoa(f.Totals.RefundCount),
+		strconv.FormatInt(f.Totals.RefundAmount, 10),
+		strconv.FormatInt(f.Totals.FeeAmount, 10),
+		strconv.FormatInt(f.Totals.NetAmount, 10),
+	})
+
+	if err := cw.WriteAll(lines); err != nil {
+		return fmt.Errorf("writing clearing file: %w", err)
+	}
+
+	return nil
+}
+
+// Read reads the file written by Write and validates it.
+func Read(r io.Reader) (*File, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	lines, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidFile, err)
+	}
+
+	if len(lines) < 2 {
+		return nil, fmt.Errorf("%w: header and trailer records are required", ErrInvalidFile)
+	}
+
+	header, details, trailer := lines[0], lines[1:len(lines)-1], lines[len(lines)-1]
+
+	f := &File{}
+
+	if len(header) != 6 || header[0] != headerRecord {
+		return nil, fmt.Errorf("%w: invalid header record", ErrInvalidFile)
+	}
+
+	f.BatchID, f.MerchantID, f.Currency, f.AcquirerID = header[1], header[2], header[3], header[5]
+
+	if f.CreatedAt, err = time.Parse(time.RFC3339, header[4]); err != nil {
+		return nil, fmt.Errorf("%w: parsing created at: %w", ErrInvalidFile, err)
+	}
+
+	for i, line := range details {
+		if len(line) != 9 || line[0] != detailRecord {
+			return nil, fmt.Errorf("%w: invalid detail record %d", ErrInvalidFile, i+1)
+		}
+
+		record := Record{
+			Type:                 RecordType(line[1]),
+			PaymentID:            line[2],
+			RefundID:             line[3],
+			STAN:                 line[4],
+			TransmissionDateTime: line[5],
+			AuthorizationCode:    line[6],
+		}
+
+		if record.Amount, err = strconv.ParseInt(line[7], 10, 64); err != nil {
+			return nil, fmt.Errorf("%w: detail record %d: parsing amount: %w", ErrInvalidFile, i+1, err)
+		}
+
+		if record.Fee, err = strconv.ParseInt(line[8], 10, 64); err != nil {
+			return nil, fmt.Errorf("%w: detail record %d: parsing fee: %w", ErrInvalidFile, i+1, err)
+		}
+
+		f.Records = append(f.Records, record)
+	}
+
+	if len(trailer) != 7 || trailer[0] != trailerRecord {
+		return nil, fmt.Errorf("%w: invalid trailer record", ErrInvalidFile)
+	}
+
+	totals := make([]int64, 0, 6)
+	for _, value := range trailer[1:] {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: parsing trailer record: %w", ErrInvalidFile, err)
+		}
+
+		totals = append(totals, n)
+	}
+
+	f.Totals = Totals{
+		CaptureCount:  int(totals[0]),
+		CaptureAmount: totals[1],
+		RefundCount:   int(totals[2]),
+		RefundAmount:  totals[3],
+		FeeAmount:     totals[4],
+		NetAmount:     totals[5],
+	}
+
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
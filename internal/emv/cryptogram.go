@@ -0,0 +1,65 @@
+package emv
+
+import (
+	"crypto/cipher"
+	"fmt"
+)
+
+// CryptogramData returns the data the application cryptogram is computed
+// over, as the applet collects it in EMVCrypto.computeAC: the CDOL data the
+// terminal sent in GENERATE AC followed by the AIP (tag 82) and the ATC (tag
+// 9F36) of the card, the minimum set of EMV Book 2, Section 8.1.1, and the
+// bytes 80 00 00 the applet appends.
+func CryptogramData(cdolData, aip, atc []byte) []byte {
+	data := make([]byte, 0, len(cdolData)+len(aip)+len(atc)+3)
+	data = append(data, cdolData...)
+	data = append(data, aip...)
+	data = append(data, atc...)
+
+	return append(data, 0x80, 0x00, 0x00)
+}
+
+// ApplicationCryptogram computes the 8 byte application cryptogram (tag 9F26)
+// of the data with the session key. It is the CBC-MAC of ISO/IEC 9797-1 with
+// padding method 2 the applet computes with ALG_DES_MAC8_ISO9797_M2: every
+// block of the data is chained with 3DES, and the MAC is the last one.
+func ApplicationCryptogram(sessionKey, data []byte) ([]byte, error) {
+	block, err := newTripleDES(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	padded := padMethod2(data)
+	cipher.NewCBCEncrypter(block, make([]byte, 8)).CryptBlocks(padded, padded)
+
+	return padded[len(padded)-8:], nil
+}
+
+// ARPC computes the authorization response cryptogram of the ARQC and the
+// authorization response code (ARC, tag 8A) with the session key, as in EMV
+// Book 2, Section 8.2.1 (method 1). The card checks it to know the response
+// came from its issuer; the FTDC applet doesn't check it.
+func ARPC(sessionKey, arqc, arc []byte) ([]byte, error) {
+	if len(arqc) != 8 {
+		return nil, fmt.Errorf("arqc must be 8 bytes, got %d", len(arqc))
+	}
+
+	if len(arc) != 2 {
+		return nil, fmt.Errorf("arc must be 2 bytes, got %d", len(arc))
+	}
+
+	block, err := newTripleDES(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// ARQC xor (ARC || 00 00 00 00 00 00)
+	data := append([]byte{}, arqc...)
+	data[0] ^= arc[0]
+	data[1] ^= arc[1]
+
+	arpc := make([]byte, 8)
+	block.Encrypt(arpc, data)
+
+	return arpc, nil
+}
@@ -0,0 +1,100 @@
+package emv
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/moov-io/bertlv"
+)
+
+// DOLEntry is a data object in a data object list: the tag of the data the
+// card asks the terminal for and its length.
+type DOLEntry struct {
+	Tag    string
+	Length int
+}
+
+// DOL is a data object list, e.g. CDOL1 (tag 8C): the data the terminal sends
+// in GENERATE AC, concatenated in the order of the list without tags and
+// lengths.
+type DOL []DOLEntry
+
+// CDOL1 is the card risk management data object list 1 of the FTDC applet
+// (javacard/src/openemv/EMVStaticData.java): amount, other amount, terminal
+// country code, TVR, currency, date, transaction type, unpredictable number,
+// terminal type, data authentication code, ICC dynamic number and CVM results.
+var CDOL1 = DOL{
+	{"9F02", 6},
+	{"9F03", 6},
+	{"9F1A", 2},
+	{"95", 5},
+	{"5F2A", 2},
+	{"9A", 3},
+	{"9C", 1},
+	{"9F37", 4},
+	{"9F35", 1},
+	{"9F45", 2},
+	{"9F4C", 8},
+	{"9F34", 3},
+}
+
+// CDOL2 is the card risk management data object list 2 of the FTDC applet:
+// the issuer authentication data and the authorization response code of the
+// online response, the TVR, the unpredictable number and the ICC dynamic
+// number.
+var CDOL2 = DOL{
+	{"91", 10},
+	{"8A", 2},
+	{"95", 5},
+	{"9F37", 4},
+	{"9F4C", 8},
+}
+
+// Bytes returns the list as the card sends it, e.g. in tag 8C: the tags
+// followed by their lengths.
+func (d DOL) Bytes() ([]byte, error) {
+	var list []byte
+	for _, entry := range d {
+		tag, err := hex.DecodeString(entry.Tag)
+		if err != nil {
+			return nil, fmt.Errorf("decoding tag %s: %w", entry.Tag, err)
+		}
+
+		list = append(list, tag...)
+		list = append(list, byte(entry.Length))
+	}
+
+	return list, nil
+}
+
+// Length returns the length of the data of the list.
+func (d DOL) Length() int {
+	length := 0
+	for _, entry := range d {
+		length += entry.Length
+	}
+
+	return length
+}
+
+// Data returns the values of the tags in the order of the list. A value
+// shorter than the length in the list is padded with zeros on the right, as
+// the terminal does for the data it doesn't have. Missing tags are an error,
+// as the data would not be the data the card computed its cryptogram over.
+func (d DOL) Data(tlvs []bertlv.TLV) ([]byte, error) {
+	data := make([]byte, 0, d.Length())
+
+	for _, entry := range d {
+		tlv, found := bertlv.FindFirstTag(tlvs, entry.Tag)
+		if !found {
+			return nil, fmt.Errorf("tag %s of the data object list is missing", entry.Tag)
+		}
+
+		value := make([]byte, entry.Length)
+		copy(value, tlv.Value)
+
+		data = append(data, value...)
+	}
+
+	return data, nil
+}
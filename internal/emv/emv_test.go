@@ -0,0 +1,129 @@
+package emv
+
+import (
+	"crypto/des"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/moov-io/bertlv"
+	"github.com/stretchr/testify/require"
+)
+
+var issuerMasterKey, _ = hex.DecodeString("0123456789ABCDEFFEDCBA9876543210")
+
+// The expected key is computed with openssl: the halves are the 3DES ECB
+// encryptions of the rightmost 16 digits of PAN || PSN and of their
+// complement, with the parity of each byte made odd, e.g.
+//
+//	echo -n 0000000000007001 | xxd -r -p |
+//	  openssl enc -des-ede-ecb -K 0123456789ABCDEFFEDCBA9876543210 -nopad | xxd -p
+func TestDeriveICCMasterKey(t *testing.T) {
+	key, err := DeriveICCMasterKey(issuerMasterKey, "7000000000000070", "01")
+	require.NoError(t, err)
+	require.Equal(t, "858520F816B00B023892DF75E6D96DA2", fmt.Sprintf("%X", key))
+
+	// the padding of the PAN in tag 5A is ignored
+	padded, err := DeriveICCMasterKey(issuerMasterKey, "7000000000000070F", "01")
+	require.NoError(t, err)
+	require.Equal(t, key, padded)
+
+	// each card has its own key
+	other, err := DeriveICCMasterKey(issuerMasterKey, "7000000000000071", "01")
+	require.NoError(t, err)
+	require.NotEqual(t, key, other)
+
+	other, err = DeriveICCMasterKey(issuerMasterKey, "7000000000000070", "02")
+	require.NoError(t, err)
+	require.NotEqual(t, key, other)
+
+	_, err = DeriveICCMasterKey(issuerMasterKey[:8], "7000000000000070", "01")
+	require.Error(t, err)
+}
+
+// the master key the FTDC applet (javacard/src/openemv/EMVCrypto.java) ships
+// with (javacard/src/openemv/EMVCrypto.java)
+var masterKey, _ = hex.DecodeString("01020304050607080910111213141516")
+
+// The expected values are computed with openssl the way the applet computes
+// them, not with this package: the session key is the 3DES CBC encryption of
+// ATC || 0F || 00.. with its padding, and the cryptogram is the last block of
+// the 3DES CBC encryption of the padded data, e.g.
+//
+//	echo -n 00010F00000000008000000000000000 | xxd -r -p |
+//	  openssl enc -des-ede-cbc -K 01020304050607080910111213141516 -iv 0000000000000000 -nopad | xxd -p
+func TestDeriveSessionKey(t *testing.T) {
+	sessionKey, err := DeriveSessionKey(masterKey, []byte{0x00, 0x01})
+	require.NoError(t, err)
+	require.Equal(t, "A98C39AB760F7D5FB5367BAA762A01F9", fmt.Sprintf("%X", sessionKey), "session key of atc 0001")
+
+	// every transaction has its own key
+	sessionKey, err = DeriveSessionKey(masterKey, []byte{0x00, 0x02})
+	require.NoError(t, err)
+	require.Equal(t, "DEB9815E6B07BFF6F4DC2BF7D671D42D", fmt.Sprintf("%X", sessionKey), "session key of atc 0002")
+
+	_, err = DeriveSessionKey(masterKey[:8], []byte{0x00, 0x01})
+	require.Error(t, err)
+}
+
+func TestCryptograms(t *testing.T) {
+	atc := []byte{0x00, 0x01}
+	aip := []byte{0x58, 0x00}
+
+	sessionKey, err := DeriveSessionKey(masterKey, atc)
+	require.NoError(t, err)
+
+	tlvs := []bertlv.TLV{
+		bertlv.NewTag("9F02", []byte{0x00, 0x00, 0x00, 0x00, 0x10, 0x00}),
+		bertlv.NewTag("9F03", make([]byte, 6)),
+		bertlv.NewTag("9F1A", []byte{0x08, 0x40}),
+		bertlv.NewTag("95", make([]byte, 5)),
+		bertlv.NewTag("5F2A", []byte{0x08, 0x40}),
+		bertlv.NewTag("9A", []byte{0x26, 0x10, 0x17}),
+		bertlv.NewTag("9C", []byte{0x00}),
+		bertlv.NewTag("9F37", []byte{0xA1, 0xB2, 0xC3, 0xD4}),
+		bertlv.NewTag("9F35", []byte{0x22}),
+		bertlv.NewTag("9F45", make([]byte, 2)),
+		bertlv.NewTag("9F4C", make([]byte, 8)),
+		bertlv.NewTag("9F34", []byte{0x42, 0x03}), // shorter than in CDOL1
+	}
+
+	cdolData, err := CDOL1.Data(tlvs)
+	require.NoError(t, err)
+	require.Equal(t, "00000000100000000000000008400000000000084026101700A1B2C3D42200000000000000000000420300", fmt.Sprintf("%X", cdolData))
+
+	data := CryptogramData(cdolData, aip, atc)
+	require.Equal(t, "58000001800000", fmt.Sprintf("%X", data[len(cdolData):]))
+
+	arqc, err := ApplicationCryptogram(sessionKey, data)
+	require.NoError(t, err)
+	require.Equal(t, "5CCB2201253E09C9", fmt.Sprintf("%X", arqc))
+
+	// the second cryptogram is computed over the CDOL2 data only, with the
+	// session key of the first
+	cdol2Data, err := hex.DecodeString("1122334455667788303030300000000000A1B2C3D40000000000000000")
+	require.NoError(t, err)
+	require.Len(t, cdol2Data, CDOL2.Length())
+
+	tc, err := ApplicationCryptogram(sessionKey, CryptogramData(cdol2Data, aip, atc))
+	require.NoError(t, err)
+	require.Equal(t, "A2D43762EFC79630", fmt.Sprintf("%X", tc))
+
+	// the card decrypts the ARPC to ARQC xor ARC
+	arc := []byte("00")
+	arpc, err := ARPC(sessionKey, arqc, arc)
+	require.NoError(t, err)
+
+	block, err := des.NewTripleDESCipher(append(append([]byte{}, sessionKey...), sessionKey[:8]...))
+	require.NoError(t, err)
+
+	decrypted := make([]byte, 8)
+	block.Decrypt(decrypted, arpc)
+
+	expected := append([]byte{arqc[0] ^ arc[0], arqc[1] ^ arc[1]}, arqc[2:]...)
+	require.Equal(t, expected, decrypted)
+
+	// the data of the card risk management is incomplete
+	_, err = CDOL1.Data(tlvs[1:])
+	require.Error(t, err)
+}
@@ -0,0 +1,127 @@
+// Package emv implements the cryptography the issuer and the chip share: the
+// derivation of the card keys from the issuer master key, the session keys of
+// the card and the application cryptograms (ARQC) and their responses (ARPC). The algorithms are the ones of the FTDC JavaCard applet
+// (javacard/src/openemv/EMVCrypto.java), so the issuer can verify the
+// cryptograms of the cards we flash.
+package emv
+
+import (
+	"crypto/cipher"
+	"crypto/des"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// KeyLength is the length of the double-length 3DES keys.
+const KeyLength = 16
+
+// DeriveICCMasterKey derives the card's master key for application
+// cryptograms from the issuer master key, the PAN and the PAN sequence number
+// (tag 5F34), as in EMV Book 2, Annex A1.4.1 (option A). Each card has its own
+// key, so the key of one card reveals nothing about the others.
+func DeriveICCMasterKey(issuerMasterKey []byte, pan, panSequenceNumber string) ([]byte, error) {
+	if panSequenceNumber == "" {
+		panSequenceNumber = "00"
+	}
+
+	// the rightmost 16 digits of the PAN and the sequence number, padded
+	// with zeros on the left when there are fewer
+	digits := strings.TrimRight(pan, "F") + panSequenceNumber
+	if len(digits) > 16 {
+		digits = digits[len(digits)-16:]
+	}
+	digits = strings.Repeat("0", 16-len(digits)) + digits
+
+	y, err := hex.DecodeString(digits)
+	if err != nil {
+		return nil, fmt.Errorf("decoding pan digits: %w", err)
+	}
+
+	block, err := newTripleDES(issuerMasterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key := make([]byte, KeyLength)
+	block.Encrypt(key[:8], y)
+
+	for i := range y {
+		y[i] ^= 0xFF
+	}
+	block.Encrypt(key[8:], y)
+
+	return withOddParity(key), nil
+}
+
+// DeriveSessionKey derives the session key of the transaction from the card's
+// master key and the application transaction counter (tag 9F36) the way the
+// applet does in EMVCrypto.setSessionKey. The applet means to follow EMV Book
+// 2, Annex A1.3.1, but it encrypts ATC || 0F || 00.. in CBC mode with padding
+// method 2, so the 16 bytes of the encryption overwrite both halves of the
+// key: the key is E(D) || E(E(D) xor 80 00..) with D = ATC || 0F || 00.. Every
+// transaction still has its own key, as the card increments the counter.
+func DeriveSessionKey(masterKey, atc []byte) ([]byte, error) {
+	if len(atc) != 2 {
+		return nil, fmt.Errorf("atc must be 2 bytes, got %d", len(atc))
+	}
+
+	block, err := newTripleDES(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	diversification := make([]byte, 8)
+	copy(diversification, atc)
+	diversification[2] = 0x0F
+
+	// the encryption of the diversification data padded with 80 00..
+	key := make([]byte, KeyLength)
+	cipher.NewCBCEncrypter(block, make([]byte, 8)).CryptBlocks(key, padMethod2(diversification))
+
+	return key, nil
+}
+
+// newTripleDES returns the 3DES cipher of the double-length key K1 || K2,
+// which is used as K1 || K2 || K1.
+func newTripleDES(key []byte) (cipher.Block, error) {
+	if len(key) != KeyLength {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", KeyLength, len(key))
+	}
+
+	block, err := des.NewTripleDESCipher(append(append([]byte{}, key...), key[:8]...))
+	if err != nil {
+		return nil, fmt.Errorf("creating 3des cipher: %w", err)
+	}
+
+	return block, nil
+}
+
+// padMethod2 pads the data with padding method 2 of ISO/IEC 9797-1: 80 and
+// then zeros up to the block size. Data of whole blocks gets a block of
+// padding.
+func padMethod2(data []byte) []byte {
+	padded := append(append([]byte{}, data...), 0x80)
+	for len(padded)%8 != 0 {
+		padded = append(padded, 0x00)
+	}
+
+	return padded
+}
+
+// withOddParity sets the lowest bit of each byte of the DES key, so each byte
+// has an odd number of ones.
+func withOddParity(key []byte) []byte {
+	for i, b := range key {
+		ones := 0
+		for bit := 1; bit < 0x100; bit <<= 1 {
+			if int(b)&bit != 0 && bit != 1 {
+				ones++
+			}
+		}
+
+		key[i] = b&0xFE | byte(1-ones%2)
+	}
+
+	return key
+}
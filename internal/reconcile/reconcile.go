@@ -0,0 +1,306 @@
+// Package reconcile matches the acquirer's payments to the issuer's
+// transactions and reports the discrepancies between them.
+package reconcile
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer"
+	acquirerModels "github.com/moov-io/ftdc-from-tap-to-auth/acquirer/models"
+	"github.com/moov-io/ftdc-from-tap-to-auth/issuer"
+	issuerModels "github.com/moov-io/ftdc-from-tap-to-auth/issuer/models"
+)
+
+type Status string
+
+const (
+	StatusMatched           Status = "matched"
+	StatusMissingOnIssuer   Status = "missing on issuer"
+	StatusMissingOnAcquirer Status = "missing on acquirer"
+	StatusAmountMismatch    Status = "amount mismatch"
+)
+
+// Record is a payment or a transaction with the fields they are matched by.
+type Record struct {
+	ID     string
+	Status string
+
+	// STAN and TransmissionDateTime of the authorization request. STANs
+	// start over when the acquirer restarts, so the transmission date &
+	// time tells apart the requests with the same STAN.
+	STAN                 string
+	TransmissionDateTime string
+	AuthorizationCode    string
+	MaskedPAN            string
+
+	Amount         int64
+	CapturedAmount int64
+	RefundedAmount int64
+}
+
+func (r Record) key() string {
+	return r.STAN + "|" + r.TransmissionDateTime + "|" + r.AuthorizationCode + "|" + r.MaskedPAN
+}
+
+// Entry is the result of matching a payment to a transaction. Payment or
+// Transaction is nil if the record is missing on its side.
+type Entry struct {
+	Status      Status
+	Payment     *Record
+	Transaction *Record
+	Reason      string
+}
+
+type Report struct {
+	CreatedAt    time.Time
+	Payments     int
+	Transactions int
+	Entries      []Entry
+}
+
+// Count returns the number of entries with the status.
+func (r *Report) Count(status Status) int {
+	var n int
+	for _, entry := range r.Entries {
+		if entry.Status == status {
+			n++
+		}
+	}
+
+	return n
+}
+
+// HasDiscrepancies returns true if any payment or transaction didn't match.
+func (r *Report) HasDiscrepancies() bool {
+	return r.Count(StatusMatched) != len(r.Entries)
+}
+
+// MaskPAN returns the PAN with all but the first 6 and the last 4 digits
+// masked, the way the acquirer keeps it.
+func MaskPAN(first6, last4 string) string {
+	return first6 + "******" + last4
+}
+
+// Reconcile matches the payments to the transactions by STAN, transmission
+// date & time, authorization code and masked PAN, and compares the amounts
+// of the matched pairs.
+func Reconcile(payments, transactions []Record) *Report {
+	report := &Report{
+		CreatedAt:    time.Now(),
+		Payments:     len(payments),
+		Transactions: len(transactions),
+	}
+
+	byKey := make(map[string][]Record)
+	for _, transaction := range transactions {
+		byKey[transaction.key()] = append(byKey[transaction.key()], transaction)
+	}
+
+	for _, payment := range payments {
+		candidates := byKey[payment.key()]
+		if len(candidates) == 0 {
+			report.Entries = append(report.Entries, Entry{
+				Status:  StatusMissingOnIssuer,
+				Payment: &payment,
+			})
+			continue
+		}
+
+		transaction := candidates[0]
+		byKey[payment.key()] = candidates[1:]
+
+		entry := Entry{
+			Status:      StatusMatched,
+			Payment:     &payment,
+			Transaction: &transaction,
+		}
+
+		switch {
+		case payment.Amount != transaction.Amount:
+			entry.Reason = fmt.Sprintf("amount %d on acquirer, %d on issuer", payment.Amount, transaction.Amount)
+		case payment.CapturedAmount != transaction.CapturedAmount:
+			entry.Reason = fmt.Sprintf("captured amount %d on acquirer, %d on issuer", payment.CapturedAmount, transaction.CapturedAmount)
+		case payment.RefundedAmount != transaction.RefundedAmount:
+			entry.Reason = fmt.Sprintf("refunded amount %d on acquirer, %d on issuer", payment.RefundedAmount, transaction.RefundedAmount)
+		}
+
+		if entry.Reason != "" {
+			entry.Status = StatusAmountMismatch
+		}
+
+		report.Entries = append(report.Entries, entry)
+	}
+
+	// what is left wasn't matched by any payment
+	var missing []Record
+	for _, candidates := range byKey {
+		missing = append(missing, candidates...)
+	}
+
+	sort.Slice(missing, func(i, j int) bool {
+		return missing[i].TransmissionDateTime < missing[j].TransmissionDateTime
+	})
+
+	for _, transaction := range missing {
+		report.Entries = append(report.Entries, Entry{
+			Status:      StatusMissingOnAcquirer,
+			Transaction: &transaction,
+		})
+	}
+
+	return report
+}
+
+// PaymentRecords returns the records of all payments of all merchants that
+// were sent to the issuer.
+func PaymentRecords(repo acquirer.Repository) ([]Record, error) {
+	merchants, err := repo.GetMerchants()
+	if err != nil {
+		return nil, fmt.Errorf("getting merchants: %w", err)
+	}
+
+	var records []Record
+	for _, merchant := range merchants {
+		payments, err := repo.GetPayments(merchant.ID)
+		if err != nil {
+			return nil, fmt.Errorf("getting payments of merchant %s: %w", merchant.ID, err)
+		}
+
+		for _, payment := range payments {
+			// the payment failed before the authorization request was sent
+			if payment.STAN == "" {
+				continue
+			}
+
+			records = append(records, paymentRecord(payment))
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].TransmissionDateTime < records[j].TransmissionDateTime
+	})
+
+	return records, nil
+}
+
+func paymentRecord(payment *acquirerModels.Payment) Record {
+	return Record{
+		ID:                   payment.ID,
+		Status:               string(payment.Status),
+		STAN:                 payment.STAN,
+		TransmissionDateTime: payment.TransmissionDateTime,
+		AuthorizationCode:    payment.AuthorizationCode,
+		MaskedPAN:            MaskPAN(payment.Card.First6, payment.Card.Last4),
+		Amount:               payment.Amount,
+		CapturedAmount:       payment.CapturedAmount,
+		RefundedAmount:       payment.RefundedAmount,
+	}
+}
+
+// TransactionRecords returns the records of all transactions of all
+// accounts.
+func TransactionRecords(repo issuer.Repository) ([]Record, error) {
+	accounts, err := repo.GetAccounts()
+	if err != nil {
+		return nil, fmt.Errorf("getting accounts: %w", err)
+	}
+
+	var records []Record
+	for _, account := range accounts {
+		transactions, err := repo.ListTransactions(account.ID)
+		if err != nil {
+			return nil, fmt.Errorf("getting transactions of account %s: %w", account.ID, err)
+		}
+
+		for _, transaction := range transactions {
+			card, err := repo.GetCard(account.ID, transaction.CardID)
+			if err != nil {
+				return nil, fmt.Errorf("getting card of transaction %s: %w", transaction.ID, err)
+			}
+
+			records = append(records, transactionRecord(transaction, card))
+		}
+	}
+
+	return records, nil
+}
+
+func transactionRecord(transaction *issuerModels.Transaction, card *issuerModels.Card) Record {
+	return Record{
+		ID:                   transaction.ID,
+		Status:               string(transaction.Status),
+		STAN:                 transaction.STAN,
+		TransmissionDateTime: transaction.TransmissionDateTime,
+		AuthorizationCode:    transaction.AuthorizationCode,
+		MaskedPAN:            MaskPAN(card.Number[:6], card.Number[len(card.Number)-4:]),
+		Amount:               transaction.Amount,
+		CapturedAmount:       transaction.CapturedAmount,
+		RefundedAmount:       transaction.RefundedAmount,
+	}
+}
+
+// Write writes the report as text: the counts of the entries by status
+// followed by the entries that didn't match.
+func (r *Report) Write(w io.Writer) error {
+	ew := &errWriter{w: w}
+
+	ew.printf("Reconciliation report, %s\n", r.CreatedAt.UTC().Format(time.RFC3339))
+	ew.printf("Acquirer payments: %d, issuer transactions: %d\n\n", r.Payments, r.Transactions)
+
+	statuses := []Status{StatusMatched, StatusMissingOnIssuer, StatusMissingOnAcquirer, StatusAmountMismatch}
+	for _, status := range statuses {
+		ew.printf("%-20s %d\n", status+":", r.Count(status))
+	}
+
+	for _, status := range statuses[1:] {
+		if r.Count(status) == 0 {
+			continue
+		}
+
+		ew.printf("\n%s\n", status)
+
+		for _, entry := range r.Entries {
+			if entry.Status != status {
+				continue
+			}
+
+			if entry.Payment != nil {
+				ew.printf("  payment %s\n", formatRecord(entry.Payment))
+			}
+
+			if entry.Transaction != nil {
+				ew.printf("  transaction %s\n", formatRecord(entry.Transaction))
+			}
+
+			if entry.Reason != "" {
+				ew.printf("    %s\n", entry.Reason)
+			}
+		}
+	}
+
+	return ew.err
+}
+
+func formatRecord(r *Record) string {
+	return fmt.Sprintf("%s: stan %s, sent at %s, auth code %q, pan %s, amount %d, captured %d, refunded %d, %s",
+		r.ID, r.STAN, r.TransmissionDateTime, r.AuthorizationCode, r.MaskedPAN,
+		r.Amount, r.CapturedAmount, r.RefundedAmount, r.Status)
+}
+
+// errWriter keeps the first error of the writes, so the report is written
+// without checking every line.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...any) {
+	if ew.err != nil {
+		return
+	}
+
+	_, ew.err = fmt.Fprintf(ew.w, format, args...)
+}
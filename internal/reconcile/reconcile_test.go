@@ -0,0 +1,56 @@
+package reconcile_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/reconcile"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcile(t *testing.T) {
+	record := func(id, stan string, amount int64) reconcile.Record {
+		return reconcile.Record{
+			ID:                   id,
+			STAN:                 stan,
+			TransmissionDateTime: "2024-01-02T10:00:00Z",
+			AuthorizationCode:    "123456",
+			MaskedPAN:            reconcile.MaskPAN("424242", "4242"),
+			Amount:               amount,
+		}
+	}
+
+	payments := []reconcile.Record{
+		record("payment-1", "000001", 10_00),
+		record("payment-2", "000002", 20_00),
+		record("payment-3", "000003", 30_00),
+	}
+
+	transactions := []reconcile.Record{
+		record("transaction-1", "000001", 10_00),
+		record("transaction-2", "000002", 25_00),
+		record("transaction-4", "000004", 40_00),
+	}
+
+	// the same STAN sent after the acquirer restarted is another request
+	restarted := record("transaction-5", "000001", 10_00)
+	restarted.TransmissionDateTime = "2024-01-02T11:00:00Z"
+	transactions = append(transactions, restarted)
+
+	report := reconcile.Reconcile(payments, transactions)
+
+	require.True(t, report.HasDiscrepancies())
+	require.Equal(t, 1, report.Count(reconcile.StatusMatched))
+	require.Equal(t, 1, report.Count(reconcile.StatusAmountMismatch))
+	require.Equal(t, 1, report.Count(reconcile.StatusMissingOnIssuer))
+	require.Equal(t, 2, report.Count(reconcile.StatusMissingOnAcquirer))
+
+	var buf bytes.Buffer
+	require.NoError(t, report.Write(&buf))
+	require.Contains(t, buf.String(), "amount 2000 on acquirer, 2500 on issuer")
+	require.Contains(t, buf.String(), "payment payment-3")
+	require.Contains(t, buf.String(), "transaction transaction-4")
+
+	report = reconcile.Reconcile(payments[:1], transactions[:1])
+	require.False(t, report.HasDiscrepancies())
+}
@@ -0,0 +1,117 @@
+package responsecode
+
+import "fmt"
+
+// Category tells what the acquirer should do with the response
+type Category string
+
+const (
+	CategoryApprove Category = "Approve"
+	CategoryDecline Category = "Decline"
+	CategoryRetry   Category = "Retry"
+	CategoryPickUp  Category = "Pick Up"
+)
+
+// ISO 8583 response codes (field 39) used by the issuer
+const (
+	Approved                   = "00"
+	ReferToCardIssuer          = "01"
+	InvalidMerchant            = "03"
+	PickUpCard                 = "04"
+	DoNotHonor                 = "05"
+	PartiallyApproved          = "10"
+	InvalidTransaction         = "12"
+	InvalidAmount              = "13"
+	InvalidCardNumber          = "14"
+	NoSuchIssuer               = "15"
+	ReEnterTransaction         = "19"
+	UnableToLocateRecord       = "25"
+	FormatError                = "30"
+	LostCard                   = "41"
+	StolenCard                 = "43"
+	InsufficientFunds          = "51"
+	ExpiredCard                = "54"
+	IncorrectPIN               = "55"
+	NotPermittedToCardholder   = "57"
+	NotPermittedToTerminal     = "58"
+	SuspectedFraud             = "59"
+	ExceedsWithdrawalLimit     = "61"
+	RestrictedCard             = "62"
+	SecurityViolation          = "63"
+	ExceedsWithdrawalFrequency = "65"
+	PINTriesExceeded           = "75"
+	NegativeCVVResult          = "82"
+	IssuerUnavailable          = "91"
+	UnableToRoute              = "92"
+	DuplicateTransmission      = "94"
+	SystemMalfunction          = "96"
+)
+
+// Info contains human-readable information about a response code
+type Info struct {
+	Code        string
+	Name        string
+	Description string
+	Category    Category
+}
+
+// IsApproved returns true if the transaction was approved
+func (i Info) IsApproved() bool {
+	return i.Category == CategoryApprove
+}
+
+var responseCodes = map[string]Info{
+	// Approvals
+	Approved:          {Approved, "Approved", "Approved or completed successfully", CategoryApprove},
+	PartiallyApproved: {PartiallyApproved, "Partially Approved", "Approved for less than the requested amount", CategoryApprove},
+
+	// Declines
+	ReferToCardIssuer:          {ReferToCardIssuer, "Refer to Card Issuer", "Contact the card issuer", CategoryDecline},
+	InvalidMerchant:            {InvalidMerchant, "Invalid Merchant", "Merchant is not known or not allowed", CategoryDecline},
+	DoNotHonor:                 {DoNotHonor, "Do Not Honor", "Declined by the issuer", CategoryDecline},
+	InvalidTransaction:         {InvalidTransaction, "Invalid Transaction", "Transaction is not valid for its original transaction", CategoryDecline},
+	InvalidAmount:              {InvalidAmount, "Invalid Amount", "Amount is not valid", CategoryDecline},
+	InvalidCardNumber:          {InvalidCardNumber, "Invalid Card Number", "Card number is not known to the issuer", CategoryDecline},
+	NoSuchIssuer:               {NoSuchIssuer, "No Such Issuer", "No issuer for the card number", CategoryDecline},
+	UnableToLocateRecord:       {UnableToLocateRecord, "Unable to Locate Record", "Original transaction was not found", CategoryDecline},
+	FormatError:                {FormatError, "Format Error", "Message is not formatted correctly", CategoryDecline},
+	InsufficientFunds:          {InsufficientFunds, "Insufficient Funds", "Not enough funds on the account", CategoryDecline},
+	ExpiredCard:                {ExpiredCard, "Expired Card", "Card is expired or expiration date is wrong", CategoryDecline},
+	IncorrectPIN:               {IncorrectPIN, "Incorrect PIN", "PIN is not correct", CategoryDecline},
+	NotPermittedToCardholder:   {NotPermittedToCardholder, "Transaction Not Permitted to Cardholder", "Card is not allowed to make this transaction", CategoryDecline},
+	NotPermittedToTerminal:     {NotPermittedToTerminal, "Transaction Not Permitted to Terminal", "Terminal is not allowed to make this transaction", CategoryDecline},
+	SuspectedFraud:             {SuspectedFraud, "Suspected Fraud", "Declined as suspected fraud", CategoryDecline},
+	ExceedsWithdrawalLimit:     {ExceedsWithdrawalLimit, "Exceeds Withdrawal Limit", "Amount exceeds the spending limit of the card", CategoryDecline},
+	RestrictedCard:             {RestrictedCard, "Restricted Card", "Card is blocked or can't be used for this transaction", CategoryDecline},
+	SecurityViolation:          {SecurityViolation, "Security Violation", "Card security check failed", CategoryDecline},
+	ExceedsWithdrawalFrequency: {ExceedsWithdrawalFrequency, "Exceeds Withdrawal Frequency", "Too many transactions for the card", CategoryDecline},
+	PINTriesExceeded:           {PINTriesExceeded, "PIN Tries Exceeded", "Allowable number of PIN tries exceeded", CategoryDecline},
+	NegativeCVVResult:          {NegativeCVVResult, "Negative CVV Result", "Card verification value is not correct", CategoryDecline},
+	UnableToRoute:              {UnableToRoute, "Unable to Route", "Transaction can't be routed to the issuer", CategoryDecline},
+	DuplicateTransmission:      {DuplicateTransmission, "Duplicate Transmission", "Transaction was already received", CategoryDecline},
+
+	// Temporary failures, the transaction may be sent again
+	ReEnterTransaction: {ReEnterTransaction, "Re-enter Transaction", "Send the transaction again", CategoryRetry},
+	IssuerUnavailable:  {IssuerUnavailable, "Issuer Unavailable", "Issuer or switch is inoperative", CategoryRetry},
+	SystemMalfunction:  {SystemMalfunction, "System Malfunction", "Transaction can't be processed now", CategoryRetry},
+
+	// Declines where the card should be retained
+	PickUpCard: {PickUpCard, "Pick Up Card", "Retain the card", CategoryPickUp},
+	LostCard:   {LostCard, "Lost Card", "Card is reported as lost, retain the card", CategoryPickUp},
+	StolenCard: {StolenCard, "Stolen Card", "Card is reported as stolen, retain the card", CategoryPickUp},
+}
+
+// GetInfo returns human-readable information about a response code. Unknown
+// codes are treated as declines.
+func GetInfo(code string) Info {
+	if info, exists := responseCodes[code]; exists {
+		return info
+	}
+
+	return Info{
+		Code:        code,
+		Name:        "Unknown Response Code",
+		Description: fmt.Sprintf("Unknown response code: %s", code),
+		Category:    CategoryDecline,
+	}
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migration is a versioned change of the database schema.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// ReadMigrations reads the migrations from the .sql files of fsys. The files
+// are named <version>_<name>.sql, e.g. 0001_create_accounts.sql, and the
+// migrations are returned in the order of their versions.
+func ReadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("listing migrations: %w", err)
+	}
+
+	migrations := make([]Migration, 0, len(files))
+	seen := make(map[int]string)
+
+	for _, file := range files {
+		version, name, found := strings.Cut(strings.TrimSuffix(file, ".sql"), "_")
+		if !found {
+			return nil, fmt.Errorf("migration %s: name must be <version>_<name>.sql", file)
+		}
+
+		v, err := strconv.Atoi(version)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: parsing version: %w", file, err)
+		}
+
+		if other, ok := seen[v]; ok {
+			return nil, fmt.Errorf("migration %s: version %d is used by %s", file, v, other)
+		}
+		seen[v] = file
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("reading migration %s: %w", file, err)
+		}
+
+		migrations = append(migrations, Migration{
+			Version: v,
+			Name:    name,
+			SQL:     string(content),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Migrate applies the migrations from the dir of fsys that were not applied
+// to the database yet. Each migration is applied in its own transaction
+// together with the record of its version in the schema_migrations table.
+func Migrate(db *sql.DB, fsys fs.FS, dir string) error {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		return fmt.Errorf("opening migrations directory: %w", err)
+	}
+
+	migrations, err := ReadMigrations(sub)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("creating schema_migrations table: %w", err)
+	}
+
+	var current int
+	err = db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("getting schema version: %w", err)
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+
+		err := WithTx(db, func(tx *sql.Tx) error {
+			if _, err := tx.Exec(m.SQL); err != nil {
+				return err
+			}
+
+			_, err := tx.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+				m.Version, m.Name, FormatTime(time.Now()))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("applying migration %d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+
+	return nil
+}
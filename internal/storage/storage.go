@@ -0,0 +1,90 @@
+// Package storage has the configuration of the repository backends and the
+// helpers shared by the SQLite repositories of the issuer and the acquirer.
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite" // pure-Go SQLite driver
+)
+
+const (
+	// BackendMemory keeps the data in memory and saves it to the JSON file
+	// when the repository is closed
+	BackendMemory = "memory"
+
+	// BackendSQLite keeps the data in the embedded SQLite database
+	BackendSQLite = "sqlite"
+)
+
+// Config selects the backend of the repository.
+type Config struct {
+	// Backend is "memory" (default) or "sqlite"
+	Backend string `yaml:"backend"`
+
+	// Path is the SQLite database file for the sqlite backend and the JSON
+	// file for the memory backend. ":memory:" opens a SQLite database that
+	// is not saved anywhere.
+	Path string `yaml:"path"`
+}
+
+// OpenSQLite opens the SQLite database at path. SQLite allows one writer at a
+// time, so the database is used over a single connection, which also makes
+// the read-check-write transactions of the repositories serializable.
+func OpenSQLite(path string) (*sql.DB, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("opening database: %w", err)
+	}
+
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to database: %w", err)
+	}
+
+	return db, nil
+}
+
+// WithTx runs fn in a transaction, which is committed if fn succeeds and
+// rolled back otherwise.
+func WithTx(db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// timeFormat has fixed width, so the stored times sort as strings.
+const timeFormat = "2006-01-02T15:04:05.000000000Z"
+
+// FormatTime formats t in UTC for storing in the database.
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+// ParseTime parses the time stored with FormatTime.
+func ParseTime(s string) (time.Time, error) {
+	t, err := time.Parse(timeFormat, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parsing time: %w", err)
+	}
+
+	return t, nil
+}
@@ -8,6 +8,7 @@ import (
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/clearing"
 	"github.com/moov-io/ftdc-from-tap-to-auth/issuer/models"
 )
 
@@ -31,9 +32,28 @@ func (a *API) AppendRoutes(r chi.Router) {
 		r.Route("/{accountID}", func(r chi.Router) {
 			r.Get("/", a.getAccount)
 			r.Post("/cards", a.issueCard)
+			r.Route("/cards/{cardID}", func(r chi.Router) {
+				r.Get("/", a.getCard)
+				r.Post("/activate", a.updateCardStatus(models.CardStatusActive))
+				r.Post("/block", a.updateCardStatus(models.CardStatusBlocked))
+				r.Post("/unblock", a.updateCardStatus(models.CardStatusActive))
+				r.Post("/lost", a.updateCardStatus(models.CardStatusLost))
+				r.Post("/stolen", a.updateCardStatus(models.CardStatusStolen))
+				r.Post("/replace", a.replaceCard)
+				r.Get("/controls", a.getSpendingControls)
+				r.Put("/controls", a.updateSpendingControls)
+			})
+			r.Get("/ledger", a.getLedger)
+			r.Post("/adjustments", a.adjustBalance)
 			r.Get("/transactions", a.getTransactions)
+			r.Post("/transactions/{transactionID}/release", a.releaseTransaction)
 		})
 	})
+	r.Route("/clearing", func(r chi.Router) {
+		r.Post("/", a.ingestClearingFile)
+		r.Get("/{batchID}", a.getClearingBatch)
+	})
+	r.Get("/stand-in/overdrafts", a.getStandInOverdrafts)
 }
 
 func (a *API) createAccount(w http.ResponseWriter, r *http.Request) {
@@ -118,6 +138,172 @@ func (a *API) issueCard(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(card)
 }
 
+func (a *API) getCard(w http.ResponseWriter, r *http.Request) {
+	accountID := chi.URLParam(r, "accountID")
+	cardID := chi.URLParam(r, "cardID")
+
+	card, err := a.issuer.GetCard(accountID, cardID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(card)
+}
+
+// updateCardStatus returns a handler that moves the card to the given status.
+func (a *API) updateCardStatus(status models.CardStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		accountID := chi.URLParam(r, "accountID")
+		cardID := chi.URLParam(r, "cardID")
+
+		card, err := a.issuer.UpdateCardStatus(accountID, cardID, status)
+		if err != nil {
+			a.logger.Error("failed to update card status", slog.Any("error", err))
+			a.cardError(w, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(card)
+	}
+}
+
+func (a *API) replaceCard(w http.ResponseWriter, r *http.Request) {
+	accountID := chi.URLParam(r, "accountID")
+	cardID := chi.URLParam(r, "cardID")
+
+	card, err := a.issuer.ReplaceCard(accountID, cardID)
+	if err != nil {
+		a.logger.Error("failed to replace card", slog.Any("error", err))
+		a.cardError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(card)
+}
+
+func (a *API) getSpendingControls(w http.ResponseWriter, r *http.Request) {
+	accountID := chi.URLParam(r, "accountID")
+	cardID := chi.URLParam(r, "cardID")
+
+	card, err := a.issuer.GetCard(accountID, cardID)
+	if err != nil {
+		a.cardError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(card.SpendingControls)
+}
+
+func (a *API) updateSpendingControls(w http.ResponseWriter, r *http.Request) {
+	accountID := chi.URLParam(r, "accountID")
+	cardID := chi.URLParam(r, "cardID")
+
+	controls := models.SpendingControls{}
+	err := json.NewDecoder(r.Body).Decode(&controls)
+	if err != nil {
+		a.logger.Error("failed to decode spending controls", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := controls.Validate(); err != nil {
+		a.logger.Error("invalid spending controls", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	card, err := a.issuer.UpdateSpendingControls(accountID, cardID, controls)
+	if err != nil {
+		a.logger.Error("failed to update spending controls", slog.Any("error", err))
+		a.cardError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(card.SpendingControls)
+}
+
+func (a *API) cardError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, models.ErrInvalidCardStatusTransition):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (a *API) getLedger(w http.ResponseWriter, r *http.Request) {
+	accountID := chi.URLParam(r, "accountID")
+
+	ledger, err := a.issuer.GetLedger(accountID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			a.logger.Error("failed to get ledger", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(ledger)
+}
+
+func (a *API) adjustBalance(w http.ResponseWriter, r *http.Request) {
+	accountID := chi.URLParam(r, "accountID")
+
+	adjustment := models.CreateAdjustment{}
+	err := json.NewDecoder(r.Body).Decode(&adjustment)
+	if err != nil {
+		a.logger.Error("failed to decode adjustment request", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := adjustment.Validate(); err != nil {
+		a.logger.Error("invalid adjustment", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entry, err := a.issuer.AdjustBalance(accountID, adjustment)
+	if err != nil {
+		a.logger.Error("failed to adjust balance", slog.Any("error", err))
+
+		switch {
+		case errors.Is(err, ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, models.ErrInsufficientFunds):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(entry)
+}
+
 func (a *API) getTransactions(w http.ResponseWriter, r *http.Request) {
 	accountID := chi.URLParam(r, "accountID")
 
@@ -133,6 +319,30 @@ func (a *API) getTransactions(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(transactions)
 }
 
+func (a *API) releaseTransaction(w http.ResponseWriter, r *http.Request) {
+	accountID := chi.URLParam(r, "accountID")
+	transactionID := chi.URLParam(r, "transactionID")
+
+	transaction, err := a.issuer.ReleaseTransaction(accountID, transactionID)
+	if err != nil {
+		a.logger.Error("failed to release transaction", slog.Any("error", err))
+
+		switch {
+		case errors.Is(err, ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, ErrInvalidTransactionStatus), errors.Is(err, models.ErrTransactionConflict):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(transaction)
+}
+
 func (a *API) getAccounts(w http.ResponseWriter, _ *http.Request) {
 	account, err := a.issuer.GetAccounts()
 	if err != nil {
@@ -149,3 +359,67 @@ func (a *API) getAccounts(w http.ResponseWriter, _ *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(account)
 }
+
+// ingestClearingFile ingests the acquirer's clearing file sent as the
+// request body.
+func (a *API) ingestClearingFile(w http.ResponseWriter, r *http.Request) {
+	file, err := clearing.Read(r.Body)
+	if err != nil {
+		a.logger.Error("failed to read clearing file", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	batch, err := a.issuer.IngestClearingFile(file)
+	if err != nil {
+		a.logger.Error("failed to ingest clearing file", slog.Any("error", err))
+
+		switch {
+		case errors.Is(err, clearing.ErrInvalidFile):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, models.ErrClearingBatchIngested):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(batch)
+}
+
+func (a *API) getClearingBatch(w http.ResponseWriter, r *http.Request) {
+	batchID := chi.URLParam(r, "batchID")
+
+	batch, err := a.issuer.GetClearingBatch(batchID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+		} else {
+			a.logger.Error("failed to get clearing batch", slog.Any("error", err))
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(batch)
+}
+
+// getStandInOverdrafts returns the transactions whose stand-in advice
+// overdrew the account.
+func (a *API) getStandInOverdrafts(w http.ResponseWriter, _ *http.Request) {
+	transactions, err := a.issuer.StandInOverdrafts()
+	if err != nil {
+		a.logger.Error("failed to get stand-in overdrafts", slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(transactions)
+}
@@ -18,7 +18,7 @@ import (
 func TestAPI(t *testing.T) {
 	router := chi.NewRouter()
 
-	api := issuer.NewAPI(log.New(), issuer.NewService(log.New(), issuer.NewRepository(), nil))
+	api := issuer.NewAPI(log.New(), issuer.NewService(log.New(), issuer.NewMemoryRepository(), nil, "", nil))
 	api.AppendRoutes(router)
 
 	t.Run("create account", func(t *testing.T) {
@@ -2,6 +2,7 @@ package issuer
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -24,6 +25,7 @@ type App struct {
 	ISO8583ServerAddr string
 	logger            *slog.Logger
 	iso8583Server     io.Closer
+	repository        Repository
 	config            *Config
 }
 
@@ -47,17 +49,28 @@ func (a *App) Start() error {
 	// setup the issuer
 	router := chi.NewRouter()
 	router.Use(middleware.NewStructuredLogger(a.logger))
-	repository := NewRepository()
 
-	err := repository.LoadFromFile()
+	repository, err := OpenRepository(a.config.Storage)
 	if err != nil {
-		return fmt.Errorf("loading repository from file: %w", err)
+		return fmt.Errorf("opening repository: %w", err)
+	}
+	a.repository = repository
+
+	// without the key the cryptograms of the cards can't be verified
+	if a.config.IssuerMasterKey == "" {
+		return errors.New("issuer_master_key is not configured")
+	}
+
+	chipKeys, err := NewChipKeys(a.config.IssuerMasterKey)
+	if err != nil {
+		return fmt.Errorf("creating chip keys: %w", err)
 	}
 
 	cp := cardpersonalizer.New(a.config.CardPersonalizerURL)
-	iss := NewService(a.logger, repository, cp)
+	iss := NewService(a.logger, repository, cp, a.config.CardBIN, chipKeys)
 
 	iso8583Server := issuer8583.NewServer(a.logger, a.config.ISO8583Addr, iss)
+	iso8583Server.SignOnOptional = a.config.SignOnOptional
 	err = iso8583Server.Start()
 	if err != nil {
 		return fmt.Errorf("starting iso8583 server: %w", err)
@@ -91,7 +104,6 @@ func (a *App) Start() error {
 			a.logger.Info("http server stopped")
 		}
 
-		repository.SaveToFile()
 		a.wg.Done()
 	}()
 
@@ -110,5 +122,11 @@ func (a *App) Shutdown() {
 
 	a.wg.Wait()
 
+	// the servers are stopped, so nothing writes to the repository anymore
+	err = a.repository.Close()
+	if err != nil {
+		a.logger.Error("closing repository", "err", err)
+	}
+
 	a.logger.Info("app stopped")
 }
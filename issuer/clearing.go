@@ -0,0 +1,220 @@
+package issuer
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/clearing"
+	"github.com/moov-io/ftdc-from-tap-to-auth/issuer/models"
+)
+
+// clearingBatchTimeout is the time after which the batch whose ingestion
+// didn't complete, e.g. because the issuer was restarted, can be ingested
+// again.
+const clearingBatchTimeout = 10 * time.Minute
+
+// IngestClearingFile matches the captures and the refunds of the acquirer's
+// clearing file to the transactions. Captures and refunds that were already
+// posted online are matched; the ones whose online message was missed are
+// posted from the file: the hold of an authorized transaction is captured
+// and a refund is returned to the account. A file can be ingested only once.
+//
+// The batch is saved before its records are cleared, so two ingestions of
+// the same file don't post it twice. When the ingestion fails the batch is
+// deleted; the file can be ingested again and the records posted before the
+// failure are matched then.
+func (i *Service) IngestClearingFile(file *clearing.File) (*models.ClearingBatch, error) {
+	if err := file.Validate(); err != nil {
+		return nil, err
+	}
+
+	batch := &models.ClearingBatch{
+		ID:         file.BatchID,
+		MerchantID: file.MerchantID,
+		Currency:   file.Currency,
+		IngestedAt: time.Now(),
+		Totals:     file.Totals,
+		Ingesting:  true,
+	}
+
+	if err := i.claimClearingBatch(batch); err != nil {
+		return nil, err
+	}
+
+	if err := i.clearRecords(file, batch); err != nil {
+		if err := i.repo.DeleteClearingBatch(batch.ID); err != nil {
+			i.logger.Error("failed to delete clearing batch", slog.String("batch_id", batch.ID), slog.String("error", err.Error()))
+		}
+
+		return nil, err
+	}
+
+	batch.Ingesting = false
+
+	if err := i.repo.UpdateClearingBatch(batch); err != nil {
+		return nil, fmt.Errorf("updating clearing batch: %w", err)
+	}
+
+	i.logger.Info("clearing file ingested",
+		slog.String("batch_id", batch.ID),
+		slog.Int("matched", batch.Matched),
+		slog.Int("posted", batch.Posted),
+		slog.Int("unmatched", batch.Unmatched),
+	)
+
+	return batch, nil
+}
+
+// claimClearingBatch saves the batch before its records are cleared. The
+// batch that was ingested or is being ingested is rejected, unless its
+// ingestion didn't complete within clearingBatchTimeout.
+func (i *Service) claimClearingBatch(batch *models.ClearingBatch) error {
+	err := i.repo.CreateClearingBatch(batch)
+	if !errors.Is(err, models.ErrClearingBatchIngested) {
+		if err != nil {
+			return fmt.Errorf("creating clearing batch: %w", err)
+		}
+
+		return nil
+	}
+
+	claimed, err := i.repo.GetClearingBatch(batch.ID)
+	if err != nil {
+		return fmt.Errorf("getting clearing batch: %w", err)
+	}
+
+	if !claimed.Ingesting || time.Since(claimed.IngestedAt) < clearingBatchTimeout {
+		return models.ErrClearingBatchIngested
+	}
+
+	// another ingestion may take over the batch at the same time
+	err = i.repo.ReclaimClearingBatch(batch, claimed.IngestedAt)
+	if errors.Is(err, ErrNotFound) {
+		return models.ErrClearingBatchIngested
+	}
+
+	if err != nil {
+		return fmt.Errorf("reclaiming clearing batch: %w", err)
+	}
+
+	i.logger.Warn("ingesting clearing batch that didn't complete",
+		slog.String("batch_id", batch.ID),
+		slog.Time("claimed_at", claimed.IngestedAt),
+	)
+
+	return nil
+}
+
+// clearRecords clears the records of the file and adds their results to the
+// batch.
+func (i *Service) clearRecords(file *clearing.File, batch *models.ClearingBatch) error {
+	// refunded keeps the amount of the file's refunds matched to each
+	// transaction, so the refunds posted online are matched only once
+	refunded := make(map[string]int64)
+
+	for _, record := range file.Records {
+		result, err := i.clearRecord(file, record, refunded)
+		if err != nil {
+			return fmt.Errorf("clearing %s of payment %s: %w", record.Type, record.PaymentID, err)
+		}
+
+		batch.Add(result)
+	}
+
+	return nil
+}
+
+func (i *Service) clearRecord(file *clearing.File, record clearing.Record, refunded map[string]int64) (models.ClearingRecordResult, error) {
+	result := models.ClearingRecordResult{Record: record}
+
+	unmatched := func(format string, args ...any) (models.ClearingRecordResult, error) {
+		result.Result = models.ClearingResultUnmatched
+		result.Reason = fmt.Sprintf(format, args...)
+
+		return result, nil
+	}
+
+	transaction, err := i.repo.FindTransactionByTrace(file.AcquirerID, record.STAN, record.TransmissionDateTime)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return unmatched("transaction not found")
+		}
+
+		return result, fmt.Errorf("finding transaction: %w", err)
+	}
+
+	result.TransactionID = transaction.ID
+
+	if transaction.Currency != file.Currency {
+		return unmatched("transaction currency is %s", transaction.Currency)
+	}
+
+	switch record.Type {
+	case clearing.RecordTypeCapture:
+		switch transaction.Status {
+		case models.TransactionStatusCaptured, models.TransactionStatusRefunded:
+			if transaction.CapturedAmount != record.Amount {
+				return unmatched("captured amount is %d", transaction.CapturedAmount)
+			}
+
+			result.Result = models.ClearingResultMatched
+		case models.TransactionStatusAuthorized:
+			entry, err := models.NewCaptureEntry(transaction.AccountID, transaction.ID, transaction.Amount, record.Amount)
+			if errors.Is(err, models.ErrCaptureExceedsHold) {
+				return unmatched("authorized amount is %d", transaction.Amount)
+			}
+
+			if err != nil {
+				return result, fmt.Errorf("creating capture entry: %w", err)
+			}
+
+			transaction.CapturedAmount = record.Amount
+			transaction.Status = models.TransactionStatusCaptured
+
+			if err := i.repo.UpdateTransaction(transaction, entry); err != nil {
+				return result, fmt.Errorf("capturing funds: %w", err)
+			}
+
+			result.Result = models.ClearingResultPosted
+		default:
+			return unmatched("transaction is %s", transaction.Status)
+		}
+	case clearing.RecordTypeRefund:
+		cleared := refunded[transaction.ID] + record.Amount
+
+		switch {
+		case cleared <= transaction.RefundedAmount:
+			result.Result = models.ClearingResultMatched
+		case transaction.Status == models.TransactionStatusCaptured &&
+			record.Amount <= transaction.CapturedAmount-transaction.RefundedAmount:
+			transaction.RefundedAmount += record.Amount
+			if transaction.RefundedAmount == transaction.CapturedAmount {
+				transaction.Status = models.TransactionStatusRefunded
+			}
+
+			err := i.repo.UpdateTransaction(transaction, models.NewRefundEntry(transaction.AccountID, transaction.ID, record.Amount))
+			if err != nil {
+				return result, fmt.Errorf("refunding funds: %w", err)
+			}
+
+			result.Result = models.ClearingResultPosted
+		default:
+			return unmatched("refund exceeds the captured amount of %s transaction", transaction.Status)
+		}
+
+		refunded[transaction.ID] = cleared
+	}
+
+	return result, nil
+}
+
+func (i *Service) GetClearingBatch(batchID string) (*models.ClearingBatch, error) {
+	batch, err := i.repo.GetClearingBatch(batchID)
+	if err != nil {
+		return nil, fmt.Errorf("getting clearing batch: %w", err)
+	}
+
+	return batch, nil
+}
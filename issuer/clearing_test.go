@@ -0,0 +1,183 @@
+package issuer_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/clearing"
+	"github.com/moov-io/ftdc-from-tap-to-auth/issuer"
+	"github.com/moov-io/ftdc-from-tap-to-auth/issuer/models"
+	"github.com/moov-io/ftdc-from-tap-to-auth/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIngestClearingFile(t *testing.T) {
+	repo := issuer.NewMemoryRepository()
+	service := issuer.NewService(log.New(), repo, nil, "", nil)
+
+	account, err := service.CreateAccount(models.CreateAccount{OwnerName: "John Doe", Balance: 100_00, Currency: "USD"})
+	require.NoError(t, err)
+
+	// the $30 transaction is authorized, but its capture message was missed
+	transaction := &models.Transaction{
+		ID:                   "transaction-1",
+		AccountID:            account.ID,
+		Amount:               30_00,
+		Currency:             "USD",
+		Status:               models.TransactionStatusAuthorized,
+		CreatedAt:            time.Now(),
+		STAN:                 "000001",
+		TransmissionDateTime: "2024-01-02T10:00:00Z",
+	}
+	require.NoError(t, repo.CreateTransaction(transaction))
+	require.NoError(t, repo.UpdateTransaction(transaction, models.NewHoldEntry(account.ID, transaction.ID, transaction.Amount)))
+
+	file := &clearing.File{
+		BatchID:    "batch-1",
+		MerchantID: "merchant-1",
+		Currency:   "USD",
+		CreatedAt:  time.Now(),
+	}
+
+	for _, record := range []clearing.Record{
+		{Type: clearing.RecordTypeCapture, PaymentID: "payment-1", STAN: "000001", TransmissionDateTime: "2024-01-02T10:00:00Z", Amount: 25_00, Fee: 35},
+		{Type: clearing.RecordTypeRefund, PaymentID: "payment-1", RefundID: "refund-1", STAN: "000001", TransmissionDateTime: "2024-01-02T10:00:00Z", Amount: 5_00},
+		{Type: clearing.RecordTypeCapture, PaymentID: "payment-2", STAN: "000002", TransmissionDateTime: "2024-01-02T10:01:00Z", Amount: 10_00, Fee: 20},
+	} {
+		file.Records = append(file.Records, record)
+		file.Totals.Add(record)
+	}
+
+	batch, err := service.IngestClearingFile(file)
+	require.NoError(t, err)
+
+	// the capture and the refund are posted from the file, the unknown
+	// payment is reported
+	require.Equal(t, 2, batch.Posted)
+	require.Equal(t, 1, batch.Unmatched)
+	require.Equal(t, "transaction not found", batch.Records[2].Reason)
+
+	found, err := repo.GetTransaction(account.ID, transaction.ID)
+	require.NoError(t, err)
+	require.Equal(t, models.TransactionStatusCaptured, found.Status)
+	require.Equal(t, int64(25_00), found.CapturedAmount)
+	require.Equal(t, int64(5_00), found.RefundedAmount)
+
+	got, err := repo.GetAccount(account.ID)
+	require.NoError(t, err)
+	require.Equal(t, int64(100_00-25_00+5_00), got.AvailableBalance)
+	require.Equal(t, int64(0), got.HoldBalance)
+
+	_, err = service.IngestClearingFile(file)
+	require.ErrorIs(t, err, models.ErrClearingBatchIngested)
+
+	// the totals must match the records
+	file.BatchID = "batch-2"
+	file.Totals.NetAmount++
+	_, err = service.IngestClearingFile(file)
+	require.ErrorIs(t, err, clearing.ErrInvalidFile)
+}
+
+// failingRepository fails the updates of the transactions after failAfter
+// of them succeeded, unless failAfter is negative
+type failingRepository struct {
+	issuer.Repository
+	failAfter int
+}
+
+func (r *failingRepository) UpdateTransaction(transaction *models.Transaction, entries ...*models.JournalEntry) error {
+	if r.failAfter == 0 {
+		return errors.New("database is down")
+	}
+
+	r.failAfter--
+
+	return r.Repository.UpdateTransaction(transaction, entries...)
+}
+
+func TestIngestClearingFileClaimsBatch(t *testing.T) {
+	repo := &failingRepository{Repository: issuer.NewMemoryRepository(), failAfter: -1}
+	service := issuer.NewService(log.New(), repo, nil, "", nil)
+
+	account, err := service.CreateAccount(models.CreateAccount{OwnerName: "John Doe", Balance: 100_00, Currency: "USD"})
+	require.NoError(t, err)
+
+	file := &clearing.File{
+		BatchID:    "batch-1",
+		MerchantID: "merchant-1",
+		Currency:   "USD",
+		CreatedAt:  time.Now(),
+	}
+
+	// the captures of two authorized transactions were missed
+	for _, stan := range []string{"000001", "000002"} {
+		transaction := &models.Transaction{
+			ID:                   "transaction-" + stan,
+			AccountID:            account.ID,
+			Amount:               10_00,
+			Currency:             "USD",
+			Status:               models.TransactionStatusAuthorized,
+			CreatedAt:            time.Now(),
+			STAN:                 stan,
+			TransmissionDateTime: "2024-01-02T10:00:00Z",
+		}
+		require.NoError(t, repo.CreateTransaction(transaction))
+		require.NoError(t, repo.UpdateTransaction(transaction, models.NewHoldEntry(account.ID, transaction.ID, transaction.Amount)))
+
+		record := clearing.Record{Type: clearing.RecordTypeCapture, PaymentID: "payment-" + stan, STAN: stan, TransmissionDateTime: "2024-01-02T10:00:00Z", Amount: 10_00}
+		file.Records = append(file.Records, record)
+		file.Totals.Add(record)
+	}
+
+	t.Run("failed ingestion can be repeated", func(t *testing.T) {
+		// the first capture is posted, the second one fails
+		repo.failAfter = 1
+		_, err := service.IngestClearingFile(file)
+		require.ErrorContains(t, err, "database is down")
+
+		_, err = repo.GetClearingBatch(file.BatchID)
+		require.ErrorIs(t, err, issuer.ErrNotFound)
+
+		repo.failAfter = -1
+		batch, err := service.IngestClearingFile(file)
+		require.NoError(t, err)
+		require.False(t, batch.Ingesting)
+		require.Equal(t, 1, batch.Matched)
+		require.Equal(t, 1, batch.Posted)
+
+		got, err := repo.GetAccount(account.ID)
+		require.NoError(t, err)
+		require.Equal(t, int64(80_00), got.AvailableBalance)
+		require.Equal(t, int64(0), got.HoldBalance)
+	})
+
+	t.Run("batch being ingested is not ingested again", func(t *testing.T) {
+		claimed := &models.ClearingBatch{ID: "batch-2", IngestedAt: time.Now(), Ingesting: true}
+		require.NoError(t, repo.CreateClearingBatch(claimed))
+
+		other := *file
+		other.BatchID = claimed.ID
+
+		_, err := service.IngestClearingFile(&other)
+		require.ErrorIs(t, err, models.ErrClearingBatchIngested)
+	})
+
+	t.Run("batch whose ingestion didn't complete is taken over", func(t *testing.T) {
+		claimed := &models.ClearingBatch{ID: "batch-3", IngestedAt: time.Now().Add(-time.Hour), Ingesting: true}
+		require.NoError(t, repo.CreateClearingBatch(claimed))
+
+		other := *file
+		other.BatchID = claimed.ID
+
+		// the records were posted with the first batch
+		batch, err := service.IngestClearingFile(&other)
+		require.NoError(t, err)
+		require.Equal(t, 2, batch.Matched)
+
+		found, err := repo.GetClearingBatch(claimed.ID)
+		require.NoError(t, err)
+		require.False(t, found.Ingesting)
+		require.Len(t, found.Records, 2)
+	})
+}
@@ -95,6 +95,79 @@ func (i *client) IssueCard(accountID string) (models.Card, error) {
 	return card, nil
 }
 
+// ChangeCardStatus calls the card action (activate, block, unblock, lost or
+// stolen) and returns the updated card or an error.
+func (i *client) ChangeCardStatus(accountID, cardID, action string) (models.Card, error) {
+	res, err := i.httpClient.Post(i.baseURL+"/accounts/"+accountID+"/cards/"+cardID+"/"+action, "application/json", nil)
+	if err != nil {
+		return models.Card{}, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return models.Card{}, fmt.Errorf("unexpected status code: %d; expected: %d", res.StatusCode, http.StatusOK)
+	}
+
+	var card models.Card
+	err = json.NewDecoder(res.Body).Decode(&card)
+	if err != nil {
+		return models.Card{}, err
+	}
+
+	return card, nil
+}
+
+// UpdateSpendingControls replaces the card's spending controls and returns
+// the updated controls or an error.
+func (i *client) UpdateSpendingControls(accountID, cardID string, controls models.SpendingControls) (models.SpendingControls, error) {
+	reqJSON, err := json.Marshal(controls)
+	if err != nil {
+		return models.SpendingControls{}, err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, i.baseURL+"/accounts/"+accountID+"/cards/"+cardID+"/controls", bytes.NewReader(reqJSON))
+	if err != nil {
+		return models.SpendingControls{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := i.httpClient.Do(req)
+	if err != nil {
+		return models.SpendingControls{}, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return models.SpendingControls{}, fmt.Errorf("unexpected status code: %d; expected: %d", res.StatusCode, http.StatusOK)
+	}
+
+	var updated models.SpendingControls
+	err = json.NewDecoder(res.Body).Decode(&updated)
+	if err != nil {
+		return models.SpendingControls{}, err
+	}
+
+	return updated, nil
+}
+
+// ReplaceCard replaces the card and returns the new card or an error.
+func (i *client) ReplaceCard(accountID, cardID string) (models.Card, error) {
+	res, err := i.httpClient.Post(i.baseURL+"/accounts/"+accountID+"/cards/"+cardID+"/replace", "application/json", nil)
+	if err != nil {
+		return models.Card{}, err
+	}
+
+	if res.StatusCode != http.StatusCreated {
+		return models.Card{}, fmt.Errorf("unexpected status code: %d; expected: %d", res.StatusCode, http.StatusCreated)
+	}
+
+	var card models.Card
+	err = json.NewDecoder(res.Body).Decode(&card)
+	if err != nil {
+		return models.Card{}, err
+	}
+
+	return card, nil
+}
+
 // GetTransactions returns the list of transactions for the given card ID
 // and account ID or an error.
 func (i *client) GetTransactions(accountID string) ([]models.Transaction, error) {
@@ -115,3 +188,92 @@ func (i *client) GetTransactions(accountID string) ([]models.Transaction, error)
 
 	return transactions, nil
 }
+
+// GetStandInOverdrafts returns the transactions of all accounts whose
+// stand-in advice overdrew the account or an error.
+func (i *client) GetStandInOverdrafts() ([]models.Transaction, error) {
+	res, err := i.httpClient.Get(i.baseURL + "/stand-in/overdrafts")
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d; expected: %d", res.StatusCode, http.StatusOK)
+	}
+
+	var transactions []models.Transaction
+	err = json.NewDecoder(res.Body).Decode(&transactions)
+	if err != nil {
+		return nil, err
+	}
+
+	return transactions, nil
+}
+
+// GetLedger returns the journal entries and the balances of the account or an
+// error.
+func (i *client) GetLedger(accountID string) (models.AccountLedger, error) {
+	res, err := i.httpClient.Get(i.baseURL + "/accounts/" + accountID + "/ledger")
+	if err != nil {
+		return models.AccountLedger{}, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return models.AccountLedger{}, fmt.Errorf("unexpected status code: %d; expected: %d", res.StatusCode, http.StatusOK)
+	}
+
+	var ledger models.AccountLedger
+	err = json.NewDecoder(res.Body).Decode(&ledger)
+	if err != nil {
+		return models.AccountLedger{}, err
+	}
+
+	return ledger, nil
+}
+
+// AdjustBalance posts the adjustment of the account's available balance and
+// returns the journal entry or an error.
+func (i *client) AdjustBalance(accountID string, adjustment models.CreateAdjustment) (models.JournalEntry, error) {
+	reqJSON, err := json.Marshal(adjustment)
+	if err != nil {
+		return models.JournalEntry{}, err
+	}
+
+	res, err := i.httpClient.Post(i.baseURL+"/accounts/"+accountID+"/adjustments", "application/json", bytes.NewReader(reqJSON))
+	if err != nil {
+		return models.JournalEntry{}, err
+	}
+
+	if res.StatusCode != http.StatusCreated {
+		return models.JournalEntry{}, fmt.Errorf("unexpected status code: %d; expected: %d", res.StatusCode, http.StatusCreated)
+	}
+
+	var entry models.JournalEntry
+	err = json.NewDecoder(res.Body).Decode(&entry)
+	if err != nil {
+		return models.JournalEntry{}, err
+	}
+
+	return entry, nil
+}
+
+// IngestClearingFile sends the acquirer's clearing file to the issuer and
+// returns the ingested batch or an error.
+func (i *client) IngestClearingFile(file []byte) (models.ClearingBatch, error) {
+	res, err := i.httpClient.Post(i.baseURL+"/clearing", "text/csv", bytes.NewReader(file))
+	if err != nil {
+		return models.ClearingBatch{}, err
+	}
+
+	if res.StatusCode != http.StatusCreated {
+		return models.ClearingBatch{}, fmt.Errorf("unexpected status code: %d; expected: %d", res.StatusCode, http.StatusCreated)
+	}
+
+	var batch models.ClearingBatch
+	err = json.NewDecoder(res.Body).Decode(&batch)
+	if err != nil {
+		return models.ClearingBatch{}, err
+	}
+
+	return batch, nil
+}
@@ -1,10 +1,27 @@
 package issuer
 
+import "github.com/moov-io/ftdc-from-tap-to-auth/internal/storage"
+
 // Config is a configuration for the issuer application
 type Config struct {
 	HTTPAddr            string `yaml:"http_addr"`
 	ISO8583Addr         string `yaml:"iso8583_addr"`
 	CardPersonalizerURL string `yaml:"card_personalizer_url"`
+
+	// CardBIN is the leading digits of the numbers of the cards we issue,
+	// the acquirer routes the payments to us by them
+	CardBIN string `yaml:"card_bin"`
+
+	// IssuerMasterKey is the hex encoded 3DES key the keys of our chip cards
+	// are derived from, the application cryptograms are verified with it
+	IssuerMasterKey string `yaml:"issuer_master_key"`
+
+	// SignOnOptional accepts financial messages from the peers that didn't
+	// sign on with 0800, for the acquirer exercise in /exercises/acquirer
+	SignOnOptional bool `yaml:"sign_on_optional"`
+
+	// Storage selects where the accounts, cards and transactions are kept
+	Storage storage.Config `yaml:"storage"`
 }
 
 func DefaultConfig() *Config {
@@ -12,5 +29,10 @@ func DefaultConfig() *Config {
 		HTTPAddr:            "localhost:9090",
 		ISO8583Addr:         "localhost:8583",
 		CardPersonalizerURL: "http://localhost:7070",
+		CardBIN:             DefaultCardBIN,
+		IssuerMasterKey:     DefaultIssuerMasterKey,
+		Storage: storage.Config{
+			Backend: storage.BackendMemory,
+		},
 	}
 }
@@ -0,0 +1,187 @@
+package issuer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/moov-io/bertlv"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/emv"
+	"github.com/moov-io/ftdc-from-tap-to-auth/issuer/models"
+)
+
+// DefaultIssuerMasterKey is the issuer master key for application cryptograms
+// when none is configured. It's a test key, don't use it for real cards.
+const DefaultIssuerMasterKey = "0123456789ABCDEFFEDCBA9876543210"
+
+// ChipKeys keeps the issuer master key the keys of our chip cards are derived
+// from, and verifies the application cryptograms the cards generate.
+type ChipKeys struct {
+	issuerMasterKey []byte
+
+	// cdol1 is the data object list of the data the terminal sends in the
+	// first GENERATE AC, the cryptogram is computed over it
+	cdol1 emv.DOL
+}
+
+// NewChipKeys returns the chip keys with the hex encoded double-length 3DES
+// issuer master key.
+func NewChipKeys(issuerMasterKey string) (*ChipKeys, error) {
+	key, err := hex.DecodeString(issuerMasterKey)
+	if err != nil {
+		return nil, fmt.Errorf("decoding issuer master key: %w", err)
+	}
+
+	if len(key) != emv.KeyLength {
+		return nil, fmt.Errorf("issuer master key must be %d bytes, got %d", emv.KeyLength, len(key))
+	}
+
+	return &ChipKeys{
+		issuerMasterKey: key,
+		cdol1:           emv.CDOL1,
+	}, nil
+}
+
+// CardMasterKey returns the master key of the card with the PAN and the PAN
+// sequence number, derived from the issuer master key. The card is
+// personalized with it to compute its cryptograms.
+func (k *ChipKeys) CardMasterKey(pan, panSequenceNumber string) ([]byte, error) {
+	key, err := emv.DeriveICCMasterKey(k.issuerMasterKey, pan, panSequenceNumber)
+	if err != nil {
+		return nil, fmt.Errorf("deriving card master key: %w", err)
+	}
+
+	return key, nil
+}
+
+// chipData are the tags of the EMV payload the cryptogram is verified with
+type chipData struct {
+	PAN               string `bertlv:"5A"`
+	PANSequenceNumber string `bertlv:"5F34"`
+	AIP               []byte `bertlv:"82"`
+	ATC               []byte `bertlv:"9F36"`
+	ARQC              []byte `bertlv:"9F26"`
+}
+
+// ARQCVerification is the result of the verification of the authorization
+// request cryptogram (ARQC). The session key of the verified cryptogram is
+// kept to generate the response cryptogram (ARPC).
+type ARQCVerification struct {
+	Result models.VerificationResult
+
+	// Reason tells why the cryptogram is missing or doesn't match
+	Reason string
+
+	arqc       []byte
+	sessionKey []byte
+}
+
+// VerifyARQC verifies the cryptogram (tag 9F26) of the EMV payload. It's
+// computed by the card with the session key of the ATC (tag 9F36) over the
+// CDOL1 data (amount, unpredictable number, ...), the AIP and the ATC, as the
+// FTDC applet does (see package emv). The card's key is derived from the PAN
+// (tag 5A) and the PAN sequence number (tag 5F34). The cryptogram of requests
+// read from the chip (chipRead) is missing without tag 9F26, so it can't be
+// stripped from them to skip the verification. Other requests without
+// cryptogram are not checked.
+func (k *ChipKeys) VerifyARQC(emvPayload []byte, chipRead bool) ARQCVerification {
+	if emvPayload == nil {
+		if chipRead {
+			return missingARQC("chip data is missing")
+		}
+
+		return ARQCVerification{Result: models.VerificationResultNotChecked}
+	}
+
+	tlvs, err := bertlv.Decode(emvPayload)
+	if err != nil {
+		return missingARQC(fmt.Sprintf("decoding EMV payload: %s", err))
+	}
+
+	data := chipData{}
+	if err := bertlv.Unmarshal(tlvs, &data); err != nil {
+		return missingARQC(fmt.Sprintf("unmarshaling EMV tags: %s", err))
+	}
+
+	if data.ARQC == nil {
+		if chipRead {
+			return missingARQC("arqc is missing")
+		}
+
+		return ARQCVerification{Result: models.VerificationResultNotChecked}
+	}
+
+	if data.PAN == "" || data.AIP == nil || data.ATC == nil {
+		return missingARQC("pan, aip or atc is missing")
+	}
+
+	cdolData, err := k.cdol1.Data(tlvs)
+	if err != nil {
+		return missingARQC(err.Error())
+	}
+
+	masterKey, err := k.CardMasterKey(data.PAN, data.PANSequenceNumber)
+	if err != nil {
+		return missingARQC(err.Error())
+	}
+
+	sessionKey, err := emv.DeriveSessionKey(masterKey, data.ATC)
+	if err != nil {
+		return missingARQC(fmt.Sprintf("deriving session key: %s", err))
+	}
+
+	arqc, err := emv.ApplicationCryptogram(sessionKey, emv.CryptogramData(cdolData, data.AIP, data.ATC))
+	if err != nil {
+		return missingARQC(fmt.Sprintf("computing cryptogram: %s", err))
+	}
+
+	if !bytes.Equal(arqc, data.ARQC) {
+		return ARQCVerification{
+			Result: models.VerificationResultMismatch,
+			Reason: fmt.Sprintf("arqc %X of atc %X doesn't match", data.ARQC, data.ATC),
+		}
+	}
+
+	return ARQCVerification{
+		Result:     models.VerificationResultMatch,
+		arqc:       arqc,
+		sessionKey: sessionKey,
+	}
+}
+
+func missingARQC(reason string) ARQCVerification {
+	return ARQCVerification{
+		Result: models.VerificationResultMissing,
+		Reason: reason,
+	}
+}
+
+// IssuerAuthenticationData returns the EMV data of the authorization response
+// for the verified cryptogram: the issuer authentication data (tag 91) with
+// the ARPC and the authorization response code, and the authorization
+// response code (tag 8A). The terminal passes them to the card in the second
+// GENERATE AC, so the card knows the response came from us. Nothing is
+// returned if the cryptogram was not verified.
+func (v ARQCVerification) IssuerAuthenticationData(responseCode string) ([]byte, error) {
+	if v.Result != models.VerificationResultMatch {
+		return nil, nil
+	}
+
+	// the authorization response code is the response code in ASCII
+	arc := []byte(responseCode)
+
+	arpc, err := emv.ARPC(v.sessionKey, v.arqc, arc)
+	if err != nil {
+		return nil, fmt.Errorf("generating arpc: %w", err)
+	}
+
+	data, err := bertlv.Encode([]bertlv.TLV{
+		bertlv.NewTag("91", append(arpc, arc...)),
+		bertlv.NewTag("8A", arc),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encoding issuer authentication data: %w", err)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,25 @@
+package iso8583
+
+// AdviceRequest is the 0120 message the acquirer sends to advise the issuer of
+// a payment it approved in stand-in while the issuer was unreachable. The
+// STAN and the transmission date & time are the ones the acquirer gave the
+// payment, the authorization code is the one it approved the payment with.
+type AdviceRequest struct {
+	MTI                  string               `index:"0"`
+	PrimaryAccountNumber string               `index:"2"`
+	Amount               int64                `index:"3"`
+	TransmissionDateTime string               `index:"4"`
+	AuthorizationCode    string               `index:"6"`
+	Currency             string               `index:"7"`
+	ExpirationDate       string               `index:"9"`
+	AcceptorInformation  *AcceptorInformation `index:"10"`
+	STAN                 string               `index:"11"`
+	AcquirerID           string               `index:"32"`
+	ChipData             []byte               `index:"55"`
+}
+
+type AdviceResponse struct {
+	MTI          string `index:"0"`
+	ResponseCode string `index:"39"`
+	STAN         string `index:"11"`
+}
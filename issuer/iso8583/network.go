@@ -0,0 +1,24 @@
+package iso8583
+
+// Network management information codes (field 70) of the 0800 message.
+const (
+	NetworkCodeSignOn   = "001"
+	NetworkCodeSignOff  = "002"
+	NetworkCodeEchoTest = "301"
+)
+
+// NetworkManagementRequest is the 0800 message used to sign on, sign off and
+// to check that the connection is alive (echo test).
+type NetworkManagementRequest struct {
+	MTI                  string `index:"0"`
+	TransmissionDateTime string `index:"4"`
+	STAN                 string `index:"11"`
+	Code                 string `index:"70"`
+}
+
+type NetworkManagementResponse struct {
+	MTI          string `index:"0"`
+	ResponseCode string `index:"39"`
+	STAN         string `index:"11"`
+	Code         string `index:"70"`
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"sync"
 
 	"github.com/moov-io/bertlv"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/responsecode"
 	"github.com/moov-io/ftdc-from-tap-to-auth/issuer/models"
 	"github.com/moov-io/iso8583"
 	iso8583Connection "github.com/moov-io/iso8583-connection"
@@ -17,14 +19,33 @@ import (
 type Server struct {
 	Addr string
 
+	// SignOnOptional lets the peers send financial messages without
+	// signing on first, e.g. the acquirer exercise of the workshop that
+	// sends a bare 0100. Set it before Start.
+	SignOnOptional bool
+
 	server     *iso8583Server.Server
 	logger     *slog.Logger
 	authorizer Authorizer
+
+	// signedOn keeps the connections that signed on with 0800 and are
+	// allowed to send financial messages
+	signedOn   map[*iso8583Connection.Connection]bool
+	signedOnMu sync.RWMutex
 }
 
-// Authorizer is an interface that defines the authorization logic.
+// Authorizer is an interface that defines the authorization logic and the
+// processing of messages that follow an authorization (incremental
+// authorization, capture, completion, reversal, refund) or replace it
+// (stand-in advice).
 type Authorizer interface {
 	AuthorizeRequest(req models.AuthorizationRequest) (models.AuthorizationResponse, error)
+	IncrementalAuthorizationRequest(req models.IncrementalAuthorizationRequest) (models.AuthorizationResponse, error)
+	CaptureRequest(req models.CaptureRequest) (models.CaptureResponse, error)
+	CompletionRequest(req models.CompletionRequest) (models.CaptureResponse, error)
+	AdviceRequest(req models.AdviceRequest) (models.AdviceResponse, error)
+	ReverseRequest(req models.ReversalRequest) (models.ReversalResponse, error)
+	RefundRequest(req models.RefundRequest) (models.RefundResponse, error)
 }
 
 // NewServer creates a new Server instance with the given logger, address and authorizer.
@@ -35,6 +56,7 @@ func NewServer(logger *slog.Logger, addr string, authorizer Authorizer) *Server
 		logger:     logger,
 		Addr:       addr,
 		authorizer: authorizer,
+		signedOn:   make(map[*iso8583Connection.Connection]bool),
 	}
 
 	// here we create an instance of the ISO 8583 server
@@ -58,6 +80,9 @@ func NewServer(logger *slog.Logger, addr string, authorizer Authorizer) *Server
 			// print error type
 			s.logger.Error("failed to handle message", slog.String("addr", s.Addr), slog.String("error", err.Error()))
 		}),
+
+		// forget the sign-on of the closed connection
+		iso8583Connection.ConnectionClosedHandler(s.setSignedOn(false)),
 	)
 
 	s.server = iso8583Server
@@ -104,10 +129,30 @@ func (s *Server) handleRequest(c *iso8583Connection.Connection, message *iso8583
 
 	logger.Info("handling request")
 
+	// financial messages are accepted only from signed on peers
+	if mti != "0800" && !s.SignOnOptional && !s.isSignedOn(c) {
+		err = s.refuseRequest(c, message, mti)
+		if err != nil {
+			logger.Error("failed to refuse request", "err", err)
+		}
+
+		return
+	}
+
 	// here we handle different MTIs
 	switch mti {
+	case "0800":
+		err = s.handleNetworkManagementRequest(c, message)
 	case "0100":
 		err = s.handleAuthorizationRequest(c, message)
+	case "0120":
+		err = s.handleAdviceRequest(c, message)
+	case "0200":
+		err = s.handleRefundRequest(c, message)
+	case "0220":
+		err = s.handleCaptureRequest(c, message)
+	case "0400":
+		err = s.handleReversalRequest(c, message)
 	default:
 		err = fmt.Errorf("unknown MTI: %s", mti)
 	}
@@ -125,6 +170,14 @@ func (s *Server) handleAuthorizationRequest(c *iso8583Connection.Connection, mes
 		return fmt.Errorf("unmarshaling message: %w", err)
 	}
 
+	if requestData.OriginalDataElements != nil {
+		return s.handleIncrementalAuthorizationRequest(c, requestData)
+	}
+
+	if requestData.AcceptorInformation == nil {
+		return fmt.Errorf("acceptor information is missing")
+	}
+
 	s.logger.With(
 		slog.String("mti", requestData.MTI),
 		slog.String("stan", requestData.STAN),
@@ -135,8 +188,13 @@ func (s *Server) handleAuthorizationRequest(c *iso8583Connection.Connection, mes
 	// here we create an instance of our authorization request
 	// and pass it to the authorizer
 	authRequest := models.AuthorizationRequest{
-		Amount:   requestData.Amount,
-		Currency: requestData.Currency,
+		Amount:               requestData.Amount,
+		Currency:             requestData.Currency,
+		AcquirerID:           requestData.AcquirerID,
+		STAN:                 requestData.STAN,
+		TransmissionDateTime: requestData.TransmissionDateTime,
+		POSEntryMode:         requestData.POSEntryMode,
+		PartialApproval:      requestData.PartialApproval == PartialApprovalSupported,
 		Merchant: models.Merchant{
 			Name:       requestData.AcceptorInformation.Name,
 			MCC:        requestData.AcceptorInformation.MCC,
@@ -145,58 +203,36 @@ func (s *Server) handleAuthorizationRequest(c *iso8583Connection.Connection, mes
 		},
 	}
 
-	if requestData.ChipData != nil {
-		authRequest.EMVPayload = requestData.ChipData
-
-		// extract card details from EMV payload
-		type card struct {
-			PAN            string `bertlv:"5A"`
-			ExpirationDate string `bertlv:"5F24"` // YYMMDD format
-			CardholderName string `bertlv:"5F20,ascii"`
-		}
-
-		emvTags, err := bertlv.Decode(requestData.ChipData)
-		if err != nil {
-			return fmt.Errorf("decoding EMV payload: %w", err)
-		}
-
-		c := &card{}
-		err = bertlv.Unmarshal(emvTags, c)
-		if err != nil {
-			return fmt.Errorf("unmarshalling EMV tags: %w", err)
-		}
+	authRequest.EMVPayload = requestData.ChipData
 
-		authRequest.Card = models.Card{
-			Number:         c.PAN,
-			ExpirationDate: c.ExpirationDate,
-			CardHolderName: c.CardholderName,
-		}
-	} else {
-		authRequest.Card = models.Card{
-			Number:         requestData.PrimaryAccountNumber,
-			ExpirationDate: requestData.ExpirationDate,
-		}
+	card, err := requestCard(requestData.PrimaryAccountNumber, requestData.ExpirationDate, requestData.CardVerificationValue, requestData.ChipData)
+	if err != nil {
+		return err
 	}
 
+	authRequest.Card = card
+
 	// we define a variable that will hold the response data
 	// we need to define it here so we can set its value in the if/else block
 	var responseData *AuthorizationResponse
 
 	// pass the request to the authorizer and get the response with the
-	// approval code and authorization code
+	// response code and authorization code
 	authResponse, err := s.authorizer.AuthorizeRequest(authRequest)
 	if err != nil {
 		responseData = &AuthorizationResponse{
 			MTI:          "0110",
 			STAN:         requestData.STAN,
-			ApprovalCode: models.ApprovalCodeSystemError,
+			ResponseCode: responsecode.SystemMalfunction,
 		}
 	} else {
 		responseData = &AuthorizationResponse{
 			MTI:               "0110",
 			STAN:              requestData.STAN,
-			ApprovalCode:      authResponse.ApprovalCode,
+			ResponseCode:      authResponse.ResponseCode,
 			AuthorizationCode: authResponse.AuthorizationCode,
+			ApprovedAmount:    authResponse.ApprovedAmount,
+			ChipData:          authResponse.IssuerAuthenticationData,
 		}
 	}
 
@@ -214,9 +250,478 @@ func (s *Server) handleAuthorizationRequest(c *iso8583Connection.Connection, mes
 	s.logger.With(
 		slog.String("mti", responseData.MTI),
 		slog.String("stan", responseData.STAN),
-		slog.String("approval_code", responseData.ApprovalCode),
+		slog.String("response_code", responseData.ResponseCode),
 		slog.String("authorization_code", responseData.AuthorizationCode),
 	).Info("authorization response sent")
 
 	return nil
 }
+
+// requestCard returns the card details of the request. For chip requests
+// they are extracted from the EMV payload, otherwise the PAN, the expiration
+// date and the CVV of the request are used.
+func requestCard(pan, expirationDate, cvv string, chipData []byte) (models.Card, error) {
+	if chipData == nil {
+		return models.Card{
+			Number:                pan,
+			ExpirationDate:        expirationDate,
+			CardVerificationValue: cvv,
+		}, nil
+	}
+
+	// extract card details from EMV payload
+	type card struct {
+		PAN            string `bertlv:"5A"`
+		ExpirationDate string `bertlv:"5F24"` // YYMMDD format
+		CardholderName string `bertlv:"5F20,ascii"`
+	}
+
+	emvTags, err := bertlv.Decode(chipData)
+	if err != nil {
+		return models.Card{}, fmt.Errorf("decoding EMV payload: %w", err)
+	}
+
+	c := &card{}
+	err = bertlv.Unmarshal(emvTags, c)
+	if err != nil {
+		return models.Card{}, fmt.Errorf("unmarshalling EMV tags: %w", err)
+	}
+
+	// chip has expiration date in YYMMDD format, the card has it in MMYY
+	var chipExpirationDate string
+	if len(c.ExpirationDate) >= 4 {
+		chipExpirationDate = c.ExpirationDate[2:4] + c.ExpirationDate[:2]
+	}
+
+	return models.Card{
+		Number:         c.PAN,
+		ExpirationDate: chipExpirationDate,
+		CardHolderName: c.CardholderName,
+	}, nil
+}
+
+// handleIncrementalAuthorizationRequest handles authorization requests that
+// reference an original authorization.
+func (s *Server) handleIncrementalAuthorizationRequest(c *iso8583Connection.Connection, requestData *AuthorizationRequest) error {
+	s.logger.With(
+		slog.String("mti", requestData.MTI),
+		slog.String("stan", requestData.STAN),
+		slog.Int64("amount", requestData.Amount),
+		slog.String("original_stan", requestData.OriginalDataElements.STAN),
+	).Info("handling incremental authorization request")
+
+	authResponse, err := s.authorizer.IncrementalAuthorizationRequest(models.IncrementalAuthorizationRequest{
+		AcquirerID:                   requestData.AcquirerID,
+		OriginalSTAN:                 requestData.OriginalDataElements.STAN,
+		OriginalTransmissionDateTime: requestData.OriginalDataElements.TransmissionDateTime,
+		Amount:                       requestData.Amount,
+		Currency:                     requestData.Currency,
+	})
+	if err != nil {
+		s.logger.Error("failed to increment authorization", "err", err)
+
+		authResponse = models.AuthorizationResponse{
+			ResponseCode: responsecode.SystemMalfunction,
+		}
+	}
+
+	responseData := &AuthorizationResponse{
+		MTI:               "0110",
+		STAN:              requestData.STAN,
+		ResponseCode:      authResponse.ResponseCode,
+		AuthorizationCode: authResponse.AuthorizationCode,
+	}
+
+	responseMessage := iso8583.NewMessage(spec)
+	if err := responseMessage.Marshal(responseData); err != nil {
+		return fmt.Errorf("marshaling response: %w", err)
+	}
+
+	if err := c.Reply(responseMessage); err != nil {
+		return fmt.Errorf("sending response: %w", err)
+	}
+
+	s.logger.With(
+		slog.String("mti", responseData.MTI),
+		slog.String("stan", responseData.STAN),
+		slog.String("response_code", responseData.ResponseCode),
+		slog.String("authorization_code", responseData.AuthorizationCode),
+	).Info("incremental authorization response sent")
+
+	return nil
+}
+
+// handleCaptureRequest handles capture and completion (financial advice)
+// requests.
+func (s *Server) handleCaptureRequest(c *iso8583Connection.Connection, message *iso8583.Message) error {
+	requestData := &CaptureRequest{}
+	if err := message.Unmarshal(requestData); err != nil {
+		return fmt.Errorf("unmarshaling message: %w", err)
+	}
+
+	s.logger.With(
+		slog.String("mti", requestData.MTI),
+		slog.String("stan", requestData.STAN),
+		slog.Int64("amount", requestData.Amount),
+		slog.String("authorization_code", requestData.AuthorizationCode),
+	).Info("handling capture request")
+
+	var captureResponse models.CaptureResponse
+	var err error
+
+	// captures reference the authorization by its authorization code too,
+	// completions only by the original data elements
+	original := requestData.OriginalDataElements
+	if original == nil {
+		original = &OriginalDataElements{}
+	}
+
+	if requestData.AuthorizationCode == "" {
+		captureResponse, err = s.authorizer.CompletionRequest(models.CompletionRequest{
+			AcquirerID:                   requestData.AcquirerID,
+			OriginalSTAN:                 original.STAN,
+			OriginalTransmissionDateTime: original.TransmissionDateTime,
+			Amount:                       requestData.Amount,
+			Currency:                     requestData.Currency,
+		})
+	} else {
+		captureResponse, err = s.authorizer.CaptureRequest(models.CaptureRequest{
+			AcquirerID:                   requestData.AcquirerID,
+			OriginalSTAN:                 original.STAN,
+			OriginalTransmissionDateTime: original.TransmissionDateTime,
+			AuthorizationCode:            requestData.AuthorizationCode,
+			Amount:                       requestData.Amount,
+			Currency:                     requestData.Currency,
+		})
+	}
+	if err != nil {
+		s.logger.Error("failed to capture request", "err", err)
+
+		captureResponse = models.CaptureResponse{
+			ResponseCode: responsecode.SystemMalfunction,
+		}
+	}
+
+	responseData := &CaptureResponse{
+		MTI:          "0230",
+		STAN:         requestData.STAN,
+		ResponseCode: captureResponse.ResponseCode,
+	}
+
+	responseMessage := iso8583.NewMessage(spec)
+	if err := responseMessage.Marshal(responseData); err != nil {
+		return fmt.Errorf("marshaling response: %w", err)
+	}
+
+	if err := c.Reply(responseMessage); err != nil {
+		return fmt.Errorf("sending response: %w", err)
+	}
+
+	s.logger.With(
+		slog.String("mti", responseData.MTI),
+		slog.String("stan", responseData.STAN),
+		slog.String("response_code", responseData.ResponseCode),
+	).Info("capture response sent")
+
+	return nil
+}
+
+// handleAdviceRequest handles the advices of payments the acquirer approved in
+// stand-in.
+func (s *Server) handleAdviceRequest(c *iso8583Connection.Connection, message *iso8583.Message) error {
+	requestData := &AdviceRequest{}
+	if err := message.Unmarshal(requestData); err != nil {
+		return fmt.Errorf("unmarshaling message: %w", err)
+	}
+
+	if requestData.AcceptorInformation == nil {
+		return fmt.Errorf("acceptor information is missing")
+	}
+
+	s.logger.With(
+		slog.String("mti", requestData.MTI),
+		slog.String("stan", requestData.STAN),
+		slog.Int64("amount", requestData.Amount),
+		slog.String("authorization_code", requestData.AuthorizationCode),
+	).Info("handling advice request")
+
+	card, err := requestCard(requestData.PrimaryAccountNumber, requestData.ExpirationDate, "", requestData.ChipData)
+	if err != nil {
+		return err
+	}
+
+	adviceResponse, err := s.authorizer.AdviceRequest(models.AdviceRequest{
+		Amount:     requestData.Amount,
+		Currency:   requestData.Currency,
+		Card:       card,
+		EMVPayload: requestData.ChipData,
+		Merchant: models.Merchant{
+			Name:       requestData.AcceptorInformation.Name,
+			MCC:        requestData.AcceptorInformation.MCC,
+			PostalCode: requestData.AcceptorInformation.PostalCode,
+			WebSite:    requestData.AcceptorInformation.WebSite,
+		},
+		AcquirerID:           requestData.AcquirerID,
+		STAN:                 requestData.STAN,
+		TransmissionDateTime: requestData.TransmissionDateTime,
+		AuthorizationCode:    requestData.AuthorizationCode,
+	})
+	if err != nil {
+		s.logger.Error("failed to apply advice", "err", err)
+
+		adviceResponse = models.AdviceResponse{
+			ResponseCode: responsecode.SystemMalfunction,
+		}
+	}
+
+	responseData := &AdviceResponse{
+		MTI:          "0130",
+		STAN:         requestData.STAN,
+		ResponseCode: adviceResponse.ResponseCode,
+	}
+
+	responseMessage := iso8583.NewMessage(spec)
+	if err := responseMessage.Marshal(responseData); err != nil {
+		return fmt.Errorf("marshaling response: %w", err)
+	}
+
+	if err := c.Reply(responseMessage); err != nil {
+		return fmt.Errorf("sending response: %w", err)
+	}
+
+	s.logger.With(
+		slog.String("mti", responseData.MTI),
+		slog.String("stan", responseData.STAN),
+		slog.String("response_code", responseData.ResponseCode),
+	).Info("advice response sent")
+
+	return nil
+}
+
+// handleReversalRequest handles reversal requests.
+func (s *Server) handleReversalRequest(c *iso8583Connection.Connection, message *iso8583.Message) error {
+	requestData := &ReversalRequest{}
+	if err := message.Unmarshal(requestData); err != nil {
+		return fmt.Errorf("unmarshaling message: %w", err)
+	}
+
+	if requestData.OriginalDataElements == nil {
+		return fmt.Errorf("original data elements are missing")
+	}
+
+	s.logger.With(
+		slog.String("mti", requestData.MTI),
+		slog.String("stan", requestData.STAN),
+		slog.Int64("amount", requestData.Amount),
+		slog.String("original_stan", requestData.OriginalDataElements.STAN),
+	).Info("handling reversal request")
+
+	reversalResponse, err := s.authorizer.ReverseRequest(models.ReversalRequest{
+		AcquirerID:                   requestData.AcquirerID,
+		OriginalSTAN:                 requestData.OriginalDataElements.STAN,
+		OriginalTransmissionDateTime: requestData.OriginalDataElements.TransmissionDateTime,
+		Amount:                       requestData.Amount,
+		Currency:                     requestData.Currency,
+	})
+	if err != nil {
+		s.logger.Error("failed to reverse request", "err", err)
+
+		reversalResponse = models.ReversalResponse{
+			ResponseCode: responsecode.SystemMalfunction,
+		}
+	}
+
+	responseData := &ReversalResponse{
+		MTI:          "0410",
+		STAN:         requestData.STAN,
+		ResponseCode: reversalResponse.ResponseCode,
+	}
+
+	responseMessage := iso8583.NewMessage(spec)
+	if err := responseMessage.Marshal(responseData); err != nil {
+		return fmt.Errorf("marshaling response: %w", err)
+	}
+
+	if err := c.Reply(responseMessage); err != nil {
+		return fmt.Errorf("sending response: %w", err)
+	}
+
+	s.logger.With(
+		slog.String("mti", responseData.MTI),
+		slog.String("stan", responseData.STAN),
+		slog.String("response_code", responseData.ResponseCode),
+	).Info("reversal response sent")
+
+	return nil
+}
+
+// handleRefundRequest handles refund requests.
+func (s *Server) handleRefundRequest(c *iso8583Connection.Connection, message *iso8583.Message) error {
+	requestData := &RefundRequest{}
+	if err := message.Unmarshal(requestData); err != nil {
+		return fmt.Errorf("unmarshaling message: %w", err)
+	}
+
+	if requestData.OriginalDataElements == nil {
+		return fmt.Errorf("original data elements are missing")
+	}
+
+	s.logger.With(
+		slog.String("mti", requestData.MTI),
+		slog.String("stan", requestData.STAN),
+		slog.Int64("amount", requestData.Amount),
+		slog.String("original_stan", requestData.OriginalDataElements.STAN),
+	).Info("handling refund request")
+
+	refundResponse, err := s.authorizer.RefundRequest(models.RefundRequest{
+		AcquirerID:                   requestData.AcquirerID,
+		OriginalSTAN:                 requestData.OriginalDataElements.STAN,
+		OriginalTransmissionDateTime: requestData.OriginalDataElements.TransmissionDateTime,
+		Amount:                       requestData.Amount,
+		Currency:                     requestData.Currency,
+	})
+	if err != nil {
+		s.logger.Error("failed to refund request", "err", err)
+
+		refundResponse = models.RefundResponse{
+			ResponseCode: responsecode.SystemMalfunction,
+		}
+	}
+
+	responseData := &RefundResponse{
+		MTI:          "0210",
+		STAN:         requestData.STAN,
+		ResponseCode: refundResponse.ResponseCode,
+	}
+
+	responseMessage := iso8583.NewMessage(spec)
+	if err := responseMessage.Marshal(responseData); err != nil {
+		return fmt.Errorf("marshaling response: %w", err)
+	}
+
+	if err := c.Reply(responseMessage); err != nil {
+		return fmt.Errorf("sending response: %w", err)
+	}
+
+	s.logger.With(
+		slog.String("mti", responseData.MTI),
+		slog.String("stan", responseData.STAN),
+		slog.String("response_code", responseData.ResponseCode),
+	).Info("refund response sent")
+
+	return nil
+}
+
+// handleNetworkManagementRequest handles sign-on, sign-off and echo test
+// requests.
+func (s *Server) handleNetworkManagementRequest(c *iso8583Connection.Connection, message *iso8583.Message) error {
+	requestData := &NetworkManagementRequest{}
+	if err := message.Unmarshal(requestData); err != nil {
+		return fmt.Errorf("unmarshaling message: %w", err)
+	}
+
+	s.logger.With(
+		slog.String("mti", requestData.MTI),
+		slog.String("stan", requestData.STAN),
+		slog.String("code", requestData.Code),
+	).Info("handling network management request")
+
+	responseCode := responsecode.Approved
+
+	switch requestData.Code {
+	case NetworkCodeSignOn:
+		s.setSignedOn(true)(c)
+	case NetworkCodeSignOff:
+		s.setSignedOn(false)(c)
+	case NetworkCodeEchoTest:
+		// nothing to do, the response itself is the echo
+	default:
+		responseCode = responsecode.InvalidTransaction
+	}
+
+	responseData := &NetworkManagementResponse{
+		MTI:          "0810",
+		STAN:         requestData.STAN,
+		ResponseCode: responseCode,
+		Code:         requestData.Code,
+	}
+
+	responseMessage := iso8583.NewMessage(spec)
+	if err := responseMessage.Marshal(responseData); err != nil {
+		return fmt.Errorf("marshaling response: %w", err)
+	}
+
+	if err := c.Reply(responseMessage); err != nil {
+		return fmt.Errorf("sending response: %w", err)
+	}
+
+	s.logger.With(
+		slog.String("mti", responseData.MTI),
+		slog.String("stan", responseData.STAN),
+		slog.String("response_code", responseData.ResponseCode),
+	).Info("network management response sent")
+
+	return nil
+}
+
+// refusedResponse is a response to a request that was not processed.
+type refusedResponse struct {
+	MTI          string `index:"0"`
+	ResponseCode string `index:"39"`
+	STAN         string `index:"11"`
+}
+
+// refuseRequest replies to the request from the peer that has not signed on
+// yet without passing it to the authorizer.
+func (s *Server) refuseRequest(c *iso8583Connection.Connection, message *iso8583.Message, mti string) error {
+	if len(mti) != 4 || mti[2] < '0' || mti[2] > '8' {
+		return fmt.Errorf("unknown MTI: %s", mti)
+	}
+
+	stan, err := message.GetString(11)
+	if err != nil {
+		return fmt.Errorf("getting STAN: %w", err)
+	}
+
+	s.logger.Warn("refusing request from connection that is not signed on", slog.String("mti", mti), slog.String("stan", stan))
+
+	// response MTI has the message function increased by one, e.g. 0100 -> 0110
+	responseData := &refusedResponse{
+		MTI:          mti[:2] + string(mti[2]+1) + mti[3:],
+		STAN:         stan,
+		ResponseCode: responsecode.IssuerUnavailable,
+	}
+
+	responseMessage := iso8583.NewMessage(spec)
+	if err := responseMessage.Marshal(responseData); err != nil {
+		return fmt.Errorf("marshaling response: %w", err)
+	}
+
+	if err := c.Reply(responseMessage); err != nil {
+		return fmt.Errorf("sending response: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Server) isSignedOn(c *iso8583Connection.Connection) bool {
+	s.signedOnMu.RLock()
+	defer s.signedOnMu.RUnlock()
+
+	return s.signedOn[c]
+}
+
+// setSignedOn returns a function that sets the sign-on state of the
+// connection, so it can be used as a connection closed handler as well.
+func (s *Server) setSignedOn(signedOn bool) func(c *iso8583Connection.Connection) {
+	return func(c *iso8583Connection.Connection) {
+		s.signedOnMu.Lock()
+		defer s.signedOnMu.Unlock()
+
+		if signedOn {
+			s.signedOn[c] = true
+		} else {
+			delete(s.signedOn, c)
+		}
+	}
+}
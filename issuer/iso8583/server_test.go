@@ -0,0 +1,155 @@
+package iso8583
+
+import (
+	"testing"
+	"time"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/responsecode"
+	"github.com/moov-io/ftdc-from-tap-to-auth/issuer/models"
+	"github.com/moov-io/ftdc-from-tap-to-auth/log"
+	"github.com/moov-io/iso8583"
+	iso8583Connection "github.com/moov-io/iso8583-connection"
+	"github.com/stretchr/testify/require"
+)
+
+type authorizerMock struct{}
+
+func (a *authorizerMock) AuthorizeRequest(req models.AuthorizationRequest) (models.AuthorizationResponse, error) {
+	return models.AuthorizationResponse{ResponseCode: responsecode.Approved, AuthorizationCode: "123456"}, nil
+}
+
+func (a *authorizerMock) IncrementalAuthorizationRequest(req models.IncrementalAuthorizationRequest) (models.AuthorizationResponse, error) {
+	return models.AuthorizationResponse{ResponseCode: responsecode.Approved, AuthorizationCode: "123456"}, nil
+}
+
+func (a *authorizerMock) CaptureRequest(req models.CaptureRequest) (models.CaptureResponse, error) {
+	return models.CaptureResponse{ResponseCode: responsecode.Approved}, nil
+}
+
+func (a *authorizerMock) CompletionRequest(req models.CompletionRequest) (models.CaptureResponse, error) {
+	return models.CaptureResponse{ResponseCode: responsecode.Approved}, nil
+}
+
+func (a *authorizerMock) AdviceRequest(req models.AdviceRequest) (models.AdviceResponse, error) {
+	return models.AdviceResponse{ResponseCode: responsecode.Approved}, nil
+}
+
+func (a *authorizerMock) ReverseRequest(req models.ReversalRequest) (models.ReversalResponse, error) {
+	return models.ReversalResponse{ResponseCode: responsecode.Approved}, nil
+}
+
+func (a *authorizerMock) RefundRequest(req models.RefundRequest) (models.RefundResponse, error) {
+	return models.RefundResponse{ResponseCode: responsecode.Approved}, nil
+}
+
+func TestServerWithOptionalSignOn(t *testing.T) {
+	server := NewServer(log.New(), "127.0.0.1:0", &authorizerMock{})
+	server.SignOnOptional = true
+	require.NoError(t, server.Start())
+	defer server.Close()
+
+	conn, err := iso8583Connection.New(server.Addr, spec, readMessageLength, writeMessageLength, iso8583Connection.SendTimeout(time.Second))
+	require.NoError(t, err)
+	require.NoError(t, conn.Connect())
+	defer conn.Close()
+
+	message := iso8583.NewMessage(spec)
+	err = message.Marshal(&AuthorizationRequest{
+		MTI:                  "0100",
+		Amount:               1000,
+		Currency:             "USD",
+		TransmissionDateTime: time.Now().UTC().Format(time.RFC3339),
+		STAN:                 "000001",
+		PrimaryAccountNumber: "4242424242424242",
+		ExpirationDate:       "1230",
+		AcceptorInformation:  &AcceptorInformation{Name: "Demo Merchant", MCC: "5411"},
+	})
+	require.NoError(t, err)
+
+	// the authorization is processed without sign-on
+	response, err := conn.Send(message)
+	require.NoError(t, err)
+
+	responseData := &AuthorizationResponse{}
+	require.NoError(t, response.Unmarshal(responseData))
+	require.Equal(t, responsecode.Approved, responseData.ResponseCode)
+}
+
+func TestServerRequiresSignOn(t *testing.T) {
+	server := NewServer(log.New(), "127.0.0.1:0", &authorizerMock{})
+	require.NoError(t, server.Start())
+	defer server.Close()
+
+	conn, err := iso8583Connection.New(server.Addr, spec, readMessageLength, writeMessageLength, iso8583Connection.SendTimeout(time.Second))
+	require.NoError(t, err)
+	require.NoError(t, conn.Connect())
+	defer conn.Close()
+
+	authorize := func(stan string) *AuthorizationResponse {
+		message := iso8583.NewMessage(spec)
+		err := message.Marshal(&AuthorizationRequest{
+			MTI:                  "0100",
+			Amount:               1000,
+			Currency:             "USD",
+			TransmissionDateTime: time.Now().UTC().Format(time.RFC3339),
+			STAN:                 stan,
+			PrimaryAccountNumber: "4242424242424242",
+			ExpirationDate:       "1230",
+			AcceptorInformation:  &AcceptorInformation{Name: "Demo Merchant", MCC: "5411"},
+		})
+		require.NoError(t, err)
+
+		response, err := conn.Send(message)
+		require.NoError(t, err)
+
+		responseData := &AuthorizationResponse{}
+		require.NoError(t, response.Unmarshal(responseData))
+
+		return responseData
+	}
+
+	networkManagement := func(stan, code string) *NetworkManagementResponse {
+		message := iso8583.NewMessage(spec)
+		err := message.Marshal(&NetworkManagementRequest{
+			MTI:                  "0800",
+			TransmissionDateTime: time.Now().UTC().Format(time.RFC3339),
+			STAN:                 stan,
+			Code:                 code,
+		})
+		require.NoError(t, err)
+
+		response, err := conn.Send(message)
+		require.NoError(t, err)
+
+		responseData := &NetworkManagementResponse{}
+		require.NoError(t, response.Unmarshal(responseData))
+
+		return responseData
+	}
+
+	// authorization is refused before sign-on
+	response := authorize("000001")
+	require.Equal(t, "0110", response.MTI)
+	require.Equal(t, responsecode.IssuerUnavailable, response.ResponseCode)
+
+	// echo test works without sign-on
+	nmResponse := networkManagement("000002", NetworkCodeEchoTest)
+	require.Equal(t, "0810", nmResponse.MTI)
+	require.Equal(t, responsecode.Approved, nmResponse.ResponseCode)
+
+	nmResponse = networkManagement("000003", NetworkCodeSignOn)
+	require.Equal(t, responsecode.Approved, nmResponse.ResponseCode)
+
+	response = authorize("000004")
+	require.Equal(t, responsecode.Approved, response.ResponseCode)
+
+	nmResponse = networkManagement("000005", NetworkCodeSignOff)
+	require.Equal(t, responsecode.Approved, nmResponse.ResponseCode)
+
+	response = authorize("000006")
+	require.Equal(t, responsecode.IssuerUnavailable, response.ResponseCode)
+
+	// unknown network management codes are rejected
+	nmResponse = networkManagement("000007", "999")
+	require.Equal(t, responsecode.InvalidTransaction, nmResponse.ResponseCode)
+}
@@ -47,13 +47,6 @@ var spec *iso8583.MessageSpec = &iso8583.MessageSpec{
 			Enc:         encoding.ASCII,
 			Pref:        prefix.ASCII.Fixed,
 		}),
-		5: field.NewString(&field.Spec{
-			Length:      2,
-			Description: "Approval Code",
-			Enc:         encoding.ASCII,
-			Pref:        prefix.ASCII.Fixed,
-			Pad:         padding.Left('0'),
-		}),
 		6: field.NewString(&field.Spec{
 			Length:      6,
 			Description: "Authorization Code",
@@ -70,7 +63,7 @@ var spec *iso8583.MessageSpec = &iso8583.MessageSpec{
 			Length:      4,
 			Description: "Card Verification Value (CVV)",
 			Enc:         encoding.ASCII,
-			Pref:        prefix.ASCII.Fixed,
+			Pref:        prefix.ASCII.LL,
 		}),
 		9: field.NewString(&field.Spec{
 			Length:      4,
@@ -120,12 +113,85 @@ var spec *iso8583.MessageSpec = &iso8583.MessageSpec{
 			Enc:         encoding.ASCII,
 			Pref:        prefix.ASCII.Fixed,
 		}),
+		22: field.NewString(&field.Spec{
+			Length:      2,
+			Description: "POS Entry Mode",
+			Enc:         encoding.ASCII,
+			Pref:        prefix.ASCII.Fixed,
+		}),
+		32: field.NewString(&field.Spec{
+			Length:      11,
+			Description: "Acquiring Institution Identification Code",
+			Enc:         encoding.ASCII,
+			Pref:        prefix.ASCII.LL,
+		}),
+		33: field.NewString(&field.Spec{
+			Length:      11,
+			Description: "Forwarding Institution Identification Code",
+			Enc:         encoding.ASCII,
+			Pref:        prefix.ASCII.LL,
+		}),
+		39: field.NewString(&field.Spec{
+			Length:      2,
+			Description: "Response Code",
+			Enc:         encoding.ASCII,
+			Pref:        prefix.ASCII.Fixed,
+		}),
+		54: field.NewNumeric(&field.Spec{
+			Length:      6,
+			Description: "Approved Amount",
+			Enc:         encoding.ASCII,
+			Pref:        prefix.ASCII.Fixed,
+			Pad:         padding.Left('0'),
+		}),
 		55: field.NewBinary(&field.Spec{
 			Length:      999,
 			Description: "Chip Data",
 			Pref:        prefix.ASCII.LLL,
 			Enc:         encoding.Binary,
 		}),
+		60: field.NewString(&field.Spec{
+			Length:      1,
+			Description: "Partial Approval Indicator",
+			Enc:         encoding.ASCII,
+			Pref:        prefix.ASCII.Fixed,
+		}),
+		70: field.NewString(&field.Spec{
+			Length:      3,
+			Description: "Network Management Information Code",
+			Enc:         encoding.ASCII,
+			Pref:        prefix.ASCII.Fixed,
+		}),
+		90: field.NewComposite(&field.Spec{
+			Length:      999,
+			Description: "Original Data Elements",
+			Pref:        prefix.ASCII.LLL,
+			Tag: &field.TagSpec{
+				Length: 2,
+				Enc:    encoding.ASCII,
+				Sort:   sort.StringsByInt,
+			},
+			Subfields: map[string]field.Field{
+				"01": field.NewString(&field.Spec{
+					Length:      4,
+					Description: "Original Message Type Indicator",
+					Enc:         encoding.ASCII,
+					Pref:        prefix.ASCII.Fixed,
+				}),
+				"02": field.NewString(&field.Spec{
+					Length:      6,
+					Description: "Original Systems Trace Audit Number (STAN)",
+					Enc:         encoding.ASCII,
+					Pref:        prefix.ASCII.Fixed,
+				}),
+				"03": field.NewString(&field.Spec{
+					Length:      20,
+					Description: "Original Transmission Date & Time",
+					Enc:         encoding.ASCII,
+					Pref:        prefix.ASCII.Fixed,
+				}),
+			},
+		}),
 	},
 }
 
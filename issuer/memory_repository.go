@@ -0,0 +1,626 @@
+package issuer
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/issuer/models"
+)
+
+type persistedData struct {
+	Cards           []*models.Card          `json:"cards"`
+	Accounts        []*models.Account       `json:"accounts"`
+	Transactions    []*models.Transaction   `json:"transactions"`
+	JournalEntries  []*models.JournalEntry  `json:"journal_entries"`
+	ClearingBatches []*models.ClearingBatch `json:"clearing_batches"`
+}
+
+// MemoryRepository keeps the data in memory. It's saved to the JSON file it
+// was loaded from when the repository is closed.
+type MemoryRepository struct {
+	Cards           []*models.Card
+	Accounts        []*models.Account
+	Transactions    []*models.Transaction
+	JournalEntries  []*models.JournalEntry
+	ClearingBatches []*models.ClearingBatch
+
+	mu   sync.RWMutex
+	path string
+}
+
+var _ Repository = (*MemoryRepository)(nil)
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		Cards:           make([]*models.Card, 0),
+		Accounts:        make([]*models.Account, 0),
+		Transactions:    make([]*models.Transaction, 0),
+		JournalEntries:  make([]*models.JournalEntry, 0),
+		ClearingBatches: make([]*models.ClearingBatch, 0),
+	}
+}
+
+// CreateAccount creates the account and posts the opening entry with its
+// initial balance.
+func (r *MemoryRepository) CreateAccount(account *models.Account, opening *models.JournalEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.postJournalEntry(opening); err != nil {
+		return err
+	}
+
+	stored := *account
+	r.Accounts = append(r.Accounts, &stored)
+
+	return nil
+}
+
+func (r *MemoryRepository) GetAccounts() ([]models.Account, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	accounts := make([]models.Account, 0)
+	for _, account := range r.Accounts {
+		accounts = append(accounts, r.accountWithBalances(account))
+	}
+	return accounts, nil
+}
+
+// GetAccount returns a copy of the account with the balances derived from
+// the ledger.
+func (r *MemoryRepository) GetAccount(accountID string) (*models.Account, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, account := range r.Accounts {
+		if account.ID == accountID {
+			found := r.accountWithBalances(account)
+			return &found, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// GetAccountLedger returns the account's journal entries and the balances
+// derived from them.
+func (r *MemoryRepository) GetAccountLedger(accountID string) (*models.AccountLedger, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	account, err := r.findAccount(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	withBalances := r.accountWithBalances(account)
+	ledger := &models.AccountLedger{
+		AccountID:        accountID,
+		AvailableBalance: withBalances.AvailableBalance,
+		HoldBalance:      withBalances.HoldBalance,
+		Entries:          make([]*models.JournalEntry, 0),
+	}
+
+	for _, entry := range r.JournalEntries {
+		if entry.AccountID == accountID {
+			ledger.Entries = append(ledger.Entries, entry)
+		}
+	}
+
+	return ledger, nil
+}
+
+// PostJournalEntry posts the balanced entry to the ledger. The entry is
+// rejected if it would make the available balance or the hold of the account
+// negative.
+func (r *MemoryRepository) PostJournalEntry(entry *models.JournalEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.findAccount(entry.AccountID); err != nil {
+		return err
+	}
+
+	return r.postJournalEntry(entry)
+}
+
+// postJournalEntry expects the caller to hold the lock.
+func (r *MemoryRepository) postJournalEntry(entry *models.JournalEntry) error {
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+
+	available := models.AvailableLedgerAccount(entry.AccountID)
+	hold := models.HoldLedgerAccount(entry.AccountID)
+
+	for _, p := range entry.Postings {
+		if p.Amount >= 0 {
+			continue
+		}
+
+		switch p.LedgerAccount {
+		case available:
+			if !entry.MayOverdraw() && r.ledgerBalance(available)+p.Amount < 0 {
+				return models.ErrInsufficientFunds
+			}
+		case hold:
+			if r.ledgerBalance(hold)+p.Amount < 0 {
+				return models.ErrInsufficientHold
+			}
+		}
+	}
+
+	r.JournalEntries = append(r.JournalEntries, entry)
+
+	return nil
+}
+
+// ledgerBalance sums the postings of the ledger account. It expects the
+// caller to hold the lock.
+func (r *MemoryRepository) ledgerBalance(ledgerAccount string) int64 {
+	var balance int64
+
+	for _, entry := range r.JournalEntries {
+		for _, p := range entry.Postings {
+			if p.LedgerAccount == ledgerAccount {
+				balance += p.Amount
+			}
+		}
+	}
+
+	return balance
+}
+
+// accountWithBalances expects the caller to hold the lock.
+func (r *MemoryRepository) accountWithBalances(account *models.Account) models.Account {
+	return models.Account{
+		ID:               account.ID,
+		OwnerName:        account.OwnerName,
+		AvailableBalance: r.ledgerBalance(models.AvailableLedgerAccount(account.ID)),
+		HoldBalance:      r.ledgerBalance(models.HoldLedgerAccount(account.ID)),
+		Currency:         account.Currency,
+	}
+}
+
+// findAccount expects the caller to hold the lock.
+func (r *MemoryRepository) findAccount(accountID string) (*models.Account, error) {
+	for _, account := range r.Accounts {
+		if account.ID == accountID {
+			return account, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (r *MemoryRepository) CreateCard(card *models.Card) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Cards = append(r.Cards, card)
+
+	return nil
+}
+
+// FindCardForAuthorization returns a copy of the card with the number from
+// the request, so its status can't change while the request is authorized.
+func (r *MemoryRepository) FindCardForAuthorization(card models.Card) (*models.Card, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, c := range r.Cards {
+		match := c.Number == card.Number
+
+		if match {
+			found := *c
+			return &found, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// GetCard returns a copy of the account's card with the given ID.
+func (r *MemoryRepository) GetCard(accountID, cardID string) (*models.Card, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	card, err := r.findCard(accountID, cardID)
+	if err != nil {
+		return nil, err
+	}
+
+	found := *card
+	return &found, nil
+}
+
+// UpdateCardStatus moves the card to the given status and returns a copy of
+// the updated card.
+func (r *MemoryRepository) UpdateCardStatus(accountID, cardID string, status models.CardStatus) (*models.Card, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	card, err := r.findCard(accountID, cardID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := card.TransitionTo(status); err != nil {
+		return nil, err
+	}
+
+	updated := *card
+	return &updated, nil
+}
+
+// UpdateCardSpendingControls replaces the card's spending controls and returns
+// a copy of the updated card.
+func (r *MemoryRepository) UpdateCardSpendingControls(accountID, cardID string, controls models.SpendingControls) (*models.Card, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	card, err := r.findCard(accountID, cardID)
+	if err != nil {
+		return nil, err
+	}
+
+	card.SpendingControls = controls
+
+	updated := *card
+	return &updated, nil
+}
+
+// ReplaceCard marks the card as replaced by the new card. The new card gets
+// the spending controls of the old one and stays inactive until it's
+// activated.
+func (r *MemoryRepository) ReplaceCard(accountID, cardID, newCardID string) (*models.Card, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	card, err := r.findCard(accountID, cardID)
+	if err != nil {
+		return nil, err
+	}
+
+	newCard, err := r.findCard(accountID, newCardID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := card.TransitionTo(models.CardStatusReplaced); err != nil {
+		return nil, err
+	}
+
+	card.ReplacedByCardID = newCard.ID
+	newCard.ReplacesCardID = card.ID
+	newCard.Status = models.CardStatusInactive
+	newCard.SpendingControls = card.SpendingControls
+
+	replacement := *newCard
+	return &replacement, nil
+}
+
+// findCard expects the caller to hold the lock.
+func (r *MemoryRepository) findCard(accountID, cardID string) (*models.Card, error) {
+	for _, card := range r.Cards {
+		if card.ID == cardID && card.AccountID == accountID {
+			return card, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (r *MemoryRepository) CreateTransaction(transaction *models.Transaction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if transaction.STAN != "" {
+		for _, t := range r.Transactions {
+			if t.AcquirerID == transaction.AcquirerID && t.STAN == transaction.STAN &&
+				t.TransmissionDateTime == transaction.TransmissionDateTime {
+				return models.ErrDuplicateTransaction
+			}
+		}
+	}
+
+	stored := *transaction
+	r.Transactions = append(r.Transactions, &stored)
+
+	return nil
+}
+
+// UpdateTransaction saves the changes of the transaction and posts the
+// journal entries. Nothing is saved if any of the entries is rejected or the
+// transaction was updated since it was read.
+func (r *MemoryRepository) UpdateTransaction(transaction *models.Transaction, entries ...*models.JournalEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	index := -1
+	for i, t := range r.Transactions {
+		if t.ID == transaction.ID {
+			index = i
+			break
+		}
+	}
+
+	if index == -1 {
+		return ErrNotFound
+	}
+
+	if r.Transactions[index].Version != transaction.Version {
+		return models.ErrTransactionConflict
+	}
+
+	posted := len(r.JournalEntries)
+	for _, entry := range entries {
+		if err := r.postJournalEntry(entry); err != nil {
+			// roll back the entries posted so far
+			r.JournalEntries = r.JournalEntries[:posted]
+			return err
+		}
+	}
+
+	transaction.Version++
+
+	stored := *transaction
+	r.Transactions[index] = &stored
+
+	return nil
+}
+
+// ListTransactions returns all transactions for a given account ID.
+func (r *MemoryRepository) ListTransactions(accountID string) ([]*models.Transaction, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	transactions := make([]*models.Transaction, 0)
+
+	for _, transaction := range r.Transactions {
+		if transaction.AccountID == accountID {
+			found := *transaction
+			transactions = append(transactions, &found)
+		}
+	}
+
+	return transactions, nil
+}
+
+// CardUsage returns the number and the total amount of the card's
+// transactions created since the given time that hold or took the funds.
+func (r *MemoryRepository) CardUsage(cardID string, since time.Time) (models.Usage, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var usage models.Usage
+
+	for _, transaction := range r.Transactions {
+		if transaction.CardID != cardID || transaction.CreatedAt.Before(since) {
+			continue
+		}
+
+		switch transaction.Status {
+		case models.TransactionStatusAuthorized:
+			usage.Count++
+			usage.Amount += transaction.Amount
+		case models.TransactionStatusCaptured:
+			usage.Count++
+			usage.Amount += transaction.CapturedAmount
+		}
+	}
+
+	return usage, nil
+}
+
+// GetTransaction returns the transaction with the given ID for the account.
+func (r *MemoryRepository) GetTransaction(accountID, transactionID string) (*models.Transaction, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, transaction := range r.Transactions {
+		if transaction.ID == transactionID && transaction.AccountID == accountID {
+			found := *transaction
+			return &found, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// FindTransactionByTrace returns the transaction created for the
+// authorization request of the acquirer with the given STAN and transmission
+// date & time.
+func (r *MemoryRepository) FindTransactionByTrace(acquirerID, stan, transmissionDateTime string) (*models.Transaction, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for i := len(r.Transactions) - 1; i >= 0; i-- {
+		transaction := r.Transactions[i]
+		if transaction.AcquirerID == acquirerID && transaction.STAN == stan &&
+			transaction.TransmissionDateTime == transmissionDateTime {
+			found := *transaction
+			return &found, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (r *MemoryRepository) CreateClearingBatch(batch *models.ClearingBatch) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, ingested := range r.ClearingBatches {
+		if ingested.ID == batch.ID {
+			return models.ErrClearingBatchIngested
+		}
+	}
+
+	stored := *batch
+	stored.Records = slices.Clone(batch.Records)
+	r.ClearingBatches = append(r.ClearingBatches, &stored)
+
+	return nil
+}
+
+func (r *MemoryRepository) UpdateClearingBatch(batch *models.ClearingBatch) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, stored := range r.ClearingBatches {
+		if stored.ID == batch.ID {
+			updated := *batch
+			updated.Records = slices.Clone(batch.Records)
+			r.ClearingBatches[i] = &updated
+
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (r *MemoryRepository) ReclaimClearingBatch(batch *models.ClearingBatch, claimedAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, stored := range r.ClearingBatches {
+		if stored.ID == batch.ID && stored.Ingesting && stored.IngestedAt.Equal(claimedAt) {
+			reclaimed := *batch
+			reclaimed.Records = slices.Clone(batch.Records)
+			r.ClearingBatches[i] = &reclaimed
+
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (r *MemoryRepository) DeleteClearingBatch(batchID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ClearingBatches = slices.DeleteFunc(r.ClearingBatches, func(batch *models.ClearingBatch) bool {
+		return batch.ID == batchID
+	})
+
+	return nil
+}
+
+func (r *MemoryRepository) GetClearingBatch(batchID string) (*models.ClearingBatch, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, batch := range r.ClearingBatches {
+		if batch.ID == batchID {
+			found := *batch
+			found.Records = slices.Clone(batch.Records)
+			return &found, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// hasJournalEntries expects the caller to hold the lock.
+func (r *MemoryRepository) hasJournalEntries(accountID string) bool {
+	for _, entry := range r.JournalEntries {
+		if entry.AccountID == accountID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Close saves the data to the file the repository was loaded from.
+func (r *MemoryRepository) Close() error {
+	if r.path == "" {
+		return nil
+	}
+
+	return r.SaveToFile(r.path)
+}
+
+func (r *MemoryRepository) SaveToFile(path string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	data := persistedData{
+		Cards:           r.Cards,
+		Accounts:        r.Accounts,
+		Transactions:    r.Transactions,
+		JournalEntries:  r.JournalEntries,
+		ClearingBatches: r.ClearingBatches,
+	}
+
+	jsonData, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, jsonData, 0644)
+}
+
+// LoadFromFile loads the data from the JSON file at path. The file is
+// remembered, so Close saves the data back to it.
+func (r *MemoryRepository) LoadFromFile(path string) error {
+	r.path = path
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // File doesn't exist yet, that's okay
+		}
+		return err
+	}
+
+	var persisted persistedData
+	if err := json.Unmarshal(data, &persisted); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Cards = persisted.Cards
+	r.Accounts = persisted.Accounts
+	r.Transactions = persisted.Transactions
+	r.JournalEntries = persisted.JournalEntries
+
+	r.ClearingBatches = persisted.ClearingBatches
+
+	if r.JournalEntries == nil {
+		r.JournalEntries = make([]*models.JournalEntry, 0)
+	}
+
+	if r.ClearingBatches == nil {
+		r.ClearingBatches = make([]*models.ClearingBatch, 0)
+	}
+
+	// accounts saved before the ledger was introduced have only the
+	// balances, so we open them in the ledger with these balances
+	for _, account := range r.Accounts {
+		if r.hasJournalEntries(account.ID) {
+			continue
+		}
+
+		opening := models.NewOpeningEntry(account.ID, account.AvailableBalance+account.HoldBalance)
+		opening.Description = "migrated balance"
+		r.JournalEntries = append(r.JournalEntries, opening)
+
+		if account.HoldBalance > 0 {
+			hold := models.NewHoldEntry(account.ID, "", account.HoldBalance)
+			hold.Description = "migrated hold"
+			r.JournalEntries = append(r.JournalEntries, hold)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+CREATE TABLE accounts (
+	id TEXT PRIMARY KEY,
+	owner_name TEXT NOT NULL,
+	currency TEXT NOT NULL
+);
+
+CREATE TABLE cards (
+	id TEXT PRIMARY KEY,
+	account_id TEXT NOT NULL REFERENCES accounts (id),
+	card_holder_name TEXT NOT NULL,
+	number TEXT NOT NULL,
+	expiration_date TEXT NOT NULL,
+	card_verification_value TEXT NOT NULL,
+	status TEXT NOT NULL,
+	spending_controls TEXT NOT NULL,
+	replaced_by_card_id TEXT NOT NULL DEFAULT '',
+	replaces_card_id TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX cards_number ON cards (number);
+
+CREATE TABLE transactions (
+	id TEXT PRIMARY KEY,
+	account_id TEXT NOT NULL REFERENCES accounts (id),
+	card_id TEXT NOT NULL REFERENCES cards (id),
+	amount INTEGER NOT NULL,
+	captured_amount INTEGER NOT NULL,
+	currency TEXT NOT NULL,
+	authorization_code TEXT NOT NULL,
+	response_code TEXT NOT NULL,
+	status TEXT NOT NULL,
+	merchant TEXT NOT NULL,
+	created_at TEXT NOT NULL,
+	decline_reason TEXT NOT NULL,
+	expiration_date_verification TEXT NOT NULL,
+	card_verification_value_verification TEXT NOT NULL,
+	stan TEXT NOT NULL,
+	transmission_date_time TEXT NOT NULL
+);
+
+CREATE INDEX transactions_account_id ON transactions (account_id);
+CREATE INDEX transactions_card_id_created_at ON transactions (card_id, created_at);
+CREATE INDEX transactions_authorization_code ON transactions (authorization_code);
+CREATE INDEX transactions_trace ON transactions (stan, transmission_date_time);
+
+CREATE TABLE journal_entries (
+	id TEXT PRIMARY KEY,
+	account_id TEXT NOT NULL REFERENCES accounts (id),
+	transaction_id TEXT NOT NULL,
+	type TEXT NOT NULL,
+	description TEXT NOT NULL,
+	created_at TEXT NOT NULL
+);
+
+CREATE INDEX journal_entries_account_id ON journal_entries (account_id);
+
+CREATE TABLE postings (
+	journal_entry_id TEXT NOT NULL REFERENCES journal_entries (id),
+	ledger_account TEXT NOT NULL,
+	amount INTEGER NOT NULL
+);
+
+CREATE INDEX postings_journal_entry_id ON postings (journal_entry_id);
+CREATE INDEX postings_ledger_account ON postings (ledger_account);
@@ -0,0 +1,8 @@
+CREATE TABLE clearing_batches (
+	id TEXT PRIMARY KEY,
+	merchant_id TEXT NOT NULL,
+	currency TEXT NOT NULL,
+	ingested_at TEXT NOT NULL,
+	totals TEXT NOT NULL,
+	records TEXT NOT NULL
+);
@@ -0,0 +1,4 @@
+ALTER TABLE transactions ADD COLUMN acquirer_id TEXT NOT NULL DEFAULT '';
+
+-- a retransmitted authorization request must not create a second transaction
+CREATE UNIQUE INDEX transactions_request ON transactions (acquirer_id, stan, transmission_date_time) WHERE stan != '';
@@ -0,0 +1,5 @@
+-- amount is what was approved, which is less than the requested amount for
+-- partial approvals
+ALTER TABLE transactions ADD COLUMN requested_amount INTEGER NOT NULL DEFAULT 0;
+
+UPDATE transactions SET requested_amount = amount;
@@ -0,0 +1,4 @@
+-- transactions the acquirer approved in stand-in and advised us of later,
+-- with the amount they overdrew the account by
+ALTER TABLE transactions ADD COLUMN stand_in BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE transactions ADD COLUMN overdraft_amount INTEGER NOT NULL DEFAULT 0;
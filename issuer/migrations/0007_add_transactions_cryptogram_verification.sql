@@ -0,0 +1,3 @@
+-- the result of the verification of the application cryptogram (ARQC) of
+-- chip transactions
+ALTER TABLE transactions ADD COLUMN cryptogram_verification TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- increased with every update of the transaction, so the updates made from a
+-- stale copy of the transaction are rejected
+ALTER TABLE transactions ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- set while the records of the batch are cleared, the batch is claimed by the
+-- ingestion in progress until then
+ALTER TABLE clearing_batches ADD COLUMN ingesting INTEGER NOT NULL DEFAULT 0;
@@ -2,12 +2,15 @@ package models
 
 import (
 	"errors"
-	"sync"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 )
 
-var ErrInsufficientFunds = errors.New("insufficient funds")
+var (
+	ErrInsufficientFunds  = errors.New("insufficient funds")
+	ErrInsufficientHold   = errors.New("insufficient hold balance")
+	ErrCaptureExceedsHold = errors.New("capture amount exceeds hold")
+)
 
 type CreateAccount struct {
 	OwnerName string `json:"owner"`
@@ -15,28 +18,14 @@ type CreateAccount struct {
 	Currency  string `json:"currency"`
 }
 
+// Account balances are derived from the account's journal entries in the
+// ledger.
 type Account struct {
 	ID               string `json:"id"`
 	OwnerName        string `json:"owner"`
 	AvailableBalance int64  `json:"balance"`
 	HoldBalance      int64  `json:"hold_balance"`
 	Currency         string `json:"currency"`
-
-	mu sync.Mutex
-}
-
-func (a *Account) Hold(amount int64) error {
-	a.mu.Lock()
-	defer a.mu.Unlock()
-
-	if a.AvailableBalance < amount {
-		return ErrInsufficientFunds
-	}
-
-	a.AvailableBalance -= amount
-	a.HoldBalance += amount
-
-	return nil
 }
 
 // Validate validates the CreateAccount struct
@@ -0,0 +1,22 @@
+package models
+
+// AdviceRequest tells the issuer about a payment the acquirer approved in
+// stand-in while the issuer was unreachable. The merchant already got the
+// approval, so the advice can't be declined for insufficient funds.
+type AdviceRequest struct {
+	Amount               int64
+	Currency             string
+	Card                 Card
+	Merchant             Merchant
+	EMVPayload           []byte
+	AcquirerID           string
+	STAN                 string
+	TransmissionDateTime string
+
+	// AuthorizationCode the acquirer approved the payment with
+	AuthorizationCode string
+}
+
+type AdviceResponse struct {
+	ResponseCode string
+}
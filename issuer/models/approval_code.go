@@ -1,10 +0,0 @@
-package models
-
-var (
-	ApprovalCodeApproved          = "00"
-	ApprovalCodeDeclined          = "05"
-	ApprovalCodeInvalidRequest    = "10"
-	ApprovalCodeInvalidCard       = "14"
-	ApprovalCodeInsufficientFunds = "51"
-	ApprovalCodeSystemError       = "99"
-)
@@ -1,14 +1,57 @@
 package models
 
 type AuthorizationRequest struct {
-	Amount     int64
-	Currency   string
-	Card       Card
-	Merchant   Merchant
-	EMVPayload []byte
+	Amount               int64
+	Currency             string
+	Card                 Card
+	Merchant             Merchant
+	EMVPayload           []byte
+	AcquirerID           string
+	STAN                 string
+	TransmissionDateTime string
+
+	// POSEntryMode is how the card data was read (field 22), e.g.
+	// POSEntryModeContactless
+	POSEntryMode string
+
+	// PartialApproval is set when the merchant accepts an approval for less
+	// than the requested amount
+	PartialApproval bool
+}
+
+// POS entry modes of the authorization requests
+const (
+	POSEntryModeManual      = "01"
+	POSEntryModeChip        = "05"
+	POSEntryModeContactless = "07"
+)
+
+// ChipRead tells whether the card data was read from the chip, with contact
+// or contactless. The chip of our cards always computes a cryptogram then.
+func (r AuthorizationRequest) ChipRead() bool {
+	return r.POSEntryMode == POSEntryModeChip || r.POSEntryMode == POSEntryModeContactless
 }
 
 type AuthorizationResponse struct {
 	AuthorizationCode string
-	ApprovalCode      string
+	ResponseCode      string
+
+	// ApprovedAmount is set for partial approvals
+	ApprovedAmount int64
+
+	// IssuerAuthenticationData is the EMV data with the ARPC (tags 91 and
+	// 8A) for chip requests with a verified cryptogram
+	IssuerAuthenticationData []byte
+}
+
+// IncrementalAuthorizationRequest asks the issuer to increase the hold of the
+// authorization identified by the acquirer ID and its STAN and transmission
+// date & time by Amount, e.g. when a hotel stay is extended. The
+// authorization keeps its authorization code.
+type IncrementalAuthorizationRequest struct {
+	AcquirerID                   string
+	OriginalSTAN                 string
+	OriginalTransmissionDateTime string
+	Amount                       int64
+	Currency                     string
 }
@@ -0,0 +1,31 @@
+package models
+
+// CaptureRequest asks the issuer to turn the hold placed by a previous
+// authorization into a posted debit. The authorization is identified by the
+// acquirer ID and its STAN and transmission date & time, and its
+// authorization code must match. Amount may be less than the authorized
+// amount (partial capture); zero means the full authorized amount.
+type CaptureRequest struct {
+	AcquirerID                   string
+	OriginalSTAN                 string
+	OriginalTransmissionDateTime string
+	AuthorizationCode            string
+	Amount                       int64
+	Currency                     string
+}
+
+type CaptureResponse struct {
+	ResponseCode string
+}
+
+// CompletionRequest asks the issuer to capture the final amount of the
+// authorization identified by the acquirer ID and its STAN and transmission
+// date & time, e.g. at hotel check-out. Like with CaptureRequest, the rest of
+// the hold is released and zero means the full authorized amount.
+type CompletionRequest struct {
+	AcquirerID                   string
+	OriginalSTAN                 string
+	OriginalTransmissionDateTime string
+	Amount                       int64
+	Currency                     string
+}
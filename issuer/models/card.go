@@ -3,17 +3,24 @@ package models
 import (
 	"regexp"
 
-	"github.com/moov-io/ftdc-from-tap-to-auth/cardpersonalizer/card"
 	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/moov-io/ftdc-from-tap-to-auth/cardpersonalizer/card"
 )
 
 type Card struct {
-	ID                    string `json:"id"`
-	AccountID             string `json:"account_id"`
-	CardHolderName        string `json:"card_holder_name"`
-	Number                string `json:"pan"`
-	ExpirationDate        string `json:"expiry"`
-	CardVerificationValue string `json:"cvv"`
+	ID                    string     `json:"id"`
+	AccountID             string     `json:"account_id"`
+	CardHolderName        string     `json:"card_holder_name"`
+	Number                string     `json:"pan"`
+	ExpirationDate        string     `json:"expiry"`
+	CardVerificationValue string     `json:"cvv"`
+	Status                CardStatus `json:"status"`
+
+	SpendingControls SpendingControls `json:"spending_controls"`
+
+	// links between the replaced card and its replacement
+	ReplacedByCardID string `json:"replaced_by_card_id,omitempty"`
+	ReplacesCardID   string `json:"replaces_card_id,omitempty"`
 }
 
 type CardRequest struct {
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidCardStatusTransition = errors.New("invalid card status transition")
+
+type CardStatus string
+
+const (
+	CardStatusInactive CardStatus = "inactive"
+	CardStatusActive   CardStatus = "active"
+	CardStatusBlocked  CardStatus = "blocked"
+	CardStatusLost     CardStatus = "lost"
+	CardStatusStolen   CardStatus = "stolen"
+	CardStatusExpired  CardStatus = "expired"
+	CardStatusReplaced CardStatus = "replaced"
+)
+
+// cardStatusTransitions lists the statuses the card can move to from each
+// status. Lost, stolen and expired cards can only be replaced, replaced cards
+// can't be changed at all.
+var cardStatusTransitions = map[CardStatus][]CardStatus{
+	CardStatusInactive: {CardStatusActive, CardStatusLost, CardStatusStolen, CardStatusReplaced},
+	CardStatusActive:   {CardStatusBlocked, CardStatusLost, CardStatusStolen, CardStatusExpired, CardStatusReplaced},
+	CardStatusBlocked:  {CardStatusActive, CardStatusLost, CardStatusStolen, CardStatusExpired, CardStatusReplaced},
+	CardStatusLost:     {CardStatusReplaced},
+	CardStatusStolen:   {CardStatusReplaced},
+	CardStatusExpired:  {CardStatusReplaced},
+}
+
+// CanTransitionTo returns true if the card in status s can move to status to.
+func (s CardStatus) CanTransitionTo(to CardStatus) bool {
+	for _, status := range cardStatusTransitions[s] {
+		if status == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TransitionTo moves the card to the given status if the transition is allowed.
+func (c *Card) TransitionTo(to CardStatus) error {
+	if !c.Status.CanTransitionTo(to) {
+		return fmt.Errorf("%w: from %s to %s", ErrInvalidCardStatusTransition, c.Status, to)
+	}
+
+	c.Status = to
+
+	return nil
+}
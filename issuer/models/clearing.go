@@ -0,0 +1,71 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/clearing"
+)
+
+var ErrClearingBatchIngested = errors.New("clearing batch already ingested")
+
+// ClearingResult tells how the capture or the refund of the clearing file
+// was matched to the transaction.
+type ClearingResult string
+
+const (
+	// ClearingResultMatched means the capture or the refund was already
+	// posted with its online message
+	ClearingResultMatched ClearingResult = "matched"
+
+	// ClearingResultPosted means the online message was missed and the
+	// capture or the refund was posted from the clearing file
+	ClearingResultPosted ClearingResult = "posted"
+
+	// ClearingResultUnmatched means the record doesn't match any transaction
+	// and nothing was posted
+	ClearingResultUnmatched ClearingResult = "unmatched"
+)
+
+type ClearingRecordResult struct {
+	clearing.Record
+
+	TransactionID string
+	Result        ClearingResult
+	Reason        string
+}
+
+// ClearingBatch is the ingested clearing file of the acquirer's settlement
+// batch with the results of its records.
+type ClearingBatch struct {
+	ID         string
+	MerchantID string
+	Currency   string
+	IngestedAt time.Time
+
+	// Ingesting is set while the records are cleared. The batch is claimed
+	// by the ingestion in progress, so the file isn't posted twice.
+	Ingesting bool
+
+	// Totals of the clearing file
+	Totals clearing.Totals
+
+	Records   []ClearingRecordResult
+	Matched   int
+	Posted    int
+	Unmatched int
+}
+
+// Add adds the result of the record to the batch.
+func (b *ClearingBatch) Add(result ClearingRecordResult) {
+	b.Records = append(b.Records, result)
+
+	switch result.Result {
+	case ClearingResultMatched:
+		b.Matched++
+	case ClearingResultPosted:
+		b.Posted++
+	case ClearingResultUnmatched:
+		b.Unmatched++
+	}
+}
@@ -0,0 +1,209 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/google/uuid"
+)
+
+var ErrUnbalancedJournalEntry = errors.New("journal entry is not balanced")
+
+// Ledger accounts of the issuer itself. Funding is where the money of the
+// account openings and adjustments comes from, settlement is where the
+// captured funds go to (and refunds come from).
+const (
+	LedgerAccountFunding    = "issuer:funding"
+	LedgerAccountSettlement = "issuer:settlement"
+)
+
+// AvailableLedgerAccount returns the ledger account with the available
+// balance of the account.
+func AvailableLedgerAccount(accountID string) string {
+	return "account:" + accountID + ":available"
+}
+
+// HoldLedgerAccount returns the ledger account with the funds held for the
+// authorized transactions of the account.
+func HoldLedgerAccount(accountID string) string {
+	return "account:" + accountID + ":hold"
+}
+
+type JournalEntryType string
+
+const (
+	JournalEntryTypeOpening    JournalEntryType = "opening"
+	JournalEntryTypeHold       JournalEntryType = "hold"
+	JournalEntryTypeCapture    JournalEntryType = "capture"
+	JournalEntryTypeRelease    JournalEntryType = "release"
+	JournalEntryTypeRefund     JournalEntryType = "refund"
+	JournalEntryTypeVoid       JournalEntryType = "void"
+	JournalEntryTypeAdjustment JournalEntryType = "adjustment"
+
+	// JournalEntryTypeStandInHold is the hold of a transaction the acquirer
+	// approved in stand-in
+	JournalEntryTypeStandInHold JournalEntryType = "stand_in_hold"
+)
+
+// JournalEntry records a single balance change of the account. The amounts
+// of its postings sum to zero, so the money only moves between the ledger
+// accounts.
+type JournalEntry struct {
+	ID            string           `json:"id"`
+	AccountID     string           `json:"account_id"`
+	TransactionID string           `json:"transaction_id,omitempty"`
+	Type          JournalEntryType `json:"type"`
+	Description   string           `json:"description,omitempty"`
+	Postings      []Posting        `json:"postings"`
+	CreatedAt     time.Time        `json:"created_at"`
+}
+
+// Posting changes the balance of the ledger account by the amount, which is
+// negative when the money leaves the ledger account.
+type Posting struct {
+	LedgerAccount string `json:"ledger_account"`
+	Amount        int64  `json:"amount"`
+}
+
+// AccountLedger is the account's journal with the balances derived from it.
+type AccountLedger struct {
+	AccountID        string          `json:"account_id"`
+	AvailableBalance int64           `json:"balance"`
+	HoldBalance      int64           `json:"hold_balance"`
+	Entries          []*JournalEntry `json:"entries"`
+}
+
+// CreateAdjustment is a manual change of the account's available balance.
+type CreateAdjustment struct {
+	Amount      int64  `json:"amount"`
+	Description string `json:"description"`
+}
+
+// Validate validates the CreateAdjustment struct
+func (c CreateAdjustment) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.Amount, validation.Required),
+		validation.Field(&c.Description, validation.Required, validation.Length(1, 255)),
+	)
+}
+
+// Validate checks that the entry has postings and that they are balanced.
+func (e *JournalEntry) Validate() error {
+	if len(e.Postings) < 2 {
+		return fmt.Errorf("%w: at least two postings are required", ErrUnbalancedJournalEntry)
+	}
+
+	var sum int64
+	for _, p := range e.Postings {
+		sum += p.Amount
+	}
+
+	if sum != 0 {
+		return fmt.Errorf("%w: postings sum to %d", ErrUnbalancedJournalEntry, sum)
+	}
+
+	return nil
+}
+
+func newJournalEntry(accountID, transactionID string, entryType JournalEntryType, postings ...Posting) *JournalEntry {
+	return &JournalEntry{
+		ID:            uuid.New().String(),
+		AccountID:     accountID,
+		TransactionID: transactionID,
+		Type:          entryType,
+		Postings:      postings,
+		CreatedAt:     time.Now(),
+	}
+}
+
+// NewOpeningEntry funds the new account with its initial balance.
+func NewOpeningEntry(accountID string, amount int64) *JournalEntry {
+	return newJournalEntry(accountID, "", JournalEntryTypeOpening,
+		Posting{LedgerAccount: LedgerAccountFunding, Amount: -amount},
+		Posting{LedgerAccount: AvailableLedgerAccount(accountID), Amount: amount},
+	)
+}
+
+// NewHoldEntry moves the authorized amount from the available balance to the
+// hold.
+func NewHoldEntry(accountID, transactionID string, amount int64) *JournalEntry {
+	return newJournalEntry(accountID, transactionID, JournalEntryTypeHold,
+		Posting{LedgerAccount: AvailableLedgerAccount(accountID), Amount: -amount},
+		Posting{LedgerAccount: HoldLedgerAccount(accountID), Amount: amount},
+	)
+}
+
+// NewStandInHoldEntry moves the amount of the transaction the acquirer
+// approved in stand-in from the available balance to the hold. Unlike
+// NewHoldEntry, it may take the available balance below zero.
+func NewStandInHoldEntry(accountID, transactionID string, amount int64) *JournalEntry {
+	return newJournalEntry(accountID, transactionID, JournalEntryTypeStandInHold,
+		Posting{LedgerAccount: AvailableLedgerAccount(accountID), Amount: -amount},
+		Posting{LedgerAccount: HoldLedgerAccount(accountID), Amount: amount},
+	)
+}
+
+// MayOverdraw returns true if the entry may take the available balance below
+// zero.
+func (e *JournalEntry) MayOverdraw() bool {
+	return e.Type == JournalEntryTypeStandInHold
+}
+
+// NewCaptureEntry takes captureAmount out of a hold of holdAmount to the
+// settlement and returns the rest of the hold to the available balance.
+func NewCaptureEntry(accountID, transactionID string, holdAmount, captureAmount int64) (*JournalEntry, error) {
+	if captureAmount > holdAmount {
+		return nil, ErrCaptureExceedsHold
+	}
+
+	postings := []Posting{
+		{LedgerAccount: HoldLedgerAccount(accountID), Amount: -holdAmount},
+		{LedgerAccount: LedgerAccountSettlement, Amount: captureAmount},
+	}
+
+	if rest := holdAmount - captureAmount; rest > 0 {
+		postings = append(postings, Posting{LedgerAccount: AvailableLedgerAccount(accountID), Amount: rest})
+	}
+
+	return newJournalEntry(accountID, transactionID, JournalEntryTypeCapture, postings...), nil
+}
+
+// NewReleaseEntry returns the held amount to the available balance.
+func NewReleaseEntry(accountID, transactionID string, amount int64) *JournalEntry {
+	return newJournalEntry(accountID, transactionID, JournalEntryTypeRelease,
+		Posting{LedgerAccount: HoldLedgerAccount(accountID), Amount: -amount},
+		Posting{LedgerAccount: AvailableLedgerAccount(accountID), Amount: amount},
+	)
+}
+
+// NewRefundEntry returns the captured amount from the settlement to the
+// available balance.
+func NewRefundEntry(accountID, transactionID string, amount int64) *JournalEntry {
+	return newJournalEntry(accountID, transactionID, JournalEntryTypeRefund,
+		Posting{LedgerAccount: LedgerAccountSettlement, Amount: -amount},
+		Posting{LedgerAccount: AvailableLedgerAccount(accountID), Amount: amount},
+	)
+}
+
+// NewVoidEntry returns the captured amount of the voided transaction from the
+// settlement to the available balance.
+func NewVoidEntry(accountID, transactionID string, amount int64) *JournalEntry {
+	return newJournalEntry(accountID, transactionID, JournalEntryTypeVoid,
+		Posting{LedgerAccount: LedgerAccountSettlement, Amount: -amount},
+		Posting{LedgerAccount: AvailableLedgerAccount(accountID), Amount: amount},
+	)
+}
+
+// NewAdjustmentEntry changes the available balance by the amount, which may
+// be negative.
+func NewAdjustmentEntry(accountID string, adjustment CreateAdjustment) *JournalEntry {
+	entry := newJournalEntry(accountID, "", JournalEntryTypeAdjustment,
+		Posting{LedgerAccount: LedgerAccountFunding, Amount: -adjustment.Amount},
+		Posting{LedgerAccount: AvailableLedgerAccount(accountID), Amount: adjustment.Amount},
+	)
+	entry.Description = adjustment.Description
+
+	return entry
+}
@@ -11,7 +11,7 @@ func GenerateCardNumber(bin string) string {
 }
 
 func completeDigits(bin string, l int) string {
-	rand.Seed(time.Now().Unix())
+	rand.Seed(time.Now().UnixNano())
 
 	randomNumberLength := l - (len(bin) + 1)
 
@@ -0,0 +1,17 @@
+package models
+
+// RefundRequest asks the issuer to return the amount of the captured
+// transaction to the account. The transaction is identified by the acquirer
+// ID and the STAN and transmission date & time of its authorization. Zero
+// amount means whatever is left of the captured amount.
+type RefundRequest struct {
+	AcquirerID                   string
+	OriginalSTAN                 string
+	OriginalTransmissionDateTime string
+	Amount                       int64
+	Currency                     string
+}
+
+type RefundResponse struct {
+	ResponseCode string
+}
@@ -0,0 +1,16 @@
+package models
+
+// ReversalRequest asks the issuer to cancel the authorization identified by
+// the acquirer ID and its STAN and transmission date & time and release its
+// hold.
+type ReversalRequest struct {
+	AcquirerID                   string
+	OriginalSTAN                 string
+	OriginalTransmissionDateTime string
+	Amount                       int64
+	Currency                     string
+}
+
+type ReversalResponse struct {
+	ResponseCode string
+}
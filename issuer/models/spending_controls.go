@@ -0,0 +1,123 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// Names of the spending control rules, stored on declined transactions.
+const (
+	SpendingRuleBlockedMCC           = "blocked_mcc"
+	SpendingRuleMaxTransactionAmount = "max_transaction_amount"
+	SpendingRuleDailyCount           = "daily_count"
+	SpendingRuleDailyAmount          = "daily_amount"
+	SpendingRuleMonthlyCount         = "monthly_count"
+	SpendingRuleMonthlyAmount        = "monthly_amount"
+)
+
+// SpendingControls are the card's rules checked during authorization. Zero
+// values mean no limit.
+type SpendingControls struct {
+	BlockedMCCs          []MCCRange    `json:"blocked_mccs,omitempty"`
+	MaxTransactionAmount int64         `json:"max_transaction_amount,omitempty"`
+	Daily                VelocityLimit `json:"daily"`
+	Monthly              VelocityLimit `json:"monthly"`
+}
+
+// MCCRange is an inclusive range of merchant category codes. For a single MCC
+// From and To are the same.
+type MCCRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// VelocityLimit limits the number and the total amount of transactions in a
+// period.
+type VelocityLimit struct {
+	MaxCount  int   `json:"max_count,omitempty"`
+	MaxAmount int64 `json:"max_amount,omitempty"`
+}
+
+// Usage is the number and the total amount of card transactions in a period.
+type Usage struct {
+	Count  int
+	Amount int64
+}
+
+var mccRegexp = regexp.MustCompile(`^[0-9]{4}$`)
+
+// Validate validates the SpendingControls struct
+func (c SpendingControls) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.BlockedMCCs),
+		validation.Field(&c.MaxTransactionAmount, validation.Min(int64(0))),
+		validation.Field(&c.Daily),
+		validation.Field(&c.Monthly),
+	)
+}
+
+// Validate validates the MCCRange struct
+func (r MCCRange) Validate() error {
+	err := validation.ValidateStruct(&r,
+		validation.Field(&r.From, validation.Required, validation.Match(mccRegexp).Error("must be 4 digits")),
+		validation.Field(&r.To, validation.Required, validation.Match(mccRegexp).Error("must be 4 digits")),
+	)
+	if err != nil {
+		return err
+	}
+
+	if r.From > r.To {
+		return errors.New("from must not be greater than to")
+	}
+
+	return nil
+}
+
+// Validate validates the VelocityLimit struct
+func (l VelocityLimit) Validate() error {
+	return validation.ValidateStruct(&l,
+		validation.Field(&l.MaxCount, validation.Min(0)),
+		validation.Field(&l.MaxAmount, validation.Min(int64(0))),
+	)
+}
+
+// Contains returns true if the MCC is within the range.
+func (r MCCRange) Contains(mcc string) bool {
+	return mcc >= r.From && mcc <= r.To
+}
+
+// Evaluate checks the transaction with the MCC and amount against the rules
+// and returns the name of the first rule that fired, or an empty string if
+// the transaction is allowed. Daily and monthly usage don't include the
+// transaction being checked.
+func (c SpendingControls) Evaluate(mcc string, amount int64, daily, monthly Usage) string {
+	for _, r := range c.BlockedMCCs {
+		if r.Contains(mcc) {
+			return SpendingRuleBlockedMCC
+		}
+	}
+
+	if c.MaxTransactionAmount > 0 && amount > c.MaxTransactionAmount {
+		return SpendingRuleMaxTransactionAmount
+	}
+
+	if c.Daily.MaxCount > 0 && daily.Count+1 > c.Daily.MaxCount {
+		return SpendingRuleDailyCount
+	}
+
+	if c.Daily.MaxAmount > 0 && daily.Amount+amount > c.Daily.MaxAmount {
+		return SpendingRuleDailyAmount
+	}
+
+	if c.Monthly.MaxCount > 0 && monthly.Count+1 > c.Monthly.MaxCount {
+		return SpendingRuleMonthlyCount
+	}
+
+	if c.Monthly.MaxAmount > 0 && monthly.Amount+amount > c.Monthly.MaxAmount {
+		return SpendingRuleMonthlyAmount
+	}
+
+	return ""
+}
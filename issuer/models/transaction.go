@@ -1,15 +1,63 @@
 package models
 
+import (
+	"errors"
+	"time"
+)
+
+// ErrDuplicateTransaction is returned when a transaction was already created
+// for the authorization request with the same acquirer ID, STAN and
+// transmission date & time.
+var ErrDuplicateTransaction = errors.New("duplicate transaction")
+
+// ErrTransactionConflict is returned when the transaction was updated since
+// it was read, e.g. by a capture and a reversal of the same authorization
+// processed at the same time.
+var ErrTransactionConflict = errors.New("transaction was updated concurrently")
+
 type Transaction struct {
 	ID                string
 	AccountID         string
 	CardID            string
 	Amount            int64
+	CapturedAmount    int64
+	RefundedAmount    int64
 	Currency          string
 	AuthorizationCode string
-	ApprovalCode      string
+	ResponseCode      string
 	Status            TransactionStatus
 	Merchant          Merchant
+	CreatedAt         time.Time
+
+	// RequestedAmount is the amount of the authorization request. Amount is
+	// what was approved, which is less for partial approvals.
+	RequestedAmount int64
+
+	// DeclineReason tells why the transaction was declined, e.g. the name
+	// of the spending control rule that fired
+	DeclineReason string
+
+	// results of the card checks, to see why the card was declined
+	ExpirationDateVerification        VerificationResult
+	CardVerificationValueVerification VerificationResult
+	CryptogramVerification            VerificationResult
+
+	// AcquirerID, STAN and TransmissionDateTime of the authorization
+	// request, used to detect retransmissions and to find the transaction
+	// for reversals, refunds and clearing
+	AcquirerID           string
+	STAN                 string
+	TransmissionDateTime string
+
+	// StandIn is set for the transactions the acquirer approved in stand-in
+	// and advised us of later. OverdraftAmount is by how much the advice
+	// overdrew the account.
+	StandIn         bool
+	OverdraftAmount int64
+
+	// Version is increased with every update, so an update of a stale copy
+	// of the transaction is rejected
+	Version int
 }
 
 type TransactionStatus string
@@ -17,4 +65,8 @@ type TransactionStatus string
 const (
 	TransactionStatusAuthorized TransactionStatus = "authorized"
 	TransactionStatusDeclined   TransactionStatus = "declined"
+	TransactionStatusCaptured   TransactionStatus = "captured"
+	TransactionStatusReleased   TransactionStatus = "released"
+	TransactionStatusReversed   TransactionStatus = "reversed"
+	TransactionStatusRefunded   TransactionStatus = "refunded"
 )
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// VerificationResult is the result of checking a card value from the
+// authorization request against the value stored for the card.
+type VerificationResult string
+
+const (
+	VerificationResultMatch      VerificationResult = "match"
+	VerificationResultMismatch   VerificationResult = "mismatch"
+	VerificationResultMissing    VerificationResult = "missing"
+	VerificationResultExpired    VerificationResult = "expired"
+	VerificationResultNotChecked VerificationResult = "not_checked"
+)
+
+// VerifyExpirationDate checks the expiration date (MMYY) from the request
+// against the card's one and whether the card is still valid at now. Cards are
+// valid through the last day of the expiration month.
+func (c *Card) VerifyExpirationDate(expirationDate string, now time.Time) VerificationResult {
+	if expirationDate == "" {
+		return VerificationResultMissing
+	}
+
+	if expirationDate != c.ExpirationDate {
+		return VerificationResultMismatch
+	}
+
+	expiresAt, err := parseExpirationDate(c.ExpirationDate)
+	if err != nil {
+		return VerificationResultMismatch
+	}
+
+	if !now.Before(expiresAt) {
+		return VerificationResultExpired
+	}
+
+	return VerificationResultMatch
+}
+
+// VerifyCardVerificationValue checks the CVV from the request against the
+// card's one.
+func (c *Card) VerifyCardVerificationValue(cvv string) VerificationResult {
+	if cvv == "" {
+		return VerificationResultMissing
+	}
+
+	if cvv != c.CardVerificationValue {
+		return VerificationResultMismatch
+	}
+
+	return VerificationResultMatch
+}
+
+// parseExpirationDate returns the moment the card expires, which is the
+// beginning of the month after the MMYY expiration date.
+func parseExpirationDate(expirationDate string) (time.Time, error) {
+	t, err := time.Parse("0106", expirationDate)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("parsing expiration date: %w", err)
+	}
+
+	return t.AddDate(0, 1, 0), nil
+}
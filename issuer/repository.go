@@ -1,166 +1,129 @@
 package issuer
 
 import (
-	"encoding/json"
 	"fmt"
-	"os"
-	"sync"
+	"time"
 
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/storage"
 	"github.com/moov-io/ftdc-from-tap-to-auth/issuer/models"
 )
 
 var ErrNotFound = fmt.Errorf("not found")
 
-type persistedData struct {
-	Cards        []*models.Card        `json:"cards"`
-	Accounts     []*models.Account     `json:"accounts"`
-	Transactions []*models.Transaction `json:"transactions"`
+// Repository stores the accounts, cards, transactions and the ledger of the
+// issuer. Every method that writes does it in a single transaction, so the
+// changes are either saved together or not at all. Returned values are
+// copies; changes to them are saved with the update methods.
+type Repository interface {
+	// CreateAccount creates the account and posts the opening entry with its
+	// initial balance.
+	CreateAccount(account *models.Account, opening *models.JournalEntry) error
+	GetAccounts() ([]models.Account, error)
+
+	// GetAccount returns the account with the balances derived from the
+	// ledger.
+	GetAccount(accountID string) (*models.Account, error)
+
+	// GetAccountLedger returns the account's journal entries and the
+	// balances derived from them.
+	GetAccountLedger(accountID string) (*models.AccountLedger, error)
+
+	// PostJournalEntry posts the balanced entry to the ledger. The entry is
+	// rejected if it would make the available balance or the hold of the
+	// account negative.
+	PostJournalEntry(entry *models.JournalEntry) error
+
+	CreateCard(card *models.Card) error
+	FindCardForAuthorization(card models.Card) (*models.Card, error)
+	GetCard(accountID, cardID string) (*models.Card, error)
+	UpdateCardStatus(accountID, cardID string, status models.CardStatus) (*models.Card, error)
+	UpdateCardSpendingControls(accountID, cardID string, controls models.SpendingControls) (*models.Card, error)
+
+	// ReplaceCard marks the card as replaced by the new card. The new card
+	// gets the spending controls of the old one and stays inactive until
+	// it's activated.
+	ReplaceCard(accountID, cardID, newCardID string) (*models.Card, error)
+
+	// CreateTransaction saves the new transaction. The transaction is
+	// rejected with models.ErrDuplicateTransaction if a transaction with the
+	// same acquirer ID, STAN and transmission date & time exists.
+	CreateTransaction(transaction *models.Transaction) error
+
+	// UpdateTransaction saves the changes of the transaction and posts the
+	// journal entries. Nothing is saved if any of the entries is rejected,
+	// or with models.ErrTransactionConflict if the transaction was updated
+	// since it was read. The version of the saved transaction is increased.
+	UpdateTransaction(transaction *models.Transaction, entries ...*models.JournalEntry) error
+	ListTransactions(accountID string) ([]*models.Transaction, error)
+
+	// CardUsage returns the number and the total amount of the card's
+	// transactions created since the given time that hold or took the
+	// funds.
+	CardUsage(cardID string, since time.Time) (models.Usage, error)
+	GetTransaction(accountID, transactionID string) (*models.Transaction, error)
+
+	// FindTransactionByTrace returns the transaction created for the
+	// authorization request of the acquirer with the given STAN and
+	// transmission date & time.
+	FindTransactionByTrace(acquirerID, stan, transmissionDateTime string) (*models.Transaction, error)
+
+	// CreateClearingBatch saves the clearing batch, before its records are
+	// cleared to claim it. The batch is rejected with
+	// models.ErrClearingBatchIngested if a batch with the same ID was
+	// already saved.
+	CreateClearingBatch(batch *models.ClearingBatch) error
+	GetClearingBatch(batchID string) (*models.ClearingBatch, error)
+
+	// UpdateClearingBatch saves the results of the records of the batch
+	// and whether it's still ingesting.
+	UpdateClearingBatch(batch *models.ClearingBatch) error
+
+	// ReclaimClearingBatch claims the batch whose ingestion didn't complete
+	// again. It returns ErrNotFound if the batch was completed or claimed
+	// again since claimedAt.
+	ReclaimClearingBatch(batch *models.ClearingBatch, claimedAt time.Time) error
+
+	// DeleteClearingBatch deletes the claim of the batch whose ingestion
+	// failed, so the file can be ingested again.
+	DeleteClearingBatch(batchID string) error
+
+	Close() error
 }
 
-type Repository struct {
-	Cards        []*models.Card
-	Accounts     []*models.Account
-	Transactions []*models.Transaction
-
-	mu sync.RWMutex
-}
-
-func NewRepository() *Repository {
-	return &Repository{
-		Cards:        make([]*models.Card, 0),
-		Accounts:     make([]*models.Account, 0),
-		Transactions: make([]*models.Transaction, 0),
-	}
-}
-
-func (r *Repository) CreateAccount(account *models.Account) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	r.Accounts = append(r.Accounts, account)
-
-	return nil
-}
-
-func (r *Repository) GetAccounts() ([]models.Account, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	accounts := make([]models.Account, 0)
-	for _, account := range r.Accounts {
-		accounts = append(accounts, models.Account{
-			ID:               account.ID,
-			OwnerName:        account.OwnerName,
-			AvailableBalance: account.AvailableBalance,
-			HoldBalance:      account.HoldBalance,
-			Currency:         account.Currency,
-		})
-	}
-	return accounts, nil
-}
-
-func (r *Repository) GetAccount(accountID string) (*models.Account, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+// default files of the memory and the sqlite backends
+const (
+	defaultDataFile     = "db/issuer_data.json"
+	defaultDatabaseFile = "db/issuer.db"
+)
 
-	for _, account := range r.Accounts {
-		if account.ID == accountID {
-			return account, nil
+// OpenRepository opens the repository with the configured backend.
+func OpenRepository(config storage.Config) (Repository, error) {
+	switch config.Backend {
+	case "", storage.BackendMemory:
+		path := config.Path
+		if path == "" {
+			path = defaultDataFile
 		}
-	}
-
-	return nil, ErrNotFound
-}
-
-func (r *Repository) CreateCard(card *models.Card) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
 
-	r.Cards = append(r.Cards, card)
-
-	return nil
-}
-
-func (r *Repository) FindCardForAuthorization(card models.Card) (*models.Card, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	for _, c := range r.Cards {
-		match := c.Number == card.Number
-
-		if match {
-			return c, nil
+		repo := NewMemoryRepository()
+		if err := repo.LoadFromFile(path); err != nil {
+			return nil, fmt.Errorf("loading repository from file: %w", err)
 		}
-	}
 
-	return nil, ErrNotFound
-}
-
-func (r *Repository) CreateTransaction(transaction *models.Transaction) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	r.Transactions = append(r.Transactions, transaction)
-
-	return nil
-}
-
-// ListTransactions returns all transactions for a given account ID.
-func (r *Repository) ListTransactions(accountID string) ([]*models.Transaction, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	transactions := make([]*models.Transaction, 0)
-
-	for _, transaction := range r.Transactions {
-		if transaction.AccountID == accountID {
-			transactions = append(transactions, transaction)
+		return repo, nil
+	case storage.BackendSQLite:
+		path := config.Path
+		if path == "" {
+			path = defaultDatabaseFile
 		}
-	}
-
-	return transactions, nil
-}
-
-const filename = "db/issuer_data.json"
 
-func (r *Repository) SaveToFile() error {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	data := persistedData{
-		Cards:        r.Cards,
-		Accounts:     r.Accounts,
-		Transactions: r.Transactions,
-	}
-
-	jsonData, err := json.MarshalIndent(data, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	return os.WriteFile(filename, jsonData, 0644)
-}
-
-func (r *Repository) LoadFromFile() error {
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil // File doesn't exist yet, that's okay
+		repo, err := NewSQLiteRepository(path)
+		if err != nil {
+			return nil, fmt.Errorf("opening sqlite repository: %w", err)
 		}
-		return err
-	}
 
-	var persisted persistedData
-	if err := json.Unmarshal(data, &persisted); err != nil {
-		return err
+		return repo, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", config.Backend)
 	}
-
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	r.Cards = persisted.Cards
-	r.Accounts = persisted.Accounts
-	r.Transactions = persisted.Transactions
-
-	return nil
 }
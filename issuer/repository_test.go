@@ -0,0 +1,84 @@
+package issuer_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/issuer"
+	"github.com/moov-io/ftdc-from-tap-to-auth/issuer/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpdateTransactionConflict(t *testing.T) {
+	for _, backend := range []string{"memory", "sqlite"} {
+		t.Run(backend, func(t *testing.T) {
+			var repo issuer.Repository = issuer.NewMemoryRepository()
+			if backend == "sqlite" {
+				sqliteRepo, err := issuer.NewSQLiteRepository(filepath.Join(t.TempDir(), "issuer.db"))
+				require.NoError(t, err)
+				t.Cleanup(func() { sqliteRepo.Close() })
+
+				repo = sqliteRepo
+			}
+
+			account := &models.Account{ID: "account-1", OwnerName: "John Doe", Currency: "USD"}
+			require.NoError(t, repo.CreateAccount(account, models.NewOpeningEntry(account.ID, 100_00)))
+
+			card := &models.Card{ID: "card-1", AccountID: account.ID, Number: "4242424242424242", Status: models.CardStatusActive}
+			require.NoError(t, repo.CreateCard(card))
+
+			transaction := &models.Transaction{
+				ID:        "transaction-1",
+				AccountID: account.ID,
+				CardID:    card.ID,
+				Amount:    30_00,
+				Currency:  "USD",
+				Status:    models.TransactionStatusAuthorized,
+				CreatedAt: time.Now(),
+				STAN:      "000001",
+			}
+			require.NoError(t, repo.CreateTransaction(transaction))
+			require.NoError(t, repo.UpdateTransaction(transaction, models.NewHoldEntry(account.ID, transaction.ID, transaction.Amount)))
+
+			// a capture and a reversal of the authorization read it at the
+			// same time
+			capture, err := repo.GetTransaction(account.ID, transaction.ID)
+			require.NoError(t, err)
+
+			reversal, err := repo.GetTransaction(account.ID, transaction.ID)
+			require.NoError(t, err)
+
+			entry, err := models.NewCaptureEntry(account.ID, capture.ID, capture.Amount, capture.Amount)
+			require.NoError(t, err)
+
+			capture.Status = models.TransactionStatusCaptured
+			capture.CapturedAmount = capture.Amount
+			require.NoError(t, repo.UpdateTransaction(capture, entry))
+
+			// the reversal read the authorized transaction, it's rejected
+			// without releasing the captured hold
+			reversal.Status = models.TransactionStatusReversed
+			err = repo.UpdateTransaction(reversal, models.NewReleaseEntry(account.ID, reversal.ID, reversal.Amount))
+			require.ErrorIs(t, err, models.ErrTransactionConflict)
+
+			found, err := repo.GetTransaction(account.ID, transaction.ID)
+			require.NoError(t, err)
+			require.Equal(t, models.TransactionStatusCaptured, found.Status)
+
+			ledger, err := repo.GetAccountLedger(account.ID)
+			require.NoError(t, err)
+			require.Len(t, ledger.Entries, 3)
+			require.Equal(t, int64(70_00), ledger.AvailableBalance)
+
+			// the capture's copy is up to date and can be updated again
+			capture.RefundedAmount = 10_00
+			require.NoError(t, repo.UpdateTransaction(capture, models.NewRefundEntry(account.ID, capture.ID, 10_00)))
+
+			// an unknown transaction is still not found
+			unknown := *found
+			unknown.ID = "transaction-2"
+			require.ErrorIs(t, repo.UpdateTransaction(&unknown), issuer.ErrNotFound)
+		})
+	}
+}
@@ -10,20 +10,64 @@ import (
 	"github.com/google/uuid"
 	cardpersonalizer "github.com/moov-io/ftdc-from-tap-to-auth/cardpersonalizer/client"
 	cpm "github.com/moov-io/ftdc-from-tap-to-auth/cardpersonalizer/models"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/responsecode"
 	"github.com/moov-io/ftdc-from-tap-to-auth/issuer/models"
 )
 
+var ErrInvalidTransactionStatus = errors.New("invalid transaction status")
+
+// cardStatusResponseCodes are the response codes for authorizations with
+// cards that are not active. Inactive and replaced cards get the generic
+// do not honor.
+var cardStatusResponseCodes = map[models.CardStatus]string{
+	models.CardStatusInactive: responsecode.DoNotHonor,
+	models.CardStatusBlocked:  responsecode.RestrictedCard,
+	models.CardStatusLost:     responsecode.LostCard,
+	models.CardStatusStolen:   responsecode.StolenCard,
+	models.CardStatusExpired:  responsecode.ExpiredCard,
+	models.CardStatusReplaced: responsecode.DoNotHonor,
+}
+
 type Service struct {
 	logger           *slog.Logger
-	repo             *Repository
+	repo             Repository
 	cardpersonalizer *cardpersonalizer.Client
+
+	// cardBIN is the leading digits of the numbers of the cards we issue
+	cardBIN string
+
+	// chipKeys verify the cryptograms of the chip cards
+	chipKeys *ChipKeys
 }
 
-func NewService(logger *slog.Logger, repo *Repository, cardpersonalizer *cardpersonalizer.Client) *Service {
+// DefaultCardBIN is the BIN of the issued cards when none is configured.
+const DefaultCardBIN = "7"
+
+// cardPANSequenceNumber is the PAN sequence number (tag 5F34) of the cards we
+// flash, the applet has it built in (javacard/src/openemv/EMVStaticData.java)
+const cardPANSequenceNumber = "01"
+
+// NewService returns the issuer service. The cards get the default BIN when
+// cardBIN is empty. Their keys are derived from the default issuer master key
+// when chipKeys is nil, with a warning, as it's a test key.
+func NewService(logger *slog.Logger, repo Repository, cardpersonalizer *cardpersonalizer.Client, cardBIN string, chipKeys *ChipKeys) *Service {
+	if cardBIN == "" {
+		cardBIN = DefaultCardBIN
+	}
+
+	if chipKeys == nil {
+		logger.Warn("no issuer master key, deriving the card keys from the default test key")
+
+		// the default key is valid
+		chipKeys, _ = NewChipKeys(DefaultIssuerMasterKey)
+	}
+
 	return &Service{
 		logger:           logger,
 		repo:             repo,
 		cardpersonalizer: cardpersonalizer,
+		cardBIN:          cardBIN,
+		chipKeys:         chipKeys,
 	}
 }
 
@@ -33,18 +77,18 @@ func (i *Service) CreateAccount(req models.CreateAccount) (*models.Account, erro
 	}
 
 	account := &models.Account{
-		ID:               uuid.New().String(),
-		OwnerName:        req.OwnerName,
-		AvailableBalance: req.Balance,
-		Currency:         req.Currency,
+		ID:        uuid.New().String(),
+		OwnerName: req.OwnerName,
+		Currency:  req.Currency,
 	}
 
-	err := i.repo.CreateAccount(account)
+	// the initial balance is funded by the opening entry of the ledger
+	err := i.repo.CreateAccount(account, models.NewOpeningEntry(account.ID, req.Balance))
 	if err != nil {
 		return nil, fmt.Errorf("creating account: %w", err)
 	}
 
-	return account, nil
+	return i.GetAccount(account.ID)
 }
 
 func (i *Service) GetAccounts() ([]models.Account, error) {
@@ -65,6 +109,33 @@ func (i *Service) GetAccount(accountID string) (*models.Account, error) {
 	return account, nil
 }
 
+// GetLedger returns the journal entries of the account with the balances
+// derived from them.
+func (i *Service) GetLedger(accountID string) (*models.AccountLedger, error) {
+	ledger, err := i.repo.GetAccountLedger(accountID)
+	if err != nil {
+		return nil, fmt.Errorf("getting ledger: %w", err)
+	}
+
+	return ledger, nil
+}
+
+// AdjustBalance posts a manual adjustment of the account's available balance.
+func (i *Service) AdjustBalance(accountID string, req models.CreateAdjustment) (*models.JournalEntry, error) {
+	if err := req.Validate(); err != nil {
+		return nil, fmt.Errorf("validating request: %w", err)
+	}
+
+	entry := models.NewAdjustmentEntry(accountID, req)
+
+	err := i.repo.PostJournalEntry(entry)
+	if err != nil {
+		return nil, fmt.Errorf("posting adjustment: %w", err)
+	}
+
+	return entry, nil
+}
+
 func (i *Service) IssueCard(accountID string, cardRequest models.CardRequest, shouldPersonalize bool) (*models.Card, error) {
 	account, err := i.repo.GetAccount(accountID)
 	if err != nil {
@@ -77,20 +148,37 @@ func (i *Service) IssueCard(accountID string, cardRequest models.CardRequest, sh
 		CardHolderName:        account.OwnerName,
 		CardVerificationValue: cardRequest.CardVerificationValue,
 		ExpirationDate:        cardRequest.ExpiryDate,
+		Status:                models.CardStatusActive,
 	}
 
 	// TODO: hardcode number so in emulator mode, we can test without cardpersonalizer
-	card.Number = models.GenerateCardNumber("7")
+	card.Number = models.GenerateCardNumber(i.cardBIN)
+
+	// cards issued without the card request still need the values we verify
+	// in authorizations
+	if card.ExpirationDate == "" {
+		card.ExpirationDate = time.Now().AddDate(3, 0, 0).Format("0106")
+	}
+
+	if card.CardVerificationValue == "" {
+		card.CardVerificationValue = generateRandomNumber(3)
+	}
 
 	if shouldPersonalize {
+		masterKey, err := i.chipKeys.CardMasterKey(card.Number, cardPANSequenceNumber)
+		if err != nil {
+			return nil, err
+		}
+
 		cr := cpm.CardRequest{
 			Name:       account.OwnerName,
 			ExpiryDate: cardRequest.ExpiryDate,
 			PAN:        card.Number,
 			PIN:        cardRequest.PIN,
+			MasterKey:  fmt.Sprintf("%X", masterKey),
 		}
 
-		_, err := i.cardpersonalizer.PersonalizeCard(cr)
+		_, err = i.cardpersonalizer.PersonalizeCard(cr)
 		if err != nil {
 			return nil, fmt.Errorf("personalizing card: %w", err)
 		}
@@ -104,6 +192,70 @@ func (i *Service) IssueCard(accountID string, cardRequest models.CardRequest, sh
 	return card, nil
 }
 
+// GetCard returns the account's card.
+func (i *Service) GetCard(accountID, cardID string) (*models.Card, error) {
+	card, err := i.repo.GetCard(accountID, cardID)
+	if err != nil {
+		return nil, fmt.Errorf("finding card: %w", err)
+	}
+
+	return card, nil
+}
+
+// UpdateCardStatus moves the card to the given status. Only transitions allowed
+// by the card state machine are accepted.
+func (i *Service) UpdateCardStatus(accountID, cardID string, status models.CardStatus) (*models.Card, error) {
+	card, err := i.repo.UpdateCardStatus(accountID, cardID, status)
+	if err != nil {
+		return nil, fmt.Errorf("updating card status: %w", err)
+	}
+
+	i.logger.Info("card status updated", slog.String("card_id", cardID), slog.String("status", string(status)))
+
+	return card, nil
+}
+
+// UpdateSpendingControls replaces the card's spending controls.
+func (i *Service) UpdateSpendingControls(accountID, cardID string, controls models.SpendingControls) (*models.Card, error) {
+	if err := controls.Validate(); err != nil {
+		return nil, fmt.Errorf("validating spending controls: %w", err)
+	}
+
+	card, err := i.repo.UpdateCardSpendingControls(accountID, cardID, controls)
+	if err != nil {
+		return nil, fmt.Errorf("updating spending controls: %w", err)
+	}
+
+	return card, nil
+}
+
+// ReplaceCard issues a new card with a new PAN for the account and marks the
+// old card as replaced by it. The new card has to be activated before use.
+func (i *Service) ReplaceCard(accountID, cardID string) (*models.Card, error) {
+	card, err := i.repo.GetCard(accountID, cardID)
+	if err != nil {
+		return nil, fmt.Errorf("finding card: %w", err)
+	}
+
+	if !card.Status.CanTransitionTo(models.CardStatusReplaced) {
+		return nil, fmt.Errorf("%w: card is %s", models.ErrInvalidCardStatusTransition, card.Status)
+	}
+
+	newCard, err := i.IssueCard(accountID, models.CardRequest{}, false)
+	if err != nil {
+		return nil, fmt.Errorf("issuing new card: %w", err)
+	}
+
+	newCard, err = i.repo.ReplaceCard(accountID, cardID, newCard.ID)
+	if err != nil {
+		return nil, fmt.Errorf("replacing card: %w", err)
+	}
+
+	i.logger.Info("card replaced", slog.String("card_id", cardID), slog.String("new_card_id", newCard.ID))
+
+	return newCard, nil
+}
+
 // ListTransactions returns a list of transactions for the given account ID.
 func (i *Service) ListTransactions(accountID string) ([]*models.Transaction, error) {
 	transactions, err := i.repo.ListTransactions(accountID)
@@ -114,9 +266,29 @@ func (i *Service) ListTransactions(accountID string) ([]*models.Transaction, err
 	return transactions, nil
 }
 
+// AuthorizeRequest authorizes the request. For chip requests with an
+// application cryptogram, the response has the issuer authentication data the
+// card checks in the second GENERATE AC.
 func (i *Service) AuthorizeRequest(req models.AuthorizationRequest) (models.AuthorizationResponse, error) {
-	// we can do whatever we want here with EMVPayload
-	// req.EMVPayload => ...
+	arqc := i.chipKeys.VerifyARQC(req.EMVPayload, req.ChipRead())
+	if arqc.Reason != "" {
+		i.logger.Warn("cryptogram not verified", slog.String("result", string(arqc.Result)), slog.String("reason", arqc.Reason))
+	}
+
+	response, err := i.authorize(req, arqc)
+	if err != nil {
+		return models.AuthorizationResponse{}, err
+	}
+
+	response.IssuerAuthenticationData, err = arqc.IssuerAuthenticationData(response.ResponseCode)
+	if err != nil {
+		return models.AuthorizationResponse{}, err
+	}
+
+	return response, nil
+}
+
+func (i *Service) authorize(req models.AuthorizationRequest, arqc ARQCVerification) (models.AuthorizationResponse, error) {
 	i.logger.Info(
 		"authorizing request",
 		slog.Int64("amount", req.Amount),
@@ -131,7 +303,7 @@ func (i *Service) AuthorizeRequest(req models.AuthorizationRequest) (models.Auth
 	if err != nil {
 		if errors.Is(err, ErrNotFound) {
 			return models.AuthorizationResponse{
-				ApprovalCode: models.ApprovalCodeInvalidCard,
+				ResponseCode: responsecode.InvalidCardNumber,
 			}, nil
 		}
 
@@ -150,33 +322,511 @@ func (i *Service) AuthorizeRequest(req models.AuthorizationRequest) (models.Auth
 		Amount:    req.Amount,
 		Currency:  req.Currency,
 		Merchant:  req.Merchant,
+		CreatedAt: time.Now(),
+
+		RequestedAmount: req.Amount,
+
+		CryptogramVerification: arqc.Result,
+
+		AcquirerID:           req.AcquirerID,
+		STAN:                 req.STAN,
+		TransmissionDateTime: req.TransmissionDateTime,
 	}
 
 	err = i.repo.CreateTransaction(transaction)
+	if errors.Is(err, models.ErrDuplicateTransaction) {
+		return i.retransmissionResponse(card, req)
+	}
+
 	if err != nil {
 		return models.AuthorizationResponse{}, fmt.Errorf("creating transaction: %w", err)
 	}
 
-	// hold the funds on the account
-	err = account.Hold(req.Amount)
+	responseCode, reason, err := i.checkAuthorization(card, req, transaction)
+	if err != nil {
+		return models.AuthorizationResponse{}, err
+	}
+
+	if responseCode != responsecode.Approved {
+		return i.decline(transaction, responseCode, reason)
+	}
+
+	transaction.ResponseCode = responsecode.Approved
+	transaction.AuthorizationCode = generateAuthorizationCode()
+	transaction.Status = models.TransactionStatusAuthorized
+
+	// approve the transaction and hold the funds on the account together
+	err = i.repo.UpdateTransaction(transaction, models.NewHoldEntry(account.ID, transaction.ID, req.Amount))
 	if err != nil {
 		// handle insufficient funds
 		if !errors.Is(err, models.ErrInsufficientFunds) {
 			return models.AuthorizationResponse{}, fmt.Errorf("holding funds: %w", err)
 		}
 
+		if req.PartialApproval {
+			return i.approvePartially(transaction)
+		}
+
+		return i.decline(transaction, responsecode.InsufficientFunds, "insufficient funds")
+	}
+
+	return models.AuthorizationResponse{
+		AuthorizationCode: transaction.AuthorizationCode,
+		ResponseCode:      transaction.ResponseCode,
+	}, nil
+}
+
+// approvePartially approves the transaction for the available balance of the
+// account, which is less than the requested amount. The transaction is
+// declined if nothing is available.
+func (i *Service) approvePartially(transaction *models.Transaction) (models.AuthorizationResponse, error) {
+	account, err := i.repo.GetAccount(transaction.AccountID)
+	if err != nil {
+		return models.AuthorizationResponse{}, fmt.Errorf("finding account: %w", err)
+	}
+
+	if account.AvailableBalance <= 0 {
+		return i.decline(transaction, responsecode.InsufficientFunds, "insufficient funds")
+	}
+
+	transaction.Amount = account.AvailableBalance
+	transaction.ResponseCode = responsecode.PartiallyApproved
+
+	err = i.repo.UpdateTransaction(transaction, models.NewHoldEntry(account.ID, transaction.ID, transaction.Amount))
+	if err != nil {
+		if !errors.Is(err, models.ErrInsufficientFunds) {
+			return models.AuthorizationResponse{}, fmt.Errorf("holding funds: %w", err)
+		}
+
+		// the balance went down since we read it
+		transaction.Amount = transaction.RequestedAmount
+
+		return i.decline(transaction, responsecode.InsufficientFunds, "insufficient funds")
+	}
+
+	return models.AuthorizationResponse{
+		AuthorizationCode: transaction.AuthorizationCode,
+		ResponseCode:      transaction.ResponseCode,
+		ApprovedAmount:    transaction.Amount,
+	}, nil
+}
+
+// retransmissionResponse answers the retransmitted authorization request with
+// the response of the original request, so no second hold is placed. The
+// request is declined as a duplicate if the original request is still being
+// processed or was for another card or amount.
+func (i *Service) retransmissionResponse(card *models.Card, req models.AuthorizationRequest) (models.AuthorizationResponse, error) {
+	original, err := i.repo.FindTransactionByTrace(req.AcquirerID, req.STAN, req.TransmissionDateTime)
+	if err != nil {
+		return models.AuthorizationResponse{}, fmt.Errorf("finding original transaction: %w", err)
+	}
+
+	i.logger.Warn("authorization request retransmitted",
+		slog.String("transaction_id", original.ID),
+		slog.String("acquirer_id", req.AcquirerID),
+		slog.String("stan", req.STAN),
+	)
+
+	if original.ResponseCode == "" || original.CardID != card.ID || original.RequestedAmount != req.Amount {
 		return models.AuthorizationResponse{
-			ApprovalCode: models.ApprovalCodeInsufficientFunds,
+			ResponseCode: responsecode.DuplicateTransmission,
 		}, nil
 	}
 
-	transaction.ApprovalCode = models.ApprovalCodeApproved
-	transaction.AuthorizationCode = generateAuthorizationCode()
-	transaction.Status = models.TransactionStatusAuthorized
+	response := models.AuthorizationResponse{
+		AuthorizationCode: original.AuthorizationCode,
+		ResponseCode:      original.ResponseCode,
+	}
+
+	if original.ResponseCode == responsecode.PartiallyApproved {
+		response.ApprovedAmount = original.Amount
+	}
+
+	return response, nil
+}
+
+// checkAuthorization checks the card status, the card details and the
+// spending controls and returns the response code with the reason of the
+// decline.
+func (i *Service) checkAuthorization(card *models.Card, req models.AuthorizationRequest, transaction *models.Transaction) (string, string, error) {
+	if responseCode, found := cardStatusResponseCodes[card.Status]; found {
+		return responseCode, fmt.Sprintf("card is %s", card.Status), nil
+	}
+
+	responseCode, reason := i.verifyCard(card, req, transaction)
+	if responseCode != responsecode.Approved {
+		// the card itself is expired, not just the date in the request
+		if transaction.ExpirationDateVerification == models.VerificationResultExpired {
+			_, err := i.repo.UpdateCardStatus(card.AccountID, card.ID, models.CardStatusExpired)
+			if err != nil {
+				i.logger.Error("failed to mark card as expired", slog.String("card_id", card.ID), slog.String("error", err.Error()))
+			}
+		}
+
+		return responseCode, reason, nil
+	}
+
+	responseCode, reason, err := i.checkSpendingControls(card, req)
+	if err != nil {
+		return "", "", fmt.Errorf("checking spending controls: %w", err)
+	}
+
+	return responseCode, reason, nil
+}
+
+// verifyCard checks the card details from the request against the card and
+// records the results on the transaction. Card-not-present requests must have
+// the expiration date and CVV, for chip requests the expiration date from the
+// chip (tag 5F24) is checked. The cryptogram of the chip request was verified
+// before, its result is on the transaction already.
+func (i *Service) verifyCard(card *models.Card, req models.AuthorizationRequest, transaction *models.Transaction) (string, string) {
+	transaction.ExpirationDateVerification = card.VerifyExpirationDate(req.Card.ExpirationDate, time.Now())
+
+	if req.EMVPayload == nil {
+		transaction.CardVerificationValueVerification = card.VerifyCardVerificationValue(req.Card.CardVerificationValue)
+	} else {
+		transaction.CardVerificationValueVerification = models.VerificationResultNotChecked
+	}
+
+	if transaction.ExpirationDateVerification != models.VerificationResultMatch {
+		return responsecode.ExpiredCard, fmt.Sprintf("expiration date %s", transaction.ExpirationDateVerification)
+	}
+
+	if transaction.CardVerificationValueVerification == models.VerificationResultMismatch ||
+		transaction.CardVerificationValueVerification == models.VerificationResultMissing {
+		return responsecode.NegativeCVVResult, fmt.Sprintf("cvv %s", transaction.CardVerificationValueVerification)
+	}
+
+	if transaction.CryptogramVerification == models.VerificationResultMismatch ||
+		transaction.CryptogramVerification == models.VerificationResultMissing {
+		return responsecode.SecurityViolation, fmt.Sprintf("cryptogram %s", transaction.CryptogramVerification)
+	}
+
+	return responsecode.Approved, ""
+}
+
+// spendingRuleResponseCodes are the response codes for declines by the
+// spending control rules
+var spendingRuleResponseCodes = map[string]string{
+	models.SpendingRuleBlockedMCC:           responsecode.NotPermittedToCardholder,
+	models.SpendingRuleMaxTransactionAmount: responsecode.ExceedsWithdrawalLimit,
+	models.SpendingRuleDailyCount:           responsecode.ExceedsWithdrawalFrequency,
+	models.SpendingRuleDailyAmount:          responsecode.ExceedsWithdrawalLimit,
+	models.SpendingRuleMonthlyCount:         responsecode.ExceedsWithdrawalFrequency,
+	models.SpendingRuleMonthlyAmount:        responsecode.ExceedsWithdrawalLimit,
+}
+
+// checkSpendingControls evaluates the card's spending controls for the
+// request. Daily and monthly periods are calendar days and months in UTC.
+func (i *Service) checkSpendingControls(card *models.Card, req models.AuthorizationRequest) (string, string, error) {
+	now := time.Now().UTC()
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	startOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	daily, err := i.repo.CardUsage(card.ID, startOfDay)
+	if err != nil {
+		return "", "", fmt.Errorf("getting daily usage: %w", err)
+	}
+
+	monthly, err := i.repo.CardUsage(card.ID, startOfMonth)
+	if err != nil {
+		return "", "", fmt.Errorf("getting monthly usage: %w", err)
+	}
+
+	rule := card.SpendingControls.Evaluate(req.Merchant.MCC, req.Amount, daily, monthly)
+	if rule == "" {
+		return responsecode.Approved, "", nil
+	}
+
+	responseCode, found := spendingRuleResponseCodes[rule]
+	if !found {
+		responseCode = responsecode.DoNotHonor
+	}
+
+	return responseCode, fmt.Sprintf("spending control %s", rule), nil
+}
+
+// decline saves the transaction as declined with the response code and the
+// reason.
+func (i *Service) decline(transaction *models.Transaction, responseCode, reason string) (models.AuthorizationResponse, error) {
+	transaction.ResponseCode = responseCode
+	transaction.AuthorizationCode = ""
+	transaction.DeclineReason = reason
+	transaction.Status = models.TransactionStatusDeclined
+
+	err := i.repo.UpdateTransaction(transaction)
+	if err != nil {
+		return models.AuthorizationResponse{}, fmt.Errorf("declining transaction: %w", err)
+	}
+
+	return models.AuthorizationResponse{
+		ResponseCode: responseCode,
+	}, nil
+}
+
+// CaptureRequest posts the authorized transaction referenced by the acquirer
+// ID and the original STAN and transmission date & time for the requested
+// amount and releases whatever is left of its hold. The authorization codes
+// are not unique, so the code only has to match the one of the transaction.
+func (i *Service) CaptureRequest(req models.CaptureRequest) (models.CaptureResponse, error) {
+	i.logger.Info(
+		"capturing request",
+		slog.Int64("amount", req.Amount),
+		slog.String("currency", req.Currency),
+		slog.String("authorization code", req.AuthorizationCode),
+		slog.String("original stan", req.OriginalSTAN),
+		slog.String("original transmission date time", req.OriginalTransmissionDateTime),
+	)
+
+	transaction, err := i.repo.FindTransactionByTrace(req.AcquirerID, req.OriginalSTAN, req.OriginalTransmissionDateTime)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return models.CaptureResponse{
+				ResponseCode: responsecode.UnableToLocateRecord,
+			}, nil
+		}
+
+		return models.CaptureResponse{}, fmt.Errorf("finding transaction: %w", err)
+	}
+
+	// only the holds of the authorization can be captured
+	if transaction.AuthorizationCode != req.AuthorizationCode || transaction.Status != models.TransactionStatusAuthorized {
+		return models.CaptureResponse{
+			ResponseCode: responsecode.UnableToLocateRecord,
+		}, nil
+	}
+
+	return i.capture(transaction, req.Amount, req.Currency)
+}
+
+// capture posts the authorized transaction for the amount and releases
+// whatever is left of its hold.
+func (i *Service) capture(transaction *models.Transaction, amount int64, currency string) (models.CaptureResponse, error) {
+	// zero amount means capture of the full authorized amount
+	if amount == 0 {
+		amount = transaction.Amount
+	}
+
+	if amount < 0 || amount > transaction.Amount {
+		return models.CaptureResponse{
+			ResponseCode: responsecode.InvalidAmount,
+		}, nil
+	}
+
+	if currency != "" && currency != transaction.Currency {
+		return models.CaptureResponse{
+			ResponseCode: responsecode.InvalidTransaction,
+		}, nil
+	}
+
+	entry, err := models.NewCaptureEntry(transaction.AccountID, transaction.ID, transaction.Amount, amount)
+	if err != nil {
+		return models.CaptureResponse{}, fmt.Errorf("creating capture entry: %w", err)
+	}
+
+	transaction.CapturedAmount = amount
+	transaction.Status = models.TransactionStatusCaptured
+
+	err = i.repo.UpdateTransaction(transaction, entry)
+	if err != nil {
+		return models.CaptureResponse{}, fmt.Errorf("capturing funds: %w", err)
+	}
+
+	return models.CaptureResponse{
+		ResponseCode: responsecode.Approved,
+	}, nil
+}
+
+// IncrementalAuthorizationRequest increases the hold of the authorization
+// referenced by the acquirer ID and the original STAN and transmission date &
+// time. The increment is held on the account of the original transaction and
+// added to its amount, no new transaction is created. The card must still be
+// active, but the spending controls were already checked for the original
+// authorization and are not checked again.
+func (i *Service) IncrementalAuthorizationRequest(req models.IncrementalAuthorizationRequest) (models.AuthorizationResponse, error) {
+	i.logger.Info(
+		"incrementing authorization",
+		slog.Int64("amount", req.Amount),
+		slog.String("original stan", req.OriginalSTAN),
+		slog.String("original transmission date time", req.OriginalTransmissionDateTime),
+	)
+
+	transaction, err := i.repo.FindTransactionByTrace(req.AcquirerID, req.OriginalSTAN, req.OriginalTransmissionDateTime)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return models.AuthorizationResponse{
+				ResponseCode: responsecode.UnableToLocateRecord,
+			}, nil
+		}
+
+		return models.AuthorizationResponse{}, fmt.Errorf("finding transaction: %w", err)
+	}
+
+	if transaction.Status != models.TransactionStatusAuthorized || req.Currency != transaction.Currency {
+		return models.AuthorizationResponse{
+			ResponseCode: responsecode.InvalidTransaction,
+		}, nil
+	}
+
+	if req.Amount <= 0 {
+		return models.AuthorizationResponse{
+			ResponseCode: responsecode.InvalidAmount,
+		}, nil
+	}
+
+	card, err := i.repo.GetCard(transaction.AccountID, transaction.CardID)
+	if err != nil {
+		return models.AuthorizationResponse{}, fmt.Errorf("finding card: %w", err)
+	}
+
+	if responseCode, found := cardStatusResponseCodes[card.Status]; found {
+		return models.AuthorizationResponse{
+			ResponseCode: responseCode,
+		}, nil
+	}
+
+	transaction.Amount += req.Amount
+
+	err = i.repo.UpdateTransaction(transaction, models.NewHoldEntry(transaction.AccountID, transaction.ID, req.Amount))
+	if err != nil {
+		if !errors.Is(err, models.ErrInsufficientFunds) {
+			return models.AuthorizationResponse{}, fmt.Errorf("holding funds: %w", err)
+		}
+
+		// the original hold stays as it was
+		return models.AuthorizationResponse{
+			ResponseCode: responsecode.InsufficientFunds,
+		}, nil
+	}
 
 	return models.AuthorizationResponse{
 		AuthorizationCode: transaction.AuthorizationCode,
-		ApprovalCode:      transaction.ApprovalCode,
+		ResponseCode:      responsecode.Approved,
+	}, nil
+}
+
+// CompletionRequest captures the final amount of the authorization referenced
+// by the acquirer ID and the original STAN and transmission date & time and
+// releases whatever is left of its hold. Completing an already completed
+// transaction for the same amount is approved, so the acquirer can safely
+// repeat the advice.
+func (i *Service) CompletionRequest(req models.CompletionRequest) (models.CaptureResponse, error) {
+	i.logger.Info(
+		"completing request",
+		slog.Int64("amount", req.Amount),
+		slog.String("original stan", req.OriginalSTAN),
+		slog.String("original transmission date time", req.OriginalTransmissionDateTime),
+	)
+
+	transaction, err := i.repo.FindTransactionByTrace(req.AcquirerID, req.OriginalSTAN, req.OriginalTransmissionDateTime)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return models.CaptureResponse{
+				ResponseCode: responsecode.UnableToLocateRecord,
+			}, nil
+		}
+
+		return models.CaptureResponse{}, fmt.Errorf("finding transaction: %w", err)
+	}
+
+	switch transaction.Status {
+	case models.TransactionStatusAuthorized:
+		return i.capture(transaction, req.Amount, req.Currency)
+	case models.TransactionStatusCaptured:
+		// zero amount is the full authorized amount
+		if req.Amount == transaction.CapturedAmount || req.Amount == 0 && transaction.CapturedAmount == transaction.Amount {
+			return models.CaptureResponse{
+				ResponseCode: responsecode.Approved,
+			}, nil
+		}
+	}
+
+	return models.CaptureResponse{
+		ResponseCode: responsecode.InvalidTransaction,
+	}, nil
+}
+
+// ReleaseTransaction releases the hold of the authorized transaction without
+// capturing it.
+func (i *Service) ReleaseTransaction(accountID, transactionID string) (*models.Transaction, error) {
+	transaction, err := i.repo.GetTransaction(accountID, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("finding transaction: %w", err)
+	}
+
+	if transaction.Status != models.TransactionStatusAuthorized {
+		return nil, fmt.Errorf("%w: transaction is %s", ErrInvalidTransactionStatus, transaction.Status)
+	}
+
+	transaction.Status = models.TransactionStatusReleased
+
+	err = i.repo.UpdateTransaction(transaction, models.NewReleaseEntry(accountID, transaction.ID, transaction.Amount))
+	if err != nil {
+		return nil, fmt.Errorf("releasing funds: %w", err)
+	}
+
+	return transaction, nil
+}
+
+// ReverseRequest cancels the authorization referenced by the acquirer ID and
+// the original STAN and transmission date & time and releases its hold. A
+// captured transaction that has not been refunded is voided and its captured
+// amount is returned to the account. Reversing an already reversed
+// transaction is approved, so the acquirer can safely repeat it.
+func (i *Service) ReverseRequest(req models.ReversalRequest) (models.ReversalResponse, error) {
+	i.logger.Info(
+		"reversing request",
+		slog.Int64("amount", req.Amount),
+		slog.String("original stan", req.OriginalSTAN),
+		slog.String("original transmission date time", req.OriginalTransmissionDateTime),
+	)
+
+	transaction, err := i.repo.FindTransactionByTrace(req.AcquirerID, req.OriginalSTAN, req.OriginalTransmissionDateTime)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return models.ReversalResponse{
+				ResponseCode: responsecode.UnableToLocateRecord,
+			}, nil
+		}
+
+		return models.ReversalResponse{}, fmt.Errorf("finding transaction: %w", err)
+	}
+
+	switch transaction.Status {
+	case models.TransactionStatusReversed:
+		return models.ReversalResponse{
+			ResponseCode: responsecode.Approved,
+		}, nil
+	case models.TransactionStatusAuthorized:
+		transaction.Status = models.TransactionStatusReversed
+
+		err = i.repo.UpdateTransaction(transaction, models.NewReleaseEntry(transaction.AccountID, transaction.ID, transaction.Amount))
+		if err != nil {
+			return models.ReversalResponse{}, fmt.Errorf("releasing funds: %w", err)
+		}
+	case models.TransactionStatusCaptured:
+		// refunded transactions can't be voided, the funds were already
+		// (partially) returned
+		if transaction.RefundedAmount > 0 {
+			return models.ReversalResponse{
+				ResponseCode: responsecode.InvalidTransaction,
+			}, nil
+		}
+
+		transaction.Status = models.TransactionStatusReversed
+
+		err = i.repo.UpdateTransaction(transaction, models.NewVoidEntry(transaction.AccountID, transaction.ID, transaction.CapturedAmount))
+		if err != nil {
+			return models.ReversalResponse{}, fmt.Errorf("voiding transaction: %w", err)
+		}
+	default:
+		return models.ReversalResponse{
+			ResponseCode: responsecode.InvalidTransaction,
+		}, nil
+	}
+
+	return models.ReversalResponse{
+		ResponseCode: responsecode.Approved,
 	}, nil
 }
 
@@ -200,3 +850,60 @@ func generateRandomNumber(length int) string {
 
 	return number
 }
+
+// RefundRequest returns the requested amount of the captured transaction
+// referenced by the acquirer ID and the original STAN and transmission date &
+// time to the account. A transaction can be refunded several times, but never
+// for more than its captured amount.
+func (i *Service) RefundRequest(req models.RefundRequest) (models.RefundResponse, error) {
+	i.logger.Info(
+		"refunding request",
+		slog.Int64("amount", req.Amount),
+		slog.String("original stan", req.OriginalSTAN),
+		slog.String("original transmission date time", req.OriginalTransmissionDateTime),
+	)
+
+	transaction, err := i.repo.FindTransactionByTrace(req.AcquirerID, req.OriginalSTAN, req.OriginalTransmissionDateTime)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return models.RefundResponse{
+				ResponseCode: responsecode.UnableToLocateRecord,
+			}, nil
+		}
+
+		return models.RefundResponse{}, fmt.Errorf("finding transaction: %w", err)
+	}
+
+	if transaction.Status != models.TransactionStatusCaptured || req.Currency != transaction.Currency {
+		return models.RefundResponse{
+			ResponseCode: responsecode.InvalidTransaction,
+		}, nil
+	}
+
+	remaining := transaction.CapturedAmount - transaction.RefundedAmount
+
+	amount := req.Amount
+	if amount == 0 {
+		amount = remaining
+	}
+
+	if amount < 0 || amount > remaining {
+		return models.RefundResponse{
+			ResponseCode: responsecode.InvalidAmount,
+		}, nil
+	}
+
+	transaction.RefundedAmount += amount
+	if transaction.RefundedAmount == transaction.CapturedAmount {
+		transaction.Status = models.TransactionStatusRefunded
+	}
+
+	err = i.repo.UpdateTransaction(transaction, models.NewRefundEntry(transaction.AccountID, transaction.ID, amount))
+	if err != nil {
+		return models.RefundResponse{}, fmt.Errorf("refunding funds: %w", err)
+	}
+
+	return models.RefundResponse{
+		ResponseCode: responsecode.Approved,
+	}, nil
+}
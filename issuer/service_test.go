@@ -0,0 +1,74 @@
+package issuer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/responsecode"
+	"github.com/moov-io/ftdc-from-tap-to-auth/issuer"
+	"github.com/moov-io/ftdc-from-tap-to-auth/issuer/models"
+	"github.com/moov-io/ftdc-from-tap-to-auth/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaptureRequest(t *testing.T) {
+	repo := issuer.NewMemoryRepository()
+	service := issuer.NewService(log.New(), repo, nil, "", nil)
+
+	// two cardholders got the same authorization code from two acquirers
+	var transactions []*models.Transaction
+	for _, acquirerID := range []string{"000001", "000002"} {
+		account, err := service.CreateAccount(models.CreateAccount{OwnerName: "John Doe", Balance: 100_00, Currency: "USD"})
+		require.NoError(t, err)
+
+		transaction := &models.Transaction{
+			ID:                   "transaction-" + acquirerID,
+			AccountID:            account.ID,
+			Amount:               30_00,
+			Currency:             "USD",
+			AuthorizationCode:    "123456",
+			Status:               models.TransactionStatusAuthorized,
+			CreatedAt:            time.Now(),
+			AcquirerID:           acquirerID,
+			STAN:                 "000001",
+			TransmissionDateTime: "2024-01-02T10:00:00Z",
+		}
+		require.NoError(t, repo.CreateTransaction(transaction))
+		require.NoError(t, repo.UpdateTransaction(transaction, models.NewHoldEntry(account.ID, transaction.ID, transaction.Amount)))
+
+		transactions = append(transactions, transaction)
+	}
+
+	capture := models.CaptureRequest{
+		AcquirerID:                   "000002",
+		OriginalSTAN:                 "000001",
+		OriginalTransmissionDateTime: "2024-01-02T10:00:00Z",
+		AuthorizationCode:            "123456",
+		Currency:                     "USD",
+	}
+
+	// the authorization code must be the one of the referenced authorization
+	wrongCode := capture
+	wrongCode.AuthorizationCode = "654321"
+	response, err := service.CaptureRequest(wrongCode)
+	require.NoError(t, err)
+	require.Equal(t, responsecode.UnableToLocateRecord, response.ResponseCode)
+
+	response, err = service.CaptureRequest(capture)
+	require.NoError(t, err)
+	require.Equal(t, responsecode.Approved, response.ResponseCode)
+
+	// only the hold of the second acquirer's authorization is captured
+	first, err := repo.GetTransaction(transactions[0].AccountID, transactions[0].ID)
+	require.NoError(t, err)
+	require.Equal(t, models.TransactionStatusAuthorized, first.Status)
+
+	second, err := repo.GetTransaction(transactions[1].AccountID, transactions[1].ID)
+	require.NoError(t, err)
+	require.Equal(t, models.TransactionStatusCaptured, second.Status)
+
+	// the captured authorization can't be captured again
+	response, err = service.CaptureRequest(capture)
+	require.NoError(t, err)
+	require.Equal(t, responsecode.UnableToLocateRecord, response.ResponseCode)
+}
@@ -0,0 +1,745 @@
+package issuer
+
+import (
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/storage"
+	"github.com/moov-io/ftdc-from-tap-to-auth/issuer/models"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// SQLiteRepository keeps the data in the embedded SQLite database.
+type SQLiteRepository struct {
+	db *sql.DB
+}
+
+var _ Repository = (*SQLiteRepository)(nil)
+
+// NewSQLiteRepository opens the database at path and migrates it to the
+// latest schema version.
+func NewSQLiteRepository(path string) (*SQLiteRepository, error) {
+	db, err := storage.OpenSQLite(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := storage.Migrate(db, migrations, "migrations"); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("migrating database: %w", err)
+	}
+
+	return &SQLiteRepository{db: db}, nil
+}
+
+func (r *SQLiteRepository) Close() error {
+	return r.db.Close()
+}
+
+func (r *SQLiteRepository) CreateAccount(account *models.Account, opening *models.JournalEntry) error {
+	return storage.WithTx(r.db, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO accounts (id, owner_name, currency) VALUES (?, ?, ?)`,
+			account.ID, account.OwnerName, account.Currency)
+		if err != nil {
+			return fmt.Errorf("inserting account: %w", err)
+		}
+
+		return postJournalEntry(tx, opening)
+	})
+}
+
+func (r *SQLiteRepository) GetAccounts() ([]models.Account, error) {
+	rows, err := r.db.Query(`SELECT id, owner_name, currency FROM accounts ORDER BY rowid`)
+	if err != nil {
+		return nil, fmt.Errorf("querying accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := make([]models.Account, 0)
+	for rows.Next() {
+		var account models.Account
+		if err := rows.Scan(&account.ID, &account.OwnerName, &account.Currency); err != nil {
+			return nil, fmt.Errorf("scanning account: %w", err)
+		}
+		accounts = append(accounts, account)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading accounts: %w", err)
+	}
+
+	for i := range accounts {
+		if err := setBalances(r.db, &accounts[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return accounts, nil
+}
+
+func (r *SQLiteRepository) GetAccount(accountID string) (*models.Account, error) {
+	return getAccount(r.db, accountID)
+}
+
+func (r *SQLiteRepository) GetAccountLedger(accountID string) (*models.AccountLedger, error) {
+	account, err := getAccount(r.db, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	ledger := &models.AccountLedger{
+		AccountID:        accountID,
+		AvailableBalance: account.AvailableBalance,
+		HoldBalance:      account.HoldBalance,
+		Entries:          make([]*models.JournalEntry, 0),
+	}
+
+	rows, err := r.db.Query(`SELECT id, account_id, transaction_id, type, description, created_at
+		FROM journal_entries WHERE account_id = ? ORDER BY rowid`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("querying journal entries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			entry     models.JournalEntry
+			createdAt string
+		)
+
+		err := rows.Scan(&entry.ID, &entry.AccountID, &entry.TransactionID, &entry.Type, &entry.Description, &createdAt)
+		if err != nil {
+			return nil, fmt.Errorf("scanning journal entry: %w", err)
+		}
+
+		if entry.CreatedAt, err = storage.ParseTime(createdAt); err != nil {
+			return nil, err
+		}
+
+		ledger.Entries = append(ledger.Entries, &entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading journal entries: %w", err)
+	}
+
+	for _, entry := range ledger.Entries {
+		if entry.Postings, err = getPostings(r.db, entry.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return ledger, nil
+}
+
+func (r *SQLiteRepository) PostJournalEntry(entry *models.JournalEntry) error {
+	return storage.WithTx(r.db, func(tx *sql.Tx) error {
+		if _, err := getAccount(tx, entry.AccountID); err != nil {
+			return err
+		}
+
+		return postJournalEntry(tx, entry)
+	})
+}
+
+func (r *SQLiteRepository) CreateCard(card *models.Card) error {
+	controls, err := json.Marshal(card.SpendingControls)
+	if err != nil {
+		return fmt.Errorf("marshaling spending controls: %w", err)
+	}
+
+	_, err = r.db.Exec(`INSERT INTO cards (id, account_id, card_holder_name, number, expiration_date,
+		card_verification_value, status, spending_controls, replaced_by_card_id, replaces_card_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		card.ID, card.AccountID, card.CardHolderName, card.Number, card.ExpirationDate,
+		card.CardVerificationValue, card.Status, string(controls), card.ReplacedByCardID, card.ReplacesCardID,
+	)
+	if err != nil {
+		return fmt.Errorf("inserting card: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) FindCardForAuthorization(card models.Card) (*models.Card, error) {
+	return scanCard(r.db.QueryRow(`SELECT `+cardColumns+` FROM cards WHERE number = ? ORDER BY rowid LIMIT 1`, card.Number))
+}
+
+func (r *SQLiteRepository) GetCard(accountID, cardID string) (*models.Card, error) {
+	return getCard(r.db, accountID, cardID)
+}
+
+func (r *SQLiteRepository) UpdateCardStatus(accountID, cardID string, status models.CardStatus) (*models.Card, error) {
+	var card *models.Card
+
+	err := storage.WithTx(r.db, func(tx *sql.Tx) error {
+		var err error
+
+		card, err = getCard(tx, accountID, cardID)
+		if err != nil {
+			return err
+		}
+
+		if err := card.TransitionTo(status); err != nil {
+			return err
+		}
+
+		return updateCard(tx, card)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return card, nil
+}
+
+func (r *SQLiteRepository) UpdateCardSpendingControls(accountID, cardID string, controls models.SpendingControls) (*models.Card, error) {
+	var card *models.Card
+
+	err := storage.WithTx(r.db, func(tx *sql.Tx) error {
+		var err error
+
+		card, err = getCard(tx, accountID, cardID)
+		if err != nil {
+			return err
+		}
+
+		card.SpendingControls = controls
+
+		return updateCard(tx, card)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return card, nil
+}
+
+func (r *SQLiteRepository) ReplaceCard(accountID, cardID, newCardID string) (*models.Card, error) {
+	var newCard *models.Card
+
+	err := storage.WithTx(r.db, func(tx *sql.Tx) error {
+		card, err := getCard(tx, accountID, cardID)
+		if err != nil {
+			return err
+		}
+
+		newCard, err = getCard(tx, accountID, newCardID)
+		if err != nil {
+			return err
+		}
+
+		if err := card.TransitionTo(models.CardStatusReplaced); err != nil {
+			return err
+		}
+
+		card.ReplacedByCardID = newCard.ID
+		newCard.ReplacesCardID = card.ID
+		newCard.Status = models.CardStatusInactive
+		newCard.SpendingControls = card.SpendingControls
+
+		if err := updateCard(tx, card); err != nil {
+			return err
+		}
+
+		return updateCard(tx, newCard)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newCard, nil
+}
+
+func (r *SQLiteRepository) CreateTransaction(transaction *models.Transaction) error {
+	merchant, err := json.Marshal(transaction.Merchant)
+	if err != nil {
+		return fmt.Errorf("marshaling merchant: %w", err)
+	}
+
+	// the unique index on the trace of the request skips the duplicates
+	result, err := r.db.Exec(`INSERT INTO transactions (id, account_id, card_id, amount, captured_amount,
+		refunded_amount, currency, authorization_code, response_code, status, merchant, created_at, decline_reason,
+		expiration_date_verification, card_verification_value_verification, acquirer_id, stan, transmission_date_time,
+		requested_amount, stand_in, overdraft_amount, cryptogram_verification)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`,
+		transaction.ID, transaction.AccountID, transaction.CardID, transaction.Amount, transaction.CapturedAmount,
+		transaction.RefundedAmount, transaction.Currency, transaction.AuthorizationCode, transaction.ResponseCode, transaction.Status,
+		string(merchant), storage.FormatTime(transaction.CreatedAt), transaction.DeclineReason,
+		transaction.ExpirationDateVerification, transaction.CardVerificationValueVerification,
+		transaction.AcquirerID, transaction.STAN, transaction.TransmissionDateTime, transaction.RequestedAmount,
+		transaction.StandIn, transaction.OverdraftAmount, transaction.CryptogramVerification,
+	)
+	if err != nil {
+		return fmt.Errorf("inserting transaction: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting affected rows: %w", err)
+	}
+
+	if n == 0 {
+		return models.ErrDuplicateTransaction
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) UpdateTransaction(transaction *models.Transaction, entries ...*models.JournalEntry) error {
+	err := storage.WithTx(r.db, func(tx *sql.Tx) error {
+		// the merchant, the amount and the trace of the request don't
+		// change after the transaction is created
+		result, err := tx.Exec(`UPDATE transactions SET amount = ?, captured_amount = ?, refunded_amount = ?,
+			authorization_code = ?, response_code = ?, status = ?, decline_reason = ?,
+			expiration_date_verification = ?, card_verification_value_verification = ?, stand_in = ?,
+			overdraft_amount = ?, cryptogram_verification = ?, version = version + 1 WHERE id = ? AND version = ?`,
+			transaction.Amount, transaction.CapturedAmount, transaction.RefundedAmount, transaction.AuthorizationCode, transaction.ResponseCode,
+			transaction.Status, transaction.DeclineReason, transaction.ExpirationDateVerification,
+			transaction.CardVerificationValueVerification, transaction.StandIn, transaction.OverdraftAmount,
+			transaction.CryptogramVerification, transaction.ID, transaction.Version,
+		)
+		if err != nil {
+			return fmt.Errorf("updating transaction: %w", err)
+		}
+
+		err = requireAffected(result)
+		if errors.Is(err, ErrNotFound) {
+			// the transaction exists, but was updated since it was read
+			var exists bool
+			if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM transactions WHERE id = ?)`, transaction.ID).Scan(&exists); err != nil {
+				return fmt.Errorf("querying transaction: %w", err)
+			}
+
+			if exists {
+				return models.ErrTransactionConflict
+			}
+		}
+
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			if err := postJournalEntry(tx, entry); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	transaction.Version++
+
+	return nil
+}
+
+func (r *SQLiteRepository) ListTransactions(accountID string) ([]*models.Transaction, error) {
+	return queryTransactions(r.db, `SELECT `+transactionColumns+` FROM transactions WHERE account_id = ? ORDER BY rowid`, accountID)
+}
+
+func (r *SQLiteRepository) CardUsage(cardID string, since time.Time) (models.Usage, error) {
+	var usage models.Usage
+
+	err := r.db.QueryRow(`SELECT COUNT(*), COALESCE(SUM(CASE status WHEN ? THEN captured_amount ELSE amount END), 0)
+		FROM transactions WHERE card_id = ? AND created_at >= ? AND status IN (?, ?)`,
+		models.TransactionStatusCaptured, cardID, storage.FormatTime(since),
+		models.TransactionStatusAuthorized, models.TransactionStatusCaptured,
+	).Scan(&usage.Count, &usage.Amount)
+	if err != nil {
+		return models.Usage{}, fmt.Errorf("querying card usage: %w", err)
+	}
+
+	return usage, nil
+}
+
+func (r *SQLiteRepository) GetTransaction(accountID, transactionID string) (*models.Transaction, error) {
+	return findTransaction(r.db, `SELECT `+transactionColumns+` FROM transactions WHERE id = ? AND account_id = ?`, transactionID, accountID)
+}
+
+func (r *SQLiteRepository) FindTransactionByTrace(acquirerID, stan, transmissionDateTime string) (*models.Transaction, error) {
+	return findTransaction(r.db, `SELECT `+transactionColumns+` FROM transactions
+		WHERE acquirer_id = ? AND stan = ? AND transmission_date_time = ? ORDER BY rowid DESC LIMIT 1`,
+		acquirerID, stan, transmissionDateTime)
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx, so the helpers below
+// can be used inside and outside of transactions.
+type querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func getAccount(q querier, accountID string) (*models.Account, error) {
+	var account models.Account
+
+	err := q.QueryRow(`SELECT id, owner_name, currency FROM accounts WHERE id = ?`, accountID).
+		Scan(&account.ID, &account.OwnerName, &account.Currency)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("querying account: %w", err)
+	}
+
+	if err := setBalances(q, &account); err != nil {
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+func setBalances(q querier, account *models.Account) error {
+	var err error
+
+	account.AvailableBalance, err = ledgerBalance(q, models.AvailableLedgerAccount(account.ID))
+	if err != nil {
+		return err
+	}
+
+	account.HoldBalance, err = ledgerBalance(q, models.HoldLedgerAccount(account.ID))
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ledgerBalance sums the postings of the ledger account.
+func ledgerBalance(q querier, ledgerAccount string) (int64, error) {
+	var balance int64
+
+	err := q.QueryRow(`SELECT COALESCE(SUM(amount), 0) FROM postings WHERE ledger_account = ?`, ledgerAccount).Scan(&balance)
+	if err != nil {
+		return 0, fmt.Errorf("querying balance of %s: %w", ledgerAccount, err)
+	}
+
+	return balance, nil
+}
+
+// postJournalEntry inserts the entry with its postings if it doesn't make the
+// available balance or the hold of the account negative. It must run in the
+// transaction that the balances are checked in.
+func postJournalEntry(tx *sql.Tx, entry *models.JournalEntry) error {
+	if err := entry.Validate(); err != nil {
+		return err
+	}
+
+	available := models.AvailableLedgerAccount(entry.AccountID)
+	hold := models.HoldLedgerAccount(entry.AccountID)
+
+	for _, p := range entry.Postings {
+		if p.Amount >= 0 || (p.LedgerAccount != available && p.LedgerAccount != hold) {
+			continue
+		}
+
+		if p.LedgerAccount == available && entry.MayOverdraw() {
+			continue
+		}
+
+		balance, err := ledgerBalance(tx, p.LedgerAccount)
+		if err != nil {
+			return err
+		}
+
+		if balance+p.Amount < 0 {
+			if p.LedgerAccount == available {
+				return models.ErrInsufficientFunds
+			}
+
+			return models.ErrInsufficientHold
+		}
+	}
+
+	_, err := tx.Exec(`INSERT INTO journal_entries (id, account_id, transaction_id, type, description, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		entry.ID, entry.AccountID, entry.TransactionID, entry.Type, entry.Description, storage.FormatTime(entry.CreatedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("inserting journal entry: %w", err)
+	}
+
+	for _, p := range entry.Postings {
+		_, err := tx.Exec(`INSERT INTO postings (journal_entry_id, ledger_account, amount) VALUES (?, ?, ?)`,
+			entry.ID, p.LedgerAccount, p.Amount)
+		if err != nil {
+			return fmt.Errorf("inserting posting: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func getPostings(q querier, entryID string) ([]models.Posting, error) {
+	rows, err := q.Query(`SELECT ledger_account, amount FROM postings WHERE journal_entry_id = ? ORDER BY rowid`, entryID)
+	if err != nil {
+		return nil, fmt.Errorf("querying postings: %w", err)
+	}
+	defer rows.Close()
+
+	var postings []models.Posting
+	for rows.Next() {
+		var p models.Posting
+		if err := rows.Scan(&p.LedgerAccount, &p.Amount); err != nil {
+			return nil, fmt.Errorf("scanning posting: %w", err)
+		}
+		postings = append(postings, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading postings: %w", err)
+	}
+
+	return postings, nil
+}
+
+const cardColumns = `id, account_id, card_holder_name, number, expiration_date, card_verification_value,
+	status, spending_controls, replaced_by_card_id, replaces_card_id`
+
+func getCard(q querier, accountID, cardID string) (*models.Card, error) {
+	return scanCard(q.QueryRow(`SELECT `+cardColumns+` FROM cards WHERE id = ? AND account_id = ?`, cardID, accountID))
+}
+
+func scanCard(row *sql.Row) (*models.Card, error) {
+	var (
+		card     models.Card
+		controls string
+	)
+
+	err := row.Scan(&card.ID, &card.AccountID, &card.CardHolderName, &card.Number, &card.ExpirationDate,
+		&card.CardVerificationValue, &card.Status, &controls, &card.ReplacedByCardID, &card.ReplacesCardID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("scanning card: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(controls), &card.SpendingControls); err != nil {
+		return nil, fmt.Errorf("unmarshaling spending controls: %w", err)
+	}
+
+	return &card, nil
+}
+
+func updateCard(tx *sql.Tx, card *models.Card) error {
+	controls, err := json.Marshal(card.SpendingControls)
+	if err != nil {
+		return fmt.Errorf("marshaling spending controls: %w", err)
+	}
+
+	_, err = tx.Exec(`UPDATE cards SET status = ?, spending_controls = ?, replaced_by_card_id = ?,
+		replaces_card_id = ? WHERE id = ?`,
+		card.Status, string(controls), card.ReplacedByCardID, card.ReplacesCardID, card.ID)
+	if err != nil {
+		return fmt.Errorf("updating card: %w", err)
+	}
+
+	return nil
+}
+
+const transactionColumns = `id, account_id, card_id, amount, captured_amount, refunded_amount, currency,
+	authorization_code, response_code, status, merchant, created_at, decline_reason, expiration_date_verification,
+	card_verification_value_verification, acquirer_id, stan, transmission_date_time, requested_amount, stand_in,
+	overdraft_amount, cryptogram_verification, version`
+
+func findTransaction(q querier, query string, args ...any) (*models.Transaction, error) {
+	transactions, err := queryTransactions(q, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(transactions) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return transactions[0], nil
+}
+
+func queryTransactions(q querier, query string, args ...any) ([]*models.Transaction, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying transactions: %w", err)
+	}
+	defer rows.Close()
+
+	transactions := make([]*models.Transaction, 0)
+	for rows.Next() {
+		var (
+			transaction models.Transaction
+			merchant    string
+			createdAt   string
+		)
+
+		err := rows.Scan(&transaction.ID, &transaction.AccountID, &transaction.CardID, &transaction.Amount,
+			&transaction.CapturedAmount, &transaction.RefundedAmount, &transaction.Currency, &transaction.AuthorizationCode,
+			&transaction.ResponseCode, &transaction.Status, &merchant, &createdAt, &transaction.DeclineReason,
+			&transaction.ExpirationDateVerification, &transaction.CardVerificationValueVerification,
+			&transaction.AcquirerID, &transaction.STAN, &transaction.TransmissionDateTime, &transaction.RequestedAmount,
+			&transaction.StandIn, &transaction.OverdraftAmount, &transaction.CryptogramVerification, &transaction.Version)
+		if err != nil {
+			return nil, fmt.Errorf("scanning transaction: %w", err)
+		}
+
+		if err := json.Unmarshal([]byte(merchant), &transaction.Merchant); err != nil {
+			return nil, fmt.Errorf("unmarshaling merchant: %w", err)
+		}
+
+		if transaction.CreatedAt, err = storage.ParseTime(createdAt); err != nil {
+			return nil, err
+		}
+
+		transactions = append(transactions, &transaction)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("reading transactions: %w", err)
+	}
+
+	return transactions, nil
+}
+
+// requireAffected returns ErrNotFound if the update didn't change any row.
+func requireAffected(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting affected rows: %w", err)
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) CreateClearingBatch(batch *models.ClearingBatch) error {
+	totals, err := json.Marshal(batch.Totals)
+	if err != nil {
+		return fmt.Errorf("marshaling totals: %w", err)
+	}
+
+	records, err := json.Marshal(batch.Records)
+	if err != nil {
+		return fmt.Errorf("marshaling records: %w", err)
+	}
+
+	result, err := r.db.Exec(`INSERT INTO clearing_batches (id, merchant_id, currency, ingested_at, totals, records, ingesting)
+		VALUES (?, ?, ?, ?, ?, ?, ?) ON CONFLICT (id) DO NOTHING`,
+		batch.ID, batch.MerchantID, batch.Currency, storage.FormatTime(batch.IngestedAt), string(totals), string(records),
+		batch.Ingesting,
+	)
+	if err != nil {
+		return fmt.Errorf("inserting clearing batch: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting affected rows: %w", err)
+	}
+
+	if n == 0 {
+		return models.ErrClearingBatchIngested
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) UpdateClearingBatch(batch *models.ClearingBatch) error {
+	records, err := json.Marshal(batch.Records)
+	if err != nil {
+		return fmt.Errorf("marshaling records: %w", err)
+	}
+
+	result, err := r.db.Exec(`UPDATE clearing_batches SET records = ?, ingesting = ? WHERE id = ?`,
+		string(records), batch.Ingesting, batch.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("updating clearing batch: %w", err)
+	}
+
+	return requireAffected(result)
+}
+
+func (r *SQLiteRepository) ReclaimClearingBatch(batch *models.ClearingBatch, claimedAt time.Time) error {
+	totals, err := json.Marshal(batch.Totals)
+	if err != nil {
+		return fmt.Errorf("marshaling totals: %w", err)
+	}
+
+	result, err := r.db.Exec(`UPDATE clearing_batches SET merchant_id = ?, currency = ?, ingested_at = ?, totals = ?
+		WHERE id = ? AND ingesting AND ingested_at = ?`,
+		batch.MerchantID, batch.Currency, storage.FormatTime(batch.IngestedAt), string(totals), batch.ID,
+		storage.FormatTime(claimedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("reclaiming clearing batch: %w", err)
+	}
+
+	return requireAffected(result)
+}
+
+func (r *SQLiteRepository) DeleteClearingBatch(batchID string) error {
+	_, err := r.db.Exec(`DELETE FROM clearing_batches WHERE id = ?`, batchID)
+	if err != nil {
+		return fmt.Errorf("deleting clearing batch: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SQLiteRepository) GetClearingBatch(batchID string) (*models.ClearingBatch, error) {
+	var (
+		batch      models.ClearingBatch
+		ingestedAt string
+		totals     string
+		records    string
+	)
+
+	err := r.db.QueryRow(`SELECT id, merchant_id, currency, ingested_at, totals, records, ingesting FROM clearing_batches WHERE id = ?`, batchID).
+		Scan(&batch.ID, &batch.MerchantID, &batch.Currency, &ingestedAt, &totals, &records, &batch.Ingesting)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("querying clearing batch: %w", err)
+	}
+
+	if batch.IngestedAt, err = storage.ParseTime(ingestedAt); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(totals), &batch.Totals); err != nil {
+		return nil, fmt.Errorf("unmarshaling totals: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(records), &batch.Records); err != nil {
+		return nil, fmt.Errorf("unmarshaling records: %w", err)
+	}
+
+	for _, result := range batch.Records {
+		switch result.Result {
+		case models.ClearingResultMatched:
+			batch.Matched++
+		case models.ClearingResultPosted:
+			batch.Posted++
+		case models.ClearingResultUnmatched:
+			batch.Unmatched++
+		}
+	}
+
+	return &batch, nil
+}
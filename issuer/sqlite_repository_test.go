@@ -0,0 +1,142 @@
+package issuer_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/issuer"
+	"github.com/moov-io/ftdc-from-tap-to-auth/issuer/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteRepository(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "issuer.db")
+
+	repo, err := issuer.NewSQLiteRepository(path)
+	require.NoError(t, err)
+
+	account := &models.Account{ID: "account-1", OwnerName: "John Doe", Currency: "USD"}
+	require.NoError(t, repo.CreateAccount(account, models.NewOpeningEntry(account.ID, 100_00)))
+
+	card := &models.Card{
+		ID:        "card-1",
+		AccountID: account.ID,
+		Number:    "4242424242424242",
+		Status:    models.CardStatusActive,
+		SpendingControls: models.SpendingControls{
+			MaxTransactionAmount: 50_00,
+		},
+	}
+	require.NoError(t, repo.CreateCard(card))
+
+	transaction := &models.Transaction{
+		ID:        "transaction-1",
+		AccountID: account.ID,
+		CardID:    card.ID,
+		Amount:    30_00,
+		Currency:  "USD",
+		Merchant:  models.Merchant{Name: "Demo Merchant", MCC: "5411"},
+		CreatedAt: time.Now(),
+		STAN:      "000001",
+	}
+	require.NoError(t, repo.CreateTransaction(transaction))
+
+	t.Run("retransmitted request is rejected as a duplicate", func(t *testing.T) {
+		duplicate := *transaction
+		duplicate.ID = "transaction-2"
+
+		err := repo.CreateTransaction(&duplicate)
+		require.ErrorIs(t, err, models.ErrDuplicateTransaction)
+
+		// the same trace of another acquirer is a new request
+		duplicate.AcquirerID = "000002"
+		require.NoError(t, repo.CreateTransaction(&duplicate))
+
+		found, err := repo.FindTransactionByTrace("000002", "000001", "")
+		require.NoError(t, err)
+		require.Equal(t, duplicate.ID, found.ID)
+	})
+
+	t.Run("transaction is authorized together with the hold", func(t *testing.T) {
+		transaction.Status = models.TransactionStatusAuthorized
+		transaction.AuthorizationCode = "123456"
+
+		err := repo.UpdateTransaction(transaction, models.NewHoldEntry(account.ID, transaction.ID, transaction.Amount))
+		require.NoError(t, err)
+
+		found, err := repo.FindTransactionByTrace("", "000001", "")
+		require.NoError(t, err)
+		require.Equal(t, transaction.ID, found.ID)
+		require.Equal(t, models.TransactionStatusAuthorized, found.Status)
+		require.Equal(t, "Demo Merchant", found.Merchant.Name)
+
+		usage, err := repo.CardUsage(card.ID, time.Now().Add(-time.Hour))
+		require.NoError(t, err)
+		require.Equal(t, models.Usage{Count: 1, Amount: 30_00}, usage)
+	})
+
+	t.Run("nothing is saved when the entry is rejected", func(t *testing.T) {
+		transaction.Status = models.TransactionStatusCaptured
+
+		// the hold has only $30
+		err := repo.UpdateTransaction(transaction, models.NewReleaseEntry(account.ID, transaction.ID, 40_00))
+		require.ErrorIs(t, err, models.ErrInsufficientHold)
+
+		found, err := repo.GetTransaction(account.ID, transaction.ID)
+		require.NoError(t, err)
+		require.Equal(t, models.TransactionStatusAuthorized, found.Status)
+
+		got, err := repo.GetAccount(account.ID)
+		require.NoError(t, err)
+		require.Equal(t, int64(70_00), got.AvailableBalance)
+		require.Equal(t, int64(30_00), got.HoldBalance)
+	})
+
+	t.Run("clearing batch is claimed before it's ingested", func(t *testing.T) {
+		claimedAt := time.Now().Add(-time.Hour)
+		batch := &models.ClearingBatch{ID: "batch-1", MerchantID: "merchant-1", Currency: "USD", IngestedAt: claimedAt, Ingesting: true}
+		require.NoError(t, repo.CreateClearingBatch(batch))
+		require.ErrorIs(t, repo.CreateClearingBatch(batch), models.ErrClearingBatchIngested)
+
+		// only one of the ingestions takes over the claim
+		batch.IngestedAt = time.Now()
+		require.NoError(t, repo.ReclaimClearingBatch(batch, claimedAt))
+		require.ErrorIs(t, repo.ReclaimClearingBatch(batch, claimedAt), issuer.ErrNotFound)
+
+		batch.Ingesting = false
+		batch.Add(models.ClearingRecordResult{TransactionID: transaction.ID, Result: models.ClearingResultMatched})
+		require.NoError(t, repo.UpdateClearingBatch(batch))
+
+		found, err := repo.GetClearingBatch(batch.ID)
+		require.NoError(t, err)
+		require.False(t, found.Ingesting)
+		require.Equal(t, 1, found.Matched)
+
+		require.NoError(t, repo.DeleteClearingBatch(batch.ID))
+		_, err = repo.GetClearingBatch(batch.ID)
+		require.ErrorIs(t, err, issuer.ErrNotFound)
+	})
+
+	t.Run("data is kept when the database is opened again", func(t *testing.T) {
+		require.NoError(t, repo.Close())
+
+		// migrations that were applied are skipped
+		repo, err = issuer.NewSQLiteRepository(path)
+		require.NoError(t, err)
+		t.Cleanup(func() { repo.Close() })
+
+		ledger, err := repo.GetAccountLedger(account.ID)
+		require.NoError(t, err)
+		require.Len(t, ledger.Entries, 2)
+		require.Equal(t, int64(70_00), ledger.AvailableBalance)
+
+		found, err := repo.FindCardForAuthorization(models.Card{Number: card.Number})
+		require.NoError(t, err)
+		require.Equal(t, int64(50_00), found.SpendingControls.MaxTransactionAmount)
+
+		transaction, err := repo.FindTransactionByTrace("", "000001", "")
+		require.NoError(t, err)
+		require.Equal(t, models.TransactionStatusAuthorized, transaction.Status)
+	})
+}
@@ -0,0 +1,174 @@
+package issuer
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/responsecode"
+	"github.com/moov-io/ftdc-from-tap-to-auth/issuer/models"
+)
+
+// AdviceRequest applies the payment the acquirer approved in stand-in while
+// we were unreachable. The merchant already has the approval, so the advice
+// is not checked against the balance or the spending controls: the amount is
+// held with the acquirer's authorization code even if it overdraws the
+// account, and the transaction records by how much. A repeated advice is
+// approved without holding the amount again.
+func (i *Service) AdviceRequest(req models.AdviceRequest) (models.AdviceResponse, error) {
+	i.logger.Info(
+		"applying stand-in advice",
+		slog.Int64("amount", req.Amount),
+		slog.String("currency", req.Currency),
+		slog.String("merchant", req.Merchant.Name),
+		slog.String("authorization code", req.AuthorizationCode),
+	)
+
+	card, err := i.repo.FindCardForAuthorization(req.Card)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return models.AdviceResponse{
+				ResponseCode: responsecode.InvalidCardNumber,
+			}, nil
+		}
+
+		return models.AdviceResponse{}, fmt.Errorf("finding card: %w", err)
+	}
+
+	transaction := &models.Transaction{
+		ID:        uuid.New().String(),
+		AccountID: card.AccountID,
+		CardID:    card.ID,
+		Amount:    req.Amount,
+		Currency:  req.Currency,
+		Merchant:  req.Merchant,
+		CreatedAt: time.Now(),
+
+		RequestedAmount: req.Amount,
+
+		AcquirerID:           req.AcquirerID,
+		STAN:                 req.STAN,
+		TransmissionDateTime: req.TransmissionDateTime,
+	}
+
+	err = i.repo.CreateTransaction(transaction)
+	if errors.Is(err, models.ErrDuplicateTransaction) {
+		original, response, err := i.adviceOfKnownRequest(card, req)
+		if original == nil || err != nil {
+			return response, err
+		}
+
+		transaction = original
+	} else if err != nil {
+		return models.AdviceResponse{}, fmt.Errorf("creating transaction: %w", err)
+	}
+
+	account, err := i.repo.GetAccount(card.AccountID)
+	if err != nil {
+		return models.AdviceResponse{}, fmt.Errorf("finding account: %w", err)
+	}
+
+	transaction.StandIn = true
+	transaction.ResponseCode = responsecode.Approved
+	transaction.AuthorizationCode = req.AuthorizationCode
+	transaction.DeclineReason = ""
+	transaction.Status = models.TransactionStatusAuthorized
+	transaction.OverdraftAmount = req.Amount - max(account.AvailableBalance, 0)
+	if transaction.OverdraftAmount < 0 {
+		transaction.OverdraftAmount = 0
+	}
+
+	err = i.repo.UpdateTransaction(transaction, models.NewStandInHoldEntry(account.ID, transaction.ID, req.Amount))
+	if err != nil {
+		return models.AdviceResponse{}, fmt.Errorf("holding funds: %w", err)
+	}
+
+	if transaction.OverdraftAmount > 0 {
+		i.logger.Warn("stand-in advice overdrew the account",
+			slog.String("account_id", account.ID),
+			slog.String("transaction_id", transaction.ID),
+			slog.Int64("overdraft_amount", transaction.OverdraftAmount),
+		)
+	}
+
+	return models.AdviceResponse{
+		ResponseCode: responsecode.Approved,
+	}, nil
+}
+
+// adviceOfKnownRequest handles the advice of a request we already have a
+// transaction for: the advice was repeated, or the authorization request
+// reached us but the acquirer didn't get the response and approved it in
+// stand-in. The original transaction is returned if the advice still has to
+// be applied to it, which is when we declined the request.
+func (i *Service) adviceOfKnownRequest(card *models.Card, req models.AdviceRequest) (*models.Transaction, models.AdviceResponse, error) {
+	original, err := i.repo.FindTransactionByTrace(req.AcquirerID, req.STAN, req.TransmissionDateTime)
+	if err != nil {
+		return nil, models.AdviceResponse{}, fmt.Errorf("finding original transaction: %w", err)
+	}
+
+	if original.CardID != card.ID || original.RequestedAmount != req.Amount {
+		return nil, models.AdviceResponse{
+			ResponseCode: responsecode.DuplicateTransmission,
+		}, nil
+	}
+
+	switch {
+	case original.StandIn:
+		return nil, models.AdviceResponse{
+			ResponseCode: responsecode.Approved,
+		}, nil
+	case original.ResponseCode == "":
+		// the request is still being processed, the acquirer sends the
+		// advice again later
+		return nil, models.AdviceResponse{
+			ResponseCode: responsecode.ReEnterTransaction,
+		}, nil
+	case original.Status == models.TransactionStatusDeclined:
+		return original, models.AdviceResponse{}, nil
+	case original.Status != models.TransactionStatusAuthorized || original.Amount != req.Amount:
+		return nil, models.AdviceResponse{
+			ResponseCode: responsecode.InvalidTransaction,
+		}, nil
+	}
+
+	// the amount is already held, the acquirer's payment just has the
+	// stand-in authorization code
+	original.StandIn = true
+	original.AuthorizationCode = req.AuthorizationCode
+
+	if err := i.repo.UpdateTransaction(original); err != nil {
+		return nil, models.AdviceResponse{}, fmt.Errorf("updating transaction: %w", err)
+	}
+
+	return nil, models.AdviceResponse{
+		ResponseCode: responsecode.Approved,
+	}, nil
+}
+
+// StandInOverdrafts returns the transactions of all accounts whose stand-in
+// advice overdrew the account.
+func (i *Service) StandInOverdrafts() ([]*models.Transaction, error) {
+	accounts, err := i.repo.GetAccounts()
+	if err != nil {
+		return nil, fmt.Errorf("getting accounts: %w", err)
+	}
+
+	overdrafts := []*models.Transaction{}
+	for _, account := range accounts {
+		transactions, err := i.repo.ListTransactions(account.ID)
+		if err != nil {
+			return nil, fmt.Errorf("listing transactions of account %s: %w", account.ID, err)
+		}
+
+		for _, transaction := range transactions {
+			if transaction.OverdraftAmount > 0 {
+				overdrafts = append(overdrafts, transaction)
+			}
+		}
+	}
+
+	return overdrafts, nil
+}
@@ -0,0 +1,103 @@
+// Package cardswitch is the card network that sits between the acquirers and
+// the issuers. The acquirers connect to the switch only, and the switch
+// forwards their requests to the issuer of the card.
+package cardswitch
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/switch/iso8583"
+)
+
+// App is the main application, it contains all the components of the switch
+// and is responsible for starting and stopping them.
+type App struct {
+	ISO8583ServerAddr string
+	logger            *slog.Logger
+	iso8583Server     *iso8583.Server
+	issuerClients     []*iso8583.IssuerClient
+	config            *Config
+}
+
+func NewApp(logger *slog.Logger, config *Config) *App {
+	logger = logger.With(slog.String("app", "switch"))
+
+	if config == nil {
+		config = DefaultConfig()
+	}
+
+	return &App{
+		logger: logger,
+		config: config,
+	}
+}
+
+func (a *App) Start() error {
+	a.logger.Info("starting app...")
+
+	if err := a.config.Validate(); err != nil {
+		return fmt.Errorf("validating config: %w", err)
+	}
+
+	var routes []*iso8583.Route
+	for _, routeConfig := range a.config.Routes {
+		logger := a.logger.With(slog.String("route", routeConfig.Name))
+
+		issuerClient, err := iso8583.NewIssuerClient(logger, routeConfig.ISO8583Addr, a.config.InstitutionID, a.config.ResponseTimeout)
+		if err != nil {
+			return fmt.Errorf("creating issuer client of route %s: %w", routeConfig.Name, err)
+		}
+
+		if a.config.ReconnectInterval > 0 {
+			issuerClient.ReconnectInterval = a.config.ReconnectInterval
+		}
+
+		a.issuerClients = append(a.issuerClients, issuerClient)
+		routes = append(routes, &iso8583.Route{
+			Name:      routeConfig.Name,
+			BINRanges: routeConfig.BINRanges,
+			Issuer:    issuerClient,
+		})
+	}
+
+	// an issuer we can't connect to is down, its cards are declined with
+	// 91 while we keep connecting to it in the background
+	for i, issuerClient := range a.issuerClients {
+		if err := issuerClient.Connect(); err != nil {
+			a.logger.Warn("issuer is unreachable", slog.String("route", routes[i].Name), "err", err)
+
+			issuerClient.Reconnect()
+		}
+	}
+
+	router := iso8583.NewRouter(routes...)
+	if a.config.AuthorizationTTL > 0 {
+		router.AuthorizationTTL = a.config.AuthorizationTTL
+	}
+
+	a.iso8583Server = iso8583.NewServer(a.logger, a.config.ISO8583Addr, router)
+	if err := a.iso8583Server.Start(); err != nil {
+		return fmt.Errorf("starting iso8583 server: %w", err)
+	}
+
+	a.ISO8583ServerAddr = a.iso8583Server.Addr
+
+	return nil
+}
+
+func (a *App) Shutdown() {
+	a.logger.Info("shutting down app...")
+
+	// stop accepting the requests of the acquirers before we sign off from
+	// the issuers
+	if a.iso8583Server != nil {
+		a.iso8583Server.Close()
+	}
+
+	for _, issuerClient := range a.issuerClients {
+		issuerClient.Close()
+	}
+
+	a.logger.Info("app stopped")
+}
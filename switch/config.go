@@ -0,0 +1,83 @@
+package cardswitch
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/bin"
+	"github.com/moov-io/ftdc-from-tap-to-auth/switch/iso8583"
+)
+
+type Config struct {
+	// ISO8583Addr is the address the acquirers connect to
+	ISO8583Addr string `yaml:"iso8583_addr"`
+
+	// InstitutionID is set as the forwarding institution (field 33) of the
+	// requests forwarded to the issuers
+	InstitutionID string `yaml:"institution_id"`
+
+	// ResponseTimeout is the time we wait for the issuer's response before
+	// we respond with 91 ourselves. It must be shorter than the time the
+	// acquirers wait for our response.
+	ResponseTimeout time.Duration `yaml:"response_timeout"`
+
+	// ReconnectInterval is the time between the attempts to connect to an
+	// issuer again after the connection was lost
+	ReconnectInterval time.Duration `yaml:"reconnect_interval"`
+
+	// AuthorizationTTL is how long we remember the issuer of an
+	// authorization to route the messages that follow it
+	AuthorizationTTL time.Duration `yaml:"authorization_ttl"`
+
+	// Routes are the issuers the requests are forwarded to by the BIN of the
+	// card
+	Routes []RouteConfig `yaml:"routes"`
+}
+
+// RouteConfig is an issuer and the BIN ranges of its cards. A route without
+// BIN ranges gets the cards no other route serves.
+type RouteConfig struct {
+	Name        string      `yaml:"name"`
+	ISO8583Addr string      `yaml:"iso8583_addr"`
+	BINRanges   []bin.Range `yaml:"bin_ranges"`
+}
+
+// Validate checks that the routes are complete and their names are unique.
+func (c *Config) Validate() error {
+	if len(c.Routes) == 0 {
+		return fmt.Errorf("no routes configured")
+	}
+
+	names := make(map[string]bool)
+	for _, route := range c.Routes {
+		if route.Name == "" || route.ISO8583Addr == "" {
+			return fmt.Errorf("route %q: name and iso8583 address are required", route.Name)
+		}
+
+		if names[route.Name] {
+			return fmt.Errorf("route %q is configured twice", route.Name)
+		}
+		names[route.Name] = true
+
+		for _, binRange := range route.BINRanges {
+			if err := binRange.Validate(); err != nil {
+				return fmt.Errorf("route %q: %w", route.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		ISO8583Addr:       "127.0.0.1:8590",
+		InstitutionID:     "000100",
+		ResponseTimeout:   iso8583.DefaultResponseTimeout,
+		ReconnectInterval: iso8583.DefaultReconnectInterval,
+		AuthorizationTTL:  iso8583.DefaultAuthorizationTTL,
+		Routes: []RouteConfig{
+			{Name: "moov", ISO8583Addr: "127.0.0.1:8583"},
+		},
+	}
+}
@@ -0,0 +1,492 @@
+package iso8583
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/responsecode"
+	"github.com/moov-io/iso8583"
+	iso8583Connection "github.com/moov-io/iso8583-connection"
+)
+
+var (
+	// ErrNoResponse is returned when the issuer didn't respond to the request
+	// in time. The request may still have been processed by the issuer.
+	ErrNoResponse = errors.New("no response from issuer")
+
+	// ErrIssuerUnavailable is returned when the request can't be sent
+	// because we are not connected to the issuer.
+	ErrIssuerUnavailable = errors.New("issuer unavailable")
+
+	// ErrSTANInFlight is returned when a request of another acquirer with
+	// the same STAN is still waiting for the issuer's response after the
+	// response timeout. The responses are matched to the requests by STAN,
+	// so the request can't be sent until then.
+	ErrSTANInFlight = errors.New("request with the same stan is in flight")
+
+	// ErrDuplicateInFlight is returned when the acquirer retransmits the
+	// request that is waiting for the issuer's response.
+	ErrDuplicateInFlight = errors.New("request is in flight")
+)
+
+const (
+	// DefaultResponseTimeout is shorter than the time the acquirer waits for
+	// the response, so the acquirer gets our response when the issuer
+	// doesn't respond.
+	DefaultResponseTimeout = 4 * time.Second
+
+	// DefaultReconnectInterval is the time between the attempts to connect
+	// again after the connection to the issuer was lost.
+	DefaultReconnectInterval = 5 * time.Second
+)
+
+// inFlightRequest is a request sent to the issuer that waits for its
+// response.
+type inFlightRequest struct {
+	MTI    string
+	SentAt time.Time
+}
+
+// IssuerClient is the connection of the switch to an issuer. It signs on,
+// keeps the connection alive with echo tests and connects again when the
+// connection is lost. The requests forwarded to the issuer get our
+// institution ID as the forwarding institution (field 33).
+type IssuerClient struct {
+	logger          *slog.Logger
+	addr            string
+	institutionID   string
+	responseTimeout time.Duration
+	stanGenerator   *stanGenerator
+
+	// ReconnectInterval is the time between the attempts to connect again.
+	// It must be set before connecting.
+	ReconnectInterval time.Duration
+
+	// mu guards the connection, which is replaced when we reconnect
+	mu                sync.RWMutex
+	iso8583Connection *iso8583Connection.Connection
+	connected         bool
+	reconnecting      bool
+	closed            bool
+	stop              chan struct{}
+
+	// inFlight keeps the requests waiting for the issuer's response by their
+	// acquirer ID, STAN and transmission date & time. The issuer's responses
+	// are matched to the requests by STAN alone, so stans has the STANs in
+	// flight with the channel closed when the response is received.
+	inFlightMu sync.Mutex
+	inFlight   map[string]inFlightRequest
+	stans      map[string]chan struct{}
+}
+
+func NewIssuerClient(logger *slog.Logger, addr, institutionID string, responseTimeout time.Duration) (*IssuerClient, error) {
+	logger = logger.With(slog.String("type", "iso8583-issuer-client"), slog.String("addr", addr))
+
+	if responseTimeout == 0 {
+		responseTimeout = DefaultResponseTimeout
+	}
+
+	c := &IssuerClient{
+		logger:            logger,
+		addr:              addr,
+		institutionID:     institutionID,
+		responseTimeout:   responseTimeout,
+		stanGenerator:     &stanGenerator{},
+		ReconnectInterval: DefaultReconnectInterval,
+		stop:              make(chan struct{}),
+		inFlight:          make(map[string]inFlightRequest),
+		stans:             make(map[string]chan struct{}),
+	}
+
+	conn, err := c.newConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	c.iso8583Connection = conn
+
+	return c, nil
+}
+
+func (c *IssuerClient) newConnection() (*iso8583Connection.Connection, error) {
+	conn, err := iso8583Connection.New(
+		c.addr,
+		spec,
+		readMessageLength,
+		writeMessageLength,
+		iso8583Connection.SendTimeout(c.responseTimeout),
+
+		// the issuer accepts financial messages only after we sign on
+		iso8583Connection.OnConnect(c.signOn),
+		iso8583Connection.OnClose(c.signOff),
+
+		// send echo test when nothing was sent for a while
+		iso8583Connection.IdleTime(30*time.Second),
+		iso8583Connection.PingHandler(c.echo),
+
+		iso8583Connection.ConnectionClosedHandler(c.connectionClosed),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("creating iso8583 connection: %w", err)
+	}
+
+	return conn, nil
+}
+
+func (c *IssuerClient) Connect() error {
+	c.logger.Info("connecting to issuer...")
+
+	c.mu.RLock()
+	conn := c.iso8583Connection
+	c.mu.RUnlock()
+
+	if err := conn.Connect(); err != nil {
+		return fmt.Errorf("connecting to issuer: %w", err)
+	}
+
+	c.mu.Lock()
+	c.connected = conn == c.iso8583Connection
+	c.mu.Unlock()
+
+	c.logger.Info("connected to issuer")
+	return nil
+}
+
+// Connected returns true while we are connected to the issuer.
+func (c *IssuerClient) Connected() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.connected
+}
+
+// Reconnect keeps connecting to the issuer in the background every
+// ReconnectInterval until it succeeds or the client is closed. Requests
+// forwarded in the meantime fail with ErrIssuerUnavailable.
+func (c *IssuerClient) Reconnect() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.reconnecting || c.closed {
+		return
+	}
+
+	c.connected = false
+	c.reconnecting = true
+
+	go c.reconnectLoop()
+}
+
+func (c *IssuerClient) reconnectLoop() {
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-time.After(c.ReconnectInterval):
+		}
+
+		conn, err := c.newConnection()
+		if err != nil {
+			c.logger.Error("failed to create connection", "err", err)
+			continue
+		}
+
+		if err := conn.Connect(); err != nil {
+			c.logger.Warn("failed to reconnect to issuer", "err", err)
+			continue
+		}
+
+		c.mu.Lock()
+		if c.closed {
+			c.mu.Unlock()
+			conn.Close()
+			return
+		}
+
+		c.iso8583Connection = conn
+		c.connected = true
+		c.reconnecting = false
+		c.mu.Unlock()
+
+		c.logger.Info("reconnected to issuer")
+
+		return
+	}
+}
+
+// connectionClosed starts reconnecting when the current connection is lost.
+// Connections we closed ourselves are ignored.
+func (c *IssuerClient) connectionClosed(conn *iso8583Connection.Connection) {
+	c.mu.RLock()
+	lost := conn == c.iso8583Connection && c.connected && !c.closed
+	c.mu.RUnlock()
+
+	if !lost {
+		return
+	}
+
+	c.logger.Warn("connection to issuer lost")
+
+	c.Reconnect()
+}
+
+// Close signs off and closes the connection to the issuer.
+func (c *IssuerClient) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+
+	c.closed = true
+	close(c.stop)
+	conn, connected := c.iso8583Connection, c.connected
+	c.mu.Unlock()
+
+	if !connected {
+		return nil
+	}
+
+	if err := conn.Close(); err != nil {
+		return fmt.Errorf("closing connection: %w", err)
+	}
+
+	return nil
+}
+
+// Forward sends the acquirer's request to the issuer with our institution ID
+// as the forwarding institution and returns the issuer's response. The
+// request keeps its STAN, so the issuer tells the requests of the acquirers
+// apart by the acquirer ID, the STAN and the transmission date & time as if
+// they were sent directly. The issuer's response is matched to the request by
+// STAN, so while the request of another acquirer with the same STAN waits for
+// the response, the request waits for it up to the response timeout.
+func (c *IssuerClient) Forward(message *iso8583.Message) (*iso8583.Message, error) {
+	if err := message.Field(33, c.institutionID); err != nil {
+		return nil, fmt.Errorf("setting forwarding institution: %w", err)
+	}
+
+	c.mu.RLock()
+	conn, connected := c.iso8583Connection, c.connected
+	c.mu.RUnlock()
+
+	if !connected {
+		return nil, fmt.Errorf("forwarding ISO 8583 message to issuer: %w", ErrIssuerUnavailable)
+	}
+
+	return c.send(conn, message, c.responseTimeout)
+}
+
+// Reverse sends the reversal of the authorization the issuer didn't respond
+// to in time.
+func (c *IssuerClient) Reverse(acquirerID, stan, transmissionDateTime string, amount int64, currency string) error {
+	c.mu.RLock()
+	conn, connected := c.iso8583Connection, c.connected
+	c.mu.RUnlock()
+
+	if !connected {
+		return fmt.Errorf("reversing authorization: %w", ErrIssuerUnavailable)
+	}
+
+	response, err := c.sendOwn(conn, func(reversalSTAN string) any {
+		return &ReversalRequest{
+			MTI:                     "0400",
+			Amount:                  amount,
+			TransmissionDateTime:    time.Now().UTC().Format(time.RFC3339),
+			Currency:                currency,
+			STAN:                    reversalSTAN,
+			AcquirerID:              acquirerID,
+			ForwardingInstitutionID: c.institutionID,
+			OriginalDataElements: &OriginalDataElements{
+				MTI:                  "0100",
+				STAN:                 stan,
+				TransmissionDateTime: transmissionDateTime,
+			},
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("reversing authorization: %w", err)
+	}
+
+	if info := responsecode.GetInfo(response.ResponseCode); !info.IsApproved() {
+		return fmt.Errorf("reversal declined with response code %s (%s)", info.Code, info.Description)
+	}
+
+	return nil
+}
+
+// send sends the message over the connection and waits for the response.
+// While it waits, the message is kept in the in-flight table, so no other
+// request with the same STAN is sent before the response is received. Such a
+// request waits up to wait for it.
+func (c *IssuerClient) send(conn *iso8583Connection.Connection, message *iso8583.Message, wait time.Duration) (*iso8583.Message, error) {
+	request := &routingData{}
+	if err := message.Unmarshal(request); err != nil {
+		return nil, fmt.Errorf("unmarshaling message: %w", err)
+	}
+
+	if err := c.reserve(request, wait); err != nil {
+		return nil, err
+	}
+	defer c.release(request)
+
+	// the connection may be lost before we notice it, then the request
+	// can't be written to it
+	var netErr *net.OpError
+
+	response, err := conn.Send(message)
+	switch {
+	case errors.Is(err, iso8583Connection.ErrSendTimeout):
+		return nil, fmt.Errorf("sending ISO 8583 message to issuer: %w: %w", ErrNoResponse, err)
+	case errors.Is(err, iso8583Connection.ErrConnectionClosed), errors.As(err, &netErr):
+		return nil, fmt.Errorf("sending ISO 8583 message to issuer: %w: %w", ErrIssuerUnavailable, err)
+	case err != nil:
+		return nil, fmt.Errorf("sending ISO 8583 message to issuer: %w", err)
+	}
+
+	return response, nil
+}
+
+// sendOwn sends the request the switch makes itself, e.g. a sign-on. Our
+// STANs may be in flight for the acquirers' requests, so we take the next one
+// then instead of waiting.
+func (c *IssuerClient) sendOwn(conn *iso8583Connection.Connection, request func(stan string) any) (*responseData, error) {
+	const attempts = 3
+
+	for i := 0; ; i++ {
+		message := iso8583.NewMessage(spec)
+		if err := message.Marshal(request(c.stanGenerator.Next())); err != nil {
+			return nil, fmt.Errorf("marshaling request data: %w", err)
+		}
+
+		responseMessage, err := c.send(conn, message, 0)
+		if errors.Is(err, ErrSTANInFlight) && i < attempts {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		response := &responseData{}
+		if err := responseMessage.Unmarshal(response); err != nil {
+			return nil, fmt.Errorf("unmarshaling response data: %w", err)
+		}
+
+		return response, nil
+	}
+}
+
+// reserve adds the request to the in-flight table. The retransmission of a
+// request in flight is rejected, a request of another acquirer with the
+// same STAN waits up to wait for the response of the one in flight.
+func (c *IssuerClient) reserve(request *routingData, wait time.Duration) error {
+	key := authorizationKey(request.AcquirerID, request.STAN, request.TransmissionDateTime)
+	timeout := time.After(wait)
+
+	for {
+		c.inFlightMu.Lock()
+
+		if inFlight, found := c.inFlight[key]; found && inFlight.MTI == request.MTI {
+			c.inFlightMu.Unlock()
+
+			return fmt.Errorf("%w: stan %s sent at %s", ErrDuplicateInFlight, request.STAN, inFlight.SentAt.Format(time.RFC3339))
+		}
+
+		released, found := c.stans[request.STAN]
+		if !found {
+			c.inFlight[key] = inFlightRequest{MTI: request.MTI, SentAt: time.Now()}
+			c.stans[request.STAN] = make(chan struct{})
+			c.inFlightMu.Unlock()
+
+			return nil
+		}
+
+		c.inFlightMu.Unlock()
+
+		select {
+		case <-released:
+		case <-timeout:
+			return fmt.Errorf("%w: stan %s", ErrSTANInFlight, request.STAN)
+		}
+	}
+}
+
+func (c *IssuerClient) release(request *routingData) {
+	c.inFlightMu.Lock()
+	defer c.inFlightMu.Unlock()
+
+	delete(c.inFlight, authorizationKey(request.AcquirerID, request.STAN, request.TransmissionDateTime))
+
+	close(c.stans[request.STAN])
+	delete(c.stans, request.STAN)
+}
+
+func (c *IssuerClient) signOn(conn *iso8583Connection.Connection) error {
+	if err := c.sendNetworkManagement(conn, NetworkCodeSignOn); err != nil {
+		return fmt.Errorf("signing on: %w", err)
+	}
+
+	c.logger.Info("signed on to issuer")
+
+	return nil
+}
+
+func (c *IssuerClient) signOff(conn *iso8583Connection.Connection) error {
+	if err := c.sendNetworkManagement(conn, NetworkCodeSignOff); err != nil {
+		return fmt.Errorf("signing off: %w", err)
+	}
+
+	c.logger.Info("signed off from issuer")
+
+	return nil
+}
+
+func (c *IssuerClient) echo(conn *iso8583Connection.Connection) {
+	if err := c.sendNetworkManagement(conn, NetworkCodeEchoTest); err != nil {
+		c.logger.Error("echo test failed", "err", err)
+	}
+}
+
+// sendNetworkManagement sends 0800 with the given network management code and
+// returns an error if the issuer didn't approve it.
+func (c *IssuerClient) sendNetworkManagement(conn *iso8583Connection.Connection, code string) error {
+	response, err := c.sendOwn(conn, func(stan string) any {
+		return &NetworkManagementRequest{
+			MTI:                  "0800",
+			TransmissionDateTime: time.Now().UTC().Format(time.RFC3339),
+			STAN:                 stan,
+			Code:                 code,
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if info := responsecode.GetInfo(response.ResponseCode); !info.IsApproved() {
+		return fmt.Errorf("network management code %s declined with response code %s (%s)", code, info.Code, info.Description)
+	}
+
+	return nil
+}
+
+// stanGenerator numbers the requests the switch makes itself. They are not
+// kept anywhere, so the numbering starts over when the switch is restarted.
+type stanGenerator struct {
+	mu  sync.Mutex
+	num int
+}
+
+// Next returns the next STAN. STANs wrap around after 999999.
+func (g *stanGenerator) Next() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.num = g.num%999999 + 1
+
+	return fmt.Sprintf("%06d", g.num)
+}
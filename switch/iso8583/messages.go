@@ -0,0 +1,45 @@
+package iso8583
+
+// routingData are the fields of the acquirer's financial requests the switch
+// routes them by. The requests are forwarded as they are, so the switch
+// doesn't need the rest of their fields.
+type routingData struct {
+	MTI                  string                `index:"0"`
+	PrimaryAccountNumber string                `index:"2"`
+	Amount               int64                 `index:"3"`
+	TransmissionDateTime string                `index:"4"`
+	Currency             string                `index:"7"`
+	STAN                 string                `index:"11"`
+	AcquirerID           string                `index:"32"`
+	ChipData             []byte                `index:"55"`
+	OriginalDataElements *OriginalDataElements `index:"90"`
+}
+
+// responseData are the fields of the issuer's responses the switch reads,
+// and of the responses it sends itself when the request can't be forwarded.
+type responseData struct {
+	MTI               string `index:"0"`
+	AuthorizationCode string `index:"6"`
+	STAN              string `index:"11"`
+	ResponseCode      string `index:"39"`
+}
+
+// ReversalRequest is the 0400 message the switch sends when the issuer
+// didn't respond to an authorization in time, so the hold the issuer may have
+// placed is released.
+type ReversalRequest struct {
+	MTI                     string                `index:"0"`
+	Amount                  int64                 `index:"3"`
+	TransmissionDateTime    string                `index:"4"`
+	Currency                string                `index:"7"`
+	STAN                    string                `index:"11"`
+	AcquirerID              string                `index:"32"`
+	ForwardingInstitutionID string                `index:"33"`
+	OriginalDataElements    *OriginalDataElements `index:"90"`
+}
+
+type OriginalDataElements struct {
+	MTI                  string `index:"01"`
+	STAN                 string `index:"02"`
+	TransmissionDateTime string `index:"03"`
+}
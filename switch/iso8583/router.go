@@ -0,0 +1,148 @@
+package iso8583
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/bin"
+)
+
+var (
+	// ErrNoRoute is returned when no issuer serves the card number.
+	ErrNoRoute = errors.New("no route to issuer")
+
+	// ErrUnknownOriginal is returned when the message references an
+	// authorization the switch didn't route.
+	ErrUnknownOriginal = errors.New("original authorization not found")
+)
+
+// DefaultAuthorizationTTL is how long the router remembers the route of an
+// authorization. The messages that follow it, e.g. the refund of the
+// captured payment, can't be routed after that.
+const DefaultAuthorizationTTL = 30 * 24 * time.Hour
+
+// Route is an issuer and the BIN ranges of the cards it issued. A route
+// without BIN ranges is the default route of the cards no other route
+// serves.
+type Route struct {
+	Name      string
+	BINRanges []bin.Range
+	Issuer    *IssuerClient
+}
+
+// Router picks the issuer of the authorization by the BIN of the card. The
+// messages that follow the authorization (incremental authorization,
+// completion, capture, reversal, refund) carry no card number, so the router
+// remembers the route of each authorization by its acquirer ID, STAN and
+// transmission date & time. The routes are forgotten when the authorization
+// is reversed or after AuthorizationTTL.
+type Router struct {
+	routes []*Route
+
+	// AuthorizationTTL is how long the route of an authorization is kept.
+	// It must be set before routing.
+	AuthorizationTTL time.Duration
+
+	// mu guards the routes of the authorizations. They are kept in memory
+	// only, so the messages that follow the authorizations routed before
+	// the switch was restarted can't be routed.
+	mu             sync.RWMutex
+	authorizations map[string]*routedAuthorization
+	// expiredAt is when the expired authorizations were removed last
+	expiredAt time.Time
+}
+
+// routedAuthorization is the route of an authorization the switch forwarded
+type routedAuthorization struct {
+	route      *Route
+	recordedAt time.Time
+}
+
+func NewRouter(routes ...*Route) *Router {
+	return &Router{
+		routes:           routes,
+		AuthorizationTTL: DefaultAuthorizationTTL,
+		authorizations:   make(map[string]*routedAuthorization),
+		expiredAt:        time.Now(),
+	}
+}
+
+// Route returns the route of the card number. When ranges of several routes
+// contain it, the most specific range wins.
+func (r *Router) Route(pan string) (*Route, error) {
+	found, ok := bin.MostSpecific(pan, r.routes, func(route *Route) []bin.Range {
+		return route.BINRanges
+	})
+	if !ok {
+		return nil, fmt.Errorf("%w: card %s", ErrNoRoute, bin.MaskPAN(pan))
+	}
+
+	return found, nil
+}
+
+// Routes returns the routes in the order they were added.
+func (r *Router) Routes() []*Route {
+	return r.routes
+}
+
+// RecordAuthorization remembers the route of the authorization.
+func (r *Router) RecordAuthorization(route *Route, acquirerID, stan, transmissionDateTime string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.removeExpired()
+
+	r.authorizations[authorizationKey(acquirerID, stan, transmissionDateTime)] = &routedAuthorization{
+		route:      route,
+		recordedAt: time.Now(),
+	}
+}
+
+// RouteOf returns the route of the authorization referenced by the acquirer
+// ID, STAN and transmission date & time.
+func (r *Router) RouteOf(acquirerID, stan, transmissionDateTime string) (*Route, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	authorization, found := r.authorizations[authorizationKey(acquirerID, stan, transmissionDateTime)]
+	if !found || r.expired(authorization) {
+		return nil, fmt.Errorf("%w: acquirer %s stan %s", ErrUnknownOriginal, acquirerID, stan)
+	}
+
+	return authorization.route, nil
+}
+
+// Forget forgets the route of the authorization, e.g. once it's reversed and
+// no message can follow it.
+func (r *Router) Forget(acquirerID, stan, transmissionDateTime string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.authorizations, authorizationKey(acquirerID, stan, transmissionDateTime))
+}
+
+// removeExpired removes the expired authorizations. It goes through all of
+// them, so it does it at most once a minute.
+func (r *Router) removeExpired() {
+	if time.Since(r.expiredAt) < time.Minute {
+		return
+	}
+
+	r.expiredAt = time.Now()
+
+	for key, authorization := range r.authorizations {
+		if r.expired(authorization) {
+			delete(r.authorizations, key)
+		}
+	}
+}
+
+func (r *Router) expired(authorization *routedAuthorization) bool {
+	return time.Since(authorization.recordedAt) > r.AuthorizationTTL
+}
+
+func authorizationKey(acquirerID, stan, transmissionDateTime string) string {
+	return acquirerID + "|" + stan + "|" + transmissionDateTime
+}
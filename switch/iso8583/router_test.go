@@ -0,0 +1,32 @@
+package iso8583
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouterForgetsExpiredAuthorizations(t *testing.T) {
+	route := &Route{Name: "moov"}
+
+	router := NewRouter(route)
+	router.AuthorizationTTL = 10 * time.Millisecond
+
+	router.RecordAuthorization(route, "000001", "000001", "2026-10-17T10:00:00Z")
+
+	found, err := router.RouteOf("000001", "000001", "2026-10-17T10:00:00Z")
+	require.NoError(t, err)
+	require.Equal(t, route, found)
+
+	time.Sleep(20 * time.Millisecond)
+
+	_, err = router.RouteOf("000001", "000001", "2026-10-17T10:00:00Z")
+	require.ErrorIs(t, err, ErrUnknownOriginal)
+
+	// the expired authorizations are removed with the next one recorded
+	router.expiredAt = time.Time{}
+	router.RecordAuthorization(route, "000001", "000002", "2026-10-17T10:00:01Z")
+
+	require.Len(t, router.authorizations, 1)
+}
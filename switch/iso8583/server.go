@@ -0,0 +1,384 @@
+package iso8583
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/moov-io/bertlv"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/responsecode"
+	"github.com/moov-io/iso8583"
+	iso8583Connection "github.com/moov-io/iso8583-connection"
+	iso8583Server "github.com/moov-io/iso8583-connection/server"
+)
+
+// Server accepts the connections of the acquirers and forwards their
+// financial messages to the issuers picked by the router. The network
+// management messages (sign-on, sign-off, echo test) are handled by the
+// switch itself, the switch signs on to the issuers on its own.
+type Server struct {
+	Addr string
+
+	server *iso8583Server.Server
+	logger *slog.Logger
+	router *Router
+
+	// signedOn keeps the connections that signed on with 0800 and are
+	// allowed to send financial messages
+	signedOn   map[*iso8583Connection.Connection]bool
+	signedOnMu sync.RWMutex
+}
+
+// NewServer creates a new Server instance with the given logger, address and
+// router.
+func NewServer(logger *slog.Logger, addr string, router *Router) *Server {
+	logger = logger.With(slog.String("type", "iso8583-server"), slog.String("addr", addr))
+
+	s := &Server{
+		logger:   logger,
+		Addr:     addr,
+		router:   router,
+		signedOn: make(map[*iso8583Connection.Connection]bool),
+	}
+
+	s.server = iso8583Server.New(
+		spec,
+		readMessageLength,
+		writeMessageLength,
+		iso8583Connection.InboundMessageHandler(s.handleRequest),
+		iso8583Connection.ErrorHandler(func(err error) {
+			if errors.Is(err, io.EOF) {
+				s.logger.Info("connection closed by acquirer")
+				return
+			}
+
+			s.logger.Error("failed to handle message", slog.String("addr", s.Addr), slog.String("error", err.Error()))
+		}),
+
+		// forget the sign-on of the closed connection
+		iso8583Connection.ConnectionClosedHandler(s.setSignedOn(false)),
+	)
+
+	return s
+}
+
+// Start starts the server.
+func (s *Server) Start() error {
+	s.logger.Info("starting ISO 8583 server...")
+
+	if err := s.server.Start(s.Addr); err != nil {
+		return fmt.Errorf("starting ISO 8583 server: %w", err)
+	}
+
+	// the address may be different from the one we passed, e.g. ":0"
+	s.Addr = s.server.Addr
+
+	s.logger.Info("ISO 8583 server started", slog.String("addr", s.Addr))
+
+	return nil
+}
+
+func (s *Server) Close() error {
+	s.logger.Info("shutting down ISO 8583 server...")
+
+	s.server.Close()
+
+	s.logger.Info("ISO 8583 server shut down")
+
+	return nil
+}
+
+// handleRequest is called when a new message is received.
+func (s *Server) handleRequest(c *iso8583Connection.Connection, message *iso8583.Message) {
+	mti, err := message.GetMTI()
+	if err != nil {
+		s.logger.Error("failed to get MTI from message", "err", err)
+	}
+
+	logger := s.logger.With(slog.String("mti", mti))
+
+	logger.Info("handling request")
+
+	// financial messages are accepted only from signed on acquirers
+	if mti != "0800" && !s.isSignedOn(c) {
+		s.logger.Warn("refusing request from connection that is not signed on", slog.String("mti", mti))
+
+		err = s.respond(c, message, mti, responsecode.IssuerUnavailable)
+		if err != nil {
+			logger.Error("failed to refuse request", "err", err)
+		}
+
+		return
+	}
+
+	switch mti {
+	case "0800":
+		err = s.handleNetworkManagementRequest(c, message)
+	case "0100", "0120", "0200", "0220", "0400":
+		err = s.handleFinancialRequest(c, message)
+	default:
+		err = fmt.Errorf("unknown MTI: %s", mti)
+	}
+
+	if err != nil {
+		logger.Error("failed to handle request", "err", err)
+	}
+}
+
+// handleFinancialRequest forwards the request to the issuer and replies with
+// the issuer's response. When the request can't be forwarded or the issuer
+// doesn't respond in time, the switch responds itself.
+func (s *Server) handleFinancialRequest(c *iso8583Connection.Connection, message *iso8583.Message) error {
+	requestData := &routingData{}
+	if err := message.Unmarshal(requestData); err != nil {
+		return fmt.Errorf("unmarshaling message: %w", err)
+	}
+
+	logger := s.logger.With(
+		slog.String("mti", requestData.MTI),
+		slog.String("stan", requestData.STAN),
+		slog.String("acquirer_id", requestData.AcquirerID),
+	)
+
+	route, err := s.route(requestData)
+	if err != nil {
+		logger.Warn("failed to route request", "err", err)
+
+		responseCode := responsecode.NoSuchIssuer
+		if errors.Is(err, ErrUnknownOriginal) {
+			responseCode = responsecode.UnableToRoute
+		}
+
+		return s.respond(c, message, requestData.MTI, responseCode)
+	}
+
+	logger = logger.With(slog.String("route", route.Name))
+
+	// the route is recorded before the authorization is forwarded, so the
+	// reversal of the authorization that got no response is routed too
+	isAuthorization := (requestData.MTI == "0100" || requestData.MTI == "0120") && requestData.OriginalDataElements == nil
+	if isAuthorization {
+		s.router.RecordAuthorization(route, requestData.AcquirerID, requestData.STAN, requestData.TransmissionDateTime)
+	}
+
+	logger.Info("forwarding request to issuer")
+
+	responseMessage, err := route.Issuer.Forward(message)
+	if err != nil {
+		logger.Warn("failed to forward request", "err", err)
+
+		if errors.Is(err, ErrNoResponse) && requestData.MTI == "0100" && isAuthorization {
+			go s.reverse(route, requestData)
+		}
+
+		return s.respond(c, message, requestData.MTI, forwardingResponseCode(err))
+	}
+
+	response := &responseData{}
+	if err := responseMessage.Unmarshal(response); err != nil {
+		return fmt.Errorf("unmarshaling response: %w", err)
+	}
+
+	// nothing follows the reversed authorization
+	if original := requestData.OriginalDataElements; requestData.MTI == "0400" && original != nil &&
+		responsecode.GetInfo(response.ResponseCode).IsApproved() {
+		s.router.Forget(requestData.AcquirerID, original.STAN, original.TransmissionDateTime)
+	}
+
+	if err := c.Reply(responseMessage); err != nil {
+		return fmt.Errorf("sending response: %w", err)
+	}
+
+	logger.With(
+		slog.String("response_code", response.ResponseCode),
+	).Info("issuer response sent")
+
+	return nil
+}
+
+// route returns the route of the request. Authorizations and advices are
+// routed by the card number, the messages that follow them by the
+// authorization they reference.
+func (s *Server) route(request *routingData) (*Route, error) {
+	if original := request.OriginalDataElements; original != nil {
+		return s.router.RouteOf(request.AcquirerID, original.STAN, original.TransmissionDateTime)
+	}
+
+	switch request.MTI {
+	case "0200", "0220", "0400":
+		return nil, fmt.Errorf("%w: original data elements are missing", ErrUnknownOriginal)
+	}
+
+	pan, err := requestPAN(request.PrimaryAccountNumber, request.ChipData)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.router.Route(pan)
+}
+
+// requestPAN returns the card number of the request, from the EMV payload for
+// chip requests.
+func requestPAN(pan string, chipData []byte) (string, error) {
+	if chipData == nil {
+		return pan, nil
+	}
+
+	emvTags, err := bertlv.Decode(chipData)
+	if err != nil {
+		return "", fmt.Errorf("decoding EMV payload: %w", err)
+	}
+
+	card := &struct {
+		PAN string `bertlv:"5A"`
+	}{}
+
+	if err := bertlv.Unmarshal(emvTags, card); err != nil {
+		return "", fmt.Errorf("unmarshalling EMV tags: %w", err)
+	}
+
+	return card.PAN, nil
+}
+
+// forwardingResponseCode returns the response code the switch responds with
+// when the request was not forwarded or got no response.
+func forwardingResponseCode(err error) string {
+	switch {
+	case errors.Is(err, ErrNoResponse), errors.Is(err, ErrIssuerUnavailable):
+		return responsecode.IssuerUnavailable
+	case errors.Is(err, ErrDuplicateInFlight):
+		return responsecode.DuplicateTransmission
+	case errors.Is(err, ErrSTANInFlight):
+		return responsecode.ReEnterTransaction
+	default:
+		return responsecode.SystemMalfunction
+	}
+}
+
+// reverse reverses the authorization the issuer didn't respond to in time. We
+// responded to the acquirer with 91, so the issuer must not keep the hold it
+// may have placed.
+func (s *Server) reverse(route *Route, request *routingData) {
+	logger := s.logger.With(
+		slog.String("route", route.Name),
+		slog.String("acquirer_id", request.AcquirerID),
+		slog.String("stan", request.STAN),
+	)
+
+	err := route.Issuer.Reverse(request.AcquirerID, request.STAN, request.TransmissionDateTime, request.Amount, request.Currency)
+	if err != nil {
+		logger.Error("failed to reverse authorization", "err", err)
+		return
+	}
+
+	s.router.Forget(request.AcquirerID, request.STAN, request.TransmissionDateTime)
+
+	logger.Info("authorization reversed")
+}
+
+// handleNetworkManagementRequest handles sign-on, sign-off and echo test
+// requests of the acquirers.
+func (s *Server) handleNetworkManagementRequest(c *iso8583Connection.Connection, message *iso8583.Message) error {
+	requestData := &NetworkManagementRequest{}
+	if err := message.Unmarshal(requestData); err != nil {
+		return fmt.Errorf("unmarshaling message: %w", err)
+	}
+
+	s.logger.With(
+		slog.String("mti", requestData.MTI),
+		slog.String("stan", requestData.STAN),
+		slog.String("code", requestData.Code),
+	).Info("handling network management request")
+
+	responseCode := responsecode.Approved
+
+	switch requestData.Code {
+	case NetworkCodeSignOn:
+		s.setSignedOn(true)(c)
+	case NetworkCodeSignOff:
+		s.setSignedOn(false)(c)
+	case NetworkCodeEchoTest:
+		// nothing to do, the response itself is the echo
+	default:
+		responseCode = responsecode.InvalidTransaction
+	}
+
+	responseData := &NetworkManagementResponse{
+		MTI:          "0810",
+		STAN:         requestData.STAN,
+		ResponseCode: responseCode,
+		Code:         requestData.Code,
+	}
+
+	responseMessage := iso8583.NewMessage(spec)
+	if err := responseMessage.Marshal(responseData); err != nil {
+		return fmt.Errorf("marshaling response: %w", err)
+	}
+
+	if err := c.Reply(responseMessage); err != nil {
+		return fmt.Errorf("sending response: %w", err)
+	}
+
+	return nil
+}
+
+// respond replies to the request with the response code without forwarding
+// it to the issuer.
+func (s *Server) respond(c *iso8583Connection.Connection, message *iso8583.Message, mti, responseCode string) error {
+	if len(mti) != 4 || mti[2] < '0' || mti[2] > '8' {
+		return fmt.Errorf("unknown MTI: %s", mti)
+	}
+
+	stan, err := message.GetString(11)
+	if err != nil {
+		return fmt.Errorf("getting STAN: %w", err)
+	}
+
+	// response MTI has the message function increased by one, e.g. 0100 -> 0110
+	response := &responseData{
+		MTI:          mti[:2] + string(mti[2]+1) + mti[3:],
+		STAN:         stan,
+		ResponseCode: responseCode,
+	}
+
+	responseMessage := iso8583.NewMessage(spec)
+	if err := responseMessage.Marshal(response); err != nil {
+		return fmt.Errorf("marshaling response: %w", err)
+	}
+
+	if err := c.Reply(responseMessage); err != nil {
+		return fmt.Errorf("sending response: %w", err)
+	}
+
+	s.logger.With(
+		slog.String("mti", response.MTI),
+		slog.String("stan", response.STAN),
+		slog.String("response_code", response.ResponseCode),
+	).Info("switch response sent")
+
+	return nil
+}
+
+func (s *Server) isSignedOn(c *iso8583Connection.Connection) bool {
+	s.signedOnMu.RLock()
+	defer s.signedOnMu.RUnlock()
+
+	return s.signedOn[c]
+}
+
+// setSignedOn returns a function that sets the sign-on state of the
+// connection, so it can be used as a connection closed handler as well.
+func (s *Server) setSignedOn(signedOn bool) func(c *iso8583Connection.Connection) {
+	return func(c *iso8583Connection.Connection) {
+		s.signedOnMu.Lock()
+		defer s.signedOnMu.Unlock()
+
+		if signedOn {
+			s.signedOn[c] = true
+		} else {
+			delete(s.signedOn, c)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package iso8583
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/bin"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/responsecode"
+	"github.com/moov-io/ftdc-from-tap-to-auth/log"
+	"github.com/moov-io/iso8583"
+	iso8583Connection "github.com/moov-io/iso8583-connection"
+	iso8583Server "github.com/moov-io/iso8583-connection/server"
+	"github.com/stretchr/testify/require"
+)
+
+// forwardedRequest are the fields of the requests the fake issuer checks
+type forwardedRequest struct {
+	MTI                     string                `index:"0"`
+	PrimaryAccountNumber    string                `index:"2"`
+	Amount                  int64                 `index:"3"`
+	TransmissionDateTime    string                `index:"4"`
+	AuthorizationCode       string                `index:"6"`
+	Currency                string                `index:"7"`
+	STAN                    string                `index:"11"`
+	AcquirerID              string                `index:"32"`
+	ForwardingInstitutionID string                `index:"33"`
+	OriginalDataElements    *OriginalDataElements `index:"90"`
+}
+
+// fakeIssuer approves all requests except the authorizations of the amount
+// it never responds to. The authorizations of the slow amount are approved
+// after a while.
+type fakeIssuer struct {
+	Addr string
+
+	server *iso8583Server.Server
+
+	mu       sync.Mutex
+	requests []forwardedRequest
+}
+
+const (
+	noResponseAmount = 666
+	slowAmount       = 777
+)
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	issuer := &fakeIssuer{}
+
+	issuer.server = iso8583Server.New(spec, readMessageLength, writeMessageLength,
+		iso8583Connection.InboundMessageHandler(func(c *iso8583Connection.Connection, message *iso8583.Message) {
+			request := forwardedRequest{}
+			require.NoError(t, message.Unmarshal(&request))
+
+			if request.MTI != "0800" {
+				issuer.mu.Lock()
+				issuer.requests = append(issuer.requests, request)
+				issuer.mu.Unlock()
+			}
+
+			if request.Amount == noResponseAmount && request.MTI == "0100" {
+				return
+			}
+
+			if request.Amount == slowAmount && request.MTI == "0100" {
+				time.Sleep(50 * time.Millisecond)
+			}
+
+			response := iso8583.NewMessage(spec)
+			require.NoError(t, response.Marshal(&responseData{
+				MTI:               request.MTI[:2] + string(request.MTI[2]+1) + request.MTI[3:],
+				STAN:              request.STAN,
+				ResponseCode:      responsecode.Approved,
+				AuthorizationCode: "123456",
+			}))
+			require.NoError(t, c.Reply(response))
+		}),
+	)
+
+	require.NoError(t, issuer.server.Start("127.0.0.1:0"))
+	t.Cleanup(issuer.server.Close)
+
+	issuer.Addr = issuer.server.Addr
+
+	return issuer
+}
+
+// Requests returns the financial requests the issuer received.
+func (i *fakeIssuer) Requests() []forwardedRequest {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return append([]forwardedRequest(nil), i.requests...)
+}
+
+func TestServer(t *testing.T) {
+	issuer := newFakeIssuer(t)
+
+	issuerClient, err := NewIssuerClient(log.New(), issuer.Addr, "000100", 200*time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, issuerClient.Connect())
+	defer issuerClient.Close()
+
+	router := NewRouter(&Route{
+		Name:      "moov",
+		BINRanges: []bin.Range{{Start: "4"}},
+		Issuer:    issuerClient,
+	})
+
+	server := NewServer(log.New(), "127.0.0.1:0", router)
+	require.NoError(t, server.Start())
+	defer server.Close()
+
+	conn, err := iso8583Connection.New(server.Addr, spec, readMessageLength, writeMessageLength, iso8583Connection.SendTimeout(time.Second))
+	require.NoError(t, err)
+	require.NoError(t, conn.Connect())
+	defer conn.Close()
+
+	send := func(request any) *responseData {
+		message := iso8583.NewMessage(spec)
+		require.NoError(t, message.Marshal(request))
+
+		response, err := conn.Send(message)
+		require.NoError(t, err)
+
+		responseData := &responseData{}
+		require.NoError(t, response.Unmarshal(responseData))
+
+		return responseData
+	}
+
+	authorize := func(stan, pan string, amount int64) *responseData {
+		return send(&forwardedRequest{
+			MTI:                  "0100",
+			PrimaryAccountNumber: pan,
+			Amount:               amount,
+			TransmissionDateTime: "2026-10-17T10:00:00Z",
+			Currency:             "USD",
+			STAN:                 stan,
+			AcquirerID:           "000001",
+		})
+	}
+
+	// financial messages are refused before sign-on
+	response := authorize("000001", "4242424242424242", 1000)
+	require.Equal(t, "0110", response.MTI)
+	require.Equal(t, responsecode.IssuerUnavailable, response.ResponseCode)
+	require.Empty(t, issuer.Requests())
+
+	response = send(&NetworkManagementRequest{
+		MTI:                  "0800",
+		TransmissionDateTime: "2026-10-17T10:00:00Z",
+		STAN:                 "000002",
+		Code:                 NetworkCodeSignOn,
+	})
+	require.Equal(t, responsecode.Approved, response.ResponseCode)
+
+	t.Run("forwards authorization with forwarding institution", func(t *testing.T) {
+		response := authorize("000003", "4242424242424242", 1000)
+		require.Equal(t, "0110", response.MTI)
+		require.Equal(t, responsecode.Approved, response.ResponseCode)
+		require.Equal(t, "123456", response.AuthorizationCode)
+
+		requests := issuer.Requests()
+		require.NotEmpty(t, requests)
+
+		forwarded := requests[len(requests)-1]
+		require.Equal(t, "000003", forwarded.STAN)
+		require.Equal(t, "000001", forwarded.AcquirerID)
+		require.Equal(t, "000100", forwarded.ForwardingInstitutionID)
+	})
+
+	capture := func(stan, acquirerID string) *responseData {
+		return send(&forwardedRequest{
+			MTI:                  "0220",
+			Amount:               1000,
+			TransmissionDateTime: "2026-10-17T10:00:02Z",
+			AuthorizationCode:    "123456",
+			Currency:             "USD",
+			STAN:                 stan,
+			AcquirerID:           acquirerID,
+			OriginalDataElements: &OriginalDataElements{
+				MTI:                  "0100",
+				STAN:                 "000003",
+				TransmissionDateTime: "2026-10-17T10:00:00Z",
+			},
+		})
+	}
+
+	t.Run("routes capture to issuer of original authorization", func(t *testing.T) {
+		response := capture("000008", "000001")
+		require.Equal(t, "0230", response.MTI)
+		require.Equal(t, responsecode.Approved, response.ResponseCode)
+
+		// another acquirer got no authorization with the trace from us
+		response = capture("000009", "000002")
+		require.Equal(t, responsecode.UnableToRoute, response.ResponseCode)
+	})
+
+	t.Run("declines capture without original data elements", func(t *testing.T) {
+		response := send(&forwardedRequest{
+			MTI:                  "0220",
+			Amount:               1000,
+			TransmissionDateTime: "2026-10-17T10:00:02Z",
+			AuthorizationCode:    "123456",
+			Currency:             "USD",
+			STAN:                 "000011",
+			AcquirerID:           "000001",
+		})
+		require.Equal(t, responsecode.UnableToRoute, response.ResponseCode)
+	})
+
+	t.Run("routes reversal to issuer of original authorization", func(t *testing.T) {
+		response := send(&forwardedRequest{
+			MTI:                  "0400",
+			Amount:               1000,
+			TransmissionDateTime: "2026-10-17T10:00:01Z",
+			Currency:             "USD",
+			STAN:                 "000004",
+			AcquirerID:           "000001",
+			OriginalDataElements: &OriginalDataElements{
+				MTI:                  "0100",
+				STAN:                 "000003",
+				TransmissionDateTime: "2026-10-17T10:00:00Z",
+			},
+		})
+		require.Equal(t, "0410", response.MTI)
+		require.Equal(t, responsecode.Approved, response.ResponseCode)
+
+		// the reversed authorization is forgotten
+		response = capture("000010", "000001")
+		require.Equal(t, responsecode.UnableToRoute, response.ResponseCode)
+	})
+
+	t.Run("declines reversal of unknown authorization", func(t *testing.T) {
+		response := send(&forwardedRequest{
+			MTI:                  "0400",
+			Amount:               1000,
+			TransmissionDateTime: "2026-10-17T10:00:01Z",
+			Currency:             "USD",
+			STAN:                 "000005",
+			AcquirerID:           "000001",
+			OriginalDataElements: &OriginalDataElements{
+				MTI:                  "0100",
+				STAN:                 "999999",
+				TransmissionDateTime: "2026-10-17T10:00:00Z",
+			},
+		})
+		require.Equal(t, responsecode.UnableToRoute, response.ResponseCode)
+	})
+
+	t.Run("declines card without route", func(t *testing.T) {
+		response := authorize("000006", "5555555555554444", 1000)
+		require.Equal(t, responsecode.NoSuchIssuer, response.ResponseCode)
+	})
+
+	t.Run("responds with 91 and reverses authorization on timeout", func(t *testing.T) {
+		response := authorize("000007", "4242424242424242", noResponseAmount)
+		require.Equal(t, "0110", response.MTI)
+		require.Equal(t, responsecode.IssuerUnavailable, response.ResponseCode)
+
+		require.Eventually(t, func() bool {
+			for _, request := range issuer.Requests() {
+				if request.MTI == "0400" && request.OriginalDataElements.STAN == "000007" {
+					return request.AcquirerID == "000001" && request.Amount == noResponseAmount
+				}
+			}
+
+			return false
+		}, time.Second, 10*time.Millisecond)
+	})
+}
+
+func TestServerForwardsRequestsOfAcquirersWithSameSTAN(t *testing.T) {
+	issuer := newFakeIssuer(t)
+
+	issuerClient, err := NewIssuerClient(log.New(), issuer.Addr, "000100", time.Second)
+	require.NoError(t, err)
+	require.NoError(t, issuerClient.Connect())
+	defer issuerClient.Close()
+
+	server := NewServer(log.New(), "127.0.0.1:0", NewRouter(&Route{Name: "moov", Issuer: issuerClient}))
+	require.NoError(t, server.Start())
+	defer server.Close()
+
+	// each acquirer has its own connection and numbers its requests itself
+	authorize := func(acquirerID string) *responseData {
+		conn, err := iso8583Connection.New(server.Addr, spec, readMessageLength, writeMessageLength, iso8583Connection.SendTimeout(2*time.Second))
+		require.NoError(t, err)
+		require.NoError(t, conn.Connect())
+		defer conn.Close()
+
+		send := func(request any) *responseData {
+			message := iso8583.NewMessage(spec)
+			require.NoError(t, message.Marshal(request))
+
+			response, err := conn.Send(message)
+			require.NoError(t, err)
+
+			responseData := &responseData{}
+			require.NoError(t, response.Unmarshal(responseData))
+
+			return responseData
+		}
+
+		response := send(&NetworkManagementRequest{
+			MTI:                  "0800",
+			TransmissionDateTime: "2026-10-17T10:00:00Z",
+			STAN:                 "000001",
+			Code:                 NetworkCodeSignOn,
+		})
+		require.Equal(t, responsecode.Approved, response.ResponseCode)
+
+		return send(&forwardedRequest{
+			MTI:                  "0100",
+			PrimaryAccountNumber: "4242424242424242",
+			Amount:               slowAmount,
+			TransmissionDateTime: "2026-10-17T10:00:00Z",
+			Currency:             "USD",
+			STAN:                 "000002",
+			AcquirerID:           acquirerID,
+		})
+	}
+
+	var wg sync.WaitGroup
+	responses := make([]*responseData, 2)
+	for i, acquirerID := range []string{"000001", "000002"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i] = authorize(acquirerID)
+		}()
+	}
+	wg.Wait()
+
+	// the second request waits for the response to the first one
+	for _, response := range responses {
+		require.Equal(t, responsecode.Approved, response.ResponseCode)
+	}
+
+	acquirerIDs := []string{}
+	for _, request := range issuer.Requests() {
+		require.Equal(t, "000002", request.STAN)
+		acquirerIDs = append(acquirerIDs, request.AcquirerID)
+	}
+	require.ElementsMatch(t, []string{"000001", "000002"}, acquirerIDs)
+}
@@ -0,0 +1,223 @@
+// Package apdutrace records the APDUs the terminal exchanges with a card to a
+// trace file and replays them without the card. A session captured with a
+// real Visa or Mastercard card can be rerun to reproduce its bugs.
+//
+// The trace is a JSON object per line, one for each command:
+//
+//	{"time":"2025-10-17T10:00:00.123Z","command":"00A404000E325041592E5359532E444446303100","response":"6F2F...","sw":"9000","duration":31000000}
+package apdutrace
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Card is the card whose APDUs are recorded: the card of the PC/SC reader or
+// the card emulator.
+type Card interface {
+	Transmit(command []byte) ([]byte, error)
+}
+
+// Exchange is a command sent to the card and its response.
+type Exchange struct {
+	Time time.Time `json:"time"`
+
+	// Command is the hex encoded command APDU
+	Command string `json:"command"`
+
+	// Response is the hex encoded data of the response, without the status
+	// word
+	Response string `json:"response,omitempty"`
+
+	// SW is the status word of the response, e.g. 9000
+	SW string `json:"sw,omitempty"`
+
+	// Duration is how long the card took to respond
+	Duration time.Duration `json:"duration"`
+
+	// Error is the error of the transmission, there is no response then
+	Error string `json:"error,omitempty"`
+}
+
+// Recorder sends the commands to the card and writes each exchange to the
+// trace. It implements kernel.RawCardReader and terminal.Card.
+type Recorder struct {
+	card Card
+
+	mu      sync.Mutex
+	encoder *json.Encoder
+	closer  io.Closer
+}
+
+// NewRecorder returns a recorder that writes the trace of the card to w.
+func NewRecorder(card Card, w io.Writer) *Recorder {
+	return &Recorder{
+		card:    card,
+		encoder: json.NewEncoder(w),
+	}
+}
+
+// Create returns a recorder that writes the trace of the card to the file,
+// it's truncated if it exists. Close closes the file.
+func Create(path string, card Card) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("creating trace file: %w", err)
+	}
+
+	recorder := NewRecorder(card, file)
+	recorder.closer = file
+
+	return recorder, nil
+}
+
+// Transmit sends the command to the card and records the exchange.
+func (r *Recorder) Transmit(command []byte) ([]byte, error) {
+	start := time.Now()
+	response, err := r.card.Transmit(command)
+
+	exchange := Exchange{
+		Time:     start.UTC(),
+		Command:  fmt.Sprintf("%X", command),
+		Duration: time.Since(start),
+	}
+
+	if err != nil {
+		exchange.Error = err.Error()
+	} else if len(response) >= 2 {
+		exchange.Response = fmt.Sprintf("%X", response[:len(response)-2])
+		exchange.SW = fmt.Sprintf("%X", response[len(response)-2:])
+	} else {
+		exchange.Response = fmt.Sprintf("%X", response)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if encodeErr := r.encoder.Encode(exchange); encodeErr != nil {
+		return nil, fmt.Errorf("recording exchange: %w", encodeErr)
+	}
+
+	return response, err
+}
+
+// SendAPDU is Transmit, for the kernel.
+func (r *Recorder) SendAPDU(command []byte) ([]byte, error) {
+	return r.Transmit(command)
+}
+
+// Close closes the trace file of the recorder created with Create.
+func (r *Recorder) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+
+	if err := r.closer.Close(); err != nil {
+		return fmt.Errorf("closing trace file: %w", err)
+	}
+
+	return nil
+}
+
+// Replayer answers the commands with the responses of a trace, in the order
+// they were recorded. Only the header of the commands (CLA, INS, P1 and P2)
+// has to match the recorded ones: the terminal data, e.g. the unpredictable
+// number and the date of GENERATE AC, is new in every run. It implements
+// kernel.RawCardReader and terminal.Card.
+type Replayer struct {
+	mu        sync.Mutex
+	exchanges []Exchange
+	next      int
+}
+
+// NewReplayer returns a replayer of the trace read from r.
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	var exchanges []Exchange
+
+	scanner := bufio.NewScanner(r)
+	// the responses of the records can be long
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var exchange Exchange
+		if err := json.Unmarshal(scanner.Bytes(), &exchange); err != nil {
+			return nil, fmt.Errorf("decoding exchange on line %d: %w", line, err)
+		}
+
+		exchanges = append(exchanges, exchange)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading trace: %w", err)
+	}
+
+	return &Replayer{exchanges: exchanges}, nil
+}
+
+// Open returns a replayer of the trace file.
+func Open(path string) (*Replayer, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening trace file: %w", err)
+	}
+	defer file.Close()
+
+	return NewReplayer(file)
+}
+
+// Transmit returns the recorded response of the next exchange.
+func (r *Replayer) Transmit(command []byte) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.next >= len(r.exchanges) {
+		return nil, fmt.Errorf("no recorded exchange for command %X, the trace has %d", command, len(r.exchanges))
+	}
+
+	exchange := r.exchanges[r.next]
+	r.next++
+
+	recorded, err := hex.DecodeString(exchange.Command)
+	if err != nil {
+		return nil, fmt.Errorf("decoding command of exchange %d: %w", r.next, err)
+	}
+
+	if len(command) < 4 || len(recorded) < 4 || string(command[:4]) != string(recorded[:4]) {
+		return nil, fmt.Errorf("command %X doesn't match the recorded %X of exchange %d", command, recorded, r.next)
+	}
+
+	if exchange.Error != "" {
+		return nil, errors.New(exchange.Error)
+	}
+
+	response, err := hex.DecodeString(exchange.Response + exchange.SW)
+	if err != nil {
+		return nil, fmt.Errorf("decoding response of exchange %d: %w", r.next, err)
+	}
+
+	return response, nil
+}
+
+// SendAPDU is Transmit, for the kernel.
+func (r *Replayer) SendAPDU(command []byte) ([]byte, error) {
+	return r.Transmit(command)
+}
+
+// Remaining returns the number of recorded exchanges not replayed yet.
+func (r *Replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.exchanges) - r.next
+}
@@ -0,0 +1,102 @@
+package apdutrace
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/moov-io/bertlv"
+	"github.com/moov-io/ftdc-from-tap-to-auth/terminal/emulator"
+	"github.com/moov-io/ftdc-from-tap-to-auth/terminal/kernel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	card, err := emulator.New(emulator.DefaultProfile())
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	recorder, err := Create(path, card)
+	require.NoError(t, err)
+
+	recorded := kernel.NewFTDCKernel(kernel.NewCardReaderAdapter(recorder))
+	transaction, err := kernel.NewTransaction(10_00)
+	require.NoError(t, err)
+	require.NoError(t, recorded.Process(transaction))
+	require.NoError(t, recorder.Close())
+
+	replayer, err := Open(path)
+	require.NoError(t, err)
+
+	// SELECT, GPO, three records and GENERATE AC
+	require.Equal(t, 6, replayer.Remaining())
+
+	// the replayed session has new terminal data, but the card answers the
+	// same
+	replayed := kernel.NewFTDCKernel(kernel.NewCardReaderAdapter(replayer))
+	transaction, err = kernel.NewTransaction(10_00)
+	require.NoError(t, err)
+	require.NoError(t, replayed.Process(transaction))
+	require.Zero(t, replayer.Remaining())
+
+	for _, tag := range []string{"5A", "9F26", "9F36"} {
+		want, found := bertlv.FindFirstTag(recorded.TagsDB, tag)
+		require.True(t, found, "tag %s", tag)
+
+		got, found := bertlv.FindFirstTag(replayed.TagsDB, tag)
+		require.True(t, found, "tag %s", tag)
+		require.Equal(t, want.Value, got.Value, "tag %s", tag)
+	}
+
+	// the session is over
+	_, err = replayer.SendAPDU([]byte{0x80, 0xAE, 0x40, 0x00})
+	require.ErrorContains(t, err, "no recorded exchange")
+}
+
+type failingCard struct{}
+
+func (failingCard) Transmit([]byte) ([]byte, error) {
+	return nil, errors.New("card removed")
+}
+
+func TestRecorderExchange(t *testing.T) {
+	card, err := emulator.New(emulator.DefaultProfile())
+	require.NoError(t, err)
+
+	trace := &bytes.Buffer{}
+	response, err := NewRecorder(card, trace).Transmit([]byte{0x80, 0xCA, 0x9F, 0x36, 0x00})
+	require.NoError(t, err)
+
+	_, err = NewRecorder(failingCard{}, trace).Transmit([]byte{0x80, 0xCA, 0x9F, 0x36, 0x00})
+	require.EqualError(t, err, "card removed")
+
+	lines := strings.Split(strings.TrimSpace(trace.String()), "\n")
+	require.Len(t, lines, 2)
+
+	exchange := Exchange{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &exchange))
+	require.Equal(t, "80CA9F3600", exchange.Command)
+	require.Equal(t, "9F36020000", exchange.Response)
+	require.Equal(t, "9000", exchange.SW)
+	require.False(t, exchange.Time.IsZero())
+
+	// the replayer answers like the card, errors included
+	replayer, err := NewReplayer(strings.NewReader(trace.String()))
+	require.NoError(t, err)
+
+	_, err = replayer.Transmit([]byte{0x80, 0xCA, 0x9F, 0x17, 0x00})
+	require.ErrorContains(t, err, "doesn't match")
+
+	replayer, err = NewReplayer(strings.NewReader(trace.String()))
+	require.NoError(t, err)
+
+	replayedResponse, err := replayer.Transmit([]byte{0x80, 0xCA, 0x9F, 0x36, 0x00})
+	require.NoError(t, err)
+	require.Equal(t, response, replayedResponse)
+
+	_, err = replayer.Transmit([]byte{0x80, 0xCA, 0x9F, 0x36, 0x00})
+	require.EqualError(t, err, "card removed")
+}
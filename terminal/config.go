@@ -6,7 +6,23 @@ type Config struct {
 	AcquirerURL   string `yaml:"acquirer_url"`   // URL of the acquirer service
 	PrinterURL    string `yaml:"printer_url"`    // URL of the printer service
 	DefaultAmount int64  `yaml:"default_amount"` // Default amount for payments
-	Kernel        string `yaml:"kernel"`         // Kernel type to use, e.g., "universal" or "ftdc"
+
+	// PartialApproval lets the issuer approve less than the amount when
+	// the balance is low; the rest is shown as the balance due
+	PartialApproval bool `yaml:"partial_approval"`
+
+	// CardProfile is the YAML profile of the emulated card, see
+	// configs/card.yaml. When set, the terminal uses the card emulator
+	// instead of the NFC reader.
+	CardProfile string `yaml:"card_profile"`
+
+	// APDUTrace is the file the APDUs exchanged with the card are recorded
+	// to, see the apdutrace package
+	APDUTrace string `yaml:"apdu_trace"`
+
+	// ReplayTrace is a recorded APDU trace the terminal replays instead of
+	// reading a card, to rerun a captured session
+	ReplayTrace string `yaml:"replay_trace"`
 }
 
 func DefaultConfig() *Config {
@@ -15,6 +31,7 @@ func DefaultConfig() *Config {
 		MerchantID:    "",                      // No default merchant ID
 		AcquirerURL:   "http://localhost:8080", // Default URL for acquirer service
 		DefaultAmount: 100,                     // Default amount of 1.00 in minor units (e.g., cents)
-		Kernel:        "ftdc",                  // Default kernel type
+
+		PartialApproval: true,
 	}
 }
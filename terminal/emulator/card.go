@@ -0,0 +1,438 @@
+// Package emulator emulates the FTDC payment card in Go, so the terminal
+// can run transactions without a card reader and a personalized JavaCard.
+package emulator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/moov-io/bertlv"
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/emv"
+)
+
+// status words of the responses
+const (
+	swSuccess                = 0x9000
+	swWrongLength            = 0x6700
+	swPINBlocked             = 0x6983
+	swConditionsNotSatisfied = 0x6985
+	swFileNotFound           = 0x6A82
+	swWrongP1P2              = 0x6B00
+	swINSNotSupported        = 0x6D00
+)
+
+// cryptogram types of GENERATE AC, the first two bits of P1 and of the CID
+const (
+	cryptogramAAC  = 0x00
+	cryptogramTC   = 0x40
+	cryptogramARQC = 0x80
+	cryptogramRFU  = 0xC0
+)
+
+// ppse is the name of the directory of the contactless applications
+const ppse = "2PAY.SYS.DDF01"
+
+// pinTries is the number of wrong PINs the card accepts before it blocks
+// the PIN
+const pinTries = 3
+
+var (
+	// aip is the application interchange profile of the applet: SDA and
+	// cardholder verification are supported, terminal risk management is
+	// to be performed
+	aip = []byte{0x58, 0x00}
+
+	// afl is the application file locator of the applet: records 1 to 3 of
+	// SFI 1, the first one is used for offline data authentication
+	afl = []byte{0x08, 0x01, 0x03, 0x01}
+)
+
+// Card is an emulated FTDC card. It answers the commands of the terminal
+// like the applet in javacard/src/openemv/SimpleEMVApplet.java and computes
+// the application cryptograms the way javacard/src/openemv/EMVCrypto.java
+// does, see package emv, with the card master key derived from the issuer
+// master key of the profile.
+//
+// Card implements kernel.RawCardReader and terminal.Card.
+type Card struct {
+	profile   Profile
+	aid       []byte
+	masterKey []byte
+	records   [][]byte
+	pin       []byte
+
+	atc           uint16
+	lastOnlineATC uint16
+	pinTriesLeft  byte
+
+	// state of the session, reset when the application is selected
+	selected   bool
+	firstAC    *byte
+	secondAC   *byte
+	sessionKey []byte
+}
+
+// New returns a card personalized with the profile.
+func New(profile Profile) (*Card, error) {
+	aid, err := hex.DecodeString(profile.AID)
+	if err != nil {
+		return nil, fmt.Errorf("decoding aid: %w", err)
+	}
+
+	issuerMasterKey, err := hex.DecodeString(profile.IssuerMasterKey)
+	if err != nil {
+		return nil, fmt.Errorf("decoding issuer master key: %w", err)
+	}
+
+	// the card gets the key the issuer personalizes the FTDC cards with
+	masterKey, err := emv.DeriveICCMasterKey(issuerMasterKey, profile.PAN, profile.PANSequenceNumber)
+	if err != nil {
+		return nil, fmt.Errorf("deriving card master key: %w", err)
+	}
+
+	pin, err := bcd(profile.PIN)
+	if err != nil {
+		return nil, fmt.Errorf("encoding pin: %w", err)
+	}
+
+	records, err := profile.records()
+	if err != nil {
+		return nil, fmt.Errorf("creating records: %w", err)
+	}
+
+	return &Card{
+		profile:       profile,
+		aid:           aid,
+		masterKey:     masterKey,
+		records:       records,
+		pin:           pin,
+		atc:           profile.ATC,
+		lastOnlineATC: profile.ATC,
+		pinTriesLeft:  pinTries,
+	}, nil
+}
+
+// records returns the records of SFI 1, like in the applet. The first one
+// has the card data, the others the (empty) keys for dynamic data
+// authentication.
+func (p Profile) records() ([][]byte, error) {
+	pan, err := bcd(p.PAN)
+	if err != nil {
+		return nil, fmt.Errorf("encoding pan: %w", err)
+	}
+
+	panSequenceNumber, err := hex.DecodeString(p.PANSequenceNumber)
+	if err != nil {
+		return nil, fmt.Errorf("decoding pan sequence number: %w", err)
+	}
+
+	if len(p.ExpirationDate) != 4 {
+		return nil, fmt.Errorf("expiration date must be in MMYY format, got %q", p.ExpirationDate)
+	}
+
+	// the chip has the expiration date as YYMM
+	expirationDate, err := hex.DecodeString(p.ExpirationDate[2:] + p.ExpirationDate[:2])
+	if err != nil {
+		return nil, fmt.Errorf("decoding expiration date: %w", err)
+	}
+
+	cdol1, err := emv.CDOL1.Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("encoding cdol1: %w", err)
+	}
+
+	cdol2, err := emv.CDOL2.Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("encoding cdol2: %w", err)
+	}
+
+	templates := [][]bertlv.TLV{
+		{
+			bertlv.NewTag("8C", cdol1),
+			bertlv.NewTag("8D", cdol2),
+			bertlv.NewTag("5A", pan),
+			bertlv.NewTag("5F34", panSequenceNumber),
+			bertlv.NewTag("5F24", expirationDate),
+			bertlv.NewTag("5F20", []byte(p.CardholderName)),
+			// always plaintext PIN verified by the card
+			bertlv.NewTag("8E", []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00}),
+			bertlv.NewTag("9F55", []byte{0x01}),
+			bertlv.NewTag("9F56", []byte{0x00, 0x00, 0x7F, 0xFF, 0xFF, 0xE0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}),
+		},
+		{
+			bertlv.NewTag("8F", nil),
+			bertlv.NewTag("90", nil),
+			bertlv.NewTag("92", nil),
+			bertlv.NewTag("9F32", nil),
+		},
+		{
+			bertlv.NewTag("9F46", nil),
+			bertlv.NewTag("9F47", nil),
+			bertlv.NewTag("9F48", nil),
+			bertlv.NewTag("9F49", []byte{0x9F, 0x37, 0x04}),
+		},
+	}
+
+	var records [][]byte
+	for _, tags := range templates {
+		record, err := bertlv.Encode([]bertlv.TLV{bertlv.NewComposite("70", tags...)})
+		if err != nil {
+			return nil, fmt.Errorf("encoding record: %w", err)
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// SendAPDU handles the command and returns the response with the status word.
+func (c *Card) SendAPDU(command []byte) ([]byte, error) {
+	if len(command) < 4 {
+		return nil, fmt.Errorf("command must be at least 4 bytes, got %d", len(command))
+	}
+
+	ins, p1, p2 := command[1], command[2], command[3]
+
+	// the data of the command, if any, follows Lc
+	var data []byte
+	if len(command) > 5 {
+		lc := int(command[4])
+		if len(command) < 5+lc {
+			return respond(nil, swWrongLength), nil
+		}
+		data = command[5 : 5+lc]
+	}
+
+	switch ins {
+	case 0xA4:
+		return c.selectFile(data), nil
+	case 0xA8:
+		return c.getProcessingOptions(), nil
+	case 0xB2:
+		return c.readRecord(p1, p2), nil
+	case 0xCA:
+		return c.getData(p1, p2), nil
+	case 0x20:
+		return c.verify(p2, data), nil
+	case 0xAE:
+		return c.generateAC(p1, data)
+	}
+
+	return respond(nil, swINSNotSupported), nil
+}
+
+// Transmit is SendAPDU, for the terminal's card reader.
+func (c *Card) Transmit(command []byte) ([]byte, error) {
+	return c.SendAPDU(command)
+}
+
+// selectFile returns the FCI of the PPSE or of the application. Selecting
+// the application starts a new session and increments the ATC.
+func (c *Card) selectFile(name []byte) []byte {
+	switch {
+	case string(name) == ppse:
+		return c.encode(bertlv.NewComposite("6F",
+			bertlv.NewTag("84", []byte(ppse)),
+			bertlv.NewComposite("A5",
+				bertlv.NewComposite("BF0C",
+					bertlv.NewComposite("61",
+						bertlv.NewTag("4F", c.aid),
+						bertlv.NewTag("50", []byte(c.profile.Label)),
+						bertlv.NewTag("87", []byte{0x01}),
+					),
+				),
+			),
+		))
+	case bytes.Equal(name, c.aid):
+		c.startNewSession()
+
+		return c.encode(bertlv.NewComposite("6F",
+			bertlv.NewTag("84", c.aid),
+			bertlv.NewComposite("A5",
+				bertlv.NewTag("50", []byte(c.profile.Label)),
+				bertlv.NewTag("87", []byte{0x00}),
+				bertlv.NewTag("5F2D", []byte("en")),
+			),
+		))
+	}
+
+	return respond(nil, swFileNotFound)
+}
+
+func (c *Card) startNewSession() {
+	c.selected = true
+	c.firstAC = nil
+	c.secondAC = nil
+	c.sessionKey = nil
+	c.atc++
+}
+
+// getProcessingOptions returns the AIP and the AFL in format 1. Like the
+// applet, the card doesn't ask for a PDOL and ignores the data.
+func (c *Card) getProcessingOptions() []byte {
+	if !c.selected {
+		return respond(nil, swConditionsNotSatisfied)
+	}
+
+	return respond(append([]byte{0x80, 0x06}, append(aip, afl...)...), swSuccess)
+}
+
+// readRecord returns a record of SFI 1.
+func (c *Card) readRecord(recordNumber, p2 byte) []byte {
+	if p2 != 0x0C || recordNumber < 1 || int(recordNumber) > len(c.records) {
+		return respond(nil, swFileNotFound)
+	}
+
+	return respond(c.records[recordNumber-1], swSuccess)
+}
+
+// getData returns the ATC (9F36), the PIN try counter (9F17) or the last
+// online ATC (9F13).
+func (c *Card) getData(p1, p2 byte) []byte {
+	if p1 != 0x9F {
+		return respond(nil, swWrongP1P2)
+	}
+
+	tag := fmt.Sprintf("9F%02X", p2)
+
+	switch p2 {
+	case 0x36:
+		return c.encode(bertlv.NewTag(tag, binary.BigEndian.AppendUint16(nil, c.atc)))
+	case 0x17:
+		return c.encode(bertlv.NewTag(tag, []byte{c.pinTriesLeft}))
+	case 0x13:
+		return c.encode(bertlv.NewTag(tag, binary.BigEndian.AppendUint16(nil, c.lastOnlineATC)))
+	}
+
+	return respond(nil, swWrongP1P2)
+}
+
+// verify checks the plaintext PIN. Like the applet, the PIN digits are
+// expected packed in the first bytes of the data.
+func (c *Card) verify(p2 byte, data []byte) []byte {
+	if p2 != 0x80 {
+		return respond(nil, swWrongP1P2)
+	}
+
+	if c.pinTriesLeft == 0 {
+		return respond(nil, swPINBlocked)
+	}
+
+	if !bytes.HasPrefix(data, c.pin) {
+		c.pinTriesLeft--
+		return respond(nil, 0x63C0+uint16(c.pinTriesLeft))
+	}
+
+	c.pinTriesLeft = pinTries
+
+	return respond(nil, swSuccess)
+}
+
+// generateAC returns the application cryptogram of the requested type. The
+// first GENERATE AC must ask for an ARQC or a TC with the CDOL1 data, the
+// second one for a TC or an AAC with the CDOL2 data. CDA is not supported.
+func (c *Card) generateAC(p1 byte, data []byte) ([]byte, error) {
+	if p1&0x10 != 0 {
+		return respond(nil, swWrongP1P2), nil
+	}
+
+	cid := p1 & 0xC0
+
+	switch {
+	case c.firstAC == nil:
+		if cid == cryptogramRFU || cid == cryptogramAAC {
+			return respond(nil, swWrongP1P2), nil
+		}
+
+		if len(data) != emv.CDOL1.Length() {
+			return respond(nil, swWrongLength), nil
+		}
+
+		sessionKey, err := emv.DeriveSessionKey(c.masterKey, c.atcBytes())
+		if err != nil {
+			return nil, fmt.Errorf("deriving session key: %w", err)
+		}
+
+		c.sessionKey = sessionKey
+		c.firstAC = &cid
+
+		return c.cryptogram(cid, data)
+	case c.secondAC == nil:
+		if cid == cryptogramRFU || cid == cryptogramARQC {
+			return respond(nil, swWrongP1P2), nil
+		}
+
+		if len(data) != emv.CDOL2.Length() {
+			return respond(nil, swWrongLength), nil
+		}
+
+		if *c.firstAC == cryptogramARQC {
+			c.lastOnlineATC = c.atc
+		}
+
+		c.secondAC = &cid
+
+		// like in the applet, the cryptogram covers the CDOL2 data only and
+		// is computed with the session key of the first GENERATE AC
+		return c.cryptogram(cid, data)
+	}
+
+	// a third GENERATE AC
+	return respond(nil, swINSNotSupported), nil
+}
+
+// cryptogram returns the response of GENERATE AC in format 1: the CID, the
+// ATC, the cryptogram and the issuer application data, which is all zeros
+// like in the applet.
+func (c *Card) cryptogram(cid byte, cdolData []byte) ([]byte, error) {
+	atc := c.atcBytes()
+
+	ac, err := emv.ApplicationCryptogram(c.sessionKey, emv.CryptogramData(cdolData, aip, atc))
+	if err != nil {
+		return nil, fmt.Errorf("computing cryptogram: %w", err)
+	}
+
+	response := []byte{cid}
+	response = append(response, atc...)
+	response = append(response, ac...)
+	response = append(response, make([]byte, 18)...)
+
+	return respond(append([]byte{0x80, byte(len(response))}, response...), swSuccess), nil
+}
+
+func (c *Card) atcBytes() []byte {
+	return binary.BigEndian.AppendUint16(nil, c.atc)
+}
+
+// encode returns the successful response with the TLV.
+func (c *Card) encode(tlv bertlv.TLV) []byte {
+	data, err := bertlv.Encode([]bertlv.TLV{tlv})
+	if err != nil {
+		// the tags are built by the card, they always encode
+		panic(fmt.Sprintf("encoding response: %s", err))
+	}
+
+	return respond(data, swSuccess)
+}
+
+func respond(data []byte, sw uint16) []byte {
+	return binary.BigEndian.AppendUint16(append([]byte{}, data...), sw)
+}
+
+// bcd packs the digits in nibbles, padded with F to full bytes.
+func bcd(digits string) ([]byte, error) {
+	if len(digits)%2 != 0 {
+		digits += "F"
+	}
+
+	packed, err := hex.DecodeString(strings.ToUpper(digits))
+	if err != nil {
+		return nil, fmt.Errorf("packing digits %q: %w", digits, err)
+	}
+
+	return packed, nil
+}
@@ -0,0 +1,171 @@
+package emulator
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/moov-io/bertlv"
+	"github.com/moov-io/ftdc-from-tap-to-auth/issuer"
+	"github.com/moov-io/ftdc-from-tap-to-auth/issuer/models"
+	"github.com/moov-io/ftdc-from-tap-to-auth/terminal/kernel"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCardWithFTDCKernel(t *testing.T) {
+	card, err := New(DefaultProfile())
+	require.NoError(t, err)
+
+	k := kernel.NewFTDCKernel(kernel.NewCardReaderAdapter(card))
+
+	transaction, err := kernel.NewTransaction(10_00)
+	require.NoError(t, err)
+	require.NoError(t, k.Process(transaction))
+
+	for tag, value := range map[string]string{
+		"5A":   "7000000000000070",
+		"5F24": "3004",
+		"9F27": "80",
+		"9F36": "0001",
+	} {
+		tlv, found := bertlv.FindFirstTag(k.TagsDB, tag)
+		require.True(t, found, "tag %s", tag)
+		require.Equal(t, value, hex.EncodeToString(tlv.Value), "tag %s", tag)
+	}
+
+	// the issuer verifies the cryptogram of the card
+	payload, err := bertlv.Encode(bertlv.CopyTags(k.TagsDB,
+		"5A", "5F34", "82", "9F36", "9F26", "9F27",
+		"9F02", "9F03", "9F1A", "95", "5F2A", "9A", "9C", "9F37", "9F35", "9F45", "9F4C", "9F34",
+	))
+	require.NoError(t, err)
+
+	chipKeys, err := issuer.NewChipKeys(issuer.DefaultIssuerMasterKey)
+	require.NoError(t, err)
+
+	verification := chipKeys.VerifyARQC(payload, true)
+	require.Equal(t, models.VerificationResultMatch, verification.Result, verification.Reason)
+
+	issuerAuthenticationData, err := verification.IssuerAuthenticationData("00")
+	require.NoError(t, err)
+
+	approved, err := k.CompleteTransaction(kernel.OnlineResponse{
+		Approved:                 true,
+		ResponseCode:             "00",
+		IssuerAuthenticationData: issuerAuthenticationData,
+	})
+	require.NoError(t, err)
+	require.True(t, approved)
+
+	// the online transaction is completed
+	require.Equal(t, "9f13020001", hex.EncodeToString(command(t, card, "80CA9F1300")[:5]))
+
+	// no third cryptogram
+	requireSW(t, "6D00", command(t, card, "80AE4000"+"1D"+hex.EncodeToString(make([]byte, 0x1D))))
+
+	// the next transaction has a new ATC and so a new cryptogram
+	next := kernel.NewFTDCKernel(kernel.NewCardReaderAdapter(card))
+	require.NoError(t, next.Process(transaction))
+
+	atc, found := bertlv.FindFirstTag(next.TagsDB, "9F36")
+	require.True(t, found)
+	require.Equal(t, []byte{0x00, 0x02}, atc.Value)
+}
+
+func TestCardCommands(t *testing.T) {
+	card, err := New(DefaultProfile())
+	require.NoError(t, err)
+
+	// the card doesn't process options before an application is selected
+	requireSW(t, "6985", command(t, card, "80A80000028300"))
+
+	response := command(t, card, "00A404000E325041592E5359532E444446303100")
+	requireSW(t, "9000", response)
+	tlvs, err := bertlv.Decode(response[:len(response)-2])
+	require.NoError(t, err)
+	aid, found := bertlv.FindFirstTag(tlvs, "4F")
+	require.True(t, found)
+	require.Equal(t, "a000000002030405", hex.EncodeToString(aid.Value))
+
+	requireSW(t, "6A82", command(t, card, "00A4040007A000000003101000"))
+	requireSW(t, "9000", command(t, card, "00A4040008A00000000203040500"))
+	require.Equal(t, "800658000801030190", hex.EncodeToString(command(t, card, "80A8000002830000"))[:18])
+
+	requireSW(t, "9000", command(t, card, "00B2030C00"))
+	requireSW(t, "6A82", command(t, card, "00B2040C00"))
+
+	require.Equal(t, "9f3602000190", hex.EncodeToString(command(t, card, "80CA9F3600"))[:12])
+	requireSW(t, "6B00", command(t, card, "80CA9F4F00"))
+
+	// the PIN is blocked after three wrong tries
+	requireSW(t, "6B00", command(t, card, "0020000002048300"))
+	requireSW(t, "63C2", command(t, card, "0020008002123400"))
+	requireSW(t, "9000", command(t, card, "0020008002048300"))
+	requireSW(t, "63C2", command(t, card, "0020008002123400"))
+	requireSW(t, "63C1", command(t, card, "0020008002123400"))
+	requireSW(t, "63C0", command(t, card, "0020008002123400"))
+	requireSW(t, "6983", command(t, card, "0020008002048300"))
+	require.Equal(t, "9f1701009000", hex.EncodeToString(command(t, card, "80CA9F1700")))
+
+	// the first cryptogram must be an ARQC or a TC with the CDOL1 data
+	cdol1Data := hex.EncodeToString(make([]byte, 0x2B))
+	requireSW(t, "6B00", command(t, card, "80AE0000"+"2B"+cdol1Data))
+	requireSW(t, "6B00", command(t, card, "80AE9000"+"2B"+cdol1Data))
+	requireSW(t, "6700", command(t, card, "80AE8000"+"02"+"0000"))
+
+	requireSW(t, "6D00", command(t, card, "80840000"))
+}
+
+// The cryptograms are the ones the applet computes for the data when it's
+// personalized with the key of the default profile (858520F816B00B02
+// 3892DF75E6D96DA2, see TestDeriveICCMasterKey in internal/emv), computed with
+// openssl like in internal/emv and not with the code of the emulator.
+func TestCardCryptogramsOfTheApplet(t *testing.T) {
+	card, err := New(DefaultProfile())
+	require.NoError(t, err)
+
+	requireSW(t, "9000", command(t, card, "00A4040008A00000000203040500"))
+	requireSW(t, "9000", command(t, card, "80A8000002830000"))
+
+	// the ARQC of ATC 0001 over the CDOL1 data, the AIP, the ATC and 80 00 00
+	cdol1Data := "00000000100000000000000008400000000000084026101700A1B2C3D42200000000000000000000420300"
+	response := command(t, card, "80AE8000"+"2B"+cdol1Data+"00")
+	require.Equal(t, "801D"+"80"+"0001"+"D38D7CF598607C82"+strings.Repeat("00", 18)+"9000", fmt.Sprintf("%X", response))
+
+	// the TC over the CDOL2 data only, with the session key of the ARQC
+	cdol2Data := "1122334455667788303030300000000000A1B2C3D40000000000000000"
+	response = command(t, card, "80AE4000"+"1D"+cdol2Data+"00")
+	require.Equal(t, "801D"+"40"+"0001"+"4A3A43BB2C1F7E2C"+strings.Repeat("00", 18)+"9000", fmt.Sprintf("%X", response))
+}
+
+func TestLoadProfile(t *testing.T) {
+	profile, err := LoadProfile(filepath.Join("..", "..", "configs", "card.yaml"))
+	require.NoError(t, err)
+
+	_, err = New(profile)
+	require.NoError(t, err)
+
+	// the fields missing in the file keep the defaults
+	require.Equal(t, DefaultProfile().AID, profile.AID)
+}
+
+func command(t *testing.T, card *Card, apdu string) []byte {
+	t.Helper()
+
+	raw, err := hex.DecodeString(apdu)
+	require.NoError(t, err)
+
+	response, err := card.SendAPDU(raw)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, len(response), 2)
+
+	return response
+}
+
+func requireSW(t *testing.T, sw string, response []byte) {
+	t.Helper()
+
+	require.Equal(t, sw, fmt.Sprintf("%X", response[len(response)-2:]), "status word of %X", response)
+}
@@ -0,0 +1,61 @@
+package emulator
+
+import (
+	"fmt"
+
+	"github.com/moov-io/ftdc-from-tap-to-auth/internal/config"
+)
+
+// Profile is the card data the emulator is personalized with, like
+// cardpersonalizer does for the physical FTDC cards.
+type Profile struct {
+	// AID of the payment application, hex encoded
+	AID string `yaml:"aid"`
+
+	// Label of the application shown by the terminal
+	Label string `yaml:"label"`
+
+	PAN               string `yaml:"pan"`
+	PANSequenceNumber string `yaml:"pan_sequence_number"` // two digits, e.g. "01"
+	ExpirationDate    string `yaml:"expiration_date"`     // MMYY, like the cards of the issuer
+	CardholderName    string `yaml:"cardholder_name"`
+
+	// PIN checked by VERIFY
+	PIN string `yaml:"pin"`
+
+	// ATC is the application transaction counter of the last transaction,
+	// the card increments it when the application is selected
+	ATC uint16 `yaml:"atc"`
+
+	// IssuerMasterKey is the hex encoded key of the issuer the card master
+	// key is derived from, it must match issuer_master_key of the issuer
+	IssuerMasterKey string `yaml:"issuer_master_key"`
+}
+
+// DefaultProfile returns the data of the applet in
+// javacard/src/openemv/EMVStaticData.java and the default key of the issuer.
+func DefaultProfile() Profile {
+	return Profile{
+		AID:               "A000000002030405",
+		Label:             "FINTECH DEVCON",
+		PAN:               "7000000000000070",
+		PANSequenceNumber: "01",
+		ExpirationDate:    "0430",
+		CardholderName:    "David Wade Arnold",
+		PIN:               "0483",
+		IssuerMasterKey:   "0123456789ABCDEFFEDCBA9876543210",
+	}
+}
+
+// LoadProfile reads the YAML profile from the file. Fields missing in the
+// file keep the values of DefaultProfile.
+func LoadProfile(path string) (Profile, error) {
+	profile := DefaultProfile()
+
+	err := config.NewFromFile(path, &profile)
+	if err != nil {
+		return Profile{}, fmt.Errorf("loading card profile: %w", err)
+	}
+
+	return profile, nil
+}
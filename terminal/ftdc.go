@@ -9,32 +9,35 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/moov-io/bertlv"
 	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer/client"
 	"github.com/moov-io/ftdc-from-tap-to-auth/acquirer/models"
 	"github.com/moov-io/ftdc-from-tap-to-auth/printer"
+	"github.com/moov-io/ftdc-from-tap-to-auth/terminal/apdutrace"
+	"github.com/moov-io/ftdc-from-tap-to-auth/terminal/emulator"
 	"github.com/moov-io/ftdc-from-tap-to-auth/terminal/kernel"
 )
 
 type Terminal struct {
 	config *Config
+
+	// kernels are the kernels of the card applications the terminal
+	// accepts
+	kernels *kernel.Registry
 }
 
 func NewTerminal(cfg *Config) (*Terminal, error) {
 	return &Terminal{
-		config: cfg,
+		config:  cfg,
+		kernels: kernel.DefaultRegistry(),
 	}, nil
 }
 
+// Run processes a payment with the card: the application picked from the
+// card's PPSE is processed by its kernel, the payment is authorized with the
+// acquirer and the issuer's response goes back to the card.
 func (t *Terminal) Run() error {
-	if t.config.Kernel != "universal" {
-		return t.RunFTDCKernel()
-	}
-
-	return t.RunUniversalKernel()
-}
-
-func (t *Terminal) RunFTDCKernel() error {
 	fmt.Println("📱FTDC Terminal is running...")
 
 	amount, err := t.promptForAmount()
@@ -46,25 +49,60 @@ func (t *Terminal) RunFTDCKernel() error {
 	if err != nil {
 		return fmt.Errorf("reading card: %w", err)
 	}
+	defer cardReader.Close()
 
-	k := kernel.NewFTDCKernel(kernel.NewCardReaderAdapter(cardReader))
+	transaction, err := kernel.NewTransaction(amount)
+	if err != nil {
+		return fmt.Errorf("creating transaction: %w", err)
+	}
 
-	err = k.Process()
+	outcome, err := t.kernels.Process(kernel.NewCardReaderAdapter(cardReader), transaction)
 	if err != nil {
 		return fmt.Errorf("processing kernel: %w", err)
 	}
 
 	fmt.Println("*********************************************")
 	fmt.Println("EMV Tags read from card")
-	bertlv.PrettyPrint(k.TagsDB)
+	bertlv.PrettyPrint(outcome.Tags)
 	fmt.Println("*********************************************")
 
 	// Send payment request to the acquirer
-	err = t.createPayment(amount, k.TagsDB)
+	payment, err := t.createPayment(amount, outcome.Tags)
 	if err != nil {
+		// the card declines the transaction it got no response for
+		if _, completeErr := outcome.Complete(kernel.OnlineResponse{}); completeErr != nil {
+			fmt.Println("Failed to complete transaction with card:", completeErr)
+		}
+
 		return fmt.Errorf("creating payment: %w", err)
 	}
 
+	// pass the issuer's response to the card, which makes the final decision
+	approved, err := outcome.Complete(kernel.OnlineResponse{
+		Approved:                 payment.Status == models.PaymentStatusAuthorized,
+		ResponseCode:             payment.ResponseCode,
+		IssuerAuthenticationData: payment.IssuerAuthenticationData,
+	})
+	if err != nil {
+		return fmt.Errorf("completing transaction with card: %w", err)
+	}
+
+	if payment.Status == models.PaymentStatusAuthorized && !approved {
+		fmt.Println("Card declined the transaction the issuer approved, voiding payment...")
+
+		payment, err = client.New(t.config.AcquirerURL).VoidPayment(t.config.MerchantID, payment.ID)
+		if err != nil {
+			return fmt.Errorf("voiding payment: %w", err)
+		}
+
+		fmt.Printf("Payment voided: ID=%s, Status=%s\n", payment.ID, payment.Status)
+	}
+
+	err = t.printReceipt(payment, outcome.Tags)
+	if err != nil {
+		return fmt.Errorf("printing receipt: %w", err)
+	}
+
 	return nil
 }
 
@@ -89,7 +127,56 @@ func (t *Terminal) promptForAmount() (int64, error) {
 	return amount, nil
 }
 
+// cardReaderWithCard returns the reader with the card to process: a replayed
+// APDU trace, the emulated card or the card tapped on the NFC reader. The
+// APDUs are recorded when a trace file is configured.
 func (t *Terminal) cardReaderWithCard() (*CardReader, error) {
+	cardReader, err := t.connectCard()
+	if err != nil {
+		return nil, err
+	}
+
+	if t.config.APDUTrace != "" {
+		err = cardReader.RecordTrace(t.config.APDUTrace)
+		if err != nil {
+			cardReader.Close()
+			return nil, fmt.Errorf("recording APDU trace: %w", err)
+		}
+
+		fmt.Println("Recording APDU trace to", t.config.APDUTrace)
+	}
+
+	return cardReader, nil
+}
+
+func (t *Terminal) connectCard() (*CardReader, error) {
+	if t.config.ReplayTrace != "" {
+		replayer, err := apdutrace.Open(t.config.ReplayTrace)
+		if err != nil {
+			return nil, fmt.Errorf("loading APDU trace: %w", err)
+		}
+
+		fmt.Println("Replaying APDU trace:", t.config.ReplayTrace)
+
+		return NewEmulatedCardReader(replayer), nil
+	}
+
+	if t.config.CardProfile != "" {
+		profile, err := emulator.LoadProfile(t.config.CardProfile)
+		if err != nil {
+			return nil, fmt.Errorf("loading card profile: %w", err)
+		}
+
+		card, err := emulator.New(profile)
+		if err != nil {
+			return nil, fmt.Errorf("creating emulated card: %w", err)
+		}
+
+		fmt.Println("Using emulated card:", profile.PAN)
+
+		return NewEmulatedCardReader(card), nil
+	}
+
 	cardReader, err := NewCardReader()
 	if err != nil {
 		return nil, fmt.Errorf("creating card reader: %w", err)
@@ -132,33 +219,63 @@ const (
 	appLabelTag       = "50"
 )
 
-func (t *Terminal) createPayment(amount int64, tags []bertlv.TLV) error {
+// cryptogramTags are the tags the issuer verifies the application
+// cryptogram with: the cryptogram, its type and the counter, the card data
+// and the terminal data of CDOL1 it was computed over
+var cryptogramTags = []string{
+	"9F26", // Application Cryptogram
+	"9F27", // Cryptogram Information Data
+	"9F36", // Application Transaction Counter
+	"9F10", // Issuer Application Data
+	"82",   // Application Interchange Profile
+	"5F34", // PAN Sequence Number
+	"9F02", // Amount, Authorized
+	"9F03", // Amount, Other
+	"9F1A", // Terminal Country Code
+	"95",   // Terminal Verification Results
+	"5F2A", // Transaction Currency Code
+	"9A",   // Transaction Date
+	"9C",   // Transaction Type
+	"9F37", // Unpredictable Number
+	"9F35", // Terminal Type
+	"9F45", // Data Authentication Code
+	"9F4C", // ICC Dynamic Number
+	"9F34", // CVM Results
+}
+
+func (t *Terminal) createPayment(amount int64, tags []bertlv.TLV) (models.Payment, error) {
 	fmt.Println("Sending payment request to acquirer...")
 
-	paymentTags := bertlv.CopyTags(tags, []string{
+	paymentTags := bertlv.CopyTags(tags, append([]string{
 		panTag,
 		expDateTag,
 		cardHolderNameTag,
 		appIDTag,
 		appLabelTag,
-	}...)
+	}, cryptogramTags...)...)
 
 	emvPayload, err := bertlv.Encode(paymentTags)
 	if err != nil {
-		return fmt.Errorf("encoding EMV payload: %w", err)
+		return models.Payment{}, fmt.Errorf("encoding EMV payload: %w", err)
 	}
 
+	// the key lets the client retry the request without charging the card
+	// twice
+	idempotencyKey := uuid.New().String()
+
 	merchant := client.New(t.config.AcquirerURL)
-	payment, err := merchant.CreatePayment(
+	payment, err := merchant.CreatePaymentWithIdempotencyKey(
 		t.config.MerchantID,
+		idempotencyKey,
 		models.CreatePayment{
-			Amount:     amount,
-			Currency:   "USD",
-			EMVPayload: emvPayload,
+			Amount:          amount,
+			Currency:        "USD",
+			EMVPayload:      emvPayload,
+			PartialApproval: t.config.PartialApproval,
 		},
 	)
 	if err != nil {
-		return fmt.Errorf("creating payment: %w", err)
+		return models.Payment{}, fmt.Errorf("creating payment with idempotency key %s: %w", idempotencyKey, err)
 	}
 
 	fmt.Printf("Payment created successfully: ID=%s, Status=%s, Authorization Code=%s\n",
@@ -167,12 +284,15 @@ func (t *Terminal) createPayment(amount int64, tags []bertlv.TLV) error {
 		payment.AuthorizationCode,
 	)
 
-	err = t.printReceipt(payment, tags)
-	if err != nil {
-		return fmt.Errorf("printing receipt: %w", err)
+	if balanceDue := payment.BalanceDue(); balanceDue > 0 {
+		fmt.Printf("Partially approved: %d of %d cents, remaining balance due: %d cents\n",
+			payment.Amount,
+			payment.RequestedAmount,
+			balanceDue,
+		)
 	}
 
-	return nil
+	return payment, nil
 }
 
 func (t *Terminal) printReceipt(payment models.Payment, tags []bertlv.TLV) error {
@@ -29,3 +29,43 @@ func NewReadRecordCommand(recordNumber byte, sfi byte) APDUCommand {
 		Le:  ptrByte(0),        // Return all available data
 	}
 }
+
+// GET PROCESSING OPTIONS command - starts the transaction on the card
+// The data is the PDOL data in the command template (tag 83), the card
+// answers with the AIP and the AFL (the records the terminal has to read)
+func NewGetProcessingOptionsCommand(pdolData []byte) APDUCommand {
+	data := append([]byte{0x83, byte(len(pdolData))}, pdolData...)
+
+	return APDUCommand{
+		CLA:  0x80,       // Proprietary class
+		INS:  0xA8,       // GET PROCESSING OPTIONS instruction
+		P1:   0x00,       // Always 0
+		P2:   0x00,       // Always 0
+		Data: data,       // Command template with the PDOL data
+		Le:   ptrByte(0), // Return all available data
+	}
+}
+
+// Cryptogram types the terminal requests in GENERATE AC (reference control
+// parameter in P1). The card answers with the same or a "lower" type, its
+// choice is in the Cryptogram Information Data (tag 9F27).
+const (
+	CryptogramAAC  byte = 0x00 // Application Authentication Cryptogram, decline
+	CryptogramTC   byte = 0x40 // Transaction Certificate, approve offline
+	CryptogramARQC byte = 0x80 // Authorization Request Cryptogram, go online
+)
+
+// GENERATE APPLICATION CRYPTOGRAM command - asks the card for a cryptogram
+// over the CDOL data (amount, currency, unpredictable number, ...)
+// The first one requests an ARQC for the issuer, the second one, after the
+// online response, a TC or an AAC
+func NewGenerateACCommand(cryptogramType byte, cdolData []byte) APDUCommand {
+	return APDUCommand{
+		CLA:  0x80,           // Proprietary class
+		INS:  0xAE,           // GENERATE AC instruction
+		P1:   cryptogramType, // Type of the cryptogram, no CDA signature
+		P2:   0x00,           // Always 0
+		Data: cdolData,       // The data the card asked for in CDOL1 or CDOL2
+		Le:   ptrByte(0),     // Return all available data
+	}
+}
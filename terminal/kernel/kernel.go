@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/moov-io/bertlv"
+	"github.com/moov-io/ftdc-from-tap-to-auth/terminal/paycard"
 )
 
 // FTDCKernel is the main kernel for processing payment cards
@@ -20,13 +21,70 @@ func NewFTDCKernel(reader CardReader) *FTDCKernel {
 	}
 }
 
-func (kt *FTDCKernel) Process() error {
-	err := kt.SelectApplication(ftdcApplicationID)
+// OnlineResponse is the issuer's response to the authorization request the
+// terminal passes to the card in the second GENERATE AC
+type OnlineResponse struct {
+	Approved bool
+
+	// ResponseCode is sent to the card as the authorization response code
+	// (tag 8A) when the issuer authentication data doesn't have it. It's
+	// empty when the terminal couldn't reach the issuer.
+	ResponseCode string
+
+	// IssuerAuthenticationData is the EMV data of the response with the
+	// ARPC (tags 91 and 8A)
+	IssuerAuthenticationData []byte
+}
+
+// unableToGoOnline is the authorization response code the terminal gives the
+// card when it got no response from the issuer
+const unableToGoOnline = "Z3"
+
+// Process runs the card's part of the transaction up to the authorization:
+// it selects the application, gets the processing options, reads the records
+// of the AFL and asks the card for the ARQC. The cryptogram, the ATC and the
+// CID are put into TagsDB with the card data and the terminal data the card
+// computed the cryptogram over.
+func (kt *FTDCKernel) Process(transaction Transaction) error {
+	err := kt.readApplication(transaction)
+	if err != nil {
+		return err
+	}
+
+	err = kt.generateFirstAC()
+	if err != nil {
+		return fmt.Errorf("generating first application cryptogram: %w", err)
+	}
+
+	return nil
+}
+
+// readApplication selects the application of the transaction (the FTDC
+// application if none), gets the processing options and reads the records
+// of the AFL.
+func (kt *FTDCKernel) readApplication(transaction Transaction) error {
+	terminalData, err := transaction.terminalData()
+	if err != nil {
+		return fmt.Errorf("building terminal data: %w", err)
+	}
+	kt.TagsDB = append(kt.TagsDB, terminalData...)
+
+	aid := transaction.AID
+	if aid == nil {
+		aid = ftdcApplicationID
+	}
+
+	err = kt.SelectApplication(aid)
 	if err != nil {
-		return fmt.Errorf("selecting default application: %w", err)
+		return fmt.Errorf("selecting application: %w", err)
 	}
 
-	err = kt.readRecords()
+	afl, err := kt.getProcessingOptions()
+	if err != nil {
+		return fmt.Errorf("getting processing options: %w", err)
+	}
+
+	err = kt.readRecords(afl)
 	if err != nil {
 		return fmt.Errorf("reading records: %w", err)
 	}
@@ -34,6 +92,50 @@ func (kt *FTDCKernel) Process() error {
 	return nil
 }
 
+// CompleteTransaction passes the issuer's response to the card in the second
+// GENERATE AC. The terminal asks for a TC when the issuer approved the
+// transaction and for an AAC otherwise; the card may still decline, e.g.
+// when the ARPC doesn't prove the response came from its issuer. It returns
+// true when the card approved the transaction.
+func (k *FTDCKernel) CompleteTransaction(response OnlineResponse) (bool, error) {
+	if len(response.IssuerAuthenticationData) > 0 {
+		tlvs, err := bertlv.Decode(response.IssuerAuthenticationData)
+		if err != nil {
+			return false, fmt.Errorf("decoding issuer authentication data: %w", err)
+		}
+
+		for _, tlv := range tlvs {
+			k.setTag(tlv)
+		}
+	}
+
+	if _, found := bertlv.FindFirstTag(k.TagsDB, "8A"); !found {
+		arc := response.ResponseCode
+		if arc == "" {
+			arc = unableToGoOnline
+		}
+
+		k.setTag(bertlv.NewTag("8A", []byte(arc)))
+	}
+
+	cdol2, found := bertlv.FindFirstTag(k.TagsDB, "8D")
+	if !found {
+		return false, fmt.Errorf("CDOL2 (8D) not found in card data")
+	}
+
+	cryptogramType := CryptogramAAC
+	if response.Approved {
+		cryptogramType = CryptogramTC
+	}
+
+	cid, err := k.generateAC(cryptogramType, cdol2.Value)
+	if err != nil {
+		return false, fmt.Errorf("generating second application cryptogram: %w", err)
+	}
+
+	return cid == CryptogramTC, nil
+}
+
 // SelectApplication selects a specific application by its AID
 // This is the core EMV command that "opens" a payment application on the card
 // For FTDC cards, we don't parse the FCI response as it's not ... ready
@@ -68,6 +170,12 @@ func (k *FTDCKernel) SelectApplication(aid []byte) error {
 		k.TagsDB = append(k.TagsDB, appLabel)
 	}
 
+	// the data the card wants in GET PROCESSING OPTIONS, if any
+	pdol, found := bertlv.FindFirstTag(fciTemplate, "9F38")
+	if found {
+		k.TagsDB = append(k.TagsDB, pdol)
+	}
+
 	fmt.Printf("✅ Application %X - %s selected successfully\n", appID.Value, appLabel.Value)
 	fmt.Printf("✅ FCI response received for selected application\n")
 	bertlv.PrettyPrint(fciTemplate)
@@ -75,11 +183,87 @@ func (k *FTDCKernel) SelectApplication(aid []byte) error {
 	return nil
 }
 
-// readRecords reads the cardholder data records (PAN, name, expiration date)
-func (k *FTDCKernel) readRecords() error {
+// getProcessingOptions starts the transaction on the card and returns the
+// AFL, the list of the records to read. The card answers in format 1 (tag 80
+// with the AIP and the AFL) or format 2 (tag 77 with tags 82 and 94).
+func (k *FTDCKernel) getProcessingOptions() ([]byte, error) {
+	var pdolData []byte
+	if pdol, found := bertlv.FindFirstTag(k.TagsDB, "9F38"); found {
+		data, err := k.dolData(pdol.Value)
+		if err != nil {
+			return nil, fmt.Errorf("building PDOL data: %w", err)
+		}
+		pdolData = data
+	}
+
+	resp, err := k.reader.SendAPDU(NewGetProcessingOptionsCommand(pdolData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send GET PROCESSING OPTIONS command: %w", err)
+	}
+
+	if !resp.IsSuccess() {
+		return nil, fmt.Errorf("GET PROCESSING OPTIONS command failed: %w", resp.Error())
+	}
+
+	tlvs, err := bertlv.Decode(resp.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode GET PROCESSING OPTIONS response: %w", err)
+	}
+
+	if format1, found := bertlv.FindFirstTag(tlvs, "80"); found {
+		if len(format1.Value) < 2 {
+			return nil, fmt.Errorf("GET PROCESSING OPTIONS response is too short: %X", format1.Value)
+		}
+
+		tlvs = []bertlv.TLV{
+			bertlv.NewTag("82", format1.Value[:2]),
+			bertlv.NewTag("94", format1.Value[2:]),
+		}
+	} else if format2, found := bertlv.FindFirstTag(tlvs, "77"); found {
+		tlvs = format2.TLVs
+	} else {
+		return nil, fmt.Errorf("response template (80 or 77) not found in GET PROCESSING OPTIONS response")
+	}
+
+	for _, tlv := range tlvs {
+		k.setTag(tlv)
+	}
+
+	fmt.Printf("✅ GET PROCESSING OPTIONS successful\n")
+	bertlv.PrettyPrint(tlvs)
+
+	afl, found := bertlv.FindFirstTag(tlvs, "94")
+	if !found || len(afl.Value)%4 != 0 {
+		return nil, fmt.Errorf("invalid application file locator (94): %X", afl.Value)
+	}
+
+	return afl.Value, nil
+}
+
+// readRecords reads the records of the AFL with the cardholder data (PAN,
+// name, expiration date) and the CDOLs. Each 4 byte entry of the AFL is the
+// SFI, the first and the last record, and the number of records for offline
+// data authentication.
+func (k *FTDCKernel) readRecords(afl []byte) error {
+	for i := 0; i < len(afl); i += 4 {
+		sfi := afl[i] >> 3
+		first, last := int(afl[i+1]), int(afl[i+2])
+
+		for record := first; record <= last; record++ {
+			err := k.readRecord(byte(record), sfi)
+			if err != nil {
+				return fmt.Errorf("reading record %d of SFI %d: %w", record, sfi, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (k *FTDCKernel) readRecord(recordNumber, sfi byte) error {
 
 	// Create READ RECORD command
-	readCmd := NewReadRecordCommand(1, 1)
+	readCmd := NewReadRecordCommand(recordNumber, sfi)
 
 	// Send command to card
 	resp, err := k.reader.SendAPDU(readCmd)
@@ -97,7 +281,7 @@ func (k *FTDCKernel) readRecords() error {
 	if err != nil {
 		return fmt.Errorf("failed to decode READ RECORD response: %w", err)
 	}
-	fmt.Printf("✅ READ RECORD successful\n")
+	fmt.Printf("✅ READ RECORD %d of SFI %d successful\n", recordNumber, sfi)
 	bertlv.PrettyPrint(tlvs)
 
 	responseMessageTemplate, found := bertlv.FindFirstTag(tlvs, "70")
@@ -111,3 +295,127 @@ func (k *FTDCKernel) readRecords() error {
 	// Process the response based on template type
 	return nil
 }
+
+// generateFirstAC asks the card for the ARQC over the CDOL1 data, so the
+// issuer can authorize the transaction online
+func (k *FTDCKernel) generateFirstAC() error {
+	cdol1, found := bertlv.FindFirstTag(k.TagsDB, "8C")
+	if !found {
+		return fmt.Errorf("CDOL1 (8C) not found in card data")
+	}
+
+	cid, err := k.generateAC(CryptogramARQC, cdol1.Value)
+	if err != nil {
+		return err
+	}
+
+	if cid == CryptogramAAC {
+		return fmt.Errorf("card declined the transaction")
+	}
+
+	return nil
+}
+
+// generateAC sends GENERATE AC with the data of the DOL and puts the
+// cryptogram (9F26), the ATC (9F36), the CID (9F27) and the issuer
+// application data (9F10) of the response into TagsDB. It returns the type
+// of the cryptogram the card generated.
+func (k *FTDCKernel) generateAC(cryptogramType byte, dol []byte) (byte, error) {
+	cdolData, err := k.dolData(dol)
+	if err != nil {
+		return 0, fmt.Errorf("building CDOL data: %w", err)
+	}
+
+	resp, err := k.reader.SendAPDU(NewGenerateACCommand(cryptogramType, cdolData))
+	if err != nil {
+		return 0, fmt.Errorf("failed to send GENERATE AC command: %w", err)
+	}
+
+	if !resp.IsSuccess() {
+		return 0, fmt.Errorf("GENERATE AC command failed: %w", resp.Error())
+	}
+
+	tlvs, err := bertlv.Decode(resp.Data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode GENERATE AC response: %w", err)
+	}
+
+	// format 1 is CID (1), ATC (2), cryptogram (8) and the optional
+	// issuer application data
+	if format1, found := bertlv.FindFirstTag(tlvs, "80"); found {
+		if len(format1.Value) < 11 {
+			return 0, fmt.Errorf("GENERATE AC response is too short: %X", format1.Value)
+		}
+
+		tlvs = []bertlv.TLV{
+			bertlv.NewTag("9F27", format1.Value[:1]),
+			bertlv.NewTag("9F36", format1.Value[1:3]),
+			bertlv.NewTag("9F26", format1.Value[3:11]),
+		}
+
+		if len(format1.Value) > 11 {
+			tlvs = append(tlvs, bertlv.NewTag("9F10", format1.Value[11:]))
+		}
+	} else if format2, found := bertlv.FindFirstTag(tlvs, "77"); found {
+		tlvs = format2.TLVs
+	} else {
+		return 0, fmt.Errorf("response template (80 or 77) not found in GENERATE AC response")
+	}
+
+	cid, found := bertlv.FindFirstTag(tlvs, "9F27")
+	if !found || len(cid.Value) != 1 {
+		return 0, fmt.Errorf("cryptogram information data (9F27) not found in GENERATE AC response")
+	}
+
+	for _, tlv := range tlvs {
+		k.setTag(tlv)
+	}
+
+	fmt.Printf("✅ GENERATE AC successful\n")
+	bertlv.PrettyPrint(tlvs)
+
+	// the upper two bits are the type of the cryptogram
+	return cid.Value[0] & 0xC0, nil
+}
+
+// dolData returns the values of the tags of the DOL from TagsDB in the order
+// of the list, as in EMV Book 3, Section 5.4: values are padded with zeros or
+// truncated to the length in the list, and tags the terminal doesn't have
+// are zeros. The tags the terminal didn't have are added to TagsDB with the
+// value sent, so the issuer gets the data the card computed the cryptogram
+// over.
+func (k *FTDCKernel) dolData(dol []byte) ([]byte, error) {
+	entries, err := paycard.ParseDOL(dol)
+	if err != nil {
+		return nil, fmt.Errorf("parsing DOL: %w", err)
+	}
+
+	var data []byte
+	for _, entry := range entries {
+		value := make([]byte, entry.Length)
+
+		tlv, found := bertlv.FindFirstTag(k.TagsDB, entry.Tag)
+		if found {
+			copy(value, tlv.Value)
+		} else {
+			k.TagsDB = append(k.TagsDB, bertlv.NewTag(entry.Tag, value))
+		}
+
+		data = append(data, value...)
+	}
+
+	return data, nil
+}
+
+// setTag puts the data object into TagsDB, replacing the value of the tag
+// if it's there already
+func (k *FTDCKernel) setTag(tlv bertlv.TLV) {
+	for i := range k.TagsDB {
+		if k.TagsDB[i].Tag == tlv.Tag {
+			k.TagsDB[i] = tlv
+			return
+		}
+	}
+
+	k.TagsDB = append(k.TagsDB, tlv)
+}
@@ -0,0 +1,121 @@
+package kernel
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/moov-io/bertlv"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedCard answers the commands of the kernel the way the FTDC applet
+// (javacard/src/openemv/SimpleEMVApplet.java) does and keeps the commands
+type scriptedCard struct {
+	t        *testing.T
+	commands []APDUCommand
+}
+
+func (c *scriptedCard) SendAPDU(command APDUCommand) (APDUResponse, error) {
+	c.commands = append(c.commands, command)
+
+	respond := func(data string) (APDUResponse, error) {
+		raw, err := hex.DecodeString(data)
+		require.NoError(c.t, err)
+
+		return APDUResponse{Data: raw, SW1: 0x90, SW2: 0x00}, nil
+	}
+
+	switch command.INS {
+	case 0xA4: // SELECT
+		return respond("6F1A8408A000000002030405A50E500C46494E544543482044455643")
+	case 0xA8: // GET PROCESSING OPTIONS: AIP 5800, AFL SFI 1 records 1-2
+		return respond("8006580008010200")
+	case 0xB2: // READ RECORD
+		if command.P1 == 1 {
+			return respond("7040" +
+				"8C219F02069F03069F1A0295055F2A029A039C019F37049F35019F45029F4C089F3403" +
+				"8D0C910A8A0295059F37049F4C08" +
+				"5A0870000000000000705F24023004")
+		}
+		return respond("70045F340101")
+	case 0xAE: // GENERATE AC: format 1 with the requested type, ATC 0001
+		return respond("800B" + hex.EncodeToString([]byte{command.P1}) + "0001" + "1122334455667788")
+	}
+
+	return APDUResponse{SW1: 0x6D, SW2: 0x00}, nil
+}
+
+func TestFTDCKernel(t *testing.T) {
+	card := &scriptedCard{t: t}
+	k := NewFTDCKernel(card)
+
+	transaction, err := NewTransaction(10_00)
+	require.NoError(t, err)
+
+	require.NoError(t, k.Process(transaction))
+
+	// SELECT, GPO, two records of the AFL and the first GENERATE AC
+	require.Len(t, card.commands, 5)
+	require.Equal(t, []byte{0x83, 0x00}, card.commands[1].Data)
+	require.Equal(t, byte(0x0C), card.commands[2].P2)
+	require.Equal(t, byte(2), card.commands[3].P1)
+
+	generateAC := card.commands[4]
+	require.Equal(t, CryptogramARQC, generateAC.P1)
+	require.Len(t, generateAC.Data, 0x2B)
+
+	// the amount and the unpredictable number are where CDOL1 wants them
+	require.Equal(t, []byte{0x00, 0x00, 0x00, 0x00, 0x10, 0x00}, generateAC.Data[:6])
+	require.Equal(t, transaction.UnpredictableNumber, generateAC.Data[25:29])
+
+	for tag, value := range map[string]string{
+		"9F27": "80",
+		"9F36": "0001",
+		"9F26": "1122334455667788",
+		"82":   "5800",
+		"5F34": "01",
+		"9F45": "0000", // the terminal has no data authentication code
+	} {
+		tlv, found := bertlv.FindFirstTag(k.TagsDB, tag)
+		require.True(t, found, "tag %s", tag)
+		require.Equal(t, value, hex.EncodeToString(tlv.Value), "tag %s", tag)
+	}
+
+	// the card gets the ARPC of the issuer in the second GENERATE AC
+	issuerAuthenticationData, err := bertlv.Encode([]bertlv.TLV{
+		bertlv.NewTag("91", []byte{0xA1, 0xA2, 0xA3, 0xA4, 0xA5, 0xA6, 0xA7, 0xA8, '0', '0'}),
+		bertlv.NewTag("8A", []byte("00")),
+	})
+	require.NoError(t, err)
+
+	approved, err := k.CompleteTransaction(OnlineResponse{
+		Approved:                 true,
+		ResponseCode:             "00",
+		IssuerAuthenticationData: issuerAuthenticationData,
+	})
+	require.NoError(t, err)
+	require.True(t, approved)
+
+	generateAC = card.commands[5]
+	require.Equal(t, CryptogramTC, generateAC.P1)
+	require.Len(t, generateAC.Data, 0x1D)
+	require.Equal(t, "a1a2a3a4a5a6a7a83030", hex.EncodeToString(generateAC.Data[:10]))
+	require.Equal(t, "3030", hex.EncodeToString(generateAC.Data[10:12]))
+}
+
+func TestFTDCKernelUnableToGoOnline(t *testing.T) {
+	card := &scriptedCard{t: t}
+	k := NewFTDCKernel(card)
+
+	transaction, err := NewTransaction(10_00)
+	require.NoError(t, err)
+	require.NoError(t, k.Process(transaction))
+
+	approved, err := k.CompleteTransaction(OnlineResponse{})
+	require.NoError(t, err)
+	require.False(t, approved)
+
+	generateAC := card.commands[len(card.commands)-1]
+	require.Equal(t, CryptogramAAC, generateAC.P1)
+	require.Equal(t, []byte(unableToGoOnline), generateAC.Data[10:12])
+}
@@ -0,0 +1,250 @@
+package kernel
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/moov-io/bertlv"
+	"github.com/moov-io/ftdc-from-tap-to-auth/terminal/paycard"
+)
+
+// Kernel processes the transaction with the card once its application is
+// picked. The outcome has the tags of the authorization request.
+type Kernel interface {
+	Process(reader CardReader, transaction Transaction) (*Outcome, error)
+}
+
+// KernelFunc lets a function be a Kernel.
+type KernelFunc func(reader CardReader, transaction Transaction) (*Outcome, error)
+
+func (f KernelFunc) Process(reader CardReader, transaction Transaction) (*Outcome, error) {
+	return f(reader, transaction)
+}
+
+// Outcome is the result of the card's part of the transaction.
+type Outcome struct {
+	// Tags are the card data, the terminal data and the cryptogram, if the
+	// card generated one, for the authorization request
+	Tags []bertlv.TLV
+
+	// complete passes the issuer's response to the card, it's nil when the
+	// kernel has nothing more to do with the card
+	complete func(response OnlineResponse) (bool, error)
+}
+
+// Complete passes the issuer's response to the card and returns true when
+// the transaction is approved. The card makes the final decision with the
+// FTDC kernel; with kernels that don't go back to the card, the issuer's
+// decision is final.
+func (o *Outcome) Complete(response OnlineResponse) (bool, error) {
+	if o.complete == nil {
+		return response.Approved, nil
+	}
+
+	return o.complete(response)
+}
+
+// FTDC is the kernel of the FTDC cards, see FTDCKernel. The card approves or
+// declines the transaction with the response of the issuer in Complete.
+var FTDC = KernelFunc(func(reader CardReader, transaction Transaction) (*Outcome, error) {
+	k := NewFTDCKernel(reader)
+
+	err := k.Process(transaction)
+	if err != nil {
+		return nil, err
+	}
+
+	outcome := &Outcome{Tags: k.TagsDB}
+	outcome.complete = func(response OnlineResponse) (bool, error) {
+		approved, err := k.CompleteTransaction(response)
+		outcome.Tags = k.TagsDB
+
+		return approved, err
+	}
+
+	return outcome, nil
+})
+
+// Universal is the kernel for the cards of the networks we have no kernel
+// of our own for. It reads the card data like the FTDC kernel but doesn't
+// ask for a cryptogram with GENERATE AC. Cards that compute it with the
+// processing options, e.g. Visa qVSDC, return it in GET PROCESSING OPTIONS.
+var Universal = KernelFunc(func(reader CardReader, transaction Transaction) (*Outcome, error) {
+	k := NewFTDCKernel(reader)
+
+	err := k.readApplication(transaction)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Outcome{Tags: k.TagsDB}, nil
+})
+
+// Registry maps the AID prefixes of the card applications to the kernels
+// that process them.
+type Registry struct {
+	entries []registryEntry
+}
+
+type registryEntry struct {
+	aidPrefix []byte
+	id        paycard.KernelID
+	kernel    Kernel
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// DefaultRegistry returns the registry with the FTDC kernel for the FTDC
+// application and the universal kernel for the applications of the card
+// networks (by their registered application provider identifier).
+func DefaultRegistry() *Registry {
+	r := NewRegistry()
+	r.Register(ftdcApplicationID, paycard.Kernel1ID, FTDC)
+	r.Register([]byte{0xA0, 0x00, 0x00, 0x00, 0x04}, paycard.Kernel2ID, Universal) // Mastercard
+	r.Register([]byte{0xA0, 0x00, 0x00, 0x00, 0x03}, paycard.Kernel3ID, Universal) // Visa
+	r.Register([]byte{0xA0, 0x00, 0x00, 0x00, 0x25}, paycard.Kernel4ID, Universal) // American Express
+	r.Register([]byte{0xA0, 0x00, 0x00, 0x00, 0x65}, paycard.Kernel5ID, Universal) // JCB
+	r.Register([]byte{0xA0, 0x00, 0x00, 0x01, 0x52}, paycard.Kernel6ID, Universal) // Discover
+	r.Register([]byte{0xA0, 0x00, 0x00, 0x03, 0x33}, paycard.Kernel7ID, Universal) // UnionPay
+
+	return r
+}
+
+// Register maps the applications whose AID starts with the prefix to the
+// kernel.
+func (r *Registry) Register(aidPrefix []byte, id paycard.KernelID, kernel Kernel) {
+	r.entries = append(r.entries, registryEntry{
+		aidPrefix: aidPrefix,
+		id:        id,
+		kernel:    kernel,
+	})
+}
+
+// Lookup returns the kernel of the application with the longest matching
+// AID prefix.
+func (r *Registry) Lookup(aid []byte) (paycard.KernelID, Kernel, bool) {
+	var match *registryEntry
+	for i, entry := range r.entries {
+		if !bytes.HasPrefix(aid, entry.aidPrefix) {
+			continue
+		}
+
+		if match == nil || len(entry.aidPrefix) > len(match.aidPrefix) {
+			match = &r.entries[i]
+		}
+	}
+
+	if match == nil {
+		return 0, nil, false
+	}
+
+	return match.id, match.kernel, true
+}
+
+// Process picks the application of the card from its PPSE directory and
+// processes the transaction with the kernel of the application. Cards
+// without PPSE, like the FTDC JavaCard applet, get the registered AIDs
+// selected directly.
+func (r *Registry) Process(reader CardReader, transaction Transaction) (*Outcome, error) {
+	applications, err := readPPSE(reader)
+	if err != nil {
+		return nil, fmt.Errorf("reading PPSE: %w", err)
+	}
+
+	if len(applications) == 0 {
+		fmt.Println("PPSE not found, trying direct application selection...")
+
+		applications, err = r.selectDirectly(reader)
+		if err != nil {
+			return nil, fmt.Errorf("direct application selection: %w", err)
+		}
+	}
+
+	for _, application := range applications {
+		id, kernel, found := r.Lookup(application.AID)
+		if !found {
+			fmt.Printf("No kernel for application %X - %s\n", application.AID, application.Label)
+			continue
+		}
+
+		fmt.Printf("✅ Processing application %X - %s with kernel %d\n", application.AID, application.Label, id)
+
+		transaction.AID = application.AID
+
+		return kernel.Process(reader, transaction)
+	}
+
+	return nil, fmt.Errorf("no kernel for the applications of the card")
+}
+
+// readPPSE selects the PPSE directory and returns its applications by
+// priority. There are none if the card has no PPSE.
+func readPPSE(reader CardReader) ([]paycard.Application, error) {
+	resp, err := reader.SendAPDU(NewSelectCommand([]byte(paycard.PPSE)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send SELECT command: %w", err)
+	}
+
+	if !resp.IsSuccess() {
+		return nil, nil
+	}
+
+	card := paycard.NewEmvCard(true)
+
+	err = card.Parse2Pay(resp.Data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing PPSE: %w", err)
+	}
+
+	// 1 is the highest priority, 0 means no priority
+	sort.SliceStable(card.Applications, func(i, j int) bool {
+		pi, pj := card.Applications[i].Priority&0x0F, card.Applications[j].Priority&0x0F
+		return pi != 0 && (pj == 0 || pi < pj)
+	})
+
+	return card.Applications, nil
+}
+
+// selectDirectly selects the registered AIDs, the prefixes select the first
+// application that starts with them, and returns the ones the card has.
+func (r *Registry) selectDirectly(reader CardReader) ([]paycard.Application, error) {
+	var applications []paycard.Application
+
+	for _, entry := range r.entries {
+		resp, err := reader.SendAPDU(NewSelectCommand(entry.aidPrefix))
+		if err != nil {
+			return nil, fmt.Errorf("failed to send SELECT command: %w", err)
+		}
+
+		if !resp.IsSuccess() {
+			continue
+		}
+
+		fci, err := bertlv.Decode(resp.Data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing FCI response: %w", err)
+		}
+
+		application := paycard.Application{AID: entry.aidPrefix}
+		if aid, found := bertlv.FindFirstTag(fci, "84"); found {
+			application.AID = aid.Value
+		}
+
+		if label, found := bertlv.FindFirstTag(fci, "50"); found {
+			application.Label = string(label.Value)
+		}
+
+		applications = append(applications, application)
+	}
+
+	if len(applications) == 0 {
+		return nil, errors.New("no supported applications found")
+	}
+
+	return applications, nil
+}
@@ -0,0 +1,119 @@
+package kernel
+
+import (
+	"testing"
+
+	"github.com/moov-io/bertlv"
+	"github.com/moov-io/ftdc-from-tap-to-auth/terminal/emulator"
+	"github.com/moov-io/ftdc-from-tap-to-auth/terminal/paycard"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryLookup(t *testing.T) {
+	registry := DefaultRegistry()
+
+	id, _, found := registry.Lookup([]byte{0xA0, 0x00, 0x00, 0x00, 0x02, 0x03, 0x04, 0x05})
+	require.True(t, found)
+	require.Equal(t, paycard.Kernel1ID, id)
+
+	id, _, found = registry.Lookup([]byte{0xA0, 0x00, 0x00, 0x00, 0x03, 0x10, 0x10})
+	require.True(t, found)
+	require.Equal(t, paycard.Kernel3ID, id)
+
+	// the longest prefix wins
+	registry.Register([]byte{0xA0, 0x00, 0x00, 0x00, 0x03, 0x10, 0x10}, paycard.Kernel1ID, Universal)
+	id, _, found = registry.Lookup([]byte{0xA0, 0x00, 0x00, 0x00, 0x03, 0x10, 0x10})
+	require.True(t, found)
+	require.Equal(t, paycard.Kernel1ID, id)
+
+	_, _, found = registry.Lookup([]byte{0xA0, 0x00, 0x00, 0x00, 0x99})
+	require.False(t, found)
+}
+
+func TestRegistryProcess(t *testing.T) {
+	transaction, err := NewTransaction(10_00)
+	require.NoError(t, err)
+
+	t.Run("FTDC card", func(t *testing.T) {
+		card, err := emulator.New(emulator.DefaultProfile())
+		require.NoError(t, err)
+
+		outcome, err := DefaultRegistry().Process(NewCardReaderAdapter(card), transaction)
+		require.NoError(t, err)
+
+		// the FTDC kernel asked for the ARQC
+		cid, found := bertlv.FindFirstTag(outcome.Tags, "9F27")
+		require.True(t, found)
+		require.Equal(t, []byte{CryptogramARQC}, cid.Value)
+
+		// the card declines the transaction without the ARPC of the issuer
+		approved, err := outcome.Complete(OnlineResponse{})
+		require.NoError(t, err)
+		require.False(t, approved)
+
+		cid, found = bertlv.FindFirstTag(outcome.Tags, "9F27")
+		require.True(t, found)
+		require.Equal(t, []byte{CryptogramAAC}, cid.Value)
+	})
+
+	t.Run("card of a network", func(t *testing.T) {
+		profile := emulator.DefaultProfile()
+		profile.AID = "A0000000031010"
+		profile.Label = "VISA CREDIT"
+
+		card, err := emulator.New(profile)
+		require.NoError(t, err)
+
+		outcome, err := DefaultRegistry().Process(NewCardReaderAdapter(card), transaction)
+		require.NoError(t, err)
+
+		// the universal kernel only read the card
+		_, found := bertlv.FindFirstTag(outcome.Tags, "9F26")
+		require.False(t, found)
+
+		pan, found := bertlv.FindFirstTag(outcome.Tags, "5A")
+		require.True(t, found)
+		require.Equal(t, []byte{0x70, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x70}, pan.Value)
+
+		// the issuer's decision is final
+		approved, err := outcome.Complete(OnlineResponse{Approved: true, ResponseCode: "00"})
+		require.NoError(t, err)
+		require.True(t, approved)
+	})
+
+	t.Run("card without PPSE", func(t *testing.T) {
+		card, err := emulator.New(emulator.DefaultProfile())
+		require.NoError(t, err)
+
+		outcome, err := DefaultRegistry().Process(&withoutPPSE{NewCardReaderAdapter(card)}, transaction)
+		require.NoError(t, err)
+
+		_, found := bertlv.FindFirstTag(outcome.Tags, "9F26")
+		require.True(t, found)
+	})
+
+	t.Run("no kernel for the card", func(t *testing.T) {
+		profile := emulator.DefaultProfile()
+		profile.AID = "A000000099"
+
+		card, err := emulator.New(profile)
+		require.NoError(t, err)
+
+		_, err = DefaultRegistry().Process(NewCardReaderAdapter(card), transaction)
+		require.ErrorContains(t, err, "no kernel")
+	})
+}
+
+// withoutPPSE is a card without PPSE directory, like the FTDC JavaCard
+// applet
+type withoutPPSE struct {
+	CardReader
+}
+
+func (c *withoutPPSE) SendAPDU(command APDUCommand) (APDUResponse, error) {
+	if command.INS == 0xA4 && string(command.Data) == paycard.PPSE {
+		return APDUResponse{SW1: 0x6A, SW2: 0x82}, nil
+	}
+
+	return c.CardReader.SendAPDU(command)
+}
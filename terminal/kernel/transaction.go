@@ -0,0 +1,103 @@
+package kernel
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/moov-io/bertlv"
+)
+
+// Terminal data the FTDC kernel passes to the card, see EMV Book 3, Annex A
+const (
+	DefaultCountryCode  = "0840" // USA
+	DefaultCurrencyCode = "0840" // USD
+
+	// attended, offline with online capability, operated by the merchant
+	terminalType = 0x22
+
+	// no CVM performed, the terminal doesn't ask for the PIN
+	cvmResults = "3F0000"
+
+	// terminal transaction qualifiers (tag 9F66) the contactless kernels of
+	// the networks ask for in the PDOL: EMV mode, online capable
+	transactionQualifiers = "B600C000"
+)
+
+// Transaction is the payment the terminal processes with the card. Its data
+// is passed to the card in GET PROCESSING OPTIONS and GENERATE AC, and the
+// card computes its cryptogram over it.
+type Transaction struct {
+	// Amount and OtherAmount (cashback) are in minor units
+	Amount      int64
+	OtherAmount int64
+
+	// CurrencyCode and CountryCode are ISO 4217 and ISO 3166 numeric codes
+	CurrencyCode string
+	CountryCode  string
+
+	// Type is the transaction type (tag 9C), 00 for purchases
+	Type byte
+
+	Date time.Time
+
+	// UnpredictableNumber is the 4 random bytes (tag 9F37) that make the
+	// cryptogram of each transaction unique
+	UnpredictableNumber []byte
+
+	// AID of the card's application the kernel selects, picked from the
+	// PPSE by the registry
+	AID []byte
+}
+
+// NewTransaction returns a purchase of the amount in USD with a random
+// unpredictable number.
+func NewTransaction(amount int64) (Transaction, error) {
+	unpredictableNumber := make([]byte, 4)
+	if _, err := rand.Read(unpredictableNumber); err != nil {
+		return Transaction{}, fmt.Errorf("generating unpredictable number: %w", err)
+	}
+
+	return Transaction{
+		Amount:              amount,
+		CurrencyCode:        DefaultCurrencyCode,
+		CountryCode:         DefaultCountryCode,
+		Type:                0x00,
+		Date:                time.Now(),
+		UnpredictableNumber: unpredictableNumber,
+	}, nil
+}
+
+// terminalData returns the data objects of the terminal for the transaction
+func (t Transaction) terminalData() ([]bertlv.TLV, error) {
+	// the order of the tags doesn't matter, the card's DOLs pick them
+	tlvs := []bertlv.TLV{
+		bertlv.NewTag("95", make([]byte, 5)), // TVR: no issues found
+		bertlv.NewTag("9C", []byte{t.Type}),
+		bertlv.NewTag("9F35", []byte{terminalType}),
+		bertlv.NewTag("9F37", t.UnpredictableNumber),
+	}
+
+	// numeric data is BCD encoded
+	numeric := []struct{ tag, digits string }{
+		{"9F02", fmt.Sprintf("%012d", t.Amount)},
+		{"9F03", fmt.Sprintf("%012d", t.OtherAmount)},
+		{"5F2A", t.CurrencyCode},
+		{"9F1A", t.CountryCode},
+		{"9A", t.Date.Format("060102")},
+		{"9F34", cvmResults},
+		{"9F66", transactionQualifiers},
+	}
+
+	for _, n := range numeric {
+		value, err := hex.DecodeString(n.digits)
+		if err != nil {
+			return nil, fmt.Errorf("encoding tag %s: %w", n.tag, err)
+		}
+
+		tlvs = append(tlvs, bertlv.NewTag(n.tag, value))
+	}
+
+	return tlvs, nil
+}
@@ -3,22 +3,33 @@ package terminal
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/ebfe/scard"
-	"github.com/kr/pretty"
-	"github.com/moov-io/bertlv"
-	"github.com/moov-io/ftdc-from-tap-to-auth/terminal/paycard"
+	"github.com/moov-io/ftdc-from-tap-to-auth/terminal/apdutrace"
 )
 
+// Card is the card the reader is connected to: a card in the PC/SC reader or
+// an emulated card.
+type Card interface {
+	Transmit(cmd []byte) ([]byte, error)
+}
+
 type CardReader struct {
 	ctx            *scard.Context
 	Readers        []string
 	SelectedReader string
-	Card           *scard.Card
+	Card           Card
+
+	// card is the connected PC/SC card, Card may wrap it
+	card *scard.Card
+
+	// trace is the file the APDUs are recorded to
+	trace io.Closer
 }
 
 func NewCardReader() (*CardReader, error) {
@@ -42,6 +53,15 @@ func NewCardReader() (*CardReader, error) {
 	}, nil
 }
 
+// NewEmulatedCardReader returns a reader connected to the emulated card, it
+// has no PC/SC readers to select or wait for.
+func NewEmulatedCardReader(card Card) *CardReader {
+	return &CardReader{
+		SelectedReader: "emulator",
+		Card:           card,
+	}
+}
+
 func (c *CardReader) SendAPDU(cmd []byte) ([]byte, error) {
 	// Ensure the card is connected
 	if c.Card == nil {
@@ -57,11 +77,18 @@ func (c *CardReader) SendAPDU(cmd []byte) ([]byte, error) {
 }
 
 func (c *CardReader) Close() error {
-	if c.Card != nil {
-		if err := c.Card.Disconnect(scard.LeaveCard); err != nil {
+	if c.card != nil {
+		if err := c.card.Disconnect(scard.LeaveCard); err != nil {
 			return fmt.Errorf("failed to disconnect card: %w", err)
 		}
-		c.Card = nil
+		c.card = nil
+	}
+	c.Card = nil
+	if c.trace != nil {
+		if err := c.trace.Close(); err != nil {
+			return fmt.Errorf("failed to close APDU trace: %w", err)
+		}
+		c.trace = nil
 	}
 	if c.ctx != nil {
 		return c.ctx.Release()
@@ -118,10 +145,24 @@ func (c *CardReader) ConnectToCard() error {
 	if err != nil {
 		return fmt.Errorf("failed to connect to card: %w", err)
 	}
+	c.card = card
 	c.Card = card
 	return nil
 }
 
+// RecordTrace records the APDUs exchanged with the card to the trace file,
+// see the apdutrace package. Close closes the file.
+func (c *CardReader) RecordTrace(path string) error {
+	recorder, err := apdutrace.Create(path, c.Card)
+	if err != nil {
+		return fmt.Errorf("creating APDU recorder: %w", err)
+	}
+
+	c.Card = recorder
+	c.trace = recorder
+	return nil
+}
+
 func (c *CardReader) WaitForCardAsync(timeout time.Duration) <-chan error {
 	resultChan := make(chan error, 1)
 
@@ -195,256 +236,3 @@ func (c *CardReader) WaitForCard(timeout time.Duration) error {
 func (c *CardReader) WaitForCardRemove(timeout time.Duration) error {
 	return <-c.WaitForCardRemoveAsync(timeout)
 }
-
-func (c *CardReader) DirectApplicationSelection(emvCard *paycard.EmvCard) error {
-	fmt.Printf("Trying direct application selection...\n")
-
-	// List of common AIDs to try
-	knownAIDs := []struct {
-		aid         []byte
-		label       string
-		kernelID    paycard.KernelID
-		description string
-	}{
-		// {[]byte{0xA0, 0x00, 0x00, 0x01, 0x51, 0x00, 0x00}, "Visa", paycard.Kernel3ID, "Visa"},
-		// {[]byte{0xA0, 0x00, 0x00, 0x00, 0x03, 0x10, 0x10, 0x10}, "Visa", paycard.Kernel3ID, "Visa"},
-		// {[]byte{0xA0, 0x00, 0x00, 0x00, 0x03, 0x10, 0x56}, "Visa", paycard.Kernel3ID, "Visa"},
-		// {[]byte{0xA0, 0x00, 0x00, 0x00, 0x03, 0x10, 0x4D}, "Visa", paycard.Kernel3ID, "Visa"},
-		{[]byte{0xA0, 0x00, 0x00, 0x00, 0x02, 0x03, 0x04, 0x05}, "FTDC", paycard.Kernel1ID, "Fintech Devcon"},
-		// {[]byte{0xD2, 0x76, 0x00, 0x00, 0x85, 0x30, 0x4A, 0x43, 0x4F, 0x90, 0x00, 0x01}, "Visa", paycard.Kernel3ID, "Visa"},
-	}
-
-	for _, aidInfo := range knownAIDs {
-		fmt.Printf("Trying AID: %X (%s)\n", aidInfo.aid, aidInfo.description)
-
-		// Build SELECT command
-		selectCommand := []byte{0x00, 0xA4, 0x04, 0x00, byte(len(aidInfo.aid))}
-		selectCommand = append(selectCommand, aidInfo.aid...)
-
-		// Send SELECT command
-		response, err := c.Card.Transmit(selectCommand)
-		if err != nil {
-			fmt.Printf("SELECT failed for %s: %v\n", aidInfo.description, err)
-			continue
-		}
-
-		// Check status word
-		if len(response) < 2 {
-			continue
-		}
-
-		sw1 := response[len(response)-2]
-		sw2 := response[len(response)-1]
-
-		if sw1 == 0x90 && sw2 == 0x00 {
-			fmt.Printf("✅ Found application: %s (AID: %X)\n", aidInfo.description, aidInfo.aid)
-
-			emvCard.Applications = append(emvCard.Applications, paycard.Application{
-				AID:      aidInfo.aid,
-				Label:    aidInfo.label,
-				Priority: 0x01,
-			})
-
-			return nil
-		}
-
-		fmt.Printf("SELECT failed for %s with status %02X%02X\n", aidInfo.description, sw1, sw2)
-	}
-
-	return fmt.Errorf("no supported applications found via direct selection")
-}
-
-func (c *CardReader) SelectPPSE(emvCard *paycard.EmvCard) (bool, error) {
-	// // APDU command to select the PPSE (Proximity Payment System Environment)
-	fmt.Println("=> 💳 SELECT FILE 2PAY.SYS.DDF01 to get the PPSE directory ...")
-
-	// Construct the select command for a contactless card using the PPSE
-	response, err := c.Card.Transmit(paycard.SelectPPSE.Bytes())
-	if err != nil {
-		// Default to PSE if PPSE is not found on the card.
-		// TODO: Implement PSE logic here. PSE is for dipping the chip
-		emvCard.Contactless = false
-		return false, fmt.Errorf("failed to trasmit select cmd: %v", err)
-	}
-
-	sw1 := response[len(response)-2]
-	sw2 := response[len(response)-1]
-
-	if sw1 != 0x90 || sw2 != 0x00 {
-		fmt.Printf("PPSE not found (status %02X%02X), trying direct application selection\n", sw1, sw2)
-		return false, nil
-	} else {
-		fmt.Printf("Select 2PAY.SYS.DDF01 Raw Response: %X\n", response)
-
-		// Parse the FCI Template to get the AID
-		err = emvCard.Parse2Pay(response)
-		if err != nil {
-			return false, fmt.Errorf("Failed to parse 2PAY.SYS.DDF01: %w", err)
-		}
-
-		// TODO: Make logging optional for every step of parsing.
-		bertlv.PrettyPrint(emvCard.FileControldInformation)
-
-		return true, nil
-	}
-}
-
-func (c *CardReader) SelectAID(emvCard *paycard.EmvCard) (string, error) {
-	/**
-	Select the Appropriate AID:
-	- Based on terminal configurations for the supported processor, the reader will then select the AID that corresponds to a supported payment application.
-	- Once an AID is selected, the reader sends another APDU SELECT command with the chosen AID, effectively “entering” that application on the card.
-	- This step initializes the specific application, allowing further commands (such as Get Processing Options or Read Record) to proceed with transaction data exchange.
-	**/
-
-	fmt.Printf("=> 💳 Selecting AID %s...\n", emvCard.Applications[0].Label)
-
-	// todo: Create a parser of the Application.AID for the application types that Moov supports
-	// use the application that moov supports for the AID selection
-
-	// Select the first application on the card (this is a simplified example)
-	cmd := paycard.SelectAID(emvCard.Applications[0].AID)
-
-	response, err := c.Card.Transmit(cmd.Bytes())
-	if err != nil {
-		return "", fmt.Errorf("failed to send APDU: %w", err)
-	}
-	// Check the response status word If the AID is not found or cannot be selected, the card may return an error status like 6A82 (File not found).
-	fmt.Printf("Select AID Raw Response: %X\n", response)
-	err = emvCard.ParseAIDResponse(response)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse AID response: %w", err)
-	}
-
-	fmt.Printf("AIDResponse: %# v\n", pretty.Formatter(emvCard.AIDResponse))
-
-	return fmt.Sprintf("%X", emvCard.Applications[0].AID), nil
-}
-
-func (c *CardReader) ProcessPDOL(emvCard *paycard.EmvCard, terminal *paycard.Terminal, session *paycard.Transaction) error {
-	// If a PDOL was included in the FCI (9F38 tag), you must structure your GPO command to match this requirement.
-	// If the PDOL is empty, you can send a GPO command with an empty data field.
-
-	// Send the GPO command with an empty PDOL
-	fmt.Println("=> 💳 Sending Get Processing Options (GPO) command...")
-	// The APDU for the GET PROCESSING OPTIONS command typically looks like:
-
-	// Create the PDOL data for the GPO command
-	var command []byte
-	if len(emvCard.AIDResponse.PDOL) > 0 {
-		// Card explicitly requested PDOL data
-		fmt.Println("Card requested PDOL data:")
-		paycard.PrettyPrintDOL(emvCard.AIDResponse.PDOL)
-
-		pdolRequest := terminal.BuildPDOLData(session, emvCard.AIDResponse.PDOL)
-		command = paycard.GetProcessingOptions(pdolRequest)
-	} else {
-		// Try minimal GPO first
-		fmt.Println("No PDOL requested, trying minimal GPO...")
-		command = paycard.GetProcessingOptions(nil)
-	}
-
-	fmt.Printf("GPO Command: %X\n", command)
-	response, err := c.Card.Transmit(command)
-	if err != nil {
-		return fmt.Errorf("Failed to send GET PROCESSING OPTIONS APDU: %w", err)
-	}
-	// Check the response status word
-	fmt.Printf("GPO Raw Response: %X\n", response)
-
-	// Check response status
-	// Analyze any status words (e.g., 6985, 6A81, 6A82) returned from the card for clues about why the command failed.
-	// todo: not sure why this logic does not detect the 6985 status word?
-	if len(response) >= 2 {
-		sw1 := response[len(response)-2]
-		sw2 := response[len(response)-1]
-
-		if sw1 == 0x67 && sw2 == 0x00 { // Wrong length
-			// Card needs data but didn't specify via PDOL
-			// Could try card-specific defaults here if needed
-			fmt.Println("Card rejected minimal GPO, needs specific data")
-		} else {
-			fmt.Printf("GPO Raw Response: %X\n", response)
-			err = emvCard.ParseGPOResponse(response)
-			if err != nil {
-				return fmt.Errorf("Failed to parse GPO response: %w", err)
-			}
-		}
-	}
-	return nil
-}
-
-func (c *CardReader) ProcessAFL(emvCard *paycard.EmvCard) error {
-	fmt.Printf("AFL: %X\n", emvCard.GPOResponse.AFL)
-	// Parse the AFL (Application File Locator) to get the SFI and record numbers
-	// The AFL contains the SFI and record numbers for the data files to be read.
-	//commands
-	// Generate the READ RECORD commands based on the AFL
-	commands := paycard.GenerateReadCommands(emvCard.GPOResponse.AFL)
-	fmt.Printf("Commands: %X\n", commands)
-	for _, cmd := range commands {
-		response, err := c.Card.Transmit(cmd)
-		if err != nil {
-			// pretty prent the READ RECORD command
-			fmt.Printf("Failed to send READ RECORD command: %X\n", cmd)
-		}
-		if len(response) > 0 {
-			// check if response is not 6A83 (Record Not Found)
-			if response[len(response)-2] != 0x6A || response[len(response)-1] != 0x83 {
-
-				// parse the SFI into the emvCard
-				emvCard.ParseSFI(response)
-				ShowBerTLV(response)
-			}
-		}
-	}
-	return nil
-}
-
-func (c *CardReader) ReadRecord(card *paycard.EmvCard) error {
-	// Send READ RECORD command: 00 B2 01 0C
-	// B2 = READ RECORD instruction
-	// 01 = Record number
-	// 0C = Reference control parameter (SFI = 0, mode = 4)
-	readCommand := []byte{0x00, 0xB2, 0x01, 0x0C}
-
-	response, err := c.Card.Transmit(readCommand)
-	if err != nil {
-		return fmt.Errorf("sending READ RECORD command: %X, error: %w", readCommand, err)
-	}
-
-	fmt.Printf("READ RECORD Response: %X\n", response)
-
-	// Check if response has status word
-	if len(response) >= 2 {
-		sw1 := response[len(response)-2]
-		sw2 := response[len(response)-1]
-
-		if sw1 == 0x90 && sw2 == 0x00 {
-			fmt.Println("✅ READ RECORD command successful")
-
-			tlvs, err := bertlv.Decode(response)
-			if err != nil {
-				return fmt.Errorf("Failed to decode READ RECORD response: %w", err)
-			}
-
-			bertlv.PrettyPrint(tlvs)
-
-			// find response message template 70
-			responseMessageTemplate, ok := bertlv.FindFirstTag(tlvs, "70")
-			if !ok {
-				return fmt.Errorf("Failed to find response message template (70) in READ RECORD response")
-			}
-
-			for _, tlv := range responseMessageTemplate.TLVs {
-				card.TagsDB = append(card.TagsDB, tlv)
-			}
-
-			return nil
-		} else {
-			return fmt.Errorf("READ RECORD command failed with status %02X%02X", sw1, sw2)
-		}
-	}
-
-	return fmt.Errorf("READ RECORD command response does not contain status word")
-}
@@ -1,134 +0,0 @@
-package terminal
-
-import (
-	"fmt"
-	"time"
-
-	"github.com/moov-io/bertlv"
-	"github.com/moov-io/ftdc-from-tap-to-auth/terminal/paycard"
-)
-
-func (t *Terminal) RunUniversalKernel() error {
-	fmt.Println("📱FTDC Terminal is running...")
-
-	var amount int64
-	if t.config.DefaultAmount != 0 {
-		amount = t.config.DefaultAmount
-		fmt.Printf("Using default amount: %d cents\n", t.config.DefaultAmount)
-	} else {
-		fmt.Println("Please enter amount (in cents, e.g., 100 for $1.00):")
-
-		_, err := fmt.Scanf("%d", &amount)
-		if err != nil {
-			return fmt.Errorf("failed to read amount: %w", err)
-		}
-
-		if amount <= 0 {
-			return fmt.Errorf("amount must be greater than 0")
-		}
-	}
-
-	emvTags, err := t.processTransaction(amount)
-	if err != nil {
-		return fmt.Errorf("running terminal: %w", err)
-	}
-
-	fmt.Println("*********************************************")
-	fmt.Println("EMV Tags read from card:")
-
-	bertlv.PrettyPrint(emvTags)
-	fmt.Println("*********************************************")
-
-	// Send payment request to the acquirer
-	err = t.createPayment(amount, emvTags)
-	if err != nil {
-		return fmt.Errorf("creating payment: %w", err)
-	}
-
-	// Implementation of terminal run logic
-	// This should include reading card data, processing payments, etc.
-	return nil
-}
-
-func (t *Terminal) processTransaction(amount int64) ([]bertlv.TLV, error) {
-	// create a new terminal
-	terminal, err := paycard.NewTerminal(
-		paycard.WithCountryCode("0840"),  // USA
-		paycard.WithCurrencyCode("0840"), // USD
-	)
-	if err != nil {
-		return nil, fmt.Errorf("creating terminal: %w", err)
-	}
-
-	// create a new session for this card transaction
-	session := paycard.Transaction{
-		AuthorizedAmount: fmt.Sprintf("%012d", amount),
-		SecondaryAmount:  "000000000000",
-		TransactionType:  "00",
-	}
-
-	// Establish context with PC/SC reader
-	cardReader, err := NewCardReader()
-	if err != nil {
-		return nil, fmt.Errorf("creating card reader: %w", err)
-	}
-
-	if t.config.ReaderIndex < 0 {
-		cardReader.DisplayReaders()
-		_, err = cardReader.SelectReader()
-		if err != nil {
-			return nil, fmt.Errorf("selecting card reader: %w", err)
-		}
-	} else if t.config.ReaderIndex >= 0 && t.config.ReaderIndex < len(cardReader.Readers) {
-		cardReader.SelectedReader = cardReader.Readers[t.config.ReaderIndex]
-	}
-
-	fmt.Println("Using NFC reader:", cardReader.SelectedReader)
-
-	timeout := time.Second * 60
-
-	_ = cardReader.WaitForCard(timeout)
-
-	err = cardReader.ConnectToCard()
-	if err != nil {
-		return nil, fmt.Errorf("connecting to card: %w", err)
-	}
-
-	// We have a emvCard to start parsing
-	emvCard := paycard.NewEmvCard(true)
-
-	ppseSelected, err := cardReader.SelectPPSE(emvCard)
-	if ppseSelected {
-		aid, err := cardReader.SelectAID(emvCard)
-		if err != nil {
-			return nil, fmt.Errorf("selecting AID: %w", err)
-		}
-		session.AID = aid
-
-		err = cardReader.ProcessPDOL(emvCard, terminal, &session)
-		if err != nil {
-			return nil, fmt.Errorf("processing PDOL: %w", err)
-		}
-	} else {
-		fmt.Println("PPSE not selected, trying direct application selection...")
-		err = cardReader.DirectApplicationSelection(emvCard)
-		if err != nil {
-			return nil, fmt.Errorf("direct application selection: %w", err)
-		}
-	}
-
-	if emvCard.GPOResponse.AFL != nil {
-		err = cardReader.ProcessAFL(emvCard)
-		if err != nil {
-			return nil, fmt.Errorf("processing AFL: %w", err)
-		}
-	} else {
-		err := cardReader.ReadRecord(emvCard)
-		if err != nil {
-			return nil, fmt.Errorf("reading record: %w", err)
-		}
-	}
-
-	return emvCard.TagsDB, nil
-
-}